@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"xyzw_study/internal/bundle"
+	"xyzw_study/internal/config"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/scripts"
+
+	"github.com/fatih/color"
+)
+
+// runBundle 导出或导入备注和脚本，与 Web 界面的导入导出使用相同的合并规则
+func runBundle(args []string) int {
+	if len(args) == 0 {
+		color.Red("用法: xyzw bundle <export|import> [-data-dir ./data] <文件>")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("bundle "+args[0], flag.ContinueOnError)
+	dataDir := fs.String("data-dir", config.Default().DataDir, "数据目录")
+	theirs := fs.Bool("theirs", false, "导入时冲突使用导入的版本，默认保留本地版本")
+	dryRun := fs.Bool("dry-run", false, "只显示导入的合并结果，不修改本地数据")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出导入结果")
+	share := fs.Bool("share", false, "导出用于共享，导出的内容作为下次导入的合并基准")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		color.Red("用法: xyzw bundle export [-data-dir ./data] [-share] <输出.json>")
+		color.Red("      xyzw bundle import [-data-dir ./data] [-dry-run] [-theirs] [-json] <导出包.json>")
+		return 2
+	}
+
+	ns, err := notes.Open(filepath.Join(*dataDir, "notes.json"))
+	if err != nil {
+		color.Red("打开备注失败: %v", err)
+		return 1
+	}
+	ss, err := scripts.Open(filepath.Join(*dataDir, "scripts.json"))
+	if err != nil {
+		color.Red("打开脚本失败: %v", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "export":
+		b, err := bundle.Export(ns, ss)
+		if err != nil {
+			color.Red("导出失败: %v", err)
+			return 1
+		}
+		if err := bundle.WriteFile(fs.Arg(0), b); err != nil {
+			color.Red("写入导出包失败: %v", err)
+			return 1
+		}
+		// 写入导出包成功后再更新合并基准
+		if *share {
+			if err := bundle.SaveBase(*dataDir, b); err != nil {
+				color.Red("%v", err)
+				return 1
+			}
+		}
+		color.Green("已导出 %d 条命令备注、%d 个命令的键备注和 %d 个脚本",
+			len(b.Notes.CommandNotes), len(b.Notes.KeyNotes), len(b.Scripts))
+		return 0
+	case "import":
+		b, err := bundle.ReadFile(fs.Arg(0))
+		if err != nil {
+			color.Red("读取导出包失败: %v", err)
+			return 1
+		}
+		summary, err := bundle.Import(ns, ss, *dataDir, b, bundle.Options{
+			Theirs: *theirs,
+			DryRun: *dryRun,
+			Author: currentUser(),
+		})
+		if err != nil {
+			color.Red("导入失败: %v", err)
+			return 1
+		}
+		if *asJSON {
+			return printJSON(summary)
+		}
+		printSummary(summary)
+		return 0
+	default:
+		color.Red("未知的 bundle 子命令: %s", args[0])
+		return 2
+	}
+}
+
+// printSummary 输出导入结果和冲突
+func printSummary(s bundle.Summary) {
+	prefix := "已导入"
+	if s.DryRun {
+		prefix = "预览导入"
+	}
+	color.Green("%s: 新增 %d，修改 %d，删除 %d，冲突 %d", prefix, s.Added, s.Updated, s.Deleted, len(s.Conflicts))
+	for _, c := range s.Conflicts {
+		var target string
+		switch c.Kind {
+		case bundle.KindCommand:
+			target = "命令备注 " + c.Cmd
+		case bundle.KindKey:
+			target = "键备注 " + c.Cmd + " " + c.Key
+		case bundle.KindTable:
+			target = "配置表映射 " + c.Cmd + " " + c.Key
+		case bundle.KindScript:
+			target = fmt.Sprintf("脚本 %s (%s)", c.Name, c.ScriptID)
+		}
+		color.Yellow("冲突 %s，使用%s版本", target, map[string]string{"local": "本地", "remote": "导入的"}[c.Resolved])
+		if c.Kind != bundle.KindScript {
+			fmt.Printf("  本地: %s\n  导入: %s\n", noteText(c.Local), noteText(c.Remote))
+		}
+	}
+}
+
+func noteText(s *string) string {
+	if s == nil {
+		return "(无)"
+	}
+	return *s
+}
+
+// currentUser 返回脚本修订记录中使用的修改人
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/fatih/color"
+)
+
+// runCommand 执行子命令并返回进程退出码
+func runCommand(name string, args []string) int {
+	switch name {
+	case "diff":
+		return runDiff(args)
+	case "redact":
+		return runRedact(args)
+	case "proxy":
+		return runProxy(args)
+	case "bundle":
+		return runBundle(args)
+	case "extract-commands":
+		return runExtractCommands(args)
+	case "tables":
+		return runTables(args)
+	case "ledger":
+		return runLedger(args)
+	case "report":
+		return runReport(args)
+	case "diagram":
+		return runDiagram(args)
+	case "help", "-h", "--help":
+		printUsage()
+		return 0
+	default:
+		color.Red("未知命令: %s", name)
+		printUsage()
+		return 2
+	}
+}
+
+// printUsage 显示命令行用法
+func printUsage() {
+	color.Cyan("用法:")
+	color.Cyan("  xyzw [参数]              启动代理和Web界面，-headless 只抓包输出 JSONL")
+	color.Cyan("  xyzw diff <a> <b>        比较两个抓包文件或两个JSON值")
+	color.Cyan("  xyzw redact <in> <out>   对抓包文件脱敏后输出")
+	color.Cyan("  xyzw proxy restore       异常退出后恢复系统代理设置")
+	color.Cyan("  xyzw bundle export <f>   导出备注和脚本")
+	color.Cyan("  xyzw bundle import <f>   导入备注和脚本，与本地修改三方合并")
+	color.Cyan("  xyzw extract-commands <bundle.js>  从客户端代码提取命令和请求参数，写入备注")
+	color.Cyan("  xyzw tables list         查看配置表，lookup <表> <ID> 查找名称")
+	color.Cyan("  xyzw tables annotate <in> <out>  为抓包文件中的ID字段添加名称")
+	color.Cyan("  xyzw ledger <f>...       统计抓包中道具和资源的变化，-totals 按命令汇总")
+	color.Cyan("  xyzw report <会话|f>     生成会话的 Markdown/HTML 摘要报告")
+	color.Cyan("  xyzw diagram <会话|f>    导出一段消息的 Mermaid/PlantUML 时序图")
+}
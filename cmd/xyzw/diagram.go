@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"xyzw_study/internal/config"
+	"xyzw_study/internal/diagram"
+	"xyzw_study/internal/notes"
+
+	"github.com/fatih/color"
+)
+
+// runDiagram 导出会话中一段消息的 Mermaid 或 PlantUML 时序图
+func runDiagram(args []string) int {
+	fs := flag.NewFlagSet("diagram", flag.ContinueOnError)
+	dataDir := fs.String("data-dir", config.Default().DataDir, "数据目录，读取其中的数据包存储和备注")
+	format := fs.String("format", diagram.FormatMermaid, "时序图格式: mermaid 或 plantuml")
+	output := fs.String("o", "-", "输出文件，- 为标准输出")
+	title := fs.String("title", "", "时序图标题")
+	seq := fs.String("seq", "", "抓包中客户端请求的序号范围，例如 10-25")
+	since := fs.String("since", "", "开始时间，RFC3339 或 2006-01-02 15:04:05")
+	until := fs.String("until", "", "结束时间，格式同 -since")
+	fields := fs.String("fields", "", "显示的关键字段，逗号分隔，例如 body.itemId,body.*.id")
+	exclude := fs.String("exclude", "", "不包含的命令，逗号分隔")
+	limit := fs.Int("limit", diagram.DefaultMaxMessages, "最多包含的消息数")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		color.Red("用法: xyzw diagram [-format mermaid|plantuml] [-seq 10-25] [-since t] [-until t] <会话ID|抓包.jsonl>")
+		return 2
+	}
+	if *format != diagram.FormatMermaid && *format != diagram.FormatPlantUML {
+		color.Red("不支持的时序图格式: %s", *format)
+		return 2
+	}
+	opts := diagram.Options{Title: *title, MaxMessages: *limit}
+	var err error
+	if opts.SeqFrom, opts.SeqTo, err = diagram.ParseSeqRange(*seq); err != nil {
+		color.Red("%v", err)
+		return 2
+	}
+	if opts.Since, err = parseLocalTime(*since); err != nil {
+		color.Red("解析 -since 失败: %v", err)
+		return 2
+	}
+	if opts.Until, err = parseLocalTime(*until); err != nil {
+		color.Red("解析 -until 失败: %v", err)
+		return 2
+	}
+	if *fields != "" {
+		opts.Fields = strings.Split(*fields, ",")
+	}
+	if *exclude != "" {
+		opts.Exclude = strings.Split(*exclude, ",")
+	}
+	if *output == "-" {
+		color.Output = os.Stderr
+	}
+
+	session, records, err := loadSession(*dataDir, fs.Arg(0))
+	if err != nil {
+		color.Red("%v", err)
+		return 1
+	}
+	if len(records) == 0 {
+		color.Red("会话没有数据包: %s", session)
+		return 1
+	}
+	n := notes.New()
+	if ns, err := notes.Open(filepath.Join(*dataDir, "notes.json")); err != nil {
+		color.Yellow("读取备注失败: %v", err)
+	} else if n, _, err = ns.Get(); err != nil {
+		color.Yellow("读取备注失败: %v", err)
+	}
+
+	d := diagram.Build(records, n, opts)
+	if len(d.Messages) == 0 {
+		color.Red("范围内没有消息")
+		return 1
+	}
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			color.Red("创建输出文件失败: %v", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := diagram.Write(w, d, *format); err != nil {
+		color.Red("生成时序图失败: %v", err)
+		return 1
+	}
+	if d.Truncated > 0 {
+		color.Yellow("另有 %d 条消息超出 -limit 没有包含", d.Truncated)
+	}
+	if *output != "-" {
+		color.Green("时序图已写入 %s，共 %d 条消息", *output, len(d.Messages))
+	}
+	return 0
+}
+
+// parseLocalTime 解析 RFC3339 时间或本地时间 2006-01-02 15:04:05，为空时返回零值
+func parseLocalTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateTime, v, time.Local)
+}
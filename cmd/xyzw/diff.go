@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"xyzw_study/internal/crypto/bon"
+	"xyzw_study/internal/diff"
+	"xyzw_study/internal/record"
+
+	"github.com/fatih/color"
+)
+
+// runDiff 比较两个抓包文件（按命令）或两个 JSON 值
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	ignore := fs.String("ignore", strings.Join(diff.DefaultIgnore, ","), "忽略的字段路径，逗号分隔，* 匹配任意一段")
+	cmd := fs.String("cmd", "", "只比较指定命令")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		color.Red("用法: xyzw diff [-ignore seq,ack] [-cmd name] [-json] <a> <b>")
+		return 2
+	}
+
+	opts := diff.Options{}
+	if *ignore != "" {
+		opts.Ignore = strings.Split(*ignore, ",")
+	}
+
+	a, errA := record.ReadFile(fs.Arg(0))
+	b, errB := record.ReadFile(fs.Arg(1))
+	if errA == nil && errB == nil {
+		if *cmd != "" {
+			a, b = filterCmd(a, *cmd), filterCmd(b, *cmd)
+		}
+		result, err := diff.Records(a, b, opts)
+		if err != nil {
+			color.Red("比较失败: %v", err)
+			return 1
+		}
+		if *asJSON {
+			return printJSON(result)
+		}
+		for _, d := range result {
+			switch d.Kind {
+			case diff.Added:
+				color.Green("== %s (仅出现在 %s)", d.Cmd, fs.Arg(1))
+			case diff.Removed:
+				color.Red("== %s (仅出现在 %s)", d.Cmd, fs.Arg(0))
+			default:
+				color.Cyan("== %s", d.Cmd)
+				fmt.Print(diff.Format(d.Changes))
+			}
+		}
+		return 0
+	}
+
+	// 不是抓包文件时按单个 JSON 值比较
+	va, err := readJSONValue(fs.Arg(0))
+	if err != nil {
+		color.Red("读取 %s 失败: %v", fs.Arg(0), err)
+		return 1
+	}
+	vb, err := readJSONValue(fs.Arg(1))
+	if err != nil {
+		color.Red("读取 %s 失败: %v", fs.Arg(1), err)
+		return 1
+	}
+	changes := diff.Values(va, vb, opts)
+	if *asJSON {
+		return printJSON(changes)
+	}
+	fmt.Print(diff.Format(changes))
+	return 0
+}
+
+func filterCmd(records []record.Record, cmd string) []record.Record {
+	var result []record.Record
+	for _, rec := range records {
+		if rec.Cmd() == cmd {
+			result = append(result, rec)
+		}
+	}
+	return result
+}
+
+func readJSONValue(path string) (any, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var v any
+	dec := json.NewDecoder(file)
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return bon.FromJSON(v), nil
+}
+
+func printJSON(v any) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		color.Red("输出失败: %v", err)
+		return 1
+	}
+	return 0
+}
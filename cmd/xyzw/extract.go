@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"xyzw_study/internal/catalog"
+	"xyzw_study/internal/config"
+	"xyzw_study/internal/notes"
+
+	"github.com/fatih/color"
+)
+
+// runExtractCommands 从游戏客户端的 JavaScript 代码中提取命令和请求参数，写入备注
+func runExtractCommands(args []string) int {
+	fs := flag.NewFlagSet("extract-commands", flag.ContinueOnError)
+	dataDir := fs.String("data-dir", config.Default().DataDir, "数据目录")
+	dryRun := fs.Bool("dry-run", false, "只输出提取结果，不写入备注")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出提取的命令")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		color.Red("用法: xyzw extract-commands [-data-dir ./data] [-dry-run] [-json] <bundle.js>")
+		return 2
+	}
+
+	src, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		color.Red("读取客户端代码失败: %v", err)
+		return 1
+	}
+	commands := catalog.Extract(src)
+	if *asJSON {
+		if code := printJSON(commands); code != 0 {
+			return code
+		}
+	} else {
+		color.Cyan("提取到 %d 个命令", len(commands))
+	}
+	if *dryRun {
+		return 0
+	}
+
+	statePath := filepath.Join(*dataDir, catalog.StateFile)
+	prev, err := catalog.ReadState(statePath)
+	if err != nil {
+		color.Red("读取上次提取结果失败: %v", err)
+		return 1
+	}
+	store, err := notes.Open(filepath.Join(*dataDir, "notes.json"))
+	if err != nil {
+		color.Red("打开备注失败: %v", err)
+		return 1
+	}
+	generated := catalog.Notes(commands)
+	var stats catalog.Stats
+	_, _, err = store.Modify(func(n *notes.Notes) error {
+		stats = catalog.Apply(n, prev, generated)
+		return nil
+	})
+	if err != nil {
+		color.Red("保存备注失败: %v", err)
+		return 1
+	}
+	if err := catalog.WriteState(statePath, generated); err != nil {
+		color.Red("保存提取结果失败: %v", err)
+		return 1
+	}
+	color.Green("备注已更新: 新增 %d，更新 %d，保留人工修改 %d", stats.Added, stats.Updated, stats.Kept)
+	return 0
+}
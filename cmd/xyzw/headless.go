@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"xyzw_study/internal/config"
+	"xyzw_study/internal/proxy"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/sysproxy"
+	"xyzw_study/internal/tables"
+
+	"github.com/fatih/color"
+)
+
+// recorder 将捕获的数据包以 JSONL 写入文件或标准输出
+type recorder struct {
+	mu     sync.Mutex
+	writer *record.Writer
+	closer io.Closer
+
+	// 配置表不为空时为记录添加ID名称
+	tables  *tables.Store
+	mapping tables.Mapping
+}
+
+// newRecorder 创建 recorder，output 为 "-" 时写入标准输出
+func newRecorder(output string) (*recorder, error) {
+	if output == "" || output == "-" {
+		return &recorder{writer: record.NewWriter(os.Stdout)}, nil
+	}
+	file, err := os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{writer: record.NewWriter(file), closer: file}, nil
+}
+
+// handle 处理一个数据包，可以被抓包回调并发调用
+func (r *recorder) handle(packet proxy.GamePacket) {
+	call := "client"
+	if packet.Direction == proxy.Receive {
+		call = "server"
+	}
+	rec := record.Record{
+		Time:    packet.Time,
+		Session: packet.SessionID,
+		Call:    call,
+		Raw:     hex.EncodeToString(packet.Raw),
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if msg, ok := packet.RawData.(string); ok && msg != "" {
+		rec.Msg = json.RawMessage(msg)
+	}
+	if r.tables != nil && len(r.tables.List()) > 0 {
+		rec = r.tables.Record(r.mapping, rec)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.writer.Write(rec); err != nil {
+		color.Red("写入抓包记录失败: %v", err)
+	}
+}
+
+// Close 关闭输出文件
+func (r *recorder) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// runHeadless 启动无界面抓包，不启动 Web 服务，代理退出时返回错误
+func runHeadless(cfg config.Config) error {
+	rec, err := newRecorder(cfg.Output)
+	if err != nil {
+		return err
+	}
+	defer rec.Close()
+	rec.tables, rec.mapping = loadTables(cfg.DataDir)
+	color.Green("无界面模式已启动，抓包输出到 %s", cfg.Output)
+
+	errCh := make(chan error, 2)
+	if cfg.SystemProxy && cfg.ProxyMode == config.ProxyModePAC {
+		// 无界面模式不启动 Web 界面，只提供 PAC 脚本
+		mux := http.NewServeMux()
+		mux.HandleFunc("/proxy.pac", sysproxy.PACHandler(cfg.ProxyAddr(), cfg.GameHosts))
+		go func() { errCh <- http.ListenAndServe(cfg.WebAddr, mux) }()
+	}
+	go func() {
+		errCh <- proxy.StartCapture(proxy.Options{Port: cfg.ProxyPort, Hosts: cfg.GameHosts, Dial: cfg.UpstreamDial()}, rec.handle)
+	}()
+	return <-errCh
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"xyzw_study/internal/config"
+	"xyzw_study/internal/ledger"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/rolestate"
+
+	"github.com/fatih/color"
+)
+
+// runLedger 统计抓包文件中道具和资源的变化，以 CSV 输出
+func runLedger(args []string) int {
+	fs := flag.NewFlagSet("ledger", flag.ContinueOnError)
+	dataDir := fs.String("data-dir", config.Default().DataDir, "数据目录，使用其中的配置表显示道具名称")
+	totals := fs.Bool("totals", false, "输出每个命令的汇总，否则输出明细")
+	output := fs.String("o", "-", "输出文件，- 为标准输出")
+	session := fs.String("session", "", "只统计指定会话")
+	jsonOut := fs.Bool("json", false, "以 JSON 输出汇总")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		color.Red("用法: xyzw ledger [-totals] [-session id] [-o out.csv] [-json] <抓包.jsonl>...")
+		return 2
+	}
+
+	// 输出到标准输出时，提示信息改为输出到标准错误
+	if *output == "-" && !*jsonOut {
+		color.Output = os.Stderr
+	}
+
+	l := ledger.New(0)
+	for _, path := range fs.Args() {
+		records, err := record.ReadFile(path)
+		if err != nil {
+			color.Red("读取抓包失败: %v", err)
+			return 1
+		}
+		// 没有会话ID的记录按文件区分会话
+		l.Records(records, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	}
+	if *jsonOut {
+		return printJSON(l.Summary(*session))
+	}
+
+	store, _ := loadTables(*dataDir)
+	names := func(kind, key string) string {
+		if kind != rolestate.KindItem {
+			return ""
+		}
+		name, _ := store.Lookup("item", key)
+		return name
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			color.Red("创建输出文件失败: %v", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	var err error
+	if *totals {
+		err = ledger.WriteTotalsCSV(w, l.Summary(*session), names)
+	} else {
+		err = ledger.WriteCSV(w, l.Entries(*session), names)
+	}
+	if err != nil {
+		color.Red("写入失败: %v", err)
+		return 1
+	}
+	return 0
+}
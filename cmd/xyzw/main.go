@@ -3,8 +3,11 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
@@ -13,11 +16,14 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	"xyzw_study/internal/auth"
+	"xyzw_study/internal/config"
+	"xyzw_study/internal/sysproxy"
+	"xyzw_study/internal/upstream"
 	"xyzw_study/web"
+	"xyzw_study/web/api"
 
 	"github.com/fatih/color"
-
-	"github.com/husanpao/game-mitm/gosysproxy"
 )
 
 // 当前应用版本
@@ -141,6 +147,43 @@ func openBrowser(url string) {
 }
 
 func main() {
+	// 执行子命令
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		color.Red("加载配置失败: %v", err)
+		os.Exit(2)
+	}
+
+	os.Exit(run(cfg))
+}
+
+// run 启动代理和 Web 服务并返回进程退出码
+// 系统代理的恢复放在 defer 中，正常退出、收到退出信号、启动失败和 run 自身的 panic 都会执行；
+// 代理、Web 服务等其它 goroutine 中的 panic 会直接结束进程，这时由下次启动或 xyzw proxy restore 根据状态文件恢复
+func run(cfg config.Config) int {
+	// 无界面模式输出到标准输出时，提示信息改为输出到标准错误
+	if cfg.Headless {
+		color.Output = os.Stderr
+	}
+
+	// 日志输出到文件
+	if cfg.LogPath != "" {
+		file, err := os.OpenFile(cfg.LogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			color.Red("打开日志文件失败: %v", err)
+			return 1
+		}
+		defer file.Close()
+		log.SetOutput(file)
+	}
+
 	// 显示免责声明
 	showDisclaimer()
 
@@ -151,29 +194,97 @@ func main() {
 	// 	return
 	// }
 
-	// 设置代理
-	err := gosysproxy.SetGlobalProxy("127.0.0.1:12311", "localhost;127.*;10.*;172.16.*;172.17.*;172.18.*;172.19.*;172.20.*;172.21.*;172.22.*;172.23.*;172.24.*;172.25.*;172.26.*;172.27.*;172.28.*;172.29.*;172.30.*;172.31.*;192.168.*")
-	if err != nil {
-		color.Red("设置系统代理失败: %v", err)
-		panic(err)
+	// 所有出站 HTTP 请求经过上游代理，抓包代理通过 cfg.UpstreamDial 使用同一个上游代理
+	if cfg.UpstreamProxy != "" {
+		dialer, err := upstream.Parse(cfg.UpstreamProxy)
+		if err != nil {
+			color.Red("%v", err)
+			return 1
+		}
+		dialer.Apply(http.DefaultTransport.(*http.Transport))
+		color.Green("出站连接和抓包代理使用上游代理: %s", dialer)
+	}
+
+	// 上次运行异常退出时先恢复系统代理
+	guard := sysproxy.NewGuard(cfg.Path(sysproxy.StateFileName))
+	if state, ok := guard.Pending(); ok {
+		if _, stale := guard.Stale(); stale {
+			color.Yellow("检测到上次运行(进程 %d)没有恢复系统代理，正在恢复...", state.PID)
+			if err := guard.Restore(); err != nil {
+				color.Red("恢复系统代理失败: %v", err)
+			}
+		} else if cfg.SystemProxy {
+			// 另一个实例正在使用系统代理，本实例修改或恢复都会影响它
+			color.Yellow("进程 %d 正在使用系统代理，本次不修改系统代理", state.PID)
+			cfg.SystemProxy = false
+		}
 	}
-	color.Green("系统代理设置成功")
 
-	// 确保在函数返回时关闭代理
-	defer func() {
-		color.Yellow("正在关闭系统代理...")
-		gosysproxy.Off()
-		color.Green("系统代理已关闭")
-	}()
+	// 设置代理
+	if cfg.SystemProxy {
+		var err error
+		if cfg.ProxyMode == config.ProxyModePAC {
+			// PAC 模式只让游戏域名走代理，其它流量不经过 MITM
+			err = guard.SetPAC(cfg.PACURL())
+		} else {
+			err = guard.SetGlobal(cfg.ProxyAddr(), sysproxy.DefaultBypass)
+		}
+		if err != nil {
+			color.Red("设置系统代理失败: %v", err)
+			return 1
+		}
+		if cfg.ProxyMode == config.ProxyModePAC {
+			color.Green("系统代理设置成功，PAC 地址: %s", cfg.PACURL())
+		} else {
+			color.Green("系统代理设置成功")
+		}
+
+		// 确保在函数返回时恢复代理
+		defer func() {
+			color.Yellow("正在恢复系统代理...")
+			if err := guard.Restore(); err != nil {
+				color.Red("恢复系统代理失败: %v，请运行 xyzw proxy restore", err)
+				return
+			}
+			color.Green("系统代理已恢复")
+		}()
+	} else {
+		color.Yellow("未修改系统代理，请将游戏客户端的代理设置为 %s", cfg.ProxyAddr())
+	}
 
 	// 设置信号处理，捕获中断信号
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	go web.StartWebServer()
-	color.Green("Web服务器已启动")
+	errCh := make(chan error, 1)
+	if cfg.Headless {
+		go func() { errCh <- runHeadless(cfg) }()
+	} else {
+		// 访问令牌在这里生成，才能输出带令牌的地址
+		if cfg.WebToken == "" {
+			token, err := auth.RandomToken()
+			if err != nil {
+				color.Red("生成访问令牌失败: %v", err)
+				return 1
+			}
+			cfg.WebToken = token
+		}
+		if !auth.IsLoopback(cfg.WebAddr) {
+			color.Yellow("Web 界面监听 %s，局域网中的其它设备也可以访问，请妥善保管访问令牌", cfg.WebAddr)
+		}
+		go func() { errCh <- web.StartWebServer(cfg) }()
+		// 退出时写入数据包存储中还没有写入的数据包
+		defer api.CloseStorage()
+		color.Green("Web服务器已启动，请使用以下地址打开: %s", cfg.WebURL())
+	}
 
-	// 等待中断信号
-	<-c
-	color.Yellow("收到退出信号，程序即将关闭...")
+	// 等待中断信号或服务退出
+	select {
+	case <-c:
+		color.Yellow("收到退出信号，程序即将关闭...")
+		return 0
+	case err := <-errCh:
+		color.Red("服务异常退出: %v", err)
+		return 1
+	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"xyzw_study/internal/config"
+	"xyzw_study/internal/sysproxy"
+
+	"github.com/fatih/color"
+)
+
+// runProxy 管理系统代理，用于进程被强制结束后修复系统代理设置
+func runProxy(args []string) int {
+	if len(args) == 0 {
+		color.Red("用法: xyzw proxy <restore|status> [-data-dir ./data] [-force]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("proxy "+args[0], flag.ContinueOnError)
+	dataDir := fs.String("data-dir", config.Default().DataDir, "数据目录")
+	force := fs.Bool("force", false, "没有保存的状态时直接关闭系统代理，或强制恢复仍在运行的实例保存的状态")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	cfg := config.Default()
+	cfg.DataDir = *dataDir
+	guard := sysproxy.NewGuard(cfg.Path(sysproxy.StateFileName))
+
+	switch args[0] {
+	case "status":
+		current, err := sysproxy.Current()
+		if err != nil {
+			color.Yellow("无法读取当前系统代理: %v", err)
+		} else {
+			color.Cyan("当前系统代理: %s", current)
+		}
+		if state, ok := guard.Pending(); ok {
+			color.Yellow("存在未恢复的系统代理状态: %s (进程 %d，保存于 %s)",
+				state, state.PID, state.SavedAt.Format("2006-01-02 15:04:05"))
+			if _, stale := guard.Stale(); !stale {
+				color.Yellow("进程 %d 仍在运行，退出时会自行恢复", state.PID)
+			}
+		} else {
+			color.Green("没有未恢复的系统代理状态")
+		}
+		return 0
+	case "restore":
+		if state, ok := guard.Pending(); ok {
+			if _, stale := guard.Stale(); !stale && !*force {
+				color.Yellow("进程 %d 仍在运行并使用系统代理，如需强制恢复请加 -force", state.PID)
+				return 1
+			}
+		} else {
+			if !*force {
+				color.Green("没有需要恢复的系统代理状态，如需直接关闭系统代理请加 -force")
+				return 0
+			}
+			if err := sysproxy.Off(); err != nil {
+				color.Red("关闭系统代理失败: %v", err)
+				return 1
+			}
+			color.Green("系统代理已关闭")
+			return 0
+		}
+		if err := guard.Restore(); err != nil {
+			color.Red("恢复系统代理失败: %v", err)
+			return 1
+		}
+		color.Green("系统代理已恢复")
+		return 0
+	default:
+		color.Red("未知的 proxy 子命令: %s", args[0])
+		return 2
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/redact"
+
+	"github.com/fatih/color"
+)
+
+// runRedact 对抓包文件进行脱敏，输出仍是可解码的 JSONL 抓包
+func runRedact(args []string) int {
+	fs := flag.NewFlagSet("redact", flag.ContinueOnError)
+	rules := fs.String("rules", "data/redact.json", "脱敏规则文件，不存在时使用默认规则")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		color.Red("用法: xyzw redact [-rules data/redact.json] <输入.jsonl> <输出.jsonl>")
+		return 2
+	}
+
+	cfg, err := redact.LoadConfig(*rules)
+	if err != nil {
+		color.Red("加载脱敏规则失败: %v", err)
+		return 1
+	}
+	records, err := record.ReadFile(fs.Arg(0))
+	if err != nil {
+		color.Red("读取抓包失败: %v", err)
+		return 1
+	}
+
+	out, err := os.Create(fs.Arg(1))
+	if err != nil {
+		color.Red("创建输出文件失败: %v", err)
+		return 1
+	}
+	defer out.Close()
+
+	redactor := redact.New(cfg)
+	writer := record.NewWriter(out)
+	skipped := 0
+	for _, rec := range records {
+		redacted, err := redactor.Record(rec)
+		if err != nil {
+			// 无法解码的记录直接跳过，避免泄露原始内容
+			skipped++
+			continue
+		}
+		if err := writer.Write(redacted); err != nil {
+			color.Red("写入失败: %v", err)
+			return 1
+		}
+	}
+	color.Green("已脱敏 %d 条记录，跳过 %d 条无法解码的记录", len(records)-skipped, skipped)
+	return 0
+}
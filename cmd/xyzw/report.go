@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"xyzw_study/internal/config"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/report"
+	"xyzw_study/internal/store"
+
+	"github.com/fatih/color"
+)
+
+// runReport 生成会话的摘要报告，参数为数据包存储中的会话ID或抓包文件
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	dataDir := fs.String("data-dir", config.Default().DataDir, "数据目录，读取其中的数据包存储和备注")
+	format := fs.String("format", report.FormatMarkdown, "报告格式: md 或 html")
+	output := fs.String("o", "-", "输出文件，- 为标准输出")
+	title := fs.String("title", "", "报告标题")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		color.Red("用法: xyzw report [-format md|html] [-o report.md] <会话ID|抓包.jsonl>")
+		return 2
+	}
+	if *output == "-" {
+		color.Output = os.Stderr
+	}
+
+	session, records, err := loadSession(*dataDir, fs.Arg(0))
+	if err != nil {
+		color.Red("%v", err)
+		return 1
+	}
+	if len(records) == 0 {
+		color.Red("会话没有数据包: %s", session)
+		return 1
+	}
+
+	n := notes.New()
+	if ns, err := notes.Open(filepath.Join(*dataDir, "notes.json")); err != nil {
+		color.Yellow("读取备注失败: %v", err)
+	} else if n, _, err = ns.Get(); err != nil {
+		color.Yellow("读取备注失败: %v", err)
+	}
+
+	rep := report.Build(session, records, n, report.Options{Title: *title})
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			color.Red("创建输出文件失败: %v", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := report.Write(w, rep, *format); err != nil {
+		color.Red("生成报告失败: %v", err)
+		return 1
+	}
+	if *output != "-" {
+		color.Green("报告已写入 %s", *output)
+	}
+	return 0
+}
+
+// loadSession 读取抓包文件，或从数据包存储中读取会话的全部数据包
+func loadSession(dataDir, arg string) (string, []record.Record, error) {
+	if info, err := os.Stat(arg); err == nil && !info.IsDir() {
+		records, err := record.ReadFile(arg)
+		if err != nil {
+			return "", nil, err
+		}
+		session := strings.TrimSuffix(filepath.Base(arg), filepath.Ext(arg))
+		if len(records) > 0 && records[0].Session != "" {
+			session = records[0].Session
+		}
+		return session, records, nil
+	}
+
+	s, err := store.Open(filepath.Join(dataDir, "packets.db"))
+	if err != nil {
+		return "", nil, err
+	}
+	defer s.Close()
+	var records []record.Record
+	err = s.Each(store.Query{Session: arg}, func(p store.Packet) error {
+		records = append(records, p.Record())
+		return nil
+	})
+	return arg, records, err
+}
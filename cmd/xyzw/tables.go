@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"xyzw_study/internal/config"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/tables"
+
+	"github.com/fatih/color"
+)
+
+// loadTables 加载数据目录中的配置表和备注中配置的字段映射
+func loadTables(dataDir string) (*tables.Store, tables.Mapping) {
+	store := tables.Open(filepath.Join(dataDir, tables.DirName))
+	if err := store.Err(); err != nil {
+		color.Yellow("%v", err)
+	}
+	mapping := tables.DefaultMapping()
+	ns, err := notes.Open(filepath.Join(dataDir, "notes.json"))
+	if err != nil {
+		color.Yellow("读取备注失败，只使用默认字段映射: %v", err)
+		return store, mapping
+	}
+	n, _, err := ns.Get()
+	if err != nil {
+		color.Yellow("读取备注失败，只使用默认字段映射: %v", err)
+		return store, mapping
+	}
+	return store, mapping.With(n.KeyTables)
+}
+
+// runTables 查看配置表，或为抓包文件添加ID名称
+func runTables(args []string) int {
+	fs := flag.NewFlagSet("tables", flag.ContinueOnError)
+	dataDir := fs.String("data-dir", config.Default().DataDir, "数据目录，配置表放在其中的 tables 子目录")
+	jsonOut := fs.Bool("json", false, "以 JSON 输出")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	usage := func() int {
+		color.Red("用法: xyzw tables [-data-dir data] list | lookup <表> <ID> | annotate <输入.jsonl> <输出.jsonl>")
+		return 2
+	}
+	if fs.NArg() == 0 {
+		return usage()
+	}
+
+	store, mapping := loadTables(*dataDir)
+	switch fs.Arg(0) {
+	case "list":
+		if fs.NArg() != 1 {
+			return usage()
+		}
+		list := store.List()
+		if *jsonOut {
+			printJSON(list)
+			return 0
+		}
+		if len(list) == 0 {
+			color.Yellow("%s 中没有配置表", store.Dir())
+			return 0
+		}
+		for _, t := range list {
+			color.Cyan("%-20s %6d 行  %s", t.Name, t.Rows, t.File)
+		}
+		return 0
+
+	case "lookup":
+		if fs.NArg() != 3 {
+			return usage()
+		}
+		name, ok := store.Lookup(fs.Arg(1), fs.Arg(2))
+		if !ok {
+			color.Red("配置表 %s 中没有ID %s", fs.Arg(1), fs.Arg(2))
+			return 1
+		}
+		if *jsonOut {
+			printJSON(map[string]string{"table": fs.Arg(1), "id": fs.Arg(2), "name": name})
+			return 0
+		}
+		color.Green("%s", name)
+		return 0
+
+	case "annotate":
+		if fs.NArg() != 3 {
+			return usage()
+		}
+		records, err := record.ReadFile(fs.Arg(1))
+		if err != nil {
+			color.Red("读取抓包失败: %v", err)
+			return 1
+		}
+		out, err := os.Create(fs.Arg(2))
+		if err != nil {
+			color.Red("创建输出文件失败: %v", err)
+			return 1
+		}
+		defer out.Close()
+
+		writer := record.NewWriter(out)
+		annotated := 0
+		for _, rec := range records {
+			rec = store.Record(mapping, rec)
+			if len(rec.Names) > 0 {
+				annotated++
+			}
+			if err := writer.Write(rec); err != nil {
+				color.Red("写入失败: %v", err)
+				return 1
+			}
+		}
+		color.Green("共 %d 条记录，%d 条添加了ID名称", len(records), annotated)
+		return 0
+
+	default:
+		return usage()
+	}
+}
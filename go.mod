@@ -7,11 +7,16 @@ require (
 	github.com/gorilla/websocket v1.5.3
 	github.com/husanpao/game-mitm v0.0.0-20250722024031-59468afa8db2
 	github.com/pierrec/lz4 v2.6.1+incompatible
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/sys v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/frankban/quicktest v1.14.6 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	golang.org/x/sys v0.25.0 // indirect
 )
+
+// 上游代理需要在 game-mitm 的隧道和 WebSocket 连接上生效，使用 third_party 中的修改版
+replace github.com/husanpao/game-mitm => ./third_party/game-mitm
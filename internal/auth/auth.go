@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 访问令牌可以通过以下方式提供
+const (
+	QueryParam   = "token"           // 地址参数，验证通过后写入 Cookie 并跳转到去掉令牌的地址
+	HeaderName   = "X-XYZW-Token"    // 请求头，也可以使用 Authorization: Bearer <token>
+	CookieName   = "xyzw_token"      // 浏览器使用的 Cookie
+	CSRFCookie   = "xyzw_csrf"       // CSRF 令牌 Cookie，前端读取后放在 CSRFHeader 中
+	CSRFHeader   = "X-CSRF-Token"    // 使用 Cookie 认证的 POST 等请求必须带上的请求头
+	tokenBytes   = 24                // 随机令牌的字节数
+	cookieMaxAge = 30 * 24 * 60 * 60 // Cookie 有效期，单位秒
+)
+
+// RandomToken 生成随机访问令牌
+func RandomToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IsLoopback 返回监听地址是否只接受本机连接
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Guard 为 Web 服务提供访问令牌认证、Origin 检查和 CSRF 防护
+//
+// 浏览器通过启动时输出的 /?token=xxx 地址访问，之后使用 Cookie 认证
+// 脚本和命令行工具使用 X-XYZW-Token 或 Authorization 请求头认证，不需要 CSRF 令牌
+type Guard struct {
+	token    string
+	csrf     string
+	loopback bool
+	public   map[string]bool
+	scoped   map[string]string // 路径 -> 只能访问该路径的令牌
+}
+
+// NewGuard 创建认证中间件，loopback 为 true 时只接受 Host 为本机地址的请求，防止 DNS 重绑定
+func NewGuard(token string, loopback bool) *Guard {
+	csrf, _ := RandomToken()
+	return &Guard{
+		token:    token,
+		csrf:     csrf,
+		loopback: loopback,
+		public:   make(map[string]bool),
+		scoped:   make(map[string]string),
+	}
+}
+
+// Token 返回访问令牌
+func (g *Guard) Token() string {
+	return g.token
+}
+
+// Public 设置不需要认证的路径，例如系统读取的 PAC 文件
+func (g *Guard) Public(paths ...string) {
+	for _, p := range paths {
+		g.public[p] = true
+	}
+}
+
+// Allow 为指定路径设置额外的访问令牌，只能通过请求头使用，不会写入 Cookie
+// 例如 Prometheus 采集 /metrics 使用的固定令牌，不需要每次启动后修改采集配置
+func (g *Guard) Allow(token string, paths ...string) {
+	for _, p := range paths {
+		g.scoped[p] = token
+	}
+}
+
+// Handler 包装 HTTP 处理器
+func (g *Guard) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.public[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if g.loopback && !loopbackHost(r.Host) {
+			http.Error(w, "不允许的 Host: "+r.Host, http.StatusForbidden)
+			return
+		}
+		if !sameOrigin(r) {
+			http.Error(w, "不允许的跨域请求", http.StatusForbidden)
+			return
+		}
+
+		// 地址中带令牌时写入 Cookie，页面请求跳转到去掉令牌的地址
+		if token := r.URL.Query().Get(QueryParam); token != "" {
+			if !g.valid(token) {
+				http.Error(w, "访问令牌无效", http.StatusUnauthorized)
+				return
+			}
+			g.setCookies(w)
+			if r.Method == http.MethodGet && !isWebSocket(r) {
+				u := *r.URL
+				q := u.Query()
+				q.Del(QueryParam)
+				u.RawQuery = q.Encode()
+				http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// 请求头认证，跨站页面无法在不经过预检的情况下设置自定义请求头
+		if token := headerToken(r); token != "" {
+			if !g.valid(token) && !g.validScoped(r.URL.Path, token) {
+				http.Error(w, "访问令牌无效", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(CookieName)
+		if err != nil || !g.valid(cookie.Value) {
+			http.Error(w, "需要访问令牌，请使用启动时输出的地址打开", http.StatusUnauthorized)
+			return
+		}
+		if !safeMethod(r.Method) && !g.validCSRF(r) {
+			http.Error(w, "CSRF 令牌无效", http.StatusForbidden)
+			return
+		}
+		// 刷新 CSRF Cookie，令牌在重启后会变化
+		if c, err := r.Cookie(CSRFCookie); err != nil || c.Value != g.csrf {
+			g.setCookies(w)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (g *Guard) valid(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) == 1
+}
+
+// validScoped 检查只能访问指定路径的令牌
+func (g *Guard) validScoped(path, token string) bool {
+	scoped, ok := g.scoped[path]
+	return ok && scoped != "" && subtle.ConstantTimeCompare([]byte(token), []byte(scoped)) == 1
+}
+
+// validCSRF 检查双重提交的 CSRF 令牌
+func (g *Guard) validCSRF(r *http.Request) bool {
+	header := r.Header.Get(CSRFHeader)
+	return header != "" && subtle.ConstantTimeCompare([]byte(header), []byte(g.csrf)) == 1
+}
+
+func (g *Guard) setCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    g.token,
+		Path:     "/",
+		MaxAge:   cookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    g.csrf,
+		Path:     "/",
+		MaxAge:   cookieMaxAge,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// headerToken 从请求头读取访问令牌
+func headerToken(r *http.Request) string {
+	if token := r.Header.Get(HeaderName); token != "" {
+		return token
+	}
+	if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+// sameOrigin 检查 Origin 与请求的 Host 是否一致，没有 Origin 的请求不是浏览器跨域请求
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && strings.EqualFold(u.Host, r.Host)
+}
+
+// loopbackHost 检查请求的 Host 是否为本机地址
+func loopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return IsLoopback(strings.Trim(host, "[]"))
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func isWebSocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestGuard() (*Guard, http.Handler) {
+	g := NewGuard("secret", true)
+	g.Public("/proxy.pac")
+	return g, g.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func request(method, target string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.Host = "127.0.0.1:12582"
+	return r
+}
+
+func cookies(w *httptest.ResponseRecorder) map[string]string {
+	result := make(map[string]string)
+	for _, c := range w.Result().Cookies() {
+		result[c.Name] = c.Value
+	}
+	return result
+}
+
+func TestQueryTokenSetsCookies(t *testing.T) {
+	g, h := newTestGuard()
+	w := serve(h, request(http.MethodGet, "/?token=secret&tab=debug"))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?tab=debug" {
+		t.Fatalf("code=%d location=%q", w.Code, w.Header().Get("Location"))
+	}
+	c := cookies(w)
+	if c[CookieName] != "secret" || c[CSRFCookie] != g.csrf {
+		t.Errorf("cookies = %v", c)
+	}
+
+	if w := serve(h, request(http.MethodGet, "/?token=wrong")); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: %d", w.Code)
+	}
+}
+
+func TestCookieAndCSRF(t *testing.T) {
+	g, h := newTestGuard()
+
+	r := request(http.MethodGet, "/api/notes/load")
+	if w := serve(h, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: %d", w.Code)
+	}
+
+	r = request(http.MethodGet, "/api/notes/load")
+	r.AddCookie(&http.Cookie{Name: CookieName, Value: "secret"})
+	if w := serve(h, r); w.Code != http.StatusOK {
+		t.Errorf("cookie GET: %d", w.Code)
+	}
+
+	// 使用 Cookie 认证的 POST 需要 CSRF 令牌
+	r = request(http.MethodPost, "/api/debug/send")
+	r.AddCookie(&http.Cookie{Name: CookieName, Value: "secret"})
+	if w := serve(h, r); w.Code != http.StatusForbidden {
+		t.Errorf("POST without CSRF: %d", w.Code)
+	}
+	r = request(http.MethodPost, "/api/debug/send")
+	r.AddCookie(&http.Cookie{Name: CookieName, Value: "secret"})
+	r.Header.Set(CSRFHeader, "guess")
+	if w := serve(h, r); w.Code != http.StatusForbidden {
+		t.Errorf("POST with wrong CSRF: %d", w.Code)
+	}
+	r = request(http.MethodPost, "/api/debug/send")
+	r.AddCookie(&http.Cookie{Name: CookieName, Value: "secret"})
+	r.Header.Set(CSRFHeader, g.csrf)
+	if w := serve(h, r); w.Code != http.StatusOK {
+		t.Errorf("POST with CSRF: %d", w.Code)
+	}
+}
+
+func TestHeaderToken(t *testing.T) {
+	_, h := newTestGuard()
+	r := request(http.MethodPost, "/api/debug/send")
+	r.Header.Set(HeaderName, "secret")
+	if w := serve(h, r); w.Code != http.StatusOK {
+		t.Errorf("header token: %d", w.Code)
+	}
+	r = request(http.MethodPost, "/api/debug/send")
+	r.Header.Set("Authorization", "Bearer secret")
+	if w := serve(h, r); w.Code != http.StatusOK {
+		t.Errorf("bearer token: %d", w.Code)
+	}
+	r = request(http.MethodGet, "/api/packets")
+	r.Header.Set(HeaderName, "wrong")
+	if w := serve(h, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong header token: %d", w.Code)
+	}
+}
+
+func TestOriginAndHost(t *testing.T) {
+	_, h := newTestGuard()
+
+	r := request(http.MethodGet, "/ws?token=secret")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Origin", "http://evil.example")
+	if w := serve(h, r); w.Code != http.StatusForbidden {
+		t.Errorf("cross-origin WebSocket: %d", w.Code)
+	}
+
+	r = request(http.MethodGet, "/ws")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Origin", "http://127.0.0.1:12582")
+	r.AddCookie(&http.Cookie{Name: CookieName, Value: "secret"})
+	if w := serve(h, r); w.Code != http.StatusOK {
+		t.Errorf("same-origin WebSocket: %d", w.Code)
+	}
+
+	// DNS 重绑定攻击的 Host 是攻击者的域名
+	r = request(http.MethodGet, "/api/packets")
+	r.Host = "rebind.example:12582"
+	r.Header.Set(HeaderName, "secret")
+	if w := serve(h, r); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "Host") {
+		t.Errorf("non-loopback host: %d", w.Code)
+	}
+
+	// PAC 文件由系统读取，不需要认证
+	r = request(http.MethodGet, "/proxy.pac")
+	r.Host = "192.168.1.2:12582"
+	if w := serve(h, r); w.Code != http.StatusOK {
+		t.Errorf("public path: %d", w.Code)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:12582": true,
+		"localhost:12582": true,
+		"[::1]:12582":     true,
+		":12582":          false,
+		"0.0.0.0:12582":   false,
+		"192.168.1.2:80":  false,
+	} {
+		if got := IsLoopback(addr); got != want {
+			t.Errorf("IsLoopback(%q) = %v", addr, got)
+		}
+	}
+}
+
+func TestAllowScopedToken(t *testing.T) {
+	g, h := newTestGuard()
+	g.Allow("scrape", "/metrics")
+
+	r := request(http.MethodGet, "/metrics")
+	r.Header.Set("Authorization", "Bearer scrape")
+	if w := serve(h, r); w.Code != http.StatusOK {
+		t.Errorf("scoped token on /metrics: %d", w.Code)
+	}
+	r = request(http.MethodGet, "/metrics")
+	r.Header.Set(HeaderName, "secret")
+	if w := serve(h, r); w.Code != http.StatusOK {
+		t.Errorf("main token on /metrics: %d", w.Code)
+	}
+
+	// 只能访问指定路径，也不能通过地址参数换取 Cookie
+	r = request(http.MethodGet, "/api/packets")
+	r.Header.Set("Authorization", "Bearer scrape")
+	if w := serve(h, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("scoped token on other path: %d", w.Code)
+	}
+	if w := serve(h, request(http.MethodGet, "/metrics?token=scrape")); w.Code != http.StatusUnauthorized {
+		t.Errorf("scoped token in query: %d", w.Code)
+	}
+}
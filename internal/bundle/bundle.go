@@ -0,0 +1,166 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"xyzw_study/internal/atomicfile"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/scripts"
+)
+
+const (
+	Format  = "xyzw-bundle" // 文件格式标识
+	Version = 1             // 当前格式版本，格式不兼容时增加
+
+	// BaseFile 数据目录中保存的合并基准，记录上次导入或共享导出的内容
+	BaseFile = "bundle_base.json"
+)
+
+// Bundle 备注和脚本的导出包，用于在团队之间共享
+type Bundle struct {
+	Format     string           `json:"format"`
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exportedAt"`
+	Notes      notes.Notes      `json:"notes"`
+	Scripts    []scripts.Script `json:"scripts"`
+}
+
+// New 创建导出包，脚本的删除时间不会导出
+func New(n notes.Notes, list []scripts.Script) Bundle {
+	b := Bundle{
+		Format:     Format,
+		Version:    Version,
+		ExportedAt: time.Now(),
+		Notes:      n.Clone(),
+		Scripts:    make([]scripts.Script, 0, len(list)),
+	}
+	for _, sc := range list {
+		sc.DeletedAt = nil
+		b.Scripts = append(b.Scripts, sc)
+	}
+	return b
+}
+
+// Read 读取导出包并检查格式和版本
+func Read(r io.Reader) (Bundle, error) {
+	var b Bundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return Bundle{}, fmt.Errorf("解析导出包失败: %w", err)
+	}
+	if b.Format != Format {
+		return Bundle{}, fmt.Errorf("不是导出包文件，格式为 %q", b.Format)
+	}
+	if b.Version < 1 || b.Version > Version {
+		return Bundle{}, fmt.Errorf("不支持的导出包版本 %d，当前支持版本 %d", b.Version, Version)
+	}
+	b.Notes = b.Notes.Clone()
+	return b, nil
+}
+
+// Write 写入导出包
+func (b Bundle) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// ReadFile 从文件读取导出包
+func ReadFile(path string) (Bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Bundle{}, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// WriteFile 原子写入导出包文件
+func WriteFile(path string, b Bundle) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, data, 0644)
+}
+
+// Options 导入选项
+type Options struct {
+	Theirs bool   // 冲突时使用导入的版本，默认保留本地版本
+	DryRun bool   // 只检查合并结果，不修改本地数据
+	Author string // 脚本修订记录中的修改人
+}
+
+// Export 导出当前的备注和未删除的脚本，不修改合并基准
+func Export(ns *notes.Store, ss *scripts.Store) (Bundle, error) {
+	n, _, err := ns.Get()
+	if err != nil {
+		return Bundle{}, err
+	}
+	list, err := ss.List()
+	if err != nil {
+		return Bundle{}, err
+	}
+	return New(n, list), nil
+}
+
+// SaveBase 将导出包记录为下次导入的合并基准
+// 只在把导出包发给其他人共享时调用，否则对方修改后再导入时无法区分哪一方修改过
+func SaveBase(dataDir string, b Bundle) error {
+	if err := WriteFile(filepath.Join(dataDir, BaseFile), b); err != nil {
+		return fmt.Errorf("保存合并基准失败: %w", err)
+	}
+	return nil
+}
+
+// Import 将导出包三方合并到本地备注和脚本
+//
+// 合并基准是上次导入或导出的内容，只有一方修改的条目直接合并，两边都修改且结果不同的条目报告为冲突
+// 没有合并基准时，两边都有但内容不同的条目都是冲突
+func Import(ns *notes.Store, ss *scripts.Store, dataDir string, remote Bundle, opts Options) (Summary, error) {
+	basePath := filepath.Join(dataDir, BaseFile)
+	base, err := ReadFile(basePath)
+	if os.IsNotExist(err) {
+		base = New(notes.New(), nil)
+	} else if err != nil {
+		return Summary{}, fmt.Errorf("读取合并基准失败: %w", err)
+	}
+
+	n, etag, err := ns.Get()
+	if err != nil {
+		return Summary{}, err
+	}
+	list, err := ss.All()
+	if err != nil {
+		return Summary{}, err
+	}
+
+	plan := Merge(base, n, list, remote, opts.Theirs)
+	plan.Summary.DryRun = opts.DryRun
+	if opts.DryRun {
+		return plan.Summary, nil
+	}
+
+	if _, err := ns.Replace(plan.Notes, etag); err != nil {
+		return Summary{}, fmt.Errorf("保存备注失败: %w", err)
+	}
+	for _, sc := range plan.Save {
+		if _, err := ss.Save(sc, opts.Author); err != nil {
+			return Summary{}, fmt.Errorf("保存脚本 %s 失败: %w", sc.Name, err)
+		}
+	}
+	for _, id := range plan.Delete {
+		if err := ss.Delete(id, opts.Author); err != nil {
+			return Summary{}, fmt.Errorf("删除脚本 %s 失败: %w", id, err)
+		}
+	}
+
+	// 导入的内容作为下次合并的基准，保留本地版本的冲突下次不会再次报告
+	if err := WriteFile(basePath, remote); err != nil {
+		return Summary{}, fmt.Errorf("保存合并基准失败: %w", err)
+	}
+	return plan.Summary, nil
+}
@@ -0,0 +1,155 @@
+package bundle
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/scripts"
+)
+
+func notesOf(cmds map[string]string, keys map[string]map[string]string) notes.Notes {
+	n := notes.New()
+	for k, v := range cmds {
+		n.CommandNotes[k] = v
+	}
+	for cmd, m := range keys {
+		n.KeyNotes[cmd] = m
+	}
+	return n
+}
+
+func TestMergeNotes(t *testing.T) {
+	base := New(notesOf(
+		map[string]string{"a": "A", "b": "B", "c": "C", "d": "D"},
+		map[string]map[string]string{"role": {"x": "X", "y": "Y"}},
+	), nil)
+	local := notesOf(
+		map[string]string{"a": "A", "b": "本地B", "c": "C", "d": "本地D"},
+		map[string]map[string]string{"role": {"x": "本地X", "y": "Y"}},
+	)
+	remote := New(notesOf(
+		map[string]string{"a": "远程A", "b": "B", "d": "远程D", "e": "E"},
+		map[string]map[string]string{"role": {"x": "远程X", "y": "远程Y"}},
+	), nil)
+
+	plan := Merge(base, local, nil, remote, false)
+	want := map[string]string{"a": "远程A", "b": "本地B", "d": "本地D", "e": "E"}
+	for k, v := range want {
+		if plan.Notes.CommandNotes[k] != v {
+			t.Errorf("command %s = %q, want %q", k, plan.Notes.CommandNotes[k], v)
+		}
+	}
+	if _, ok := plan.Notes.CommandNotes["c"]; ok {
+		t.Error("remote deletion not applied")
+	}
+	if plan.Notes.KeyNotes["role"]["x"] != "本地X" || plan.Notes.KeyNotes["role"]["y"] != "远程Y" {
+		t.Errorf("key notes = %v", plan.Notes.KeyNotes)
+	}
+	if plan.Added != 1 || plan.Updated != 2 || plan.Deleted != 1 {
+		t.Errorf("summary = %+v", plan.Summary)
+	}
+
+	var got []string
+	for _, c := range plan.Conflicts {
+		got = append(got, c.Kind+":"+c.Cmd+":"+c.Key+":"+*c.Local+":"+*c.Remote)
+	}
+	if strings.Join(got, ",") != "command:d::本地D:远程D,key:role:x:本地X:远程X" {
+		t.Errorf("conflicts = %v", got)
+	}
+
+	plan = Merge(base, local, nil, remote, true)
+	if plan.Notes.CommandNotes["d"] != "远程D" || plan.Notes.KeyNotes["role"]["x"] != "远程X" || plan.Conflicts[0].Resolved != "remote" {
+		t.Errorf("theirs merge = %+v", plan.Notes)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	ns, err := notes.Open(filepath.Join(dir, "notes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, err := scripts.Open(filepath.Join(dir, "scripts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.Replace(notesOf(map[string]string{"a": "A"}, nil), "")
+	kept, _ := ss.Save(scripts.Script{Name: "保留", Content: "k1", Enabled: true}, "")
+	removed, _ := ss.Save(scripts.Script{Name: "删除", Content: "r1"}, "")
+
+	exported, err := Export(ns, ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 普通导出不修改合并基准
+	if _, err := os.Stat(filepath.Join(dir, BaseFile)); !os.IsNotExist(err) {
+		t.Fatalf("export wrote merge base: %v", err)
+	}
+	if err := SaveBase(dir, exported); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	exported.Write(&buf)
+	remote, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 对方修改了备注和脚本
+	remote.Notes.CommandNotes["a"] = "远程A"
+	remote.Notes.KeyNotes["role"] = map[string]string{"x": "X"}
+	remote.Scripts = []scripts.Script{
+		{ID: kept.ID, Name: "保留", Content: "k2", Enabled: false},
+		{ID: "shared", Name: "新脚本", Content: "n1", Enabled: true},
+	}
+
+	summary, err := Import(ns, ss, dir, remote, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _, _ := ns.Get(); n.CommandNotes["a"] != "A" {
+		t.Fatal("dry run modified notes")
+	}
+	if summary.Added != 2 || summary.Updated != 2 || summary.Deleted != 1 || len(summary.Conflicts) != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	if _, err := Import(ns, ss, dir, remote, Options{Author: "bundle"}); err != nil {
+		t.Fatal(err)
+	}
+	n, _, _ := ns.Get()
+	if n.CommandNotes["a"] != "远程A" || n.KeyNotes["role"]["x"] != "X" {
+		t.Errorf("notes = %+v", n)
+	}
+	sc, _ := ss.Get(kept.ID)
+	if sc.Content != "k2" || !sc.Enabled {
+		t.Errorf("updated script = %+v", sc)
+	}
+	if sc, _ := ss.Get(removed.ID); sc.DeletedAt == nil {
+		t.Error("script deleted remotely still active")
+	}
+	if sc, err := ss.Get("shared"); err != nil || sc.Enabled {
+		t.Errorf("new script = %+v, %v", sc, err)
+	}
+	if revs, _ := ss.Revisions(kept.ID); revs[len(revs)-1].Author != "bundle" {
+		t.Errorf("revisions = %+v", revs)
+	}
+
+	// 导入同一个包不再有变化
+	summary, _ = Import(ns, ss, dir, remote, Options{DryRun: true})
+	if summary.Added+summary.Updated+summary.Deleted+len(summary.Conflicts) != 0 {
+		t.Errorf("second import = %+v", summary)
+	}
+}
+
+func TestReadVersion(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"format":"xyzw-bundle","version":99}`)); err == nil {
+		t.Error("future version accepted")
+	}
+	if _, err := Read(strings.NewReader(`{"commandNotes":{}}`)); err == nil {
+		t.Error("notes file accepted as bundle")
+	}
+}
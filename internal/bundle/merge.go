@@ -0,0 +1,268 @@
+package bundle
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/scripts"
+)
+
+// 冲突的条目类型
+const (
+	KindCommand = "command" // 命令备注
+	KindKey     = "key"     // 键备注
+	KindTable   = "table"   // ID字段对应的配置表
+	KindScript  = "script"  // 脚本
+)
+
+// Conflict 两边都修改过且结果不同的条目，值为 nil 表示该方没有这个条目或已删除
+type Conflict struct {
+	Kind     string  `json:"kind"`               // 条目类型
+	Cmd      string  `json:"cmd,omitempty"`      // 命令，命令备注和键备注使用
+	Key      string  `json:"key,omitempty"`      // 键路径，键备注使用
+	ScriptID string  `json:"scriptId,omitempty"` // 脚本ID
+	Name     string  `json:"name,omitempty"`     // 脚本名称
+	Base     *string `json:"base"`               // 合并基准中的值，脚本为内容
+	Local    *string `json:"local"`              // 本地的值
+	Remote   *string `json:"remote"`             // 导入的值
+	Resolved string  `json:"resolved"`           // 使用的版本，local 或 remote
+}
+
+// Summary 合并结果
+type Summary struct {
+	Added     int        `json:"added"`     // 新增的条目数
+	Updated   int        `json:"updated"`   // 修改的条目数
+	Deleted   int        `json:"deleted"`   // 删除的条目数
+	Conflicts []Conflict `json:"conflicts"` // 冲突的条目
+	DryRun    bool       `json:"dryRun"`    // 只检查没有修改
+}
+
+// Plan 合并计划，由 Import 应用到本地数据
+type Plan struct {
+	Summary
+	Notes  notes.Notes      // 合并后的备注
+	Save   []scripts.Script // 需要新建或修改的脚本
+	Delete []string         // 需要删除的脚本ID
+}
+
+// outcome 单个条目的合并结果
+type outcome int
+
+const (
+	keep     outcome = iota // 保留本地
+	added                   // 使用导入的新条目
+	updated                 // 使用导入的修改
+	deleted                 // 导入方删除了条目
+	conflict                // 两边都修改过
+)
+
+// merge3 三方合并一组条目，report 收到每个不保留本地的条目
+// 冲突时 theirs 为 true 使用导入的值，否则保留本地的值
+func merge3[V comparable](base, local, remote map[string]V, theirs bool, report func(key string, o outcome, b, l, r *V)) map[string]V {
+	merged := maps.Clone(local)
+	if merged == nil {
+		merged = make(map[string]V)
+	}
+	keys := slices.Sorted(maps.Keys(union(base, local, remote)))
+	for _, k := range keys {
+		b, inBase := base[k]
+		l, inLocal := local[k]
+		r, inRemote := remote[k]
+		take := func() {
+			if inRemote {
+				merged[k] = r
+			} else {
+				delete(merged, k)
+			}
+		}
+		switch {
+		case inLocal == inRemote && l == r:
+			// 两边相同
+		case inLocal == inBase && l == b:
+			// 本地没有修改，使用导入的版本
+			take()
+			o := updated
+			if !inLocal {
+				o = added
+			} else if !inRemote {
+				o = deleted
+			}
+			report(k, o, ptr(b, inBase), ptr(l, inLocal), ptr(r, inRemote))
+		case inRemote == inBase && r == b:
+			// 导入方没有修改，保留本地
+		default:
+			if theirs {
+				take()
+			}
+			report(k, conflict, ptr(b, inBase), ptr(l, inLocal), ptr(r, inRemote))
+		}
+	}
+	return merged
+}
+
+func union[V any](ms ...map[string]V) map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, m := range ms {
+		for k := range m {
+			keys[k] = struct{}{}
+		}
+	}
+	return keys
+}
+
+func ptr[V any](v V, ok bool) *V {
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+// Merge 计算将 remote 三方合并到本地备注和脚本的结果，不修改任何数据
+// localScripts 包括已删除的脚本，导入的脚本与已删除的脚本ID相同时恢复该脚本
+func Merge(base Bundle, localNotes notes.Notes, localScripts []scripts.Script, remote Bundle, theirs bool) Plan {
+	plan := Plan{Summary: Summary{Conflicts: []Conflict{}}}
+	resolved := "local"
+	if theirs {
+		resolved = "remote"
+	}
+	count := func(o outcome) {
+		switch o {
+		case added:
+			plan.Added++
+		case updated:
+			plan.Updated++
+		case deleted:
+			plan.Deleted++
+		}
+	}
+
+	// 命令备注
+	commands := merge3(base.Notes.CommandNotes, localNotes.CommandNotes, remote.Notes.CommandNotes, theirs,
+		func(cmd string, o outcome, b, l, r *string) {
+			count(o)
+			if o == conflict {
+				plan.Conflicts = append(plan.Conflicts, Conflict{Kind: KindCommand, Cmd: cmd, Base: b, Local: l, Remote: r, Resolved: resolved})
+			}
+		})
+
+	// 键备注按 命令+键 合并，不同的键互不影响
+	keys := merge3(flatten(base.Notes.KeyNotes), flatten(localNotes.KeyNotes), flatten(remote.Notes.KeyNotes), theirs,
+		func(k string, o outcome, b, l, r *string) {
+			count(o)
+			if o == conflict {
+				cmd, key := splitKey(k)
+				plan.Conflicts = append(plan.Conflicts, Conflict{Kind: KindKey, Cmd: cmd, Key: key, Base: b, Local: l, Remote: r, Resolved: resolved})
+			}
+		})
+
+	// 配置表映射与键备注相同
+	tables := merge3(flatten(base.Notes.KeyTables), flatten(localNotes.KeyTables), flatten(remote.Notes.KeyTables), theirs,
+		func(k string, o outcome, b, l, r *string) {
+			count(o)
+			if o == conflict {
+				cmd, key := splitKey(k)
+				plan.Conflicts = append(plan.Conflicts, Conflict{Kind: KindTable, Cmd: cmd, Key: key, Base: b, Local: l, Remote: r, Resolved: resolved})
+			}
+		})
+
+	plan.Notes = notes.New()
+	plan.Notes.CommandNotes = commands
+	unflatten(plan.Notes.KeyNotes, keys)
+	unflatten(plan.Notes.KeyTables, tables)
+
+	// 脚本按ID合并名称和内容，启用状态只在本地设置
+	existing := make(map[string]scripts.Script, len(localScripts))
+	active := make([]scripts.Script, 0, len(localScripts))
+	for _, sc := range localScripts {
+		existing[sc.ID] = sc
+		if sc.DeletedAt == nil {
+			active = append(active, sc)
+		}
+	}
+	remoteScripts := make(map[string]scripts.Script, len(remote.Scripts))
+	for _, sc := range remote.Scripts {
+		remoteScripts[sc.ID] = sc
+	}
+	merge3(scriptValues(base.Scripts), scriptValues(active), scriptValues(remote.Scripts), theirs,
+		func(id string, o outcome, b, l, r *scriptValue) {
+			count(o)
+			if o == conflict {
+				c := Conflict{Kind: KindScript, ScriptID: id, Base: b.content(), Local: l.content(), Remote: r.content(), Resolved: resolved}
+				if l != nil {
+					c.Name = l.Name
+				} else if r != nil {
+					c.Name = r.Name
+				}
+				plan.Conflicts = append(plan.Conflicts, c)
+				if !theirs {
+					return
+				}
+			}
+			if r == nil {
+				plan.Delete = append(plan.Delete, id)
+				return
+			}
+			sc, ok := existing[id]
+			if !ok {
+				// 导入的新脚本默认禁用，检查后再启用
+				sc = remoteScripts[id]
+				sc.Enabled = false
+			} else if sc.DeletedAt != nil {
+				sc.Enabled = false
+			}
+			sc.Name = r.Name
+			sc.Content = r.Content
+			plan.Save = append(plan.Save, sc)
+		})
+	return plan
+}
+
+// scriptValue 参与合并的脚本字段
+type scriptValue struct {
+	Name    string
+	Content string
+}
+
+func (v *scriptValue) content() *string {
+	if v == nil {
+		return nil
+	}
+	return &v.Content
+}
+
+func scriptValues(list []scripts.Script) map[string]scriptValue {
+	m := make(map[string]scriptValue, len(list))
+	for _, sc := range list {
+		m[sc.ID] = scriptValue{Name: sc.Name, Content: sc.Content}
+	}
+	return m
+}
+
+// keySep 分隔命令和键路径，不会出现在命令和键路径中
+const keySep = "\x00"
+
+func flatten(nested map[string]map[string]string) map[string]string {
+	m := make(map[string]string)
+	for cmd, keys := range nested {
+		for key, v := range keys {
+			m[cmd+keySep+key] = v
+		}
+	}
+	return m
+}
+
+func unflatten(dst map[string]map[string]string, m map[string]string) {
+	for k, v := range m {
+		cmd, key := splitKey(k)
+		if dst[cmd] == nil {
+			dst[cmd] = make(map[string]string)
+		}
+		dst[cmd][key] = v
+	}
+}
+
+func splitKey(k string) (cmd, key string) {
+	cmd, key, _ = strings.Cut(k, keySep)
+	return cmd, key
+}
@@ -0,0 +1,119 @@
+package catalog
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"xyzw_study/internal/notes"
+)
+
+// 与 README 中手工整理的格式相同
+const annotated = `
+(e.SkyHorse_BuySignUpItem = "skyhorse_buysignupitem"), // 购买道具
+{ num: e }
+
+(e.SkyHorse_ChooseBuff = "skyhorse_choosebuff"), // 选择 buf
+{
+chooseBuffId: e,
+chooseBuffIndex: e,
+}
+
+(e.SkyHorse_ChooseLegion = "skyhorse_chooselegion"),// 选择打哪个俱乐部 没用了
+
+(e.SkyHorse_PickAward = "skyhorse_pickaward"), // 打图鉴马?
+{
+legionId: i,
+monsterUId: e,
+index: t,
+}
+`
+
+// 压缩后的客户端代码
+const minified = `!function(e){e.SkyHorse_FightPVP="skyhorse_fightpvp",e.Role_GetRoleInfo="role_getroleinfo",e.Title="Title"}(o||(o={}));` +
+	`var r=/"[a-z]+_x"/g,s='e.Fake_Cmd = "fake_cmd"';` +
+	"var u=`${o.Fake_Tpl}=\"fake_tpl\"`;" +
+	`n.prototype.fight=function(e,t){return this.send(o.SkyHorse_FightPVP,{targetId:e,battle:{type:1,auto:!0},skip:-1})},` +
+	`n.prototype.info=function(){return this.send(o.Role_GetRoleInfo,{clientVersion:"1.0",inviteUid:0})};`
+
+func find(commands []Command, cmd string) *Command {
+	for i := range commands {
+		if commands[i].Cmd == cmd {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func TestExtractAnnotated(t *testing.T) {
+	commands := Extract([]byte(annotated))
+	if len(commands) != 4 {
+		t.Fatalf("extracted %d commands: %+v", len(commands), commands)
+	}
+	c := find(commands, "skyhorse_pickaward")
+	if c == nil || c.Name != "SkyHorse_PickAward" || c.Comment != "打图鉴马?" || len(c.Fields) != 3 || c.Fields[1].Path != "monsterUId" {
+		t.Errorf("pickaward = %+v", c)
+	}
+	if c := find(commands, "skyhorse_chooselegion"); c.Comment != "选择打哪个俱乐部 没用了" || len(c.Fields) != 0 {
+		t.Errorf("chooselegion = %+v", c)
+	}
+	if c := find(commands, "skyhorse_buysignupitem"); len(c.Fields) != 1 || c.Fields[0].Value != "e" || c.Fields[0].Literal {
+		t.Errorf("buysignupitem = %+v", c)
+	}
+}
+
+func TestExtractMinified(t *testing.T) {
+	commands := Extract([]byte(minified))
+	data, _ := json.Marshal(commands)
+	if len(commands) != 2 {
+		t.Fatalf("extracted %s", data)
+	}
+	c := find(commands, "skyhorse_fightpvp")
+	var paths []string
+	for _, f := range c.Fields {
+		paths = append(paths, f.Path+"="+f.Value)
+	}
+	want := `["targetId=e","battle.type=1","battle.auto=!0","skip=-1"]`
+	if got, _ := json.Marshal(paths); string(got) != want {
+		t.Errorf("fields = %s", got)
+	}
+	if c := find(commands, "role_getroleinfo"); len(c.Fields) != 2 || !c.Fields[0].Literal || c.Fields[0].Value != `"1.0"` {
+		t.Errorf("role_getroleinfo = %+v", c)
+	}
+}
+
+func TestApply(t *testing.T) {
+	generated := Notes(Extract([]byte(annotated)))
+	if generated.CommandNotes["skyhorse_buysignupitem"] != "购买道具" || generated.KeyNotes["skyhorse_choosebuff"]["body.chooseBuffId"] != "请求参数" {
+		t.Fatalf("generated = %+v", generated)
+	}
+
+	n := notes.New()
+	n.CommandNotes["skyhorse_pickaward"] = "人工备注"
+	stats := Apply(&n, notes.New(), generated)
+	if n.CommandNotes["skyhorse_pickaward"] != "人工备注" || stats.Kept != 1 || stats.Added == 0 {
+		t.Errorf("first apply: %+v %+v", stats, n.CommandNotes)
+	}
+
+	// 人工修改和删除上次提取的备注后重新提取
+	prev := generated.Clone()
+	n.CommandNotes["skyhorse_buysignupitem"] = "买报名道具"
+	delete(n.CommandNotes, "skyhorse_choosebuff")
+	generated.CommandNotes["skyhorse_chooselegion"] = "选择俱乐部"
+	stats = Apply(&n, prev, generated)
+	if n.CommandNotes["skyhorse_buysignupitem"] != "买报名道具" || n.CommandNotes["skyhorse_chooselegion"] != "选择俱乐部" {
+		t.Errorf("second apply = %+v", n.CommandNotes)
+	}
+	if _, ok := n.CommandNotes["skyhorse_choosebuff"]; ok {
+		t.Error("deleted note added again")
+	}
+	if stats.Updated != 1 || stats.Added != 0 || stats.Kept != 3 {
+		t.Errorf("second apply stats = %+v", stats)
+	}
+}
+
+func TestStateMissing(t *testing.T) {
+	n, err := ReadState(filepath.Join(t.TempDir(), StateFile))
+	if err != nil || n.CommandNotes == nil {
+		t.Errorf("missing state = %+v, %v", n, err)
+	}
+}
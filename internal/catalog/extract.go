@@ -0,0 +1,289 @@
+package catalog
+
+import (
+	"slices"
+	"strings"
+)
+
+// Command 从客户端代码中提取的命令
+type Command struct {
+	Name    string  `json:"name"`              // 常量名，例如 SkyHorse_FightPVP
+	Cmd     string  `json:"cmd"`               // 命令，例如 skyhorse_fightpvp
+	Comment string  `json:"comment,omitempty"` // 常量附近的注释
+	Fields  []Field `json:"fields,omitempty"`  // 请求参数，来自发送命令的调用处
+}
+
+// Field 请求参数
+type Field struct {
+	Path    string `json:"path"`              // 参数路径，嵌套对象用 . 连接，例如 targetId
+	Value   string `json:"value"`             // 源码中的值表达式
+	Literal bool   `json:"literal,omitempty"` // 值是否为常量
+	Comment string `json:"comment,omitempty"` // 参数后面的注释
+}
+
+// Extract 从客户端 JavaScript 代码中提取命令常量、请求参数和注释
+//
+// 命令常量的格式为 e.SkyHorse_FightPVP = "skyhorse_fightpvp" 或 SkyHorse_FightPVP: "skyhorse_fightpvp"，
+// 只提取值等于常量名小写的常量
+// 请求参数来自 xxx.SkyHorse_FightPVP, { targetId: e } 形式的调用，或紧跟在常量定义后面的对象
+func Extract(src []byte) []Command {
+	tokens := lex(string(src))
+	p := &parser{tokens: tokens}
+	commands := make(map[string]*Command)
+
+	// 第一遍提取常量
+	for i := range tokens {
+		name, value, end, ok := p.constant(i)
+		if !ok {
+			continue
+		}
+		c := commands[name]
+		if c == nil {
+			c = &Command{Name: name, Cmd: value}
+			commands[name] = c
+		}
+		if c.Comment == "" {
+			c.Comment = p.comment(i, end)
+		}
+		// 紧跟在常量定义后面的对象作为请求参数
+		if j := p.skip(end+1, ")", ",", ";"); p.is(j, tokPunct, "{") {
+			fields, _ := p.object(j, "")
+			c.Fields = mergeFields(c.Fields, fields)
+		}
+	}
+
+	// 第二遍从调用处提取请求参数
+	for i := 0; i+3 < len(tokens); i++ {
+		if !p.is(i, tokPunct, ".") || tokens[i+1].kind != tokIdent {
+			continue
+		}
+		c := commands[tokens[i+1].text]
+		if c == nil || !p.is(i+2, tokPunct, ",") {
+			continue
+		}
+		if j := p.skip(i + 3); p.is(j, tokPunct, "{") {
+			fields, _ := p.object(j, "")
+			c.Fields = mergeFields(c.Fields, fields)
+		}
+	}
+
+	list := make([]Command, 0, len(commands))
+	for _, c := range commands {
+		list = append(list, *c)
+	}
+	slices.SortFunc(list, func(a, b Command) int { return strings.Compare(a.Cmd, b.Cmd) })
+	return list
+}
+
+// mergeFields 合并多个调用处的参数，同一路径保留第一次出现的值
+func mergeFields(a, b []Field) []Field {
+	for _, f := range b {
+		i := slices.IndexFunc(a, func(x Field) bool { return x.Path == f.Path })
+		if i < 0 {
+			a = append(a, f)
+		} else if a[i].Comment == "" {
+			a[i].Comment = f.Comment
+		}
+	}
+	return a
+}
+
+type parser struct {
+	tokens []token
+}
+
+// is 检查第 i 个单元的类型和内容
+func (p *parser) is(i int, kind tokenKind, text string) bool {
+	return i >= 0 && i < len(p.tokens) && p.tokens[i].kind == kind && p.tokens[i].text == text
+}
+
+// skip 从第 i 个单元开始跳过注释和指定的标点，返回下一个单元的位置
+func (p *parser) skip(i int, puncts ...string) int {
+	for i < len(p.tokens) {
+		t := p.tokens[i]
+		if t.kind != tokComment && !(t.kind == tokPunct && slices.Contains(puncts, t.text)) {
+			break
+		}
+		i++
+	}
+	return i
+}
+
+// constant 检查第 i 个单元是否开始一个命令常量，返回常量名、命令和值所在的位置
+func (p *parser) constant(i int) (name, value string, end int, ok bool) {
+	if i+2 >= len(p.tokens) || p.tokens[i].kind != tokIdent {
+		return "", "", 0, false
+	}
+	// e.Name = "value" 中的 e 不是常量名
+	if p.is(i+1, tokPunct, ".") {
+		return "", "", 0, false
+	}
+	op := p.tokens[i+1]
+	if op.kind != tokPunct || op.text != "=" && op.text != ":" {
+		return "", "", 0, false
+	}
+	// 排除 ==、=== 和 =>
+	if op.text == "=" && (p.is(i+2, tokPunct, "=") || p.is(i+2, tokPunct, ">")) {
+		return "", "", 0, false
+	}
+	if op.text == "=" && !p.is(i-1, tokPunct, ".") {
+		return "", "", 0, false
+	}
+	v := p.tokens[i+2]
+	if v.kind != tokString || !isCommand(p.tokens[i].text, v.text) {
+		return "", "", 0, false
+	}
+	return p.tokens[i].text, v.text, i + 2, true
+}
+
+// isCommand 命令的值是常量名的小写形式
+func isCommand(name, value string) bool {
+	return strings.Contains(value, "_") && strings.ToLower(name) == value
+}
+
+// comment 返回常量后面同一行的注释，没有时使用常量上一行单独的注释
+func (p *parser) comment(start, end int) string {
+	line := p.tokens[end].line
+	for j := end + 1; j < len(p.tokens) && p.tokens[j].line == line; j++ {
+		t := p.tokens[j]
+		if t.kind == tokComment {
+			return t.text
+		}
+		if t.kind != tokPunct || !slices.Contains([]string{")", ",", ";"}, t.text) {
+			break
+		}
+	}
+	// 跳过 e. 和 (
+	j := start - 1
+	for j >= 0 && p.tokens[j].kind != tokComment && (p.is(j, tokPunct, ".") || p.is(j, tokPunct, "(") || j == start-2 && p.tokens[j].kind == tokIdent) {
+		j--
+	}
+	if j < 0 || p.tokens[j].kind != tokComment || p.tokens[j].line < p.tokens[start].line-1 {
+		return ""
+	}
+	// 上一行末尾的注释属于上一个常量
+	if j > 0 && p.tokens[j-1].line == p.tokens[j].line {
+		return ""
+	}
+	return p.tokens[j].text
+}
+
+// object 解析从第 i 个单元 { 开始的对象字面量，返回参数和对象结束后的位置
+func (p *parser) object(i int, prefix string) ([]Field, int) {
+	var fields []Field
+	i++
+	for i < len(p.tokens) {
+		i = p.skip(i, ",")
+		if i >= len(p.tokens) || p.is(i, tokPunct, "}") {
+			return fields, i + 1
+		}
+		t := p.tokens[i]
+
+		// 展开运算符和计算属性名无法确定参数名，跳过
+		if t.kind == tokPunct {
+			i = p.value(i)
+			continue
+		}
+		key := t.text
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		// 简写属性 { targetId }
+		if j := p.skip(i + 1); p.is(j, tokPunct, ",") || p.is(j, tokPunct, "}") {
+			fields = append(fields, Field{Path: path, Value: key, Comment: p.trailingComment(i)})
+			i = j
+			continue
+		}
+		if !p.is(i+1, tokPunct, ":") {
+			// 方法定义等，跳过
+			i = p.value(i + 1)
+			continue
+		}
+
+		j := p.skip(i + 2)
+		if p.is(j, tokPunct, "{") {
+			nested, end := p.object(j, path)
+			if len(nested) == 0 {
+				fields = append(fields, Field{Path: path, Value: "{}", Literal: true, Comment: p.trailingComment(j)})
+			}
+			fields = append(fields, nested...)
+			i = end
+			continue
+		}
+		end := p.value(j)
+		fields = append(fields, p.field(path, j, end))
+		i = end
+	}
+	return fields, i
+}
+
+// value 跳过一个值表达式，返回 , 或 } 的位置
+func (p *parser) value(i int) int {
+	depth := 0
+	for ; i < len(p.tokens); i++ {
+		t := p.tokens[i]
+		if t.kind != tokPunct {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]":
+			depth--
+		case "}":
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// field 根据值表达式的单元生成参数
+func (p *parser) field(path string, start, end int) Field {
+	f := Field{Path: path}
+	var code []token
+	for _, t := range p.tokens[start:end] {
+		if t.kind == tokComment {
+			f.Comment = t.text
+		} else {
+			code = append(code, t)
+		}
+	}
+	var parts []string
+	for _, t := range code {
+		parts = append(parts, t.raw)
+	}
+	f.Value = strings.Join(parts, "")
+	if len(code) == 1 || len(code) == 2 && code[0].kind == tokPunct && code[0].text == "-" {
+		last := code[len(code)-1]
+		f.Literal = last.kind == tokString || last.kind == tokNumber ||
+			last.kind == tokIdent && (last.text == "true" || last.text == "false" || last.text == "null")
+	}
+	if f.Comment == "" && end > start {
+		f.Comment = p.trailingComment(end - 1)
+	}
+	return f
+}
+
+// trailingComment 返回值后面同一行的注释
+func (p *parser) trailingComment(i int) string {
+	line := p.tokens[i].line
+	for j := i + 1; j < len(p.tokens) && p.tokens[j].line == line; j++ {
+		t := p.tokens[j]
+		if t.kind == tokComment {
+			return t.text
+		}
+		if t.kind != tokPunct || t.text != "," {
+			break
+		}
+	}
+	return ""
+}
@@ -0,0 +1,239 @@
+package catalog
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind 词法单元类型
+type tokenKind int
+
+const (
+	tokIdent   tokenKind = iota // 标识符和关键字
+	tokString                   // 字符串，text 为去掉引号和转义后的内容
+	tokNumber                   // 数字
+	tokPunct                    // 标点和运算符，每个字符一个单元
+	tokComment                  // 注释，text 为去掉注释符号后的内容
+	tokOther                    // 模板字符串和正则表达式，内容不使用
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	raw  string // 源码中的原始文本
+	line int
+}
+
+// keywords 之后的 / 是正则表达式而不是除号
+var regexKeywords = map[string]bool{
+	"return": true, "typeof": true, "case": true, "do": true, "else": true,
+	"in": true, "instanceof": true, "new": true, "delete": true, "void": true, "throw": true,
+}
+
+// lex 将 JavaScript 源码分解为词法单元
+// 只需要足够准确地跳过字符串、注释、模板和正则表达式，不检查语法
+func lex(src string) []token {
+	var tokens []token
+	line := 1
+	i := 0
+	// regexAllowed 判断 / 是否开始正则表达式
+	regexAllowed := func() bool {
+		for j := len(tokens) - 1; j >= 0; j-- {
+			t := tokens[j]
+			switch t.kind {
+			case tokComment:
+				continue
+			case tokIdent:
+				return regexKeywords[t.text]
+			case tokString, tokNumber, tokOther:
+				return false
+			case tokPunct:
+				return t.text != ")" && t.text != "]" && t.text != "}"
+			}
+		}
+		return true
+	}
+	emit := func(kind tokenKind, text string, start, startLine int) {
+		tokens = append(tokens, token{kind: kind, text: text, raw: src[start:i], line: startLine})
+	}
+
+	for i < len(src) {
+		c := src[i]
+		start, startLine := i, line
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			i += end
+			emit(tokComment, strings.TrimSpace(src[start+2:i]), start, startLine)
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 4
+			}
+			body := strings.TrimSuffix(src[start+2:i], "*/")
+			line += strings.Count(body, "\n")
+			emit(tokComment, cleanBlockComment(body), start, startLine)
+		case c == '"' || c == '\'':
+			text := lexString(src, &i, &line)
+			emit(tokString, text, start, startLine)
+		case c == '`':
+			lexTemplate(src, &i, &line)
+			emit(tokOther, "", start, startLine)
+		case c == '/' && regexAllowed():
+			lexRegexp(src, &i)
+			emit(tokOther, "", start, startLine)
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			for i < len(src) && (isIdentPart(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			emit(tokNumber, src[start:i], start, startLine)
+		default:
+			r, size := utf8.DecodeRuneInString(src[i:])
+			if isIdentStart(r) {
+				for i < len(src) {
+					r, size := utf8.DecodeRuneInString(src[i:])
+					if !isIdentPart(r) {
+						break
+					}
+					i += size
+				}
+				emit(tokIdent, src[start:i], start, startLine)
+				continue
+			}
+			i += size
+			emit(tokPunct, src[start:i], start, startLine)
+		}
+	}
+	return tokens
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
+
+// lexString 读取引号字符串，返回处理转义后的内容
+func lexString(src string, i *int, line *int) string {
+	quote := src[*i]
+	*i++
+	var b strings.Builder
+	for *i < len(src) {
+		c := src[*i]
+		switch {
+		case c == quote:
+			*i++
+			return b.String()
+		case c == '\\' && *i+1 < len(src):
+			next := src[*i+1]
+			switch next {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '\n':
+				*line++
+			default:
+				b.WriteByte(next)
+			}
+			*i += 2
+		case c == '\n':
+			// 未闭合的字符串，在行尾结束
+			return b.String()
+		default:
+			b.WriteByte(c)
+			*i++
+		}
+	}
+	return b.String()
+}
+
+// lexTemplate 跳过模板字符串，包括 ${} 中嵌套的模板
+func lexTemplate(src string, i *int, line *int) {
+	*i++
+	for *i < len(src) {
+		switch src[*i] {
+		case '\\':
+			*i += 2
+			continue
+		case '\n':
+			*line++
+		case '`':
+			*i++
+			return
+		case '$':
+			if *i+1 < len(src) && src[*i+1] == '{' {
+				*i += 2
+				depth := 1
+				for *i < len(src) && depth > 0 {
+					switch src[*i] {
+					case '{':
+						depth++
+					case '}':
+						depth--
+					case '\n':
+						*line++
+					case '`':
+						lexTemplate(src, i, line)
+						continue
+					case '"', '\'':
+						lexString(src, i, line)
+						continue
+					}
+					*i++
+				}
+				continue
+			}
+		}
+		*i++
+	}
+}
+
+// lexRegexp 跳过正则表达式字面量
+func lexRegexp(src string, i *int) {
+	*i++
+	inClass := false
+	for *i < len(src) {
+		c := src[*i]
+		switch {
+		case c == '\\':
+			*i += 2
+			continue
+		case c == '\n':
+			return
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			*i++
+			for *i < len(src) && isIdentPart(rune(src[*i])) {
+				*i++
+			}
+			return
+		}
+		*i++
+	}
+}
+
+// cleanBlockComment 去掉块注释每行开头的 *
+func cleanBlockComment(body string) string {
+	lines := strings.Split(body, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(l), "*"))
+	}
+	return strings.TrimSpace(strings.Join(lines, " "))
+}
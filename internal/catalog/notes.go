@@ -0,0 +1,107 @@
+package catalog
+
+import (
+	"encoding/json"
+	"os"
+	"xyzw_study/internal/atomicfile"
+	"xyzw_study/internal/notes"
+)
+
+// StateFile 数据目录中记录上次提取写入的备注，用于判断备注是否被人工修改过
+const StateFile = "extracted_notes.json"
+
+// Notes 根据提取的命令生成备注
+// 命令备注使用常量附近的注释，没有注释时使用常量名；请求参数的备注写入 body.<参数路径>
+func Notes(commands []Command) notes.Notes {
+	n := notes.New()
+	for _, c := range commands {
+		note := c.Comment
+		if note == "" {
+			note = c.Name
+		}
+		n.CommandNotes[c.Cmd] = note
+
+		for _, f := range c.Fields {
+			note := f.Comment
+			if note == "" {
+				note = "请求参数"
+				if f.Literal {
+					note = "请求参数，客户端固定为 " + f.Value
+				}
+			}
+			if n.KeyNotes[c.Cmd] == nil {
+				n.KeyNotes[c.Cmd] = make(map[string]string)
+			}
+			n.KeyNotes[c.Cmd]["body."+f.Path] = note
+		}
+	}
+	return n
+}
+
+// Stats 写入备注的统计
+type Stats struct {
+	Added   int `json:"added"`   // 新增的备注
+	Updated int `json:"updated"` // 更新的上次提取的备注
+	Kept    int `json:"kept"`    // 人工修改或删除过，没有覆盖的备注
+}
+
+// Apply 将生成的备注写入 n，不覆盖人工编辑的备注
+//
+// prev 是上次提取写入的备注，当前备注与 prev 相同说明没有被人工修改过，可以更新
+// 上次提取写入后被人工删除的备注也不会重新添加
+func Apply(n *notes.Notes, prev, generated notes.Notes) Stats {
+	var stats Stats
+	apply := func(current map[string]string, prev map[string]string, key, note string) {
+		old, exists := current[key]
+		last, written := prev[key]
+		switch {
+		case old == note:
+		case !exists && !written:
+			current[key] = note
+			stats.Added++
+		case exists && written && old == last:
+			current[key] = note
+			stats.Updated++
+		default:
+			stats.Kept++
+		}
+	}
+
+	for cmd, note := range generated.CommandNotes {
+		apply(n.CommandNotes, prev.CommandNotes, cmd, note)
+	}
+	for cmd, keys := range generated.KeyNotes {
+		if n.KeyNotes[cmd] == nil {
+			n.KeyNotes[cmd] = make(map[string]string)
+		}
+		for key, note := range keys {
+			apply(n.KeyNotes[cmd], prev.KeyNotes[cmd], key, note)
+		}
+	}
+	return stats
+}
+
+// ReadState 读取上次提取写入的备注，文件不存在时返回空备注
+func ReadState(path string) (notes.Notes, error) {
+	n := notes.New()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return n, nil
+	}
+	if err != nil {
+		return n, err
+	}
+	if err := json.Unmarshal(data, &n); err != nil {
+		return n, err
+	}
+	return n.Clone(), nil
+}
+
+// WriteState 保存本次提取写入的备注
+func WriteState(path string, n notes.Notes) error {
+	data, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,408 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"xyzw_study/internal/crypto/bon"
+	"xyzw_study/internal/model"
+	"xyzw_study/internal/msgpath"
+	"xyzw_study/internal/seqmap"
+
+	"github.com/gorilla/websocket"
+)
+
+// 默认参数
+const (
+	DefaultHeartbeat         = 10 * time.Second
+	DefaultReconnectDelay    = time.Second
+	DefaultMaxReconnectDelay = 30 * time.Second
+)
+
+var (
+	// ErrClosed 表示客户端已关闭
+	ErrClosed = errors.New("客户端已关闭")
+	// ErrDisconnected 表示请求发出后连接断开，没有收到回复
+	ErrDisconnected = errors.New("连接已断开")
+)
+
+// Message 定义一条解码后的服务器消息
+type Message struct {
+	Cmd  string
+	Seq  int32 // 服务器序号
+	Ack  int32 // 服务器确认的客户端序号
+	Resp int32 // 所回复请求的客户端序号，推送消息为 0
+	Time int64
+	Body any
+}
+
+// Options 定义客户端参数
+type Options struct {
+	URL    string      // 游戏 WebSocket 地址，例如 wss://xxz-xyzw.hortorgames.com/...
+	Header http.Header // 握手时附带的请求头
+
+	// NetDialContext 自定义 TCP 连接，例如通过 upstream.Dialer 使用上游代理
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// InsecureSkipVerify 跳过证书校验，用于连接本地测试服务器
+	InsecureSkipVerify bool
+
+	Heartbeat         time.Duration // 心跳间隔，为 0 时使用默认值，小于 0 时不发送心跳
+	ReconnectDelay    time.Duration // 首次重连等待时间，之后每次翻倍
+	MaxReconnectDelay time.Duration // 最大重连等待时间
+	NoReconnect       bool          // 断开后不自动重连
+
+	// OnConnect 每次连接成功后调用，可以在这里重新登录
+	OnConnect func(c *Client)
+	Logger    *log.Logger // 为 nil 时不输出日志
+}
+
+// Client 使用独立的 WebSocket 连接与游戏服务器通信
+// 客户端自己维护 seq 和 ack，断线后自动重连并从 seq 1 重新开始
+type Client struct {
+	opts   Options
+	dialer *websocket.Dialer
+	pushes chan Message
+	closed chan struct{}
+
+	writeMu sync.Mutex // 保证分配序号和写入的顺序一致
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	ready     chan struct{} // 连接建立时关闭
+	seq       int32         // 最后发送的客户端序号
+	ack       int32         // 最后收到的服务器序号
+	pending   map[int32]chan Message
+	closeOnce sync.Once
+}
+
+// Dial 连接游戏服务器，首次连接失败时直接返回错误
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	if opts.Heartbeat == 0 {
+		opts.Heartbeat = DefaultHeartbeat
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = DefaultReconnectDelay
+	}
+	if opts.MaxReconnectDelay <= 0 {
+		opts.MaxReconnectDelay = DefaultMaxReconnectDelay
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(io.Discard, "", 0)
+	}
+
+	dialer := &websocket.Dialer{
+		NetDialContext:   opts.NetDialContext,
+		HandshakeTimeout: 10 * time.Second,
+	}
+	if opts.InsecureSkipVerify {
+		dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	c := &Client{
+		opts:    opts,
+		dialer:  dialer,
+		pushes:  make(chan Message, 256),
+		closed:  make(chan struct{}),
+		ready:   make(chan struct{}),
+		pending: make(map[int32]chan Message),
+	}
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go c.run(conn)
+	if opts.Heartbeat > 0 {
+		go c.heartbeat()
+	}
+	return c, nil
+}
+
+// Pushes 返回服务器推送消息的通道，通道满时丢弃新的推送
+func (c *Client) Pushes() <-chan Message {
+	return c.pushes
+}
+
+// Call 发送请求并等待对应 resp 的回复
+// 连接断开时会等待重连后再发送，请求发出后连接断开返回 ErrDisconnected
+func (c *Client) Call(ctx context.Context, cmd string, body any) (Message, error) {
+	ch := make(chan Message, 1)
+	seq, err := c.send(ctx, cmd, body, ch)
+	if err != nil {
+		return Message{}, err
+	}
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return Message{}, ErrDisconnected
+		}
+		return msg, nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+		return Message{}, ctx.Err()
+	case <-c.closed:
+		return Message{}, ErrClosed
+	}
+}
+
+// Send 发送请求但不等待回复，返回使用的客户端序号
+func (c *Client) Send(ctx context.Context, cmd string, body any) (int32, error) {
+	return c.send(ctx, cmd, body, nil)
+}
+
+// Close 关闭客户端，不再重连
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mu.Lock()
+		conn := c.conn
+		c.conn = nil
+		c.mu.Unlock()
+		if conn != nil {
+			err = conn.Close()
+		}
+	})
+	return err
+}
+
+// send 等待连接可用后分配序号并发送，reply 不为 nil 时登记等待回复
+func (c *Client) send(ctx context.Context, cmd string, body any, reply chan Message) (int32, error) {
+	conn, err := c.waitConn(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	if c.conn != conn {
+		// 等待期间连接已经更换，序号可能已经重置
+		c.mu.Unlock()
+		return 0, ErrDisconnected
+	}
+	c.seq++
+	seq := c.seq
+	ack := c.ack
+	if reply != nil {
+		c.pending[seq] = reply
+	}
+	c.mu.Unlock()
+
+	msg := model.XYMsg{
+		Ack:  int(ack),
+		Body: bon.EncodeToBytes(body),
+		Cmd:  cmd,
+		Seq:  seq,
+		Time: time.Now().UnixMilli(),
+	}
+	if err := c.write(conn, msg); err != nil {
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+		return 0, err
+	}
+	c.opts.Logger.Printf("Send => %s seq=%d ack=%d", cmd, seq, ack)
+	return seq, nil
+}
+
+// write 编码并写入一条消息，调用方需要持有 writeMu
+func (c *Client) write(conn *websocket.Conn, msg model.XYMsg) error {
+	data, err := bon.EncodeAndEncryptX(msg)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+// waitConn 等待连接可用
+func (c *Client) waitConn(ctx context.Context) (*websocket.Conn, error) {
+	for {
+		c.mu.Lock()
+		conn, ready := c.conn, c.ready
+		c.mu.Unlock()
+		if conn != nil {
+			return conn, nil
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.closed:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// connect 建立连接，成功后重置序号
+func (c *Client) connect(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := c.dialer.DialContext(ctx, c.opts.URL, c.opts.Header)
+	if err != nil {
+		return nil, fmt.Errorf("连接游戏服务器失败: %w", err)
+	}
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		// 重连期间客户端已关闭
+		c.mu.Unlock()
+		conn.Close()
+		return nil, ErrClosed
+	default:
+	}
+	c.conn = conn
+	c.seq = 0
+	c.ack = 0
+	close(c.ready)
+	c.mu.Unlock()
+	c.opts.Logger.Printf("已连接 %s", c.opts.URL)
+	if c.opts.OnConnect != nil {
+		go c.opts.OnConnect(c)
+	}
+	return conn, nil
+}
+
+// disconnect 标记连接断开，未完成的请求返回 ErrDisconnected
+func (c *Client) disconnect(conn *websocket.Conn) {
+	conn.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == conn {
+		c.conn = nil
+		c.ready = make(chan struct{})
+	}
+	for seq, ch := range c.pending {
+		close(ch)
+		delete(c.pending, seq)
+	}
+}
+
+// run 读取消息，连接断开后按退避时间重连
+func (c *Client) run(conn *websocket.Conn) {
+	for {
+		err := c.readLoop(conn)
+		c.disconnect(conn)
+		select {
+		case <-c.closed:
+			return
+		default:
+		}
+		c.opts.Logger.Printf("连接断开: %v", err)
+		if c.opts.NoReconnect {
+			c.Close()
+			return
+		}
+
+		delay := c.opts.ReconnectDelay
+		for {
+			select {
+			case <-time.After(delay):
+			case <-c.closed:
+				return
+			}
+			next, err := c.connect(context.Background())
+			if err == nil {
+				conn = next
+				break
+			}
+			c.opts.Logger.Printf("重连失败: %v", err)
+			delay *= 2
+			if delay > c.opts.MaxReconnectDelay {
+				delay = c.opts.MaxReconnectDelay
+			}
+		}
+	}
+}
+
+// readLoop 读取并分发服务器消息，直到连接出错
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		msg, err := decode(data)
+		if err != nil {
+			c.opts.Logger.Printf("解码消息失败: %v", err)
+			continue
+		}
+		c.opts.Logger.Printf("Recv <= %s seq=%d ack=%d resp=%d", msg.Cmd, msg.Seq, msg.Ack, msg.Resp)
+
+		c.mu.Lock()
+		if msg.Seq > c.ack {
+			c.ack = msg.Seq
+		}
+		var reply chan Message
+		if msg.Resp != 0 {
+			reply = c.pending[msg.Resp]
+			delete(c.pending, msg.Resp)
+		}
+		c.mu.Unlock()
+
+		switch {
+		case reply != nil:
+			reply <- msg
+		case msg.Cmd == seqmap.AckCmd:
+		default:
+			select {
+			case c.pushes <- msg:
+			default:
+				c.opts.Logger.Printf("推送队列已满，丢弃 %s", msg.Cmd)
+			}
+		}
+	}
+}
+
+// heartbeat 定时发送 _sys/ack 确认收到的服务器序号
+func (c *Client) heartbeat() {
+	ticker := time.NewTicker(c.opts.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.closed:
+			return
+		}
+		c.writeMu.Lock()
+		c.mu.Lock()
+		conn, ack := c.conn, c.ack
+		c.mu.Unlock()
+		if conn != nil {
+			if err := c.write(conn, model.XYMsg{Ack: int(ack), Cmd: seqmap.AckCmd, Time: time.Now().UnixMilli()}); err != nil {
+				c.opts.Logger.Printf("发送心跳失败: %v", err)
+			}
+		}
+		c.writeMu.Unlock()
+	}
+}
+
+// decode 解码 X 加密的服务器消息
+func decode(data []byte) (Message, error) {
+	m, err := bon.DecodeXWithBody(data)
+	if err != nil {
+		return Message{}, err
+	}
+	cmd, ok := m["cmd"].(string)
+	if !ok {
+		return Message{}, errors.New("消息缺少 cmd")
+	}
+	return Message{
+		Cmd:  cmd,
+		Seq:  int32(msgpath.Int(m["seq"])),
+		Ack:  int32(msgpath.Int(m["ack"])),
+		Resp: int32(msgpath.Int(m["resp"])),
+		Time: msgpath.Int(m["time"]),
+		Body: m["body"],
+	}, nil
+}
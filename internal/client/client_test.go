@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"xyzw_study/internal/mockserver"
+	"xyzw_study/internal/seqmap"
+)
+
+// startServer 启动模拟服务器并返回 WebSocket 地址
+func startServer(t *testing.T, s *mockserver.Server) string {
+	t.Helper()
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func dial(t *testing.T, opts Options) *Client {
+	t.Helper()
+	if opts.Heartbeat == 0 {
+		opts.Heartbeat = -1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func timeout(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestCall(t *testing.T) {
+	s := mockserver.New()
+	s.Handle("role_getroleinfo", func(req mockserver.Frame) []mockserver.Reply {
+		return []mockserver.Reply{{Cmd: "Role_GetRoleInfoResp", Body: req.Body}}
+	})
+	c := dial(t, Options{URL: startServer(t, s)})
+
+	resp, err := c.Call(timeout(t), "role_getroleinfo", map[string]any{"roleId": int32(42)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Cmd != "Role_GetRoleInfoResp" || resp.Resp != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Body.(map[string]any)["roleId"] != int32(42) {
+		t.Errorf("body not echoed: %v", resp.Body)
+	}
+
+	// 第二个请求带上收到的服务器序号
+	if _, err := c.Call(timeout(t), "role_getroleinfo", nil); err != nil {
+		t.Fatal(err)
+	}
+	received := s.Received()
+	if len(received) != 2 || received[1].Seq != 2 || received[1].Ack != 1 {
+		t.Fatalf("unexpected frames: %+v", received)
+	}
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	s := mockserver.New()
+	s.Default = func(req mockserver.Frame) []mockserver.Reply {
+		return []mockserver.Reply{{Cmd: req.Cmd + "Resp", Body: req.Body}}
+	}
+	c := dial(t, Options{URL: startServer(t, s)})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int32) {
+			defer wg.Done()
+			resp, err := c.Call(timeout(t), "echo", map[string]any{"i": i})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if got := resp.Body.(map[string]any)["i"]; got != i {
+				errs <- errors.New("response matched to wrong request")
+			}
+		}(int32(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if v := s.Violations(); len(v) != 0 {
+		t.Errorf("violations: %v", v)
+	}
+}
+
+func TestPushes(t *testing.T) {
+	s := mockserver.New()
+	s.Handle("system_buygold", func(req mockserver.Frame) []mockserver.Reply {
+		return []mockserver.Reply{
+			{Cmd: "System_BuyGoldResp"},
+			{Cmd: "SyncRewardResp", Body: map[string]any{"gold": int32(1)}, Push: true},
+		}
+	})
+	c := dial(t, Options{URL: startServer(t, s)})
+	if _, err := c.Call(timeout(t), "system_buygold", nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-c.Pushes():
+		if msg.Cmd != "SyncRewardResp" || msg.Resp != 0 {
+			t.Fatalf("unexpected push: %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no push received")
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	s := mockserver.New()
+	c := dial(t, Options{URL: startServer(t, s)})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Call(ctx, "unanswered", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	c.mu.Lock()
+	n := len(c.pending)
+	c.mu.Unlock()
+	if n != 0 {
+		t.Errorf("pending not cleaned up: %d", n)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	s := mockserver.New()
+	s.Respond("a", "AResp", nil)
+	c := dial(t, Options{URL: startServer(t, s), Heartbeat: 20 * time.Millisecond})
+	if _, err := c.Call(timeout(t), "a", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, f := range s.Received() {
+			if f.Cmd == seqmap.AckCmd && f.Ack == 1 {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no heartbeat acknowledging server seq 1: %+v", s.Received())
+}
+
+func TestReconnect(t *testing.T) {
+	s := mockserver.New()
+	s.Respond("a", "AResp", nil)
+	connects := make(chan struct{}, 4)
+	c := dial(t, Options{
+		URL:            startServer(t, s),
+		ReconnectDelay: 10 * time.Millisecond,
+		OnConnect:      func(*Client) { connects <- struct{}{} },
+	})
+	<-connects
+	first := <-s.Connected()
+
+	// 等待回复期间断开，请求返回 ErrDisconnected
+	s.Handle("slow", func(mockserver.Frame) []mockserver.Reply {
+		first.Close()
+		return nil
+	})
+	if _, err := c.Call(timeout(t), "a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Call(timeout(t), "slow", nil); !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("expected ErrDisconnected, got %v", err)
+	}
+
+	select {
+	case <-connects:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client did not reconnect")
+	}
+
+	// 重连后序号从 1 重新开始
+	resp, err := c.Call(timeout(t), "a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Resp != 1 {
+		t.Errorf("seq not reset after reconnect, resp = %d", resp.Resp)
+	}
+	if v := s.Violations(); len(v) != 0 {
+		t.Errorf("violations: %v", v)
+	}
+}
+
+func TestClose(t *testing.T) {
+	s := mockserver.New()
+	c := dial(t, Options{URL: startServer(t, s)})
+	c.Close()
+	if _, err := c.Call(timeout(t), "a", nil); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestDialFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := Dial(ctx, Options{URL: "ws://127.0.0.1:1/"}); err == nil {
+		t.Fatal("expected dial error")
+	}
+}
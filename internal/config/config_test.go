@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile 在临时目录写入配置文件并返回路径
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadPrecedence 命令行参数优先于环境变量，环境变量优先于配置文件，配置文件优先于默认值
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "xyzw.yaml", `
+proxyPort: 1000
+webAddr: 127.0.0.1:2000
+dataDir: file-data
+logPath: file.log
+wsQueueSize: 64
+`)
+	t.Setenv("XYZW_WEB_ADDR", "127.0.0.1:3000")
+	t.Setenv("XYZW_DATA_DIR", "env-data")
+	t.Setenv("XYZW_WS_QUEUE_SIZE", "512")
+	t.Setenv("XYZW_GAME_HOSTS", "a.example.com, *.b.example.com")
+
+	// 命令行显式指定的值即使等于默认值也会覆盖环境变量
+	cfg, err := Load([]string{"-config", file, "-data-dir", "flag-data", "-ws-queue-size", "256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"proxyPort", cfg.ProxyPort, 1000},
+		{"webAddr", cfg.WebAddr, "127.0.0.1:3000"},
+		{"dataDir", cfg.DataDir, "flag-data"},
+		{"logPath", cfg.LogPath, "file.log"},
+		{"wsQueueSize", cfg.WSQueueSize, 256},
+		{"wsOverflow", cfg.WSOverflow, "drop-oldest"},
+		{"gameHosts", strings.Join(cfg.GameHosts, ","), "a.example.com,*.b.example.com"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+// TestLoadJSONFromEnv 配置文件可以通过 XYZW_CONFIG 指定，非 YAML 扩展名按 JSON 解析
+func TestLoadJSONFromEnv(t *testing.T) {
+	t.Setenv("XYZW_CONFIG", writeFile(t, "xyzw.json", `{"proxyMode": "pac", "metricsToken": "scrape"}`))
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ProxyMode != ProxyModePAC || cfg.MetricsToken != "scrape" || cfg.ProxyPort != Default().ProxyPort {
+		t.Errorf("cfg = %+v", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		args func(t *testing.T) []string
+		want string
+	}{
+		{"unknown yaml key", func(t *testing.T) []string {
+			return []string{"-config", writeFile(t, "xyzw.yaml", "proxyPrt: 1000\n")}
+		}, "proxyPrt"},
+		{"unknown json key", func(t *testing.T) []string {
+			return []string{"-config", writeFile(t, "xyzw.json", `{"webadress": "127.0.0.1:1"}`)}
+		}, "webadress"},
+		{"invalid yaml value", func(t *testing.T) []string {
+			return []string{"-config", writeFile(t, "xyzw.yml", "proxyPort: abc\n")}
+		}, "解析配置文件失败"},
+		{"invalid json value", func(t *testing.T) []string {
+			return []string{"-config", writeFile(t, "xyzw.json", `{"systemProxy": "yes"}`)}
+		}, "解析配置文件失败"},
+		{"missing file", func(t *testing.T) []string {
+			return []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}
+		}, "读取配置文件失败"},
+		{"invalid env", func(t *testing.T) []string {
+			t.Setenv("XYZW_PROXY_PORT", "port")
+			return nil
+		}, "XYZW_PROXY_PORT"},
+		{"validate", func(t *testing.T) []string {
+			return []string{"-proxy-mode", "auto"}
+		}, "未知的系统代理模式"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Load(c.args(t))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("err = %v, want %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default config: %v", err)
+	}
+	cases := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"proxy mode", func(c *Config) { c.ProxyMode = "auto" }, "未知的系统代理模式"},
+		{"game hosts", func(c *Config) { c.GameHosts = nil }, "没有配置游戏域名"},
+		{"overflow", func(c *Config) { c.WSOverflow = "block" }, "未知的推送队列溢出策略"},
+		{"queue size", func(c *Config) { c.WSQueueSize = 0 }, "推送队列长度必须大于 0"},
+		{"upstream", func(c *Config) { c.UpstreamProxy = "ftp://127.0.0.1:21" }, ""},
+	}
+	for _, c := range cases {
+		cfg := Default()
+		c.modify(&cfg)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
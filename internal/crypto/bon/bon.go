@@ -3,6 +3,9 @@ package bon
 import (
 	"encoding/json"
 	"errors"
+	"math"
+	"sync"
+	"time"
 	"xyzw_study/internal/crypto"
 )
 
@@ -10,6 +13,9 @@ var (
 	// 全局单例解码器和编码器
 	globalDecoder = NewBonDecoder()
 	globalEncoder = NewBonEncoder()
+	// 抓包回调、调试队列和导出接口会并发调用，需要串行访问单例
+	decoderMu sync.Mutex
+	encoderMu sync.Mutex
 )
 
 // Decode 解码二进制数据为Go对象
@@ -18,12 +24,16 @@ func _Decode(data []byte) (interface{}, error) {
 		return nil, errors.New("empty data")
 	}
 
+	decoderMu.Lock()
+	defer decoderMu.Unlock()
 	globalDecoder.Reset(data)
 	return globalDecoder.Decode()
 }
 
 // Encode 将Go对象编码为二进制数据
 func _Encode(value interface{}, copy bool) ([]byte, error) {
+	encoderMu.Lock()
+	defer encoderMu.Unlock()
 	globalEncoder.Reset()
 	if err := globalEncoder.Encode(value); err != nil {
 		return nil, err
@@ -164,3 +174,85 @@ func DecodeFromBytes(data []byte) interface{} {
 	}
 	return result
 }
+
+// DecodeXWithBody 解密并解码X消息，并将 body 解码为对象，保留BON原始类型
+// 与 DecodeX 不同，该函数不会修改传入的数据
+func DecodeXWithBody(data []byte) (map[string]any, error) {
+	input := make([]byte, len(data))
+	copy(input, data)
+	result, err := DecryptXAndDecode(input)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := result.(map[string]any)
+	if !ok {
+		return nil, errors.New("not a message object")
+	}
+	if body, ok := m["body"].([]byte); ok {
+		m["body"] = DecodeFromBytes(body)
+	}
+	return m, nil
+}
+
+// TypeName 返回值对应的BON类型名称
+func TypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "Null"
+	case int, int8, int16, int32, uint8, uint16:
+		return "Int32"
+	case int64, uint, uint32, uint64, Int64:
+		return "Long"
+	case float32, Float:
+		return "Float"
+	case float64, Double:
+		return "Double"
+	case string:
+		return "String"
+	case bool:
+		return "Boolean"
+	case []byte:
+		return "Binary"
+	case map[string]any:
+		return "Object"
+	case []any:
+		return "Array"
+	case time.Time:
+		return "DateTime"
+	default:
+		return "Unknown"
+	}
+}
+
+// FromJSON 将 encoding/json (UseNumber) 解码得到的值转换为BON解码器使用的类型
+// 整数按范围转换为 int32 或 int64，小数转换为 float64
+func FromJSON(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			if i >= math.MinInt32 && i <= math.MaxInt32 {
+				return int32(i)
+			}
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case float64:
+		if val == math.Trunc(val) && val >= math.MinInt32 && val <= math.MaxInt32 {
+			return int32(val)
+		}
+		return val
+	case map[string]any:
+		for k, item := range val {
+			val[k] = FromJSON(item)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = FromJSON(item)
+		}
+		return val
+	default:
+		return v
+	}
+}
@@ -3,6 +3,7 @@ package bon
 import (
 	"encoding/hex"
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -54,3 +55,51 @@ func TestEncode(t *testing.T) {
 	}
 	fmt.Println(hex.EncodeToString(data2))
 }
+
+func TestEncodeNumberRoundTrip(t *testing.T) {
+	cases := []struct {
+		in   any
+		want any
+	}{
+		{float32(3), int32(3)},
+		{float32(1.5), float32(1.5)},
+		{float64(7), int32(7)},
+		{float64(2.25), float64(2.25)},
+		{float64(-0.5), float64(-0.5)},
+		{float64(5000000000), int64(5000000000)},
+		{float64(-5000000000), int64(-5000000000)},
+		{Double(7), float64(7)},
+		{Double(0), float64(0)},
+		{Float(3), float32(3)},
+	}
+	for _, c := range cases {
+		got := DecodeFromBytes(EncodeToBytes(map[string]any{"v": c.in}))
+		m, ok := got.(map[string]any)
+		if !ok {
+			t.Fatalf("%v: decode failed: %v", c.in, got)
+		}
+		if m["v"] != c.want {
+			t.Errorf("%T(%v): got %T(%v), want %T(%v)", c.in, c.in, m["v"], m["v"], c.want, c.want)
+		}
+	}
+}
+
+func TestEncodeDecodeConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				want := fmt.Sprintf("item_%d_%d", i, j)
+				data := EncodeToBytes(map[string]any{"cmd": want, "seq": int32(j)})
+				m, ok := DecodeFromBytes(data).(map[string]any)
+				if !ok || m["cmd"] != want || m["seq"] != int32(j) {
+					t.Errorf("round trip mismatch: %v", m)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
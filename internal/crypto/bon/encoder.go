@@ -1,11 +1,18 @@
 package bon
 
 import (
+	"math"
 	"reflect"
 	"time"
 	"xyzw_study/internal/crypto"
 )
 
+// Double 总是按 Double 编码的浮点数，整数值也不压缩为 Int，用于保持解码得到的 float64 的类型
+type Double float64
+
+// Float 总是按 Float 编码的浮点数，用于保持解码得到的 float32 的类型
+type Float float32
+
 // BonEncoder 实现二进制对象表示法的编码器
 type BonEncoder struct {
 	dw     *crypto.DataWriter
@@ -35,10 +42,24 @@ func (e *BonEncoder) EncodeNumber(val interface{}) error {
 		return e.EncodeInt(int(reflect.ValueOf(v).Int()))
 	case int64, uint, uint32, uint64:
 		return e.EncodeLong(reflect.ValueOf(v).Int())
+	case Double:
+		return e.EncodeDouble(float64(v))
+	case Float:
+		return e.EncodeFloat(float32(v))
 	case float32:
-		return e.EncodeInt(int(v))
+		// 整数值按 Int 编码，保留小数时按 Float 编码
+		if v == float32(math.Trunc(float64(v))) {
+			return e.EncodeInt(int(v))
+		}
+		return e.EncodeFloat(v)
 	case float64:
 		// 检查是否可以表示为更小的类型
+		if v != math.Trunc(v) {
+			return e.EncodeDouble(v)
+		}
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return e.EncodeLong(int64(v))
+		}
 		intVal := int(v)
 		return e.EncodeInt(intVal)
 	default:
@@ -72,11 +72,8 @@ func (w *DataWriter) WriteInt32(val int) {
 // WriteInt64 写入一个64位整数
 func (w *DataWriter) WriteInt64(val int64) {
 	w.WriteInt32(int(val))
-	if val < 0 {
-		w.WriteInt32(^int(val / 4294967296))
-	} else {
-		w.WriteInt32(int(val / 4294967296))
-	}
+	// 高32位按向下取整，与 ReadInt64 中"低位无符号 + 高位*2^32"对应
+	w.WriteInt32(int(val >> 32))
 }
 
 // WriteFloat32 写入一个32位浮点数
@@ -0,0 +1,259 @@
+package diagram
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"xyzw_study/internal/msgpath"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/record"
+)
+
+// 默认限制
+const (
+	DefaultMaxMessages = 200 // 时序图最多包含的消息数，过多时图无法阅读
+	DefaultMaxFields   = 4   // 每条消息最多显示的关键字段数
+	maxValueLen        = 24  // 字段值最多显示的字符数
+)
+
+// 时序图中的参与者
+const (
+	Client = "client" // 游戏客户端
+	Proxy  = "proxy"  // xyzw，调试注入的消息从这里发出
+	Server = "server" // 游戏服务器
+)
+
+// 消息的类型
+const (
+	KindRequest  = "request"  // 客户端请求
+	KindResponse = "response" // 找到对应请求的服务器回复
+	KindPush     = "push"     // 服务器推送，或找不到请求的回复
+)
+
+// Options 生成时序图的选项
+type Options struct {
+	Title       string
+	Since       time.Time // 只包含这个时间之后的消息，为零值时不限制
+	Until       time.Time // 只包含这个时间之前的消息，为零值时不限制
+	SeqFrom     int64     // 请求序号范围，见 Build，都为 0 时不限制
+	SeqTo       int64
+	Fields      []string // 显示的关键字段，为 msgpath 模式，例如 body.itemId、body.*.id，不以 body. 开头时自动加上
+	Exclude     []string // 不包含的命令
+	MaxMessages int      // 不大于 0 时使用 DefaultMaxMessages
+	MaxFields   int      // 不大于 0 时使用 DefaultMaxFields
+}
+
+// Diagram 一段会话的时序图
+type Diagram struct {
+	Title     string    `json:"title"`
+	Proxy     bool      `json:"proxy"` // 是否有调试注入的消息，有时显示 xyzw 参与者
+	Messages  []Message `json:"messages"`
+	Truncated int       `json:"truncated"` // 超出 MaxMessages 没有包含的消息数
+}
+
+// Message 时序图中的一条消息
+type Message struct {
+	Time     time.Time `json:"time"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Kind     string    `json:"kind"`
+	Cmd      string    `json:"cmd"`
+	Seq      int64     `json:"seq,omitempty"`     // 抓包中的序号
+	Request  string    `json:"request,omitempty"` // 回复对应的请求命令
+	Latency  float64   `json:"latency,omitempty"` // 回复的延迟，单位毫秒
+	Injected bool      `json:"injected,omitempty"`
+	Note     string    `json:"note,omitempty"`   // 命令备注
+	Fields   []Field   `json:"fields,omitempty"` // 关键字段
+}
+
+// Field 消息中的一个关键字段
+type Field struct {
+	Path  string `json:"path"`
+	Name  string `json:"name"` // 键备注，没有时为路径的最后一段
+	Value string `json:"value"`
+}
+
+// item 一条消息及其所属请求在抓包中的序号，请求为自身的序号，推送为 0
+type item struct {
+	Message
+	reqSeq int64
+}
+
+// Build 根据一个会话的全部抓包记录生成时序图，records 按时间顺序排列
+//
+// 回复通过 record.Matcher 与请求配对，所以需要传入会话从开始的全部记录，再用 opts 选择其中一段：
+// 序号范围选择抓包中序号在 [SeqFrom, SeqTo] 内的客户端请求及其回复，以及这段时间内的服务器推送；
+// SeqTo 为 0 时不限制上限
+func Build(records []record.Record, n notes.Notes, opts Options) Diagram {
+	if opts.MaxMessages <= 0 {
+		opts.MaxMessages = DefaultMaxMessages
+	}
+	if opts.MaxFields <= 0 {
+		opts.MaxFields = DefaultMaxFields
+	}
+	patterns := make([]string, len(opts.Fields))
+	for i, f := range opts.Fields {
+		if f != "body" && !strings.HasPrefix(f, "body.") {
+			f = "body." + f
+		}
+		patterns[i] = f
+	}
+
+	type reqKey struct {
+		injected bool
+		seq      int64
+	}
+	captured := make(map[reqKey]int64) // Matcher 记录的请求 -> 抓包中的序号
+	matcher := record.NewMatcher()
+	var items []item
+	for _, rec := range records {
+		msg, err := rec.Value()
+		if err != nil {
+			continue
+		}
+		cmd, _ := msg["cmd"].(string)
+		it := item{Message: Message{
+			Time:     rec.Time,
+			Cmd:      cmd,
+			Seq:      msgpath.Int(msg["seq"]),
+			Injected: rec.Injected,
+		}}
+		if rec.Call == "client" {
+			req := matcher.Request(cmd, it.Seq, rec.Time, rec.Injected)
+			captured[reqKey{req.Injected, req.Seq}] = it.Seq
+			it.Kind, it.From, it.To, it.reqSeq = KindRequest, Client, Server, it.Seq
+			if rec.Injected {
+				it.From = Proxy
+			}
+		} else if req, ok := matcher.Find(msgpath.Int(msg["resp"]), rec.Injected); ok && !rec.Forged {
+			it.Kind, it.From, it.To = KindResponse, Server, Client
+			if req.Injected {
+				it.To = Proxy
+			}
+			it.Request = req.Cmd
+			it.reqSeq = captured[reqKey{req.Injected, req.Seq}]
+			if d := rec.Time.Sub(req.Time); d >= 0 {
+				it.Latency = float64(d.Microseconds()) / 1000
+			}
+		} else {
+			// 调试伪造的服务器消息的 resp 是客户端看到的序号，不与请求配对，作为代理发出的推送
+			it.Kind, it.From, it.To = KindPush, Server, Client
+			if rec.Injected {
+				it.From = Proxy
+			}
+		}
+		if slices.Contains(opts.Exclude, cmd) || !inTime(rec.Time, opts) {
+			continue
+		}
+		it.Note = n.CommandNotes[cmd]
+		it.Fields = fields(msg, n.KeyNotes[cmd], patterns, opts.MaxFields)
+		items = append(items, it)
+	}
+
+	d := Diagram{Title: opts.Title, Messages: []Message{}}
+	for _, it := range selectSeq(items, opts.SeqFrom, opts.SeqTo) {
+		if len(d.Messages) >= opts.MaxMessages {
+			d.Truncated++
+			continue
+		}
+		if it.From == Proxy || it.To == Proxy {
+			d.Proxy = true
+		}
+		d.Messages = append(d.Messages, it.Message)
+	}
+	return d
+}
+
+func inTime(t time.Time, opts Options) bool {
+	if !opts.Since.IsZero() && t.Before(opts.Since) {
+		return false
+	}
+	return opts.Until.IsZero() || !t.After(opts.Until)
+}
+
+// selectSeq 选择序号范围内的请求和回复，以及第一条和最后一条之间的推送
+func selectSeq(items []item, from, to int64) []item {
+	if from == 0 && to == 0 {
+		return items
+	}
+	in := func(it item) bool {
+		return it.Kind != KindPush && it.reqSeq >= from && (to == 0 || it.reqSeq <= to)
+	}
+	first, last := -1, -1
+	for i, it := range items {
+		if in(it) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	var selected []item
+	for i := first; i >= 0 && i <= last; i++ {
+		if it := items[i]; it.Kind == KindPush || in(it) {
+			selected = append(selected, it)
+		}
+	}
+	return selected
+}
+
+// fields 返回消息中的关键字段：匹配 patterns 的字段和有键备注的字段，按路径排序
+func fields(msg map[string]any, keyNotes map[string]string, patterns []string, max int) []Field {
+	if len(patterns) == 0 && len(keyNotes) == 0 {
+		return nil
+	}
+	var result []Field
+	for path, v := range msgpath.Flatten(msg) {
+		if !strings.HasPrefix(path, "body.") {
+			continue
+		}
+		note, noted := keyNotes[path]
+		if !noted && !slices.ContainsFunc(patterns, func(p string) bool { return msgpath.Match(p, path) }) {
+			continue
+		}
+		name := note
+		if name == "" {
+			name = path[strings.LastIndex(path, ".")+1:]
+		}
+		result = append(result, Field{Path: path, Name: name, Value: shorten(msgpath.String(v))})
+	}
+	slices.SortFunc(result, func(a, b Field) int { return strings.Compare(a.Path, b.Path) })
+	if len(result) > max {
+		result = result[:max]
+	}
+	return result
+}
+
+func shorten(s string) string {
+	if r := []rune(s); len(r) > maxValueLen {
+		return string(r[:maxValueLen]) + "…"
+	}
+	return s
+}
+
+// ParseSeqRange 解析序号范围，格式为 "10-25"、"10-" 或 "10"
+func ParseSeqRange(s string) (from, to int64, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, nil
+	}
+	a, b, isRange := strings.Cut(s, "-")
+	if from, err = strconv.ParseInt(strings.TrimSpace(a), 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("序号范围格式错误: %s", s)
+	}
+	if !isRange {
+		return from, from, nil
+	}
+	if b = strings.TrimSpace(b); b != "" {
+		if to, err = strconv.ParseInt(b, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("序号范围格式错误: %s", s)
+		}
+		if to < from {
+			return 0, 0, errors.New("序号范围的结束小于开始: " + s)
+		}
+	}
+	return from, to, nil
+}
@@ -0,0 +1,164 @@
+package diagram
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/record"
+)
+
+func records() []record.Record {
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	s := time.Second
+	return []record.Record{
+		{Time: at, Call: "client", Msg: json.RawMessage(`{"cmd":"heart_beat","seq":1}`)},
+		{Time: at.Add(20 * time.Millisecond), Call: "server", Msg: json.RawMessage(`{"cmd":"HeartBeatResp","resp":1}`)},
+		{Time: at.Add(2 * s), Call: "client", Injected: true, Msg: json.RawMessage(`{"cmd":"role_getroleinfo","seq":2}`)},
+		{Time: at.Add(2*s + 10*time.Millisecond), Call: "server", Injected: true, Msg: json.RawMessage(`{"cmd":"Role_GetRoleInfoResp","resp":2}`)},
+		// 注入后客户端的序号 2 在抓包中是 3，回复的 resp 仍为 2
+		{Time: at.Add(3 * s), Call: "client", Msg: json.RawMessage(`{"cmd":"skyhorse_signup","seq":3,"body":{"activityId":7}}`)},
+		{Time: at.Add(3*s + 30*time.Millisecond), Call: "server", Msg: json.RawMessage(`{"cmd":"SkyHorse_SignUpResp","resp":2,"body":{"ok":true}}`)},
+		{Time: at.Add(4 * s), Call: "client", Msg: json.RawMessage(`{"cmd":"skyhorse_choosebuff","seq":4,"body":{"buffId":301}}`)},
+		{Time: at.Add(4*s + 50*time.Millisecond), Call: "server", Msg: json.RawMessage(`{"cmd":"SyncRewardResp","body":{"role":{"gold":10}}}`)},
+		{Time: at.Add(4*s + 60*time.Millisecond), Call: "server", Msg: json.RawMessage(`{"cmd":"SkyHorse_ChooseBuffResp","resp":3}`)},
+		{Time: at.Add(5 * s), Call: "client", Msg: json.RawMessage(`{"cmd":"skyhorse_fight","seq":5}`)},
+		{Time: at.Add(6 * s), Call: "server", Msg: json.RawMessage(`{"cmd":"SyncRewardResp","body":{"role":{"gold":20}}}`)},
+		{Time: at.Add(7 * s), Call: "server", Msg: json.RawMessage(`{"cmd":"SkyHorse_FightResp","resp":4}`)},
+	}
+}
+
+func summary(d Diagram) string {
+	var parts []string
+	for _, m := range d.Messages {
+		s := m.From + ">" + m.To + ":" + m.Cmd
+		if m.Request != "" {
+			s += "<" + m.Request
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestBuild(t *testing.T) {
+	n := notes.New()
+	n.CommandNotes["skyhorse_choosebuff"] = "选择增益"
+	n.KeyNotes["skyhorse_choosebuff"] = map[string]string{"body.buffId": "增益"}
+
+	d := Build(records(), n, Options{Exclude: []string{"heart_beat", "HeartBeatResp"}})
+	want := "proxy>server:role_getroleinfo,server>proxy:Role_GetRoleInfoResp<role_getroleinfo," +
+		"client>server:skyhorse_signup,server>client:SkyHorse_SignUpResp<skyhorse_signup," +
+		"client>server:skyhorse_choosebuff,server>client:SyncRewardResp,server>client:SkyHorse_ChooseBuffResp<skyhorse_choosebuff," +
+		"client>server:skyhorse_fight,server>client:SyncRewardResp,server>client:SkyHorse_FightResp<skyhorse_fight"
+	if got := summary(d); got != want || !d.Proxy {
+		t.Errorf("messages = %s", got)
+	}
+	buff := d.Messages[4]
+	if buff.Note != "选择增益" || len(buff.Fields) != 1 || buff.Fields[0].Name != "增益" || buff.Fields[0].Value != "301" {
+		t.Errorf("choosebuff = %+v", buff)
+	}
+
+	// 抓包序号 4~5：选择增益到战斗，包含其间的推送，不包含之前的报名
+	d = Build(records(), n, Options{SeqFrom: 4, SeqTo: 5, Fields: []string{"activityId"}})
+	want = "client>server:skyhorse_choosebuff,server>client:SyncRewardResp,server>client:SkyHorse_ChooseBuffResp<skyhorse_choosebuff," +
+		"client>server:skyhorse_fight,server>client:SyncRewardResp,server>client:SkyHorse_FightResp<skyhorse_fight"
+	if got := summary(d); got != want || d.Proxy {
+		t.Errorf("seq range = %s", got)
+	}
+
+	d = Build(records(), n, Options{SeqFrom: 3, SeqTo: 3, Fields: []string{"activityId"}})
+	if got := summary(d); got != "client>server:skyhorse_signup,server>client:SkyHorse_SignUpResp<skyhorse_signup" {
+		t.Errorf("single seq = %s", got)
+	}
+	if f := d.Messages[0].Fields; len(f) != 1 || f[0].Path != "body.activityId" {
+		t.Errorf("fields = %+v", f)
+	}
+	if d.Messages[1].Latency != 30 {
+		t.Errorf("latency = %v", d.Messages[1].Latency)
+	}
+
+	at := time.Date(2026, 10, 19, 10, 0, 5, 0, time.UTC)
+	d = Build(records(), n, Options{Since: at, MaxMessages: 2})
+	if got := summary(d); got != "client>server:skyhorse_fight,server>client:SyncRewardResp" || d.Truncated != 1 {
+		t.Errorf("since = %s truncated = %d", got, d.Truncated)
+	}
+}
+
+// TestBuildForged 调试伪造的服务器消息显示为代理发出的推送，不与注入的请求配对
+func TestBuildForged(t *testing.T) {
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+	records := []record.Record{
+		// 注入的请求占用服务器看到的 seq 1
+		{Time: at, Call: "client", Injected: true, Msg: json.RawMessage(`{"cmd":"role_getroleinfo","seq":1}`)},
+		// 客户端的 seq 1 在抓包中是 2，伪造的回复 resp 为客户端看到的 1
+		{Time: at.Add(10 * ms), Call: "client", Msg: json.RawMessage(`{"cmd":"item_openpack","seq":2}`)},
+		{Time: at.Add(20 * ms), Call: "server", Injected: true, Forged: true, Msg: json.RawMessage(`{"cmd":"Item_OpenBoxResp","resp":1}`)},
+		{Time: at.Add(30 * ms), Call: "server", Injected: true, Msg: json.RawMessage(`{"cmd":"Role_GetRoleInfoResp","resp":1}`)},
+	}
+	d := Build(records, notes.New(), Options{})
+	want := "proxy>server:role_getroleinfo,client>server:item_openpack,proxy>client:Item_OpenBoxResp," +
+		"server>proxy:Role_GetRoleInfoResp<role_getroleinfo"
+	if got := summary(d); got != want {
+		t.Errorf("messages = %s", got)
+	}
+	if forged := d.Messages[2]; forged.Kind != KindPush || forged.Latency != 0 {
+		t.Errorf("forged = %+v", forged)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	n := notes.New()
+	n.CommandNotes["skyhorse_signup"] = "报名; <天马>"
+	d := Build(records(), n, Options{Title: "天马", SeqFrom: 3, SeqTo: 3, Fields: []string{"activityId"}})
+
+	var b strings.Builder
+	if err := Write(&b, d, FormatMermaid); err != nil {
+		t.Fatal(err)
+	}
+	want := "sequenceDiagram\n" +
+		"    title 天马\n" +
+		"    participant C as 客户端\n" +
+		"    participant S as 服务器\n" +
+		"    C->>S: skyhorse_signup seq=3（报名#59; #60;天马#62;）<br/>activityId=7\n" +
+		"    S-->>C: SkyHorse_SignUpResp 30ms\n"
+	if b.String() != want {
+		t.Errorf("mermaid:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := Write(&b, d, FormatPlantUML); err != nil {
+		t.Fatal(err)
+	}
+	want = "@startuml\n" +
+		"title 天马\n" +
+		"participant \"客户端\" as C\n" +
+		"participant \"服务器\" as S\n" +
+		"C -> S : skyhorse_signup seq=3（报名; <天马>）\\nactivityId=7\n" +
+		"S --> C : SkyHorse_SignUpResp 30ms\n" +
+		"@enduml\n"
+	if b.String() != want {
+		t.Errorf("plantuml:\n%s", b.String())
+	}
+}
+
+func TestParseSeqRange(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		from, to int64
+		err      bool
+	}{
+		{"", 0, 0, false},
+		{"10", 10, 10, false},
+		{"10-25", 10, 25, false},
+		{" 10 - ", 10, 0, false},
+		{"25-10", 0, 0, true},
+		{"a-b", 0, 0, true},
+	} {
+		from, to, err := ParseSeqRange(tc.in)
+		if from != tc.from || to != tc.to || (err != nil) != tc.err {
+			t.Errorf("%q = %d, %d, %v", tc.in, from, to, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package diagram
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 时序图格式
+const (
+	FormatMermaid  = "mermaid"
+	FormatPlantUML = "plantuml"
+)
+
+// Write 按格式输出时序图，format 为 FormatMermaid 或 FormatPlantUML
+func Write(w io.Writer, d Diagram, format string) error {
+	switch format {
+	case FormatMermaid:
+		return Mermaid(w, d)
+	case FormatPlantUML, "puml":
+		return PlantUML(w, d)
+	default:
+		return fmt.Errorf("不支持的时序图格式: %s", format)
+	}
+}
+
+// 参与者在图中的标识和显示名称
+var participants = []struct{ id, alias, name string }{
+	{Client, "C", "客户端"},
+	{Proxy, "P", "xyzw"},
+	{Server, "S", "服务器"},
+}
+
+func alias(id string) string {
+	for _, p := range participants {
+		if p.id == id {
+			return p.alias
+		}
+	}
+	return id
+}
+
+// Mermaid 输出 Mermaid 格式的时序图
+func Mermaid(w io.Writer, d Diagram) error {
+	var b strings.Builder
+	b.WriteString("sequenceDiagram\n")
+	if d.Title != "" {
+		fmt.Fprintf(&b, "    title %s\n", mermaidText(d.Title))
+	}
+	for _, p := range participants {
+		if p.id != Proxy || d.Proxy {
+			fmt.Fprintf(&b, "    participant %s as %s\n", p.alias, p.name)
+		}
+	}
+	for _, m := range d.Messages {
+		arrow := "->>"
+		switch m.Kind {
+		case KindResponse:
+			arrow = "-->>"
+		case KindPush:
+			arrow = "-)"
+		}
+		lines := label(m)
+		for i := range lines {
+			lines[i] = mermaidText(lines[i])
+		}
+		fmt.Fprintf(&b, "    %s%s%s: %s\n", alias(m.From), arrow, alias(m.To), strings.Join(lines, "<br/>"))
+	}
+	if d.Truncated > 0 {
+		fmt.Fprintf(&b, "    Note over C,S: 另有 %d 条消息没有显示\n", d.Truncated)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// PlantUML 输出 PlantUML 格式的时序图
+func PlantUML(w io.Writer, d Diagram) error {
+	var b strings.Builder
+	b.WriteString("@startuml\n")
+	if d.Title != "" {
+		fmt.Fprintf(&b, "title %s\n", plantText(d.Title))
+	}
+	for _, p := range participants {
+		if p.id != Proxy || d.Proxy {
+			fmt.Fprintf(&b, "participant \"%s\" as %s\n", p.name, p.alias)
+		}
+	}
+	for _, m := range d.Messages {
+		arrow := "->"
+		switch m.Kind {
+		case KindResponse:
+			arrow = "-->"
+		case KindPush:
+			arrow = "->>"
+		}
+		lines := label(m)
+		for i := range lines {
+			lines[i] = plantText(lines[i])
+		}
+		fmt.Fprintf(&b, "%s %s %s : %s\n", alias(m.From), arrow, alias(m.To), strings.Join(lines, `\n`))
+	}
+	if d.Truncated > 0 {
+		fmt.Fprintf(&b, "note over C, S : 另有 %d 条消息没有显示\n", d.Truncated)
+	}
+	b.WriteString("@enduml\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// label 返回消息的标签，第一行为命令、序号和备注，之后每行一个关键字段
+func label(m Message) []string {
+	head := m.Cmd
+	if m.Kind == KindRequest && m.Seq != 0 {
+		head += " seq=" + strconv.FormatInt(m.Seq, 10)
+	}
+	if m.Note != "" {
+		head += "（" + m.Note + "）"
+	}
+	if m.Kind == KindResponse {
+		head += " " + strconv.FormatFloat(m.Latency, 'f', 0, 64) + "ms"
+	}
+	lines := []string{head}
+	for _, f := range m.Fields {
+		lines = append(lines, f.Name+"="+f.Value)
+	}
+	return lines
+}
+
+// mermaidText 转义 Mermaid 消息文本中有特殊含义的字符
+func mermaidText(s string) string {
+	return strings.NewReplacer(
+		"#", "#35;",
+		";", "#59;",
+		"<", "#60;",
+		">", "#62;",
+		"\n", " ",
+		"\r", "",
+	).Replace(s)
+}
+
+// plantText 转义 PlantUML 消息文本，避免 \n 等被当作换行
+func plantText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		"\n", " ",
+		"\r", "",
+	).Replace(s)
+}
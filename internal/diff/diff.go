@@ -0,0 +1,242 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"xyzw_study/internal/crypto/bon"
+	"xyzw_study/internal/record"
+)
+
+// Kind 定义差异类型
+type Kind string
+
+const (
+	// Added 表示新增字段
+	Added Kind = "added"
+	// Removed 表示删除字段
+	Removed Kind = "removed"
+	// Changed 表示值发生变化
+	Changed Kind = "changed"
+	// TypeChanged 表示BON类型发生变化，例如 Int32 变为 Long
+	TypeChanged Kind = "type"
+)
+
+// DefaultIgnore 默认忽略的易变字段
+var DefaultIgnore = []string{"seq", "ack", "time", "resp"}
+
+// Change 定义一处字段差异
+type Change struct {
+	Path    string `json:"path"`
+	Kind    Kind   `json:"kind"`
+	OldType string `json:"oldType,omitempty"`
+	NewType string `json:"newType,omitempty"`
+	Old     any    `json:"old,omitempty"`
+	New     any    `json:"new,omitempty"`
+}
+
+// Options 定义比较选项
+type Options struct {
+	// Ignore 忽略的字段路径，路径段之间用 "." 分隔，"*" 匹配任意一段
+	Ignore []string
+}
+
+// CmdDiff 定义同一命令在两个抓包文件中的差异
+type CmdDiff struct {
+	Cmd     string   `json:"cmd"`
+	Kind    Kind     `json:"kind,omitempty"` // 只在一侧出现时为 added 或 removed
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Values 比较两个解码后的值
+func Values(a, b any, opts Options) []Change {
+	var changes []Change
+	walk(nil, a, b, opts, &changes)
+	return changes
+}
+
+// Records 按命令比较两个抓包文件中的消息，每个命令取第一次出现的消息
+func Records(a, b []record.Record, opts Options) ([]CmdDiff, error) {
+	left, err := firstByCmd(a)
+	if err != nil {
+		return nil, err
+	}
+	right, err := firstByCmd(b)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make(map[string]bool)
+	for cmd := range left {
+		cmds[cmd] = true
+	}
+	for cmd := range right {
+		cmds[cmd] = true
+	}
+	names := make([]string, 0, len(cmds))
+	for cmd := range cmds {
+		names = append(names, cmd)
+	}
+	sort.Strings(names)
+
+	var result []CmdDiff
+	for _, cmd := range names {
+		l, inLeft := left[cmd]
+		r, inRight := right[cmd]
+		switch {
+		case !inLeft:
+			result = append(result, CmdDiff{Cmd: cmd, Kind: Added})
+		case !inRight:
+			result = append(result, CmdDiff{Cmd: cmd, Kind: Removed})
+		default:
+			if changes := Values(l, r, opts); len(changes) > 0 {
+				result = append(result, CmdDiff{Cmd: cmd, Changes: changes})
+			}
+		}
+	}
+	return result, nil
+}
+
+func firstByCmd(records []record.Record) (map[string]map[string]any, error) {
+	result := make(map[string]map[string]any)
+	for _, rec := range records {
+		msg, err := rec.Value()
+		if err != nil {
+			return nil, err
+		}
+		cmd, _ := msg["cmd"].(string)
+		if cmd == "" {
+			continue
+		}
+		if _, ok := result[cmd]; !ok {
+			result[cmd] = msg
+		}
+	}
+	return result, nil
+}
+
+func walk(path []string, a, b any, opts Options, changes *[]Change) {
+	if ignored(path, opts.Ignore) {
+		return
+	}
+	p := strings.Join(path, ".")
+	ta, tb := bon.TypeName(a), bon.TypeName(b)
+	if ta != tb {
+		*changes = append(*changes, Change{Path: p, Kind: TypeChanged, OldType: ta, NewType: tb, Old: a, New: b})
+		return
+	}
+
+	switch va := a.(type) {
+	case map[string]any:
+		vb := b.(map[string]any)
+		for _, k := range sortedKeys(va, vb) {
+			child := append(path[:len(path):len(path)], k)
+			x, inA := va[k]
+			y, inB := vb[k]
+			switch {
+			case !inB:
+				if !ignored(child, opts.Ignore) {
+					*changes = append(*changes, Change{Path: strings.Join(child, "."), Kind: Removed, OldType: bon.TypeName(x), Old: x})
+				}
+			case !inA:
+				if !ignored(child, opts.Ignore) {
+					*changes = append(*changes, Change{Path: strings.Join(child, "."), Kind: Added, NewType: bon.TypeName(y), New: y})
+				}
+			default:
+				walk(child, x, y, opts, changes)
+			}
+		}
+	case []any:
+		vb := b.([]any)
+		n := len(va)
+		if len(vb) > n {
+			n = len(vb)
+		}
+		for i := 0; i < n; i++ {
+			child := append(path[:len(path):len(path)], strconv.Itoa(i))
+			switch {
+			case i >= len(vb):
+				*changes = append(*changes, Change{Path: strings.Join(child, "."), Kind: Removed, OldType: bon.TypeName(va[i]), Old: va[i]})
+			case i >= len(va):
+				*changes = append(*changes, Change{Path: strings.Join(child, "."), Kind: Added, NewType: bon.TypeName(vb[i]), New: vb[i]})
+			default:
+				walk(child, va[i], vb[i], opts, changes)
+			}
+		}
+	default:
+		if !equal(a, b) {
+			*changes = append(*changes, Change{Path: p, Kind: Changed, OldType: ta, NewType: tb, Old: a, New: b})
+		}
+	}
+}
+
+func equal(a, b any) bool {
+	switch va := a.(type) {
+	case []byte:
+		return bytes.Equal(va, b.([]byte))
+	case time.Time:
+		return va.Equal(b.(time.Time))
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+func sortedKeys(a, b map[string]any) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ignored 判断路径是否匹配忽略规则
+func ignored(path []string, patterns []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	for _, pattern := range patterns {
+		segs := strings.Split(pattern, ".")
+		if len(segs) != len(path) {
+			continue
+		}
+		match := true
+		for i, seg := range segs {
+			if seg != "*" && seg != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Format 将差异格式化为便于阅读的文本
+func Format(changes []Change) string {
+	var sb strings.Builder
+	for _, c := range changes {
+		switch c.Kind {
+		case Added:
+			fmt.Fprintf(&sb, "  + %s (%s): %v\n", c.Path, c.NewType, c.New)
+		case Removed:
+			fmt.Fprintf(&sb, "  - %s (%s): %v\n", c.Path, c.OldType, c.Old)
+		case Changed:
+			fmt.Fprintf(&sb, "  ~ %s: %v -> %v\n", c.Path, c.Old, c.New)
+		case TypeChanged:
+			fmt.Fprintf(&sb, "  ! %s: %s -> %s (%v -> %v)\n", c.Path, c.OldType, c.NewType, c.Old, c.New)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,85 @@
+package diff
+
+import (
+	"testing"
+	"xyzw_study/internal/record"
+)
+
+func TestValues(t *testing.T) {
+	a := map[string]any{
+		"cmd":  "role_getroleinfo",
+		"seq":  int32(1),
+		"time": int64(1742068792116),
+		"body": map[string]any{
+			"roleId": int32(100),
+			"name":   "a",
+			"items":  []any{int32(1), int32(2)},
+			"old":    true,
+		},
+	}
+	b := map[string]any{
+		"cmd":  "role_getroleinfo",
+		"seq":  int32(7),
+		"time": int64(1742068799999),
+		"body": map[string]any{
+			"roleId": int64(100),
+			"name":   "b",
+			"items":  []any{int32(1), int32(2), int32(3)},
+			"new":    int32(5),
+		},
+	}
+
+	changes := Values(a, b, Options{Ignore: DefaultIgnore})
+	want := map[string]Kind{
+		"body.items.2": Added,
+		"body.name":    Changed,
+		"body.new":     Added,
+		"body.old":     Removed,
+		"body.roleId":  TypeChanged,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d:\n%s", len(changes), len(want), Format(changes))
+	}
+	for _, c := range changes {
+		if want[c.Path] != c.Kind {
+			t.Errorf("%s: got kind %s, want %s", c.Path, c.Kind, want[c.Path])
+		}
+	}
+	for _, c := range changes {
+		if c.Path == "body.roleId" && (c.OldType != "Int32" || c.NewType != "Long") {
+			t.Errorf("body.roleId: got %s -> %s", c.OldType, c.NewType)
+		}
+	}
+
+	if changes := Values(a, b, Options{}); len(changes) != len(want)+2 {
+		t.Errorf("without ignore got %d changes:\n%s", len(changes), Format(changes))
+	}
+}
+
+func TestRecords(t *testing.T) {
+	a := []record.Record{
+		{Call: "server", Msg: []byte(`{"cmd":"Role_GetRoleInfoResp","seq":1,"body":{"level":10}}`)},
+		{Call: "server", Msg: []byte(`{"cmd":"SyncRewardResp","seq":2,"body":{}}`)},
+	}
+	b := []record.Record{
+		{Call: "server", Msg: []byte(`{"cmd":"Role_GetRoleInfoResp","seq":5,"body":{"level":11}}`)},
+		{Call: "server", Msg: []byte(`{"cmd":"Item_OpenBoxResp","seq":6,"body":{}}`)},
+	}
+
+	result, err := Records(a, b, Options{Ignore: DefaultIgnore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 3 {
+		t.Fatalf("got %d cmd diffs, want 3: %+v", len(result), result)
+	}
+	if result[0].Cmd != "Item_OpenBoxResp" || result[0].Kind != Added {
+		t.Errorf("unexpected %+v", result[0])
+	}
+	if result[1].Cmd != "Role_GetRoleInfoResp" || len(result[1].Changes) != 1 || result[1].Changes[0].Path != "body.level" {
+		t.Errorf("unexpected %+v", result[1])
+	}
+	if result[2].Cmd != "SyncRewardResp" || result[2].Kind != Removed {
+		t.Errorf("unexpected %+v", result[2])
+	}
+}
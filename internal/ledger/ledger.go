@@ -0,0 +1,345 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xyzw_study/internal/msgpath"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/rolestate"
+)
+
+// pushWindow 推送消息（resp 为 0）归到这段时间内最近的一个请求
+const pushWindow = 3 * time.Second
+
+// DefaultLimit 每个会话保留的明细条数，超过后只保留最近的明细，汇总不受影响
+const DefaultLimit = 100000
+
+// Entry 一次道具或资源的变化
+type Entry struct {
+	Time    time.Time `json:"time"`          // 消息时间
+	Session string    `json:"session"`       // 会话ID
+	Cmd     string    `json:"cmd"`           // 引起变化的请求命令，找不到请求时为带来变化的消息命令
+	Seq     int64     `json:"seq,omitempty"` // 请求在客户端看到的序号，找不到请求时为 0
+	Source  string    `json:"source"`        // 带来变化的服务器消息命令
+	Kind    string    `json:"kind"`          // rolestate.KindItem 或 rolestate.KindResource
+	Key     string    `json:"key"`           // 道具ID或资源名
+	Delta   float64   `json:"delta"`         // 变化量
+	Balance float64   `json:"balance"`       // 变化后的数量
+}
+
+// Total 一个命令引起的一种道具或资源的汇总
+type Total struct {
+	Cmd   string  `json:"cmd"`   // 请求命令
+	Kind  string  `json:"kind"`  // 类型
+	Key   string  `json:"key"`   // 道具ID或资源名
+	Count int     `json:"count"` // 变化次数
+	Gain  float64 `json:"gain"`  // 增加的总量
+	Loss  float64 `json:"loss"`  // 减少的总量，为正数
+	Net   float64 `json:"net"`   // 净变化
+}
+
+// Summary 一个会话的汇总
+type Summary struct {
+	Session  string         `json:"session"`  // 会话ID
+	Requests map[string]int `json:"requests"` // 各命令的请求次数，用于计算掉落率
+	Totals   []Total        `json:"totals"`   // 按命令、类型和ID排序
+}
+
+// Ledger 按会话记录道具和资源的变化以及引起变化的请求，可以被多个协程并发使用
+//
+// 服务器回复通过 resp 找到对应的客户端请求，见 record.Matcher；推送消息归到 3 秒内最近的一个请求，
+// 没有请求时使用推送消息自己的命令
+type Ledger struct {
+	limit   int
+	tracker *rolestate.Tracker // Records 使用的角色状态
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+type session struct {
+	matcher *record.Matcher
+	counts  map[string]int
+	entries []Entry
+	totals  map[totalKey]*Total
+}
+
+type totalKey struct {
+	cmd, kind, key string
+}
+
+// New 创建 Ledger，limit 为每个会话保留的明细条数，不大于 0 时使用 DefaultLimit
+func New(limit int) *Ledger {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &Ledger{limit: limit, tracker: rolestate.New(0), sessions: make(map[string]*session)}
+}
+
+func (l *Ledger) session(id string) *session {
+	s := l.sessions[id]
+	if s == nil {
+		s = &session{matcher: record.NewMatcher(), counts: make(map[string]int), totals: make(map[totalKey]*Total)}
+		l.sessions[id] = s
+	}
+	return s
+}
+
+// Request 记录一个客户端请求，seq 为抓包中的序号，injected 为是否为调试注入的消息
+func (l *Ledger) Request(sessionID string, at time.Time, seq int64, cmd string, injected bool) {
+	if cmd == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.session(sessionID)
+	s.counts[cmd]++
+	s.matcher.Request(cmd, seq, at, injected)
+}
+
+// cause 查找引起服务器消息的请求
+func (s *session) cause(c rolestate.Change, injected bool) (string, int64) {
+	if c.Resp > 0 {
+		if req, ok := s.matcher.Find(c.Resp, injected); ok {
+			return req.Cmd, req.Seq
+		}
+		return c.Cmd, 0
+	}
+	if last, ok := s.matcher.Last(); ok {
+		if d := c.Time.Sub(last.Time); d >= 0 && d <= pushWindow {
+			return last.Cmd, last.Seq
+		}
+	}
+	return c.Cmd, 0
+}
+
+// Changes 记录一条服务器消息带来的角色状态变化，只记录道具数量和角色数值字段，返回记录的明细
+// injected 为消息是否为注入请求的回复
+func (l *Ledger) Changes(changes []rolestate.Change, injected bool) []Entry {
+	var entries []Entry
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, c := range changes {
+		if !counted(c) {
+			continue
+		}
+		e := Entry{
+			Time:    c.Time,
+			Session: c.Session,
+			Source:  c.Cmd,
+			Kind:    c.Kind,
+			Key:     c.Key,
+			Delta:   c.Delta,
+		}
+		// rolestate 中的数值统一为 int64 或 float64
+		switch n := c.New.(type) {
+		case int64:
+			e.Balance = float64(n)
+		case float64:
+			e.Balance = n
+		}
+		s := l.session(c.Session)
+		e.Cmd, e.Seq = s.cause(c, injected)
+
+		s.entries = append(s.entries, e)
+		if len(s.entries) > l.limit {
+			s.entries = slices.Clone(s.entries[len(s.entries)-l.limit:])
+		}
+		k := totalKey{e.Cmd, e.Kind, e.Key}
+		t := s.totals[k]
+		if t == nil {
+			t = &Total{Cmd: e.Cmd, Kind: e.Kind, Key: e.Key}
+			s.totals[k] = t
+		}
+		t.Count++
+		t.Net += e.Delta
+		if e.Delta > 0 {
+			t.Gain += e.Delta
+		} else {
+			t.Loss -= e.Delta
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// counted 判断变化是否计入账本：道具的数量，或角色的数值字段
+func counted(c rolestate.Change) bool {
+	if c.Delta == 0 {
+		return false
+	}
+	switch c.Kind {
+	case rolestate.KindResource:
+		return true
+	case rolestate.KindItem:
+		return c.Path == "items."+c.Key || c.Path == "items."+c.Key+".quantity"
+	}
+	return false
+}
+
+// Sessions 返回有记录的会话，按会话ID排序
+func (l *Ledger) Sessions() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Sorted(maps.Keys(l.sessions))
+}
+
+// Entries 返回会话的明细，session 为空时返回所有会话的明细
+func (l *Ledger) Entries(sessionID string) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if sessionID != "" {
+		if s := l.sessions[sessionID]; s != nil {
+			return slices.Clone(s.entries)
+		}
+		return []Entry{}
+	}
+	entries := []Entry{}
+	for _, id := range slices.Sorted(maps.Keys(l.sessions)) {
+		entries = append(entries, l.sessions[id].entries...)
+	}
+	return entries
+}
+
+// Summary 返回会话的汇总，session 为空时合并所有会话
+func (l *Ledger) Summary(sessionID string) Summary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sum := Summary{Session: sessionID, Requests: make(map[string]int), Totals: []Total{}}
+	totals := make(map[totalKey]*Total)
+	for id, s := range l.sessions {
+		if sessionID != "" && id != sessionID {
+			continue
+		}
+		for cmd, n := range s.counts {
+			sum.Requests[cmd] += n
+		}
+		for k, t := range s.totals {
+			if cur := totals[k]; cur != nil {
+				cur.Count += t.Count
+				cur.Gain += t.Gain
+				cur.Loss += t.Loss
+				cur.Net += t.Net
+			} else {
+				c := *t
+				totals[k] = &c
+			}
+		}
+	}
+	for _, t := range totals {
+		sum.Totals = append(sum.Totals, *t)
+	}
+	slices.SortFunc(sum.Totals, func(a, b Total) int {
+		if c := strings.Compare(a.Cmd, b.Cmd); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		return compareKey(a.Key, b.Key)
+	})
+	return sum
+}
+
+// compareKey 数字ID按数值排序
+func compareKey(a, b string) int {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// Records 将抓包记录加入账本，用于分析保存的抓包文件，可以多次调用加入多个文件
+// 记录没有会话ID时使用 defaultSession，调试伪造的服务器消息不是真实的变化，不加入账本
+func (l *Ledger) Records(records []record.Record, defaultSession string) {
+	for _, rec := range records {
+		if rec.Forged {
+			continue
+		}
+		id := rec.Session
+		if id == "" {
+			id = defaultSession
+		}
+		msg, err := rec.Value()
+		if err != nil {
+			continue
+		}
+		if rec.Call == "client" {
+			cmd, _ := msg["cmd"].(string)
+			l.Request(id, rec.Time, msgpath.Int(msg["seq"]), cmd, rec.Injected)
+			continue
+		}
+		l.Changes(l.tracker.Apply(id, rec.Time, msg), rec.Injected)
+	}
+}
+
+// NameFunc 返回道具ID或资源名对应的名称，没有时返回空字符串
+type NameFunc func(kind, key string) string
+
+// WriteCSV 以 CSV 输出明细，names 可以为 nil
+func WriteCSV(w io.Writer, entries []Entry, names NameFunc) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "session", "cmd", "seq", "source", "kind", "key", "name", "delta", "balance"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Time.Format(time.RFC3339Nano),
+			e.Session,
+			e.Cmd,
+			strconv.FormatInt(e.Seq, 10),
+			e.Source,
+			e.Kind,
+			e.Key,
+			name(names, e.Kind, e.Key),
+			formatFloat(e.Delta),
+			formatFloat(e.Balance),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteTotalsCSV 以 CSV 输出汇总，每行带上该命令的请求次数
+func WriteTotalsCSV(w io.Writer, sum Summary, names NameFunc) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"cmd", "requests", "kind", "key", "name", "count", "gain", "loss", "net"})
+	for _, t := range sum.Totals {
+		cw.Write([]string{
+			t.Cmd,
+			strconv.Itoa(sum.Requests[t.Cmd]),
+			t.Kind,
+			t.Key,
+			name(names, t.Kind, t.Key),
+			strconv.Itoa(t.Count),
+			formatFloat(t.Gain),
+			formatFloat(t.Loss),
+			formatFloat(t.Net),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func name(names NameFunc, kind, key string) string {
+	if names == nil {
+		return ""
+	}
+	return names(kind, key)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
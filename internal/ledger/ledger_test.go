@@ -0,0 +1,127 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"xyzw_study/internal/record"
+)
+
+func TestRecords(t *testing.T) {
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	records := []record.Record{
+		{Time: at, Call: "server", Msg: json.RawMessage(`{"cmd":"Role_GetRoleInfoResp","resp":1,"body":{"role":{"gold":100,"level":10,"items":{"3010":{"itemId":3010,"quantity":5}}}}}`)},
+	}
+	// 开 3 次箱子，每次消耗 1 个 3010，其中两次掉落 1001
+	for i := 0; i < 3; i++ {
+		seq := i + 2
+		sent := at.Add(time.Duration(i+1) * time.Minute)
+		records = append(records, record.Record{Time: sent, Call: "client", Msg: json.RawMessage(`{"cmd":"item_openpack","seq":` + strconv.Itoa(seq) + `,"body":{"itemId":3010}}`)})
+		items := `"3010":{"quantity":` + strconv.Itoa(4-i) + `}`
+		if i < 2 {
+			items += `,"1001":{"itemId":1001,"quantity":` + strconv.Itoa(i+1) + `}`
+		}
+		records = append(records, record.Record{Time: sent.Add(100 * time.Millisecond), Call: "server",
+			Msg: json.RawMessage(`{"cmd":"Item_OpenBoxResp","resp":` + strconv.Itoa(seq) + `,"body":{"role":{"items":{` + items + `}}}}`)})
+	}
+	// 请求后推送的金币变化归到最近的请求，很久以后的推送使用推送自己的命令
+	records = append(records,
+		record.Record{Time: at.Add(3*time.Minute + time.Second), Call: "server", Msg: json.RawMessage(`{"cmd":"SyncRewardResp","body":{"role":{"gold":150}}}`)},
+		record.Record{Time: at.Add(time.Hour), Call: "server", Msg: json.RawMessage(`{"cmd":"SyncRewardResp","body":{"role":{"gold":120}}}`)},
+	)
+
+	l := New(0)
+	l.Records(records, "file")
+	sum := l.Summary("file")
+	if sum.Requests["item_openpack"] != 3 {
+		t.Errorf("requests = %v", sum.Requests)
+	}
+	got := map[string]Total{}
+	for _, tot := range sum.Totals {
+		got[tot.Cmd+"/"+tot.Key] = tot
+	}
+	if tot := got["item_openpack/1001"]; tot.Count != 2 || tot.Gain != 2 {
+		t.Errorf("1001 = %+v", tot)
+	}
+	if tot := got["item_openpack/3010"]; tot.Count != 3 || tot.Loss != 3 || tot.Net != -3 {
+		t.Errorf("3010 = %+v", tot)
+	}
+	if tot := got["item_openpack/gold"]; tot.Gain != 50 {
+		t.Errorf("gold after request = %+v", tot)
+	}
+	if tot := got["SyncRewardResp/gold"]; tot.Loss != 30 {
+		t.Errorf("gold push = %+v", tot)
+	}
+	if len(sum.Totals) != 4 {
+		t.Errorf("totals = %+v", sum.Totals)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, l.Entries(""), func(kind, key string) string {
+		if key == "1001" {
+			return "金币袋"
+		}
+		return ""
+	}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 8 || !strings.Contains(lines[1], "item_openpack,2,Item_OpenBoxResp,item,1001,金币袋,1,1") {
+		t.Errorf("csv = %s", buf.String())
+	}
+}
+
+// TestRecordsInjected 注入请求之后，抓包中客户端请求的 seq 比回复的 resp 大，仍然归到正确的请求
+func TestRecordsInjected(t *testing.T) {
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	records := []record.Record{
+		{Time: at, Call: "server", Msg: json.RawMessage(`{"cmd":"Role_GetRoleInfoResp","resp":1,"body":{"role":{"gold":100,"diamond":10}}}`)},
+		{Time: at.Add(time.Second), Call: "client", Msg: json.RawMessage(`{"cmd":"item_openpack","seq":2}`)},
+		// 注入的请求占用服务器看到的 seq 3，回复的 resp 为 3
+		{Time: at.Add(2 * time.Second), Call: "client", Injected: true, Msg: json.RawMessage(`{"cmd":"system_buygold","seq":3}`)},
+		{Time: at.Add(2*time.Second + 10*time.Millisecond), Call: "server", Injected: true, Msg: json.RawMessage(`{"cmd":"System_BuyGoldResp","resp":3,"body":{"role":{"gold":200}}}`)},
+		// 客户端的 seq 3 在抓包中是 4，转发给客户端的回复 resp 为 3
+		{Time: at.Add(3 * time.Second), Call: "client", Msg: json.RawMessage(`{"cmd":"hero_upgrade","seq":4}`)},
+		{Time: at.Add(3*time.Second + 10*time.Millisecond), Call: "server", Msg: json.RawMessage(`{"cmd":"Hero_UpgradeResp","resp":3,"body":{"role":{"gold":150}}}`)},
+		{Time: at.Add(4 * time.Second), Call: "server", Msg: json.RawMessage(`{"cmd":"Item_OpenBoxResp","resp":2,"body":{"role":{"diamond":15}}}`)},
+	}
+
+	l := New(0)
+	l.Records(records, "file")
+	got := map[string]Total{}
+	for _, tot := range l.Summary("file").Totals {
+		got[tot.Cmd+"/"+tot.Key] = tot
+	}
+	if tot := got["system_buygold/gold"]; tot.Gain != 100 {
+		t.Errorf("injected = %+v", tot)
+	}
+	if tot := got["hero_upgrade/gold"]; tot.Loss != 50 {
+		t.Errorf("hero_upgrade = %+v", tot)
+	}
+	if tot := got["item_openpack/diamond"]; tot.Gain != 5 {
+		t.Errorf("item_openpack = %+v", tot)
+	}
+	if len(got) != 3 {
+		t.Errorf("totals = %+v", got)
+	}
+}
+
+// TestRecordsForged 调试伪造的服务器消息不记入账本，也不影响之后的变化
+func TestRecordsForged(t *testing.T) {
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	records := []record.Record{
+		{Time: at, Call: "server", Msg: json.RawMessage(`{"cmd":"Role_GetRoleInfoResp","resp":1,"body":{"role":{"gold":100}}}`)},
+		{Time: at.Add(time.Second), Call: "server", Injected: true, Forged: true, Msg: json.RawMessage(`{"cmd":"Role_GetRoleInfoResp","resp":1,"body":{"role":{"gold":999}}}`)},
+		{Time: at.Add(2 * time.Second), Call: "server", Msg: json.RawMessage(`{"cmd":"SyncRewardResp","body":{"role":{"gold":150}}}`)},
+	}
+
+	l := New(0)
+	l.Records(records, "file")
+	entries := l.Entries("file")
+	if len(entries) != 1 || entries[0].Cmd != "SyncRewardResp" || entries[0].Delta != 50 {
+		t.Errorf("entries = %+v", entries)
+	}
+}
@@ -0,0 +1,311 @@
+// Package metrics 实现运行指标的记录和 OpenMetrics 文本格式输出，只包含本项目用到的计数器、仪表和直方图
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType OpenMetrics 文本格式的 Content-Type
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// LatencyBuckets 请求延迟直方图的默认桶，单位秒
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default 默认的注册表，/metrics 输出其中的全部指标
+var Default = NewRegistry()
+
+// family 一个指标族
+type family interface {
+	name() string
+	write(b *strings.Builder)
+}
+
+// Registry 指标注册表，可以被多个协程并发使用
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// NewRegistry 创建空的注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register 注册指标族，名称重复时 panic，指标通常在包初始化时注册
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, cur := range r.families {
+		if cur.name() == f.name() {
+			panic("metrics: 重复注册指标 " + f.name())
+		}
+	}
+	r.families = append(r.families, f)
+}
+
+// Write 以 OpenMetrics 文本格式输出全部指标，按名称排序
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+	slices.SortFunc(families, func(a, b family) int { return strings.Compare(a.name(), b.name()) })
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+	b.WriteString("# EOF\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// meta 指标族的名称、说明和标签名
+type meta struct {
+	Name   string
+	Help   string
+	Labels []string
+}
+
+func (m *meta) name() string { return m.Name }
+
+func (m *meta) header(b *strings.Builder, typ, unit string) {
+	fmt.Fprintf(b, "# TYPE %s %s\n", m.Name, typ)
+	if unit != "" {
+		fmt.Fprintf(b, "# UNIT %s %s\n", m.Name, unit)
+	}
+	fmt.Fprintf(b, "# HELP %s %s\n", m.Name, escapeHelp(m.Help))
+}
+
+// labels 格式化标签，extra 为额外的标签名和值，例如直方图的 le
+func (m *meta) labels(values []string, extra ...string) string {
+	if len(m.Labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var parts []string
+	for i, name := range m.Labels {
+		parts = append(parts, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// series 按标签值保存一个指标族中的各个序列
+type series[T any] struct {
+	meta
+	newValue func() *T
+
+	mu     sync.RWMutex
+	values map[string]*entry[T]
+}
+
+type entry[T any] struct {
+	labels []string
+	value  *T
+}
+
+func (s *series[T]) with(values []string) *T {
+	if len(values) != len(s.Labels) {
+		panic(fmt.Sprintf("metrics: %s 需要 %d 个标签值，传入了 %d 个", s.Name, len(s.Labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s.mu.RLock()
+	e := s.values[key]
+	s.mu.RUnlock()
+	if e != nil {
+		return e.value
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e = s.values[key]; e == nil {
+		e = &entry[T]{labels: slices.Clone(values), value: s.newValue()}
+		s.values[key] = e
+	}
+	return e.value
+}
+
+// each 按标签值排序遍历各个序列
+func (s *series[T]) each(fn func(values []string, v *T)) {
+	s.mu.RLock()
+	entries := make([]*entry[T], 0, len(s.values))
+	for _, e := range s.values {
+		entries = append(entries, e)
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(entries, func(a, b *entry[T]) int { return slices.Compare(a.labels, b.labels) })
+	for _, e := range entries {
+		fn(e.labels, e.value)
+	}
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc 加 1
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add 加 n
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+
+// Value 返回当前值
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	series[Counter]
+}
+
+// NewCounterVec 在注册表中创建带标签的计数器，name 不带 _total 后缀，输出时自动加上
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{series[Counter]{
+		meta:     meta{Name: name, Help: help, Labels: labels},
+		newValue: func() *Counter { return &Counter{} },
+		values:   make(map[string]*entry[Counter]),
+	}}
+	r.register(c)
+	return c
+}
+
+// With 返回标签值对应的计数器，标签值的个数与创建时的标签名相同
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(values)
+}
+
+func (c *CounterVec) write(b *strings.Builder) {
+	c.header(b, "counter", "")
+	c.each(func(values []string, v *Counter) {
+		fmt.Fprintf(b, "%s_total%s %d\n", c.Name, c.labels(values), v.Value())
+	})
+}
+
+// funcMetric 读取时调用函数得到值的计数器或仪表，用于已经在别处统计的数值
+type funcMetric struct {
+	meta
+	typ string
+	fn  func() float64
+}
+
+// NewCounterFunc 在注册表中创建计数器，值由 fn 提供，fn 的返回值只能增加
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{meta: meta{Name: name, Help: help}, typ: "counter", fn: fn})
+}
+
+// NewGaugeFunc 在注册表中创建仪表，值由 fn 提供
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{meta: meta{Name: name, Help: help}, typ: "gauge", fn: fn})
+}
+
+func (f *funcMetric) write(b *strings.Builder) {
+	f.header(b, f.typ, "")
+	suffix := ""
+	if f.typ == "counter" {
+		suffix = "_total"
+	}
+	fmt.Fprintf(b, "%s%s %s\n", f.Name, suffix, formatFloat(f.fn()))
+}
+
+// Histogram 直方图
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64 // 每个桶的计数，不累加，最后一个为 +Inf
+	sum    float64
+	count  uint64
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.buckets, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	series[Histogram]
+	unit    string
+	buckets []float64
+}
+
+// NewHistogramVec 在注册表中创建带标签的直方图，buckets 为各个桶的上限，unit 可以为空
+// 有 unit 时 name 需要以 _unit 结尾，例如 latency_seconds
+func (r *Registry) NewHistogramVec(name, help, unit string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	h := &HistogramVec{unit: unit, buckets: buckets}
+	h.series = series[Histogram]{
+		meta: meta{Name: name, Help: help, Labels: labels},
+		newValue: func() *Histogram {
+			return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+		},
+		values: make(map[string]*entry[Histogram]),
+	}
+	r.register(h)
+	return h
+}
+
+// With 返回标签值对应的直方图
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values)
+}
+
+func (h *HistogramVec) write(b *strings.Builder) {
+	h.header(b, "histogram", h.unit)
+	h.each(func(values []string, v *Histogram) {
+		v.mu.Lock()
+		counts := slices.Clone(v.counts)
+		sum, count := v.sum, v.count
+		v.mu.Unlock()
+
+		var cumulative uint64
+		for i, c := range counts {
+			cumulative += c
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = formatFloat(h.buckets[i])
+			}
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.Name, h.labels(values, "le", le), cumulative)
+		}
+		fmt.Fprintf(b, "%s_count%s %d\n", h.Name, h.labels(values), count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.Name, h.labels(values), formatFloat(sum))
+	})
+}
+
+// formatFloat 按 OpenMetrics 的规范格式化数值，整数带 .0
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
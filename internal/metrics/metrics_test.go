@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	frames := r.NewCounterVec("test_frames", "帧数", "direction", "cmd")
+	frames.With("server", "B\"Resp").Add(2)
+	frames.With("client", "a").Inc()
+	frames.With("client", "a").Inc()
+	r.NewGaugeFunc("test_queue_depth", "队列\n长度", func() float64 { return 3 })
+	r.NewCounterFunc("test_dropped", "丢弃数", func() float64 { return 7 })
+	latency := r.NewHistogramVec("test_latency_seconds", "延迟", "seconds", []float64{1, 0.1}, "cmd")
+	latency.With("a").Observe(0.05)
+	latency.With("a").Observe(0.1)
+	latency.With("a").Observe(3)
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE test_dropped counter
+# HELP test_dropped 丢弃数
+test_dropped_total 7.0
+# TYPE test_frames counter
+# HELP test_frames 帧数
+test_frames_total{direction="client",cmd="a"} 2
+test_frames_total{direction="server",cmd="B\"Resp"} 2
+# TYPE test_latency_seconds histogram
+# UNIT test_latency_seconds seconds
+# HELP test_latency_seconds 延迟
+test_latency_seconds_bucket{cmd="a",le="0.1"} 2
+test_latency_seconds_bucket{cmd="a",le="1.0"} 2
+test_latency_seconds_bucket{cmd="a",le="+Inf"} 3
+test_latency_seconds_count{cmd="a"} 3
+test_latency_seconds_sum{cmd="a"} 3.15
+# TYPE test_queue_depth gauge
+# HELP test_queue_depth 队列\n长度
+test_queue_depth 3.0
+# EOF
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s", b.String())
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("dup", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	r.NewGaugeFunc("dup", "", func() float64 { return 0 })
+}
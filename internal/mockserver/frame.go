@@ -0,0 +1,60 @@
+package mockserver
+
+import (
+	"errors"
+	"time"
+	"xyzw_study/internal/crypto/bon"
+	"xyzw_study/internal/msgpath"
+)
+
+// Frame 定义一条解码后的游戏消息
+// 客户端消息的 Seq 为客户端序号，Ack 为收到的最后一个服务器序号
+// 服务器消息的 Seq 为服务器序号，Ack 为收到的最后一个客户端序号，Resp 为所回复请求的序号
+type Frame struct {
+	Cmd  string
+	Seq  int32
+	Ack  int32
+	Resp int32
+	Time int64
+	Body any
+}
+
+// Decode 解码 X 加密的消息帧，不会修改传入的数据
+func Decode(data []byte) (Frame, error) {
+	msg, err := bon.DecodeXWithBody(data)
+	if err != nil {
+		return Frame{}, err
+	}
+	cmd, ok := msg["cmd"].(string)
+	if !ok {
+		return Frame{}, errors.New("消息缺少 cmd")
+	}
+	return Frame{
+		Cmd:  cmd,
+		Seq:  int32(msgpath.Int(msg["seq"])),
+		Ack:  int32(msgpath.Int(msg["ack"])),
+		Resp: int32(msgpath.Int(msg["resp"])),
+		Time: msgpath.Int(msg["time"]),
+		Body: msg["body"],
+	}, nil
+}
+
+// Encode 将消息编码为 X 加密的消息帧，Resp 为 0 时不写入 resp 字段
+func (f Frame) Encode() ([]byte, error) {
+	if f.Time == 0 {
+		f.Time = time.Now().UnixMilli()
+	}
+	msg := map[string]any{
+		"cmd":  f.Cmd,
+		"seq":  f.Seq,
+		"ack":  f.Ack,
+		"time": f.Time,
+	}
+	if f.Resp != 0 {
+		msg["resp"] = f.Resp
+	}
+	if f.Body != nil {
+		msg["body"] = bon.EncodeToBytes(f.Body)
+	}
+	return bon.EncodeAndEncryptX(msg)
+}
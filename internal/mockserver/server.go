@@ -0,0 +1,320 @@
+package mockserver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"xyzw_study/internal/msgpath"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/seqmap"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reply 定义服务器对一个请求的回复
+// Push 为 true 时作为服务器推送发送，不带 resp 字段
+type Reply struct {
+	Cmd  string
+	Body any
+	Push bool
+}
+
+// Handler 处理一个客户端请求，返回需要发送的回复
+type Handler func(req Frame) []Reply
+
+// Server 模拟游戏服务器，使用 X 加密的 BON 消息通信，可以直接作为 http.Handler 使用
+// 请求按 Handle 注册的处理函数、回放的抓包、Default 的顺序查找回复
+type Server struct {
+	Default Handler     // 没有匹配的处理函数和回放时使用，为 nil 时不回复
+	Logger  *log.Logger // 为 nil 时不输出日志
+
+	mu         sync.Mutex
+	handlers   map[string]Handler
+	replays    map[string][][]Reply
+	conns      map[*Conn]struct{}
+	received   []Frame
+	violations []string
+	connected  chan *Conn
+	upgrader   websocket.Upgrader
+}
+
+// New 创建模拟服务器
+func New() *Server {
+	return &Server{
+		handlers:  make(map[string]Handler),
+		replays:   make(map[string][][]Reply),
+		conns:     make(map[*Conn]struct{}),
+		connected: make(chan *Conn, 16),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// Handle 注册命令的处理函数
+func (s *Server) Handle(cmd string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[cmd] = h
+}
+
+// Respond 注册固定回复，收到 cmd 时回复 respCmd
+func (s *Server) Respond(cmd, respCmd string, body any) {
+	s.Handle(cmd, func(Frame) []Reply {
+		return []Reply{{Cmd: respCmd, Body: body}}
+	})
+}
+
+// LoadReplay 从抓包记录加载回放，返回加载的请求数
+// 服务器回复使用 record.Matcher 按 resp 对应到请求命令，两个请求之间的服务器推送归到前一个请求
+// 调试注入的请求、它们的回复和伪造的服务器消息不回放，注入的请求只用于换算之后的序号
+// 同一命令多次请求时按抓包顺序依次回放，回放到最后一次后重复使用最后一次的回复
+func (s *Server) LoadReplay(records []record.Record) int {
+	type request struct {
+		cmd     string
+		replies []Reply
+	}
+	var (
+		requests []*request
+		matchers = make(map[string]*record.Matcher)
+		bySeq    = make(map[string]map[int64]*request) // 客户端看到的序号 -> 请求
+		current  = make(map[string]*request)
+	)
+	for _, rec := range records {
+		msg, err := rec.Value()
+		if err != nil {
+			continue
+		}
+		cmd, _ := msg["cmd"].(string)
+		if cmd == "" || cmd == seqmap.AckCmd {
+			continue
+		}
+		matcher := matchers[rec.Session]
+		if matcher == nil {
+			matcher = record.NewMatcher()
+			matchers[rec.Session] = matcher
+			bySeq[rec.Session] = make(map[int64]*request)
+		}
+		if rec.Call == "client" {
+			seq := matcher.Request(cmd, msgpath.Int(msg["seq"]), rec.Time, rec.Injected).Seq
+			if rec.Injected {
+				continue
+			}
+			req := &request{cmd: cmd}
+			requests = append(requests, req)
+			bySeq[rec.Session][seq] = req
+			current[rec.Session] = req
+			continue
+		}
+		if rec.Injected {
+			continue
+		}
+		reply := Reply{Cmd: cmd, Body: msg["body"]}
+		if found, ok := matcher.Find(msgpath.Int(msg["resp"]), false); ok {
+			req := bySeq[rec.Session][found.Seq]
+			req.replies = append(req.replies, reply)
+		} else if req := current[rec.Session]; req != nil {
+			reply.Push = true
+			req.replies = append(req.replies, reply)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, req := range requests {
+		if len(req.replies) == 0 {
+			continue
+		}
+		s.replays[req.cmd] = append(s.replays[req.cmd], req.replies)
+		count++
+	}
+	return count
+}
+
+// ServeHTTP 将请求升级为 WebSocket 连接并处理消息，直到连接断开
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logf("WebSocket 升级失败: %v", err)
+		return
+	}
+	conn := &Conn{server: s, ws: ws}
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	select {
+	case s.connected <- conn:
+	default:
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+	conn.serve()
+}
+
+// Connected 返回新连接通知通道
+func (s *Server) Connected() <-chan *Conn {
+	return s.connected
+}
+
+// Push 向所有连接推送一条服务器消息
+func (s *Server) Push(cmd string, body any) error {
+	s.mu.Lock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	if len(conns) == 0 {
+		return errors.New("没有客户端连接")
+	}
+	var errs []error
+	for _, c := range conns {
+		errs = append(errs, c.Push(cmd, body))
+	}
+	return errors.Join(errs...)
+}
+
+// Received 返回收到的所有客户端消息，包括 _sys/ack
+func (s *Server) Received() []Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Frame(nil), s.received...)
+}
+
+// Violations 返回检测到的协议错误，例如客户端 seq 不连续或消息无法解码
+func (s *Server) Violations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.violations...)
+}
+
+// lookup 查找请求对应的回复
+func (s *Server) lookup(req Frame) []Reply {
+	s.mu.Lock()
+	h, ok := s.handlers[req.Cmd]
+	if !ok {
+		if queue := s.replays[req.Cmd]; len(queue) > 0 {
+			replies := queue[0]
+			if len(queue) > 1 {
+				s.replays[req.Cmd] = queue[1:]
+			}
+			s.mu.Unlock()
+			return replies
+		}
+		h = s.Default
+	}
+	s.mu.Unlock()
+	if h == nil {
+		return nil
+	}
+	return h(req)
+}
+
+func (s *Server) record(f Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, f)
+}
+
+func (s *Server) violate(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	s.logf("协议错误: %s", msg)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.violations = append(s.violations, msg)
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
+
+// Conn 表示一个客户端连接，维护双方的序号
+type Conn struct {
+	server *Server
+	ws     *websocket.Conn
+
+	mu        sync.Mutex // 保护写入和序号
+	clientSeq int32      // 收到的最后一个客户端序号
+	serverSeq int32      // 发送的最后一个服务器序号
+}
+
+// serve 读取客户端消息并回复
+func (c *Conn) serve() {
+	for {
+		kind, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		req, err := Decode(data)
+		if err != nil {
+			c.server.violate("无法解码的消息: %v", err)
+			continue
+		}
+		c.server.record(req)
+		c.server.logf("Recv <= %s seq=%d ack=%d", req.Cmd, req.Seq, req.Ack)
+
+		if req.Cmd == seqmap.AckCmd {
+			// 心跳回复确认收到的最后一个客户端序号
+			if err := c.send(Frame{Cmd: seqmap.AckCmd}); err != nil {
+				return
+			}
+			continue
+		}
+		// 客户端重新从 1 开始编号表示重新登录
+		c.mu.Lock()
+		if req.Seq != c.clientSeq+1 && req.Seq != 1 {
+			c.server.violate("%s seq=%d，期望 %d", req.Cmd, req.Seq, c.clientSeq+1)
+		}
+		c.clientSeq = req.Seq
+		c.mu.Unlock()
+
+		for _, reply := range c.server.lookup(req) {
+			f := Frame{Cmd: reply.Cmd, Body: reply.Body}
+			if !reply.Push {
+				f.Resp = req.Seq
+			}
+			if err := c.send(f); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Push 向该连接推送一条服务器消息
+func (c *Conn) Push(cmd string, body any) error {
+	return c.send(Frame{Cmd: cmd, Body: body})
+}
+
+// Close 关闭连接，用于测试客户端重连
+func (c *Conn) Close() error {
+	return c.ws.Close()
+}
+
+// send 填写服务器序号和 ack 后发送
+func (c *Conn) send(f Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f.Cmd != seqmap.AckCmd {
+		c.serverSeq++
+		f.Seq = c.serverSeq
+	}
+	f.Ack = c.clientSeq
+	data, err := f.Encode()
+	if err != nil {
+		return err
+	}
+	c.server.logf("Send => %s seq=%d ack=%d resp=%d", f.Cmd, f.Seq, f.Ack, f.Resp)
+	return c.ws.WriteMessage(websocket.BinaryMessage, data)
+}
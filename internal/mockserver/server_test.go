@@ -0,0 +1,236 @@
+package mockserver
+
+import (
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/seqmap"
+
+	"github.com/gorilla/websocket"
+)
+
+// dial 连接模拟服务器
+func dial(t *testing.T, s *Server) *websocket.Conn {
+	t.Helper()
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func send(t *testing.T, ws *websocket.Conn, f Frame) {
+	t.Helper()
+	data, err := f.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func recv(t *testing.T, ws *websocket.Conn) Frame {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	f := Frame{Cmd: "role_getroleinfo", Seq: 3, Ack: 2, Resp: 7, Time: 1742068792116, Body: map[string]any{"roleId": int32(1)}}
+	data, err := f.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 0x70 || data[1] != 0x78 {
+		t.Fatalf("missing X header: %x", data[:2])
+	}
+	got, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cmd != f.Cmd || got.Seq != 3 || got.Ack != 2 || got.Resp != 7 || got.Time != f.Time {
+		t.Errorf("header mismatch: %+v", got)
+	}
+	if got.Body.(map[string]any)["roleId"] != int32(1) {
+		t.Errorf("body mismatch: %v", got.Body)
+	}
+}
+
+func TestScriptedReply(t *testing.T) {
+	s := New()
+	s.Respond("role_getroleinfo", "Role_GetRoleInfoResp", map[string]any{"role": map[string]any{"level": int32(10)}})
+	s.Handle("system_buygold", func(req Frame) []Reply {
+		return []Reply{
+			{Cmd: "System_BuyGoldResp", Body: req.Body},
+			{Cmd: "SyncRewardResp", Body: map[string]any{"gold": int32(100)}, Push: true},
+		}
+	})
+	ws := dial(t, s)
+
+	send(t, ws, Frame{Cmd: "role_getroleinfo", Seq: 1})
+	resp := recv(t, ws)
+	if resp.Cmd != "Role_GetRoleInfoResp" || resp.Resp != 1 || resp.Seq != 1 || resp.Ack != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	send(t, ws, Frame{Cmd: "system_buygold", Seq: 2, Ack: 1, Body: map[string]any{"count": int32(1)}})
+	resp = recv(t, ws)
+	if resp.Cmd != "System_BuyGoldResp" || resp.Resp != 2 || resp.Seq != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	push := recv(t, ws)
+	if push.Cmd != "SyncRewardResp" || push.Resp != 0 || push.Seq != 3 || push.Ack != 2 {
+		t.Fatalf("unexpected push: %+v", push)
+	}
+
+	// 心跳回复当前确认的客户端序号，不占用服务器序号
+	send(t, ws, Frame{Cmd: seqmap.AckCmd, Ack: 3})
+	ack := recv(t, ws)
+	if ack.Cmd != seqmap.AckCmd || ack.Ack != 2 || ack.Seq != 0 {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+
+	if v := s.Violations(); len(v) != 0 {
+		t.Errorf("unexpected violations: %v", v)
+	}
+	if n := len(s.Received()); n != 3 {
+		t.Errorf("received %d frames, want 3", n)
+	}
+}
+
+func TestSeqViolation(t *testing.T) {
+	s := New()
+	s.Respond("a", "AResp", nil)
+	ws := dial(t, s)
+
+	send(t, ws, Frame{Cmd: "a", Seq: 1})
+	recv(t, ws)
+	send(t, ws, Frame{Cmd: "a", Seq: 3})
+	recv(t, ws)
+	// 重新登录从 1 开始不算错误
+	send(t, ws, Frame{Cmd: "a", Seq: 1})
+	recv(t, ws)
+
+	v := s.Violations()
+	if len(v) != 1 || !strings.Contains(v[0], "seq=3") {
+		t.Fatalf("violations = %v", v)
+	}
+}
+
+func TestPush(t *testing.T) {
+	s := New()
+	ws := dial(t, s)
+	select {
+	case <-s.Connected():
+	case <-time.After(2 * time.Second):
+		t.Fatal("no connection")
+	}
+	if err := s.Push("System_NewChatMessageNotify", map[string]any{"content": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	f := recv(t, ws)
+	if f.Cmd != "System_NewChatMessageNotify" || f.Seq != 1 || f.Resp != 0 {
+		t.Fatalf("unexpected push: %+v", f)
+	}
+}
+
+func rec(t *testing.T, call string, f Frame) record.Record {
+	t.Helper()
+	data, err := f.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record.Record{Session: "s1", Call: call, Raw: hex.EncodeToString(data)}
+}
+
+func TestReplay(t *testing.T) {
+	records := []record.Record{
+		rec(t, "client", Frame{Cmd: "role_getroleinfo", Seq: 1}),
+		rec(t, "server", Frame{Cmd: "Role_GetRoleInfoResp", Seq: 1, Resp: 1, Body: map[string]any{"n": int32(1)}}),
+		rec(t, "server", Frame{Cmd: "SyncRewardResp", Seq: 2, Body: map[string]any{"gold": int32(5)}}),
+		rec(t, "client", Frame{Cmd: seqmap.AckCmd}),
+		rec(t, "client", Frame{Cmd: "role_getroleinfo", Seq: 2}),
+		rec(t, "server", Frame{Cmd: "Role_GetRoleInfoResp", Seq: 3, Resp: 2, Body: map[string]any{"n": int32(2)}}),
+		rec(t, "client", Frame{Cmd: "unanswered", Seq: 3}),
+	}
+	s := New()
+	if n := s.LoadReplay(records); n != 2 {
+		t.Fatalf("loaded %d requests, want 2", n)
+	}
+	ws := dial(t, s)
+
+	send(t, ws, Frame{Cmd: "role_getroleinfo", Seq: 1})
+	first := recv(t, ws)
+	if first.Resp != 1 || first.Body.(map[string]any)["n"] != int32(1) {
+		t.Fatalf("unexpected first reply: %+v", first)
+	}
+	push := recv(t, ws)
+	if push.Cmd != "SyncRewardResp" || push.Resp != 0 {
+		t.Fatalf("unexpected push: %+v", push)
+	}
+
+	// 第二次和之后的请求使用第二次抓包的回复
+	for seq := int32(2); seq <= 3; seq++ {
+		send(t, ws, Frame{Cmd: "role_getroleinfo", Seq: seq})
+		reply := recv(t, ws)
+		if reply.Resp != seq || reply.Body.(map[string]any)["n"] != int32(2) {
+			t.Fatalf("unexpected reply for seq %d: %+v", seq, reply)
+		}
+	}
+}
+
+// TestReplayInjected 抓包中有调试注入时，之后的回复仍对应到正确的请求，注入的请求和伪造的消息不回放
+func TestReplayInjected(t *testing.T) {
+	injected := func(r record.Record) record.Record {
+		r.Injected = true
+		return r
+	}
+	forged := rec(t, "server", Frame{Cmd: "System_NewChatMessageNotify", Seq: 4, Resp: 2})
+	forged.Injected, forged.Forged = true, true
+	records := []record.Record{
+		rec(t, "client", Frame{Cmd: "role_getroleinfo", Seq: 1}),
+		rec(t, "server", Frame{Cmd: "Role_GetRoleInfoResp", Seq: 1, Resp: 1}),
+		// 注入的请求占用服务器看到的 seq 2，回复不转发给客户端
+		injected(rec(t, "client", Frame{Cmd: "system_buygold", Seq: 2})),
+		injected(rec(t, "server", Frame{Cmd: "System_BuyGoldResp", Seq: 2, Resp: 2})),
+		// 客户端的 seq 2 在抓包中是 3，转发给客户端的回复 resp 为 2
+		rec(t, "client", Frame{Cmd: "item_openpack", Seq: 3}),
+		rec(t, "server", Frame{Cmd: "Item_OpenBoxResp", Seq: 3, Resp: 2}),
+		forged,
+	}
+	s := New()
+	if n := s.LoadReplay(records); n != 2 {
+		t.Fatalf("loaded %d requests, want 2", n)
+	}
+	if r := s.replays["system_buygold"]; r != nil {
+		t.Errorf("injected request replayed: %+v", r)
+	}
+	if r := s.replays["item_openpack"]; len(r) != 1 || len(r[0]) != 1 {
+		t.Errorf("item_openpack replays: %+v", r)
+	}
+	ws := dial(t, s)
+
+	send(t, ws, Frame{Cmd: "item_openpack", Seq: 1})
+	if reply := recv(t, ws); reply.Cmd != "Item_OpenBoxResp" || reply.Resp != 1 {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+	send(t, ws, Frame{Cmd: "role_getroleinfo", Seq: 2})
+	if reply := recv(t, ws); reply.Cmd != "Role_GetRoleInfoResp" || reply.Resp != 2 {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+}
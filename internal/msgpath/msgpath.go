@@ -0,0 +1,155 @@
+package msgpath
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flatten 将解码后的消息展开为 "路径 -> 叶子值" 的映射
+// 路径格式与前端键备注一致，例如 body.role.items.3010.quantity
+func Flatten(v any) map[string]any {
+	result := make(map[string]any)
+	flatten("", v, result)
+	return result
+}
+
+func flatten(prefix string, v any, result map[string]any) {
+	switch val := v.(type) {
+	case map[string]any:
+		if len(val) == 0 && prefix != "" {
+			result[prefix] = val
+		}
+		for k, item := range val {
+			flatten(join(prefix, k), item, result)
+		}
+	case []any:
+		if len(val) == 0 && prefix != "" {
+			result[prefix] = val
+		}
+		for i, item := range val {
+			flatten(join(prefix, strconv.Itoa(i)), item, result)
+		}
+	default:
+		if prefix != "" {
+			result[prefix] = v
+		}
+	}
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// Get 按路径取值
+func Get(v any, path string) (any, bool) {
+	if path == "" {
+		return v, true
+	}
+	cur := v
+	for _, seg := range strings.Split(path, ".") {
+		switch val := cur.(type) {
+		case map[string]any:
+			next, ok := val[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(val) {
+				return nil, false
+			}
+			cur = val[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Match 判断路径是否匹配模式，模式中 "*" 匹配任意一段，"**" 匹配任意多段
+func Match(pattern, path string) bool {
+	return matchSegs(strings.Split(pattern, "."), strings.Split(path, "."))
+}
+
+func matchSegs(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegs(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 || (pattern[0] != "*" && pattern[0] != path[0]) {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// String 将叶子值格式化为字符串，用于索引和比较
+func String(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return val
+	case []byte:
+		return hex.EncodeToString(val)
+	case time.Time:
+		return strconv.FormatInt(val.UnixMilli(), 10)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// Int 将数字字段转换为整数，支持 BON 解码得到的各种整数和浮点数、JSON 数字和数字字符串
+// 无法转换时返回 0
+func Int(v any) int64 {
+	switch n := v.(type) {
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	case float32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			f, _ := n.Float64()
+			return int64(f)
+		}
+		return i
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	default:
+		return 0
+	}
+}
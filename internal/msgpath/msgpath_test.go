@@ -0,0 +1,30 @@
+package msgpath
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInt(t *testing.T) {
+	cases := []struct {
+		in   any
+		want int64
+	}{
+		{int32(-3), -3},
+		{int64(1742068792116), 1742068792116},
+		{uint8(7), 7},
+		{float64(12.9), 12},
+		{float32(5), 5},
+		{json.Number("42"), 42},
+		{json.Number("1.5e3"), 1500},
+		{"3010", 3010},
+		{"abc", 0},
+		{nil, 0},
+		{map[string]any{}, 0},
+	}
+	for _, c := range cases {
+		if got := Int(c.in); got != c.want {
+			t.Errorf("Int(%T %v) = %d, want %d", c.in, c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package notes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+	"xyzw_study/internal/atomicfile"
+)
+
+// ErrConflict 表示保存时备注已经被其他人修改
+var ErrConflict = errors.New("备注已被修改，请重新加载后再保存")
+
+// Notes 定义备注数据结构
+type Notes struct {
+	CommandNotes map[string]string            `json:"commandNotes"`        // 命令备注，格式: {cmd: note}
+	KeyNotes     map[string]map[string]string `json:"keyNotes"`            // 键备注，格式: {cmd: {key: note}}
+	KeyTables    map[string]map[string]string `json:"keyTables,omitempty"` // ID字段对应的配置表，格式: {cmd: {path: table}}，cmd 为 * 时对所有命令生效
+}
+
+// New 返回空备注
+func New() Notes {
+	return Notes{
+		CommandNotes: make(map[string]string),
+		KeyNotes:     make(map[string]map[string]string),
+		KeyTables:    make(map[string]map[string]string),
+	}
+}
+
+// Clone 返回备注的深拷贝
+func (n Notes) Clone() Notes {
+	c := New()
+	for cmd, note := range n.CommandNotes {
+		c.CommandNotes[cmd] = note
+	}
+	cloneNested(c.KeyNotes, n.KeyNotes)
+	cloneNested(c.KeyTables, n.KeyTables)
+	return c
+}
+
+func cloneNested(dst, src map[string]map[string]string) {
+	for cmd, keys := range src {
+		m := make(map[string]string, len(keys))
+		for key, v := range keys {
+			m[key] = v
+		}
+		dst[cmd] = m
+	}
+}
+
+// normalize 补全空的映射并去掉空备注
+func (n *Notes) normalize() {
+	if n.CommandNotes == nil {
+		n.CommandNotes = make(map[string]string)
+	}
+	if n.KeyNotes == nil {
+		n.KeyNotes = make(map[string]map[string]string)
+	}
+	if n.KeyTables == nil {
+		n.KeyTables = make(map[string]map[string]string)
+	}
+	for cmd, note := range n.CommandNotes {
+		if note == "" {
+			delete(n.CommandNotes, cmd)
+		}
+	}
+	normalizeNested(n.KeyNotes)
+	normalizeNested(n.KeyTables)
+}
+
+func normalizeNested(m map[string]map[string]string) {
+	for cmd, keys := range m {
+		for key, v := range keys {
+			if v == "" {
+				delete(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			delete(m, cmd)
+		}
+	}
+}
+
+// Patch 定义对单条备注的修改，格式与 JSON Merge Patch 相同
+// 值为 null 或空字符串时删除对应的备注
+// 例如 {"commandNotes": {"role_getroleinfo": "获取角色信息"}, "keyNotes": {"role_getroleinfo": {"body.role.level": null}}}
+type Patch struct {
+	CommandNotes map[string]*string            `json:"commandNotes"`
+	KeyNotes     map[string]map[string]*string `json:"keyNotes"`
+	KeyTables    map[string]map[string]*string `json:"keyTables"`
+}
+
+// apply 将修改应用到备注
+func (p Patch) apply(n *Notes) {
+	for cmd, note := range p.CommandNotes {
+		if note == nil || *note == "" {
+			delete(n.CommandNotes, cmd)
+		} else {
+			n.CommandNotes[cmd] = *note
+		}
+	}
+	applyNested(n.KeyNotes, p.KeyNotes)
+	applyNested(n.KeyTables, p.KeyTables)
+}
+
+func applyNested(dst map[string]map[string]string, patch map[string]map[string]*string) {
+	for cmd, keys := range patch {
+		for key, v := range keys {
+			if v == nil || *v == "" {
+				delete(dst[cmd], key)
+				continue
+			}
+			if dst[cmd] == nil {
+				dst[cmd] = make(map[string]string)
+			}
+			dst[cmd][key] = *v
+		}
+		if len(dst[cmd]) == 0 {
+			delete(dst, cmd)
+		}
+	}
+}
+
+// Store 保存备注文件，可以被多个请求并发使用
+// 写入时先写临时文件再重命名，进程崩溃不会留下损坏的文件
+// 文件被其它程序修改后，下次读取时重新加载
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	notes   Notes
+	etag    string
+	modTime time.Time
+	size    int64
+}
+
+// Open 打开备注文件，文件不存在时创建空备注
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := s.write(New()); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get 返回备注和对应的 ETag
+func (s *Store) Get() (Notes, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return Notes{}, "", err
+	}
+	return s.notes.Clone(), s.etag, nil
+}
+
+// Replace 替换全部备注，ifMatch 不为空且与当前 ETag 不一致时返回 ErrConflict
+func (s *Store) Replace(n Notes, ifMatch string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return "", err
+	}
+	if ifMatch != "" && ifMatch != "*" && ifMatch != s.etag {
+		return s.etag, ErrConflict
+	}
+	n = n.Clone()
+	n.normalize()
+	if err := s.write(n); err != nil {
+		return "", err
+	}
+	return s.etag, nil
+}
+
+// Update 修改单条或多条备注，不会覆盖其他备注，返回修改后的备注和 ETag
+func (s *Store) Update(p Patch) (Notes, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return Notes{}, "", err
+	}
+	n := s.notes.Clone()
+	p.apply(&n)
+	if err := s.write(n); err != nil {
+		return Notes{}, "", err
+	}
+	return s.notes.Clone(), s.etag, nil
+}
+
+// Modify 在锁内读取、修改并保存备注，fn 返回错误时不保存
+func (s *Store) Modify(fn func(n *Notes) error) (Notes, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return Notes{}, "", err
+	}
+	n := s.notes.Clone()
+	if err := fn(&n); err != nil {
+		return Notes{}, "", err
+	}
+	n.normalize()
+	if err := s.write(n); err != nil {
+		return Notes{}, "", err
+	}
+	return s.notes.Clone(), s.etag, nil
+}
+
+// reload 文件被其它程序修改时重新加载，调用方需要持有 mu
+func (s *Store) reload() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		// 文件被删除时保留内存中的备注，下次保存时重新创建
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	return s.load()
+}
+
+// load 从文件加载备注，调用方需要持有 mu 或独占 Store
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	n := New()
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	n.normalize()
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.notes = n
+	s.etag = etag(n)
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+// write 保存备注并更新 ETag，调用方需要持有 mu 或独占 Store
+func (s *Store) write(n Notes) error {
+	data, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(s.path, data, 0644); err != nil {
+		return err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.notes = n
+	s.etag = etag(n)
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+// etag 根据备注内容计算 ETag，内容相同的备注 ETag 相同
+func etag(n Notes) string {
+	data, _ := json.Marshal(n)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
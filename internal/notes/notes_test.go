@@ -0,0 +1,122 @@
+package notes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func str(s string) *string { return &s }
+
+func TestUpdateConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := fmt.Sprintf("cmd_%d", i)
+			_, _, err := s.Update(Patch{
+				CommandNotes: map[string]*string{cmd: str("note")},
+				KeyNotes:     map[string]map[string]*string{"role_getroleinfo": {cmd: str("key")}},
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _, _ := reopened.Get()
+	if len(n.CommandNotes) != 20 || len(n.KeyNotes["role_getroleinfo"]) != 20 {
+		t.Errorf("lost updates: %d command notes, %d key notes", len(n.CommandNotes), len(n.KeyNotes["role_getroleinfo"]))
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+}
+
+func TestUpdateDelete(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "notes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Update(Patch{
+		CommandNotes: map[string]*string{"a": str("A"), "b": str("B")},
+		KeyNotes:     map[string]map[string]*string{"a": {"body.x": str("X")}},
+	})
+	n, _, err := s.Update(Patch{
+		CommandNotes: map[string]*string{"a": nil, "b": str("")},
+		KeyNotes:     map[string]map[string]*string{"a": {"body.x": nil}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.CommandNotes) != 0 || len(n.KeyNotes) != 0 {
+		t.Errorf("notes not deleted: %+v", n)
+	}
+}
+
+func TestReplaceConflict(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "notes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, etag, _ := s.Get()
+
+	// 另一个页面先修改了备注
+	if _, _, err := s.Update(Patch{CommandNotes: map[string]*string{"a": str("A")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := New()
+	stale.CommandNotes["b"] = "B"
+	if _, err := s.Replace(stale, etag); err != ErrConflict {
+		t.Fatalf("stale save: %v", err)
+	}
+	_, current, _ := s.Get()
+	next, err := s.Replace(stale, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == current {
+		t.Error("etag unchanged after save")
+	}
+	n, _, _ := s.Get()
+	if len(n.CommandNotes) != 1 || n.CommandNotes["b"] != "B" {
+		t.Errorf("notes = %+v", n)
+	}
+}
+
+func TestReloadExternalChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, before, _ := s.Get()
+	data := `{"commandNotes": {"role_getroleinfo": "获取角色信息"}, "keyNotes": {}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, after, err := s.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.CommandNotes["role_getroleinfo"] != "获取角色信息" || after == before {
+		t.Errorf("external change not loaded: %+v %s", n, after)
+	}
+}
@@ -1,10 +1,15 @@
 package proxy
 
 import (
+	"context"
+	"fmt"
 	"log"
-	"os"
-	"sync/atomic"
+	"net"
+	"strings"
+	"sync"
+	"time"
 	"xyzw_study/internal/crypto/bon"
+	"xyzw_study/internal/seqmap"
 
 	gamemitm "github.com/husanpao/game-mitm"
 )
@@ -19,15 +24,56 @@ const (
 	Receive
 )
 
-var seq int32
-var clientMSg map[int32]int32
+var (
+	sessionIDs   = make(map[*gamemitm.Session]string)
+	sessionIDsMu sync.Mutex
+	lastSession  string
 
-func NextSeq() int32 {
-	return atomic.AddInt32(&seq, 1)
+	translators   = make(map[*gamemitm.Session]*seqmap.Translator)
+	translatorsMu sync.Mutex
+)
+
+// Translator 返回会话的序号转换器，每个游戏连接独立维护客户端和服务器的序号
+func Translator(session *gamemitm.Session) *seqmap.Translator {
+	translatorsMu.Lock()
+	defer translatorsMu.Unlock()
+	t, ok := translators[session]
+	if !ok {
+		t = seqmap.New()
+		translators[session] = t
+	}
+	return t
 }
 
-func CurrentSeq() int32 {
-	return atomic.LoadInt32(&seq)
+// SessionID 返回会话对应的稳定ID，会话为 nil 时返回最近一次出现的会话ID
+func SessionID(session *gamemitm.Session) string {
+	sessionIDsMu.Lock()
+	defer sessionIDsMu.Unlock()
+	if session == nil {
+		return lastSession
+	}
+	id, ok := sessionIDs[session]
+	if !ok {
+		id = fmt.Sprintf("%s-%d", time.Now().Format("20060102150405"), len(sessionIDs)+1)
+		sessionIDs[session] = id
+	}
+	lastSession = id
+	return id
+}
+
+// closeSession 游戏连接断开后删除会话的ID和序号转换器，返回会话ID，未出现过的会话返回空字符串
+func closeSession(session *gamemitm.Session) string {
+	sessionIDsMu.Lock()
+	id := sessionIDs[session]
+	delete(sessionIDs, session)
+	sessionIDsMu.Unlock()
+
+	translatorsMu.Lock()
+	delete(translators, session)
+	translatorsMu.Unlock()
+
+	dropPendings(session)
+	return id
 }
 
 // GamePacket 定义游戏数据包结构
@@ -36,176 +82,235 @@ type GamePacket struct {
 	RawData   any
 	Direction Direction // 使用枚举类型标识消息方向
 	Session   *gamemitm.Session
+	SessionID string    // 会话ID，用于持久化存储和检索
+	Time      time.Time // 捕获时间
+	Injected  bool      // 调试注入的消息，或服务器对注入请求的回复
+	Forged    bool      // 调试伪造的服务器消息，直接发给客户端，不是服务器的回复
 }
 
 // PacketHandler 定义处理数据包的函数类型
 type PacketHandler func(packet GamePacket)
 
-// StartCapture 开始捕获游戏数据包
-func StartCapture(handler PacketHandler) {
-	// 创建或打开日志文件
-	file, err := os.OpenFile("app.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer file.Close()
-
-	// 设置日志输出到文件
-	log.SetOutput(file)
+// Options 定义抓包代理的配置
+type Options struct {
+	Port   int         // 代理监听端口
+	Hosts  []string    // 需要抓包的游戏域名，支持 *.example.com 形式
+	Logger *log.Logger // 抓包日志输出，为 nil 时使用标准日志
+	// Dial 连接游戏服务器使用的拨号函数，为 nil 时直连，用于经过上游代理
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// Closed 游戏连接断开时调用，之后该会话不能再注入消息
+	Closed func(session *gamemitm.Session, sessionID string)
+}
 
-	proxy := gamemitm.NewProxy()
-	proxy.SetVerbose(false)
-	seq = 0
-	clientMSg = make(map[int32]int32)
-	proxy.OnRequest("xxz-xyzw.hortorgames.com").Do(func(body []byte, ctx *gamemitm.ProxyCtx) []byte {
-		if handler == nil {
-			return body
-		}
-		// 拷贝原始请求体
+// safeHandle 捕获回调中的 panic 并原样转发数据，避免单个异常数据包导致整个进程退出
+func safeHandle(logger *log.Logger, handle gamemitm.Handle) gamemitm.Handle {
+	return func(body []byte, ctx *gamemitm.ProxyCtx) (result []byte) {
+		// 解密会原地修改数据，先保留一份原始数据用于异常时转发
 		original := make([]byte, len(body))
 		copy(original, body)
-		if len(body) >= 2 && body[0] == 0x70 && body[1] == 0x78 {
-			msg := bon.DecodeXAsMap(body)
-			if msg["seq"] != nil {
-				gameSeq := msg["seq"].(int32)
-				if gameSeq == 1 {
-					seq = 0
-				}
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Printf("处理数据包异常: %v", r)
+				result = original
 			}
+		}()
+		return handle(body, ctx)
+	}
+}
 
-			var processed []byte
-			if msg["cmd"] == nil {
-				return original
-			}
-			if msg["cmd"].(string) == "_sys/ack" {
-				processed = bon.EncodeReplaceAck(original, seq+1)
-			} else {
-				processed = bon.EncodeReplaceSeq(original, NextSeq())
-				clientMSg[CurrentSeq()] = msg["seq"].(int32)
-			}
-			// 给 DecodeX 使用一份拷贝，避免修改原 processed
-			decodedInput := make([]byte, len(processed))
-			copy(decodedInput, processed)
-			updateStr := bon.DecodeX(decodedInput)
-			log.Printf("Send => %s", updateStr)
-
-			handler(GamePacket{processed, updateStr, Send, ctx.WSSession})
-			return processed
+// StartCapture 启动代理并开始捕获游戏数据包，代理停止或启动失败时返回错误
+func StartCapture(opts Options, handler PacketHandler) (err error) {
+	// 创建代理时证书加载失败会 panic，这里转换为错误返回
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("启动抓包代理失败: %v", r)
 		}
-		return original
-	})
-	proxy.OnResponse("xxz-xyzw.hortorgames.com").Do(func(body []byte, ctx *gamemitm.ProxyCtx) []byte {
-		if handler == nil {
-			return body
-		}
-		// 拷贝原始请求体
-		original := make([]byte, len(body))
-		copy(original, body)
-		if len(body) >= 2 && body[0] == 0x70 && body[1] == 0x78 {
+	}()
 
-			msg := bon.DecodeXAsMap(body)
-			var processed []byte
-			if msg["cmd"] == nil {
-				return original
-			}
-			if msg["cmd"].(string) == "_sys/ack" {
-				processed = bon.EncodeReplaceAck(original, CurrentSeq())
-			} else {
-				if msg["resp"] != nil {
-					if rseq, ok := clientMSg[msg["resp"].(int32)]; ok {
-						processed = bon.EncodeReplaceResp(original, rseq)
-					} else {
-						processed = original
-					}
-				} else {
-					processed = original
-				}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
 
+	proxy := gamemitm.NewProxy()
+	proxy.SetPort(opts.Port)
+	proxy.SetVerbose(false)
+	if opts.Dial != nil {
+		proxy.SetDialContext(opts.Dial)
+	}
+	for _, host := range opts.Hosts {
+		// gamemitm 按子串匹配域名，*.example.com 转换为 .example.com
+		key := strings.TrimPrefix(host, "*")
+		proxy.OnRequest(key).Do(safeHandle(logger, func(body []byte, ctx *gamemitm.ProxyCtx) []byte {
+			if handler == nil {
+				return body
 			}
-			decodedInput := make([]byte, len(processed))
-			copy(decodedInput, processed)
-			// 给 DecodeX 使用一份拷贝，避免修改原 processed
-			updateStr := bon.DecodeX(decodedInput)
-			log.Printf("Recv <= %s", updateStr)
-			handler(GamePacket{processed, updateStr, Receive, ctx.WSSession})
-			return processed
-		}
-		return original
-	})
-	proxy.OnRequest("xxz-xyzw-new.hortorgames.com").Do(func(body []byte, ctx *gamemitm.ProxyCtx) []byte {
-		if handler == nil {
-			return body
-		}
-		// 拷贝原始请求体
-		original := make([]byte, len(body))
-		copy(original, body)
-		if len(body) >= 2 && body[0] == 0x70 && body[1] == 0x78 {
-			msg := bon.DecodeXAsMap(body)
-			if msg["seq"] != nil {
-				gameSeq := msg["seq"].(int32)
-				if gameSeq == 1 {
-					seq = 0
-				}
-			}
-
-			var processed []byte
-			if msg["cmd"] == nil {
-				return original
+			return handleRequest(body, ctx, handler, logger, host)
+		}))
+		proxy.OnResponse(key).Do(safeHandle(logger, func(body []byte, ctx *gamemitm.ProxyCtx) []byte {
+			if handler == nil {
+				return body
 			}
-			if msg["cmd"].(string) == "_sys/ack" {
-				processed = bon.EncodeReplaceAck(original, seq+1)
-			} else {
-				processed = bon.EncodeReplaceSeq(original, NextSeq())
-				clientMSg[CurrentSeq()] = msg["seq"].(int32)
+			return handleResponse(body, ctx, handler, logger, host)
+		}))
+		proxy.OnClosed(key).Do(safeHandle(logger, func(body []byte, ctx *gamemitm.ProxyCtx) []byte {
+			// 多个域名规则匹配同一个连接时会调用多次，只通知一次
+			if id := closeSession(ctx.WSSession); id != "" && opts.Closed != nil {
+				opts.Closed(ctx.WSSession, id)
 			}
-			// 给 DecodeX 使用一份拷贝，避免修改原 processed
-			decodedInput := make([]byte, len(processed))
-			copy(decodedInput, processed)
-			updateStr := bon.DecodeX(decodedInput)
-			log.Printf("NewSend => %s", updateStr)
-
-			handler(GamePacket{processed, updateStr, Send, ctx.WSSession})
-			return processed
-		}
-		return original
-	})
-	proxy.OnResponse("xxz-xyzw-new.hortorgames.com").Do(func(body []byte, ctx *gamemitm.ProxyCtx) []byte {
-		if handler == nil {
 			return body
-		}
-		// 拷贝原始请求体
-		original := make([]byte, len(body))
-		copy(original, body)
-		if len(body) >= 2 && body[0] == 0x70 && body[1] == 0x78 {
+		}))
+	}
+	return proxy.Start()
+}
 
-			msg := bon.DecodeXAsMap(body)
-			var processed []byte
-			if msg["cmd"] == nil {
-				return original
-			}
-			if msg["cmd"].(string) == "_sys/ack" {
-				processed = bon.EncodeReplaceAck(original, CurrentSeq())
-			} else {
-				if msg["resp"] != nil {
-					if rseq, ok := clientMSg[msg["resp"].(int32)]; ok {
-						processed = bon.EncodeReplaceResp(original, rseq)
-					} else {
-						processed = original
-					}
-				} else {
-					processed = original
-				}
+// isX 判断数据是否是 X 加密的消息
+func isX(body []byte) bool {
+	return len(body) >= 2 && body[0] == 0x70 && body[1] == 0x78
+}
 
-			}
-			decodedInput := make([]byte, len(processed))
-			copy(decodedInput, processed)
-			// 给 DecodeX 使用一份拷贝，避免修改原 processed
-			updateStr := bon.DecodeX(decodedInput)
-			log.Printf("NewRecv <= %s", updateStr)
-			handler(GamePacket{processed, updateStr, Receive, ctx.WSSession})
-			return processed
+// decodeHeader 解码消息但保留 body 的原始字节，用于改写序号后重新编码
+func decodeHeader(body []byte) (map[string]any, seqmap.Header, bool) {
+	input := make([]byte, len(body))
+	copy(input, body)
+	msg := bon.DecodeXAsMap(input)
+	cmd, ok := msg["cmd"].(string)
+	if !ok {
+		return nil, seqmap.Header{}, false
+	}
+	h := seqmap.Header{Cmd: cmd}
+	h.Seq, _ = msg["seq"].(int32)
+	h.Ack, _ = msg["ack"].(int32)
+	h.Resp, _ = msg["resp"].(int32)
+	return msg, h, true
+}
+
+// rewrite 写入转换后的序号字段并重新编码，原消息没有的字段只在非 0 时写入
+func rewrite(msg map[string]any, h seqmap.Header) ([]byte, error) {
+	set := func(key string, v int32) {
+		if _, ok := msg[key]; ok || v != 0 {
+			msg[key] = v
 		}
-		return original
-	})
-	proxy.Start()
+	}
+	set("seq", h.Seq)
+	set("ack", h.Ack)
+	set("resp", h.Resp)
+	return bon.EncodeAndEncryptX(msg)
+}
+
+// encodeFrame 使用转换器分配的序号编码一条注入的消息
+func encodeFrame(h seqmap.Header, body any) ([]byte, error) {
+	msg := map[string]any{
+		"cmd":  h.Cmd,
+		"seq":  h.Seq,
+		"ack":  h.Ack,
+		"time": time.Now().UnixMilli(),
+		"body": bon.EncodeToBytes(body),
+	}
+	if h.Resp != 0 {
+		msg["resp"] = h.Resp
+	}
+	return bon.EncodeAndEncryptX(msg)
+}
+
+// EncodeToServer 编码一条注入到服务器的消息，占用服务器看到的下一个客户端序号
+// 服务器对它的回复不会转发给游戏客户端
+func EncodeToServer(session *gamemitm.Session, cmd string, body any) ([]byte, error) {
+	h := Translator(session).InjectUpstream(cmd)
+	frame, err := encodeFrame(h, body)
+	if err != nil {
+		encodeFailures.With(directionLabel(Send)).Inc()
+		return nil, err
+	}
+	trackRequest(session, cmd, h.Seq, time.Now())
+	return frame, nil
+}
+
+// EncodeToClient 编码一条注入到客户端的消息，占用客户端看到的下一个服务器序号
+// resp 为客户端视角的请求序号，0 表示推送消息
+func EncodeToClient(session *gamemitm.Session, cmd string, body any, resp int32) ([]byte, error) {
+	frame, err := encodeFrame(Translator(session).InjectDownstream(cmd, resp), body)
+	if err != nil {
+		encodeFailures.With(directionLabel(Receive)).Inc()
+	}
+	return frame, err
+}
+
+// handleRequest 处理客户端发往服务器的数据包，将客户端序号转换为服务器看到的序号
+func handleRequest(body []byte, ctx *gamemitm.ProxyCtx, handler PacketHandler, logger *log.Logger, host string) []byte {
+	countFrame(Send, body)
+	if !isX(body) {
+		return body
+	}
+	msg, h, ok := decodeHeader(body)
+	if !ok {
+		decodeFailures.With(directionLabel(Send)).Inc()
+		return body
+	}
+	countMessage(Send, h.Cmd, len(body))
+	up := Translator(ctx.WSSession).Upstream(h)
+	processed, err := rewrite(msg, up)
+	if err != nil {
+		encodeFailures.With(directionLabel(Send)).Inc()
+		logger.Printf("改写序号失败: %v", err)
+		return body
+	}
+	trackRequest(ctx.WSSession, h.Cmd, up.Seq, time.Now())
+
+	// 给 DecodeX 使用一份拷贝，避免修改原 processed
+	decodedInput := make([]byte, len(processed))
+	copy(decodedInput, processed)
+	updateStr := bon.DecodeX(decodedInput)
+	if updateStr == "" {
+		decodeFailures.With(directionLabel(Send)).Inc()
+	}
+	logger.Printf("[%s] Send => %s", host, updateStr)
+
+	handler(GamePacket{Raw: processed, RawData: updateStr, Direction: Send, Session: ctx.WSSession, SessionID: SessionID(ctx.WSSession), Time: time.Now()})
+	return processed
+}
+
+// handleResponse 处理服务器发往客户端的数据包，将序号转换为客户端看到的序号
+// 对注入请求的回复只交给 handler，转发给客户端的是一条不占用序号的 _sys/ack
+func handleResponse(body []byte, ctx *gamemitm.ProxyCtx, handler PacketHandler, logger *log.Logger, host string) []byte {
+	countFrame(Receive, body)
+	if !isX(body) {
+		return body
+	}
+	msg, h, ok := decodeHeader(body)
+	if !ok {
+		decodeFailures.With(directionLabel(Receive)).Inc()
+		return body
+	}
+	countMessage(Receive, h.Cmd, len(body))
+	observeResponse(ctx.WSSession, h.Resp, time.Now())
+	tr := Translator(ctx.WSSession)
+
+	packet := body
+	forward := body
+	var err error
+	injected := tr.InjectedResp(h)
+	if injected {
+		tr.DropDownstream(h)
+		forward, err = encodeFrame(tr.InjectDownstream(seqmap.AckCmd, 0), nil)
+	} else {
+		forward, err = rewrite(msg, tr.Downstream(h))
+		packet = forward
+	}
+	if err != nil {
+		encodeFailures.With(directionLabel(Receive)).Inc()
+		logger.Printf("改写序号失败: %v", err)
+		return body
+	}
+
+	// 给 DecodeX 使用一份拷贝，避免修改原数据
+	decodedInput := make([]byte, len(packet))
+	copy(decodedInput, packet)
+	updateStr := bon.DecodeX(decodedInput)
+	if updateStr == "" {
+		decodeFailures.With(directionLabel(Receive)).Inc()
+	}
+	logger.Printf("[%s] Recv <= %s", host, updateStr)
+	handler(GamePacket{Raw: packet, RawData: updateStr, Direction: Receive, Session: ctx.WSSession, SessionID: SessionID(ctx.WSSession), Time: time.Now(), Injected: injected})
+	return forward
 }
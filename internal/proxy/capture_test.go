@@ -0,0 +1,316 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"xyzw_study/internal/mockserver"
+	"xyzw_study/internal/upstream"
+
+	"github.com/gorilla/websocket"
+	gamemitm "github.com/husanpao/game-mitm"
+)
+
+// standIn 模拟上游代理，记录每个连接请求的目标地址
+type standIn struct {
+	mu      sync.Mutex
+	targets []string
+}
+
+func (s *standIn) hit(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets = append(s.targets, addr)
+}
+
+func (s *standIn) Targets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.targets...)
+}
+
+// listen 在本地随机端口启动 TCP 服务，每个连接交给 handle 处理
+func listen(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// pipe 在两个连接之间双向转发数据
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	<-done
+	a.Close()
+	b.Close()
+}
+
+// connectProxy 模拟只支持 CONNECT 的 HTTP 代理
+func connectProxy(t *testing.T, s *standIn) string {
+	return listen(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil || req.Method != http.MethodConnect {
+			conn.Close()
+			return
+		}
+		s.hit(req.Host)
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+			conn.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+		pipe(conn, target)
+	})
+}
+
+// socks5Proxy 模拟不需要认证的 SOCKS5 代理
+func socks5Proxy(t *testing.T, s *standIn) string {
+	return listen(t, func(conn net.Conn) {
+		buf := make([]byte, 262)
+		// 协商认证方法
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			conn.Close()
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+			conn.Close()
+			return
+		}
+		conn.Write([]byte{5, 0})
+
+		// 连接请求
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			conn.Close()
+			return
+		}
+		var host string
+		switch buf[3] {
+		case 1:
+			io.ReadFull(conn, buf[:4])
+			host = net.IP(buf[:4]).String()
+		case 3:
+			io.ReadFull(conn, buf[:1])
+			n := int(buf[0])
+			io.ReadFull(conn, buf[:n])
+			host = string(buf[:n])
+		default:
+			conn.Close()
+			return
+		}
+		io.ReadFull(conn, buf[:2])
+		addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+		s.hit(addr)
+		target, err := net.Dial("tcp", addr)
+		if err != nil {
+			conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			conn.Close()
+			return
+		}
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		pipe(conn, target)
+	})
+}
+
+// startCapture 在临时目录中启动抓包代理，证书目录 ./ca 不会写入源码目录
+func startCapture(t *testing.T, opts Options, handler PacketHandler) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Port = ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	opts.Logger = log.New(io.Discard, "", 0)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- StartCapture(opts, handler) }()
+
+	addr := "127.0.0.1:" + strconv.Itoa(opts.Port)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-errCh:
+			t.Fatalf("抓包代理启动失败: %v", err)
+		default:
+		}
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("抓包代理没有启动")
+	return ""
+}
+
+// TestCaptureUpstream 游戏客户端经过抓包代理连接服务器时，HTTPS 隧道和 WebSocket 都经过上游代理
+func TestCaptureUpstream(t *testing.T) {
+	mock := mockserver.New()
+	mock.Respond("role_getroleinfo", "Role_GetRoleInfoResp", map[string]any{"role": map[string]any{"level": int32(10)}})
+	gameServer := httptest.NewTLSServer(mock)
+	defer gameServer.Close()
+	gameURL, _ := url.Parse(gameServer.URL)
+
+	for _, scheme := range []string{"http", "socks5"} {
+		t.Run(scheme, func(t *testing.T) {
+			stand := &standIn{}
+			var upstreamAddr string
+			if scheme == "http" {
+				upstreamAddr = connectProxy(t, stand)
+			} else {
+				upstreamAddr = socks5Proxy(t, stand)
+			}
+			dialer, err := upstream.Parse(scheme + "://" + upstreamAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			var packets []GamePacket
+			proxyAddr := startCapture(t, Options{Hosts: []string{gameURL.Hostname()}, Dial: dialer.DialContext}, func(p GamePacket) {
+				mu.Lock()
+				defer mu.Unlock()
+				packets = append(packets, p)
+			})
+
+			client := websocket.Dialer{
+				Proxy:           http.ProxyURL(&url.URL{Scheme: "http", Host: proxyAddr}),
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+			ws, _, err := client.Dial("wss://"+gameURL.Host+"/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+
+			data, err := mockserver.Frame{Cmd: "role_getroleinfo", Seq: 1}.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				t.Fatal(err)
+			}
+			ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, data, err = ws.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp, err := mockserver.Decode(data); err != nil || resp.Cmd != "Role_GetRoleInfoResp" || resp.Resp != 1 {
+				t.Fatalf("unexpected response: %+v %v", resp, err)
+			}
+
+			// 抓包代理连接服务器的隧道和 WebSocket 各经过一次上游代理
+			targets := stand.Targets()
+			if len(targets) != 2 {
+				t.Fatalf("upstream saw %d connections, want 2: %v", len(targets), targets)
+			}
+			for _, target := range targets {
+				if target != gameURL.Host {
+					t.Errorf("upstream target %s, want %s", target, gameURL.Host)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(packets) != 2 {
+				t.Errorf("captured %d packets, want 2", len(packets))
+			}
+		})
+	}
+}
+
+// TestCaptureSessionClosed 游戏连接断开后删除会话的ID和序号转换器
+func TestCaptureSessionClosed(t *testing.T) {
+	mock := mockserver.New()
+	mock.Respond("role_getroleinfo", "Role_GetRoleInfoResp", map[string]any{})
+	gameServer := httptest.NewTLSServer(mock)
+	defer gameServer.Close()
+	gameURL, _ := url.Parse(gameServer.URL)
+
+	sessions := make(chan *gamemitm.Session, 1)
+	closed := make(chan string, 1)
+	proxyAddr := startCapture(t, Options{
+		Hosts:  []string{gameURL.Hostname()},
+		Closed: func(session *gamemitm.Session, id string) { closed <- id },
+	}, func(p GamePacket) {
+		select {
+		case sessions <- p.Session:
+		default:
+		}
+	})
+
+	client := websocket.Dialer{
+		Proxy:           http.ProxyURL(&url.URL{Scheme: "http", Host: proxyAddr}),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	ws, _, err := client.Dial("wss://"+gameURL.Host+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := mockserver.Frame{Cmd: "role_getroleinfo", Seq: 1}.Encode()
+	ws.WriteMessage(websocket.BinaryMessage, data)
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := ws.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	session := <-sessions
+	id := SessionID(session)
+	ws.Close()
+
+	select {
+	case got := <-closed:
+		if got != id {
+			t.Errorf("closed session %s, want %s", got, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("closed handler not called")
+	}
+	sessionIDsMu.Lock()
+	_, hasID := sessionIDs[session]
+	sessionIDsMu.Unlock()
+	translatorsMu.Lock()
+	_, hasTranslator := translators[session]
+	translatorsMu.Unlock()
+	pendingsMu.Lock()
+	_, hasPending := pendings[session]
+	pendingsMu.Unlock()
+	if hasID || hasTranslator || hasPending {
+		t.Errorf("session state not pruned: id=%v translator=%v pending=%v", hasID, hasTranslator, hasPending)
+	}
+}
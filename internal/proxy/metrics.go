@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+	"xyzw_study/internal/metrics"
+
+	gamemitm "github.com/husanpao/game-mitm"
+)
+
+const (
+	// maxPending 每个会话最多保留的等待回复的请求数
+	maxPending = 4096
+	// pendingTimeout 超过这个时间没有回复的请求在等待列表满时删除，不计入延迟
+	pendingTimeout = time.Minute
+)
+
+var (
+	framesTotal = metrics.Default.NewCounterVec("xyzw_proxy_frames",
+		"抓包代理处理的 WebSocket 帧数，format 为 x、lx 或 other，只有 x 帧会被解码", "direction", "format")
+	frameBytes = metrics.Default.NewCounterVec("xyzw_proxy_frame_bytes",
+		"抓包代理处理的 WebSocket 帧字节数", "direction", "format")
+	messagesTotal = metrics.Default.NewCounterVec("xyzw_proxy_messages",
+		"解码成功的游戏消息数", "direction", "cmd")
+	messageBytes = metrics.Default.NewCounterVec("xyzw_proxy_message_bytes",
+		"解码成功的游戏消息的原始帧字节数", "direction", "cmd")
+	decodeFailures = metrics.Default.NewCounterVec("xyzw_proxy_decode_failures",
+		"无法解码的 x 帧数，这些帧原样转发", "direction")
+	encodeFailures = metrics.Default.NewCounterVec("xyzw_proxy_encode_failures",
+		"改写序号或编码注入消息失败的次数", "direction")
+	requestLatency = metrics.Default.NewHistogramVec("xyzw_proxy_request_latency_seconds",
+		"客户端请求到服务器回复的延迟，按请求命令", "seconds", metrics.LatencyBuckets, "cmd")
+)
+
+// directionLabel 返回指标中的方向标签，与抓包记录的 call 相同
+func directionLabel(d Direction) string {
+	if d == Send {
+		return "client"
+	}
+	return "server"
+}
+
+// frameFormat 返回帧的加密格式
+func frameFormat(body []byte) string {
+	switch {
+	case isX(body):
+		return "x"
+	case len(body) >= 2 && body[0] == 0x70 && body[1] == 0x6c:
+		return "lx"
+	default:
+		return "other"
+	}
+}
+
+// countFrame 统计一个帧
+func countFrame(d Direction, body []byte) {
+	dir, format := directionLabel(d), frameFormat(body)
+	framesTotal.With(dir, format).Inc()
+	frameBytes.With(dir, format).Add(uint64(len(body)))
+}
+
+// countMessage 统计一条解码成功的消息
+func countMessage(d Direction, cmd string, size int) {
+	dir := directionLabel(d)
+	messagesTotal.With(dir, cmd).Inc()
+	messageBytes.With(dir, cmd).Add(uint64(size))
+}
+
+// pendingRequest 等待回复的请求
+type pendingRequest struct {
+	cmd string
+	at  time.Time
+}
+
+var (
+	pendings   = make(map[*gamemitm.Session]map[int32]pendingRequest)
+	pendingsMu sync.Mutex
+)
+
+// trackRequest 记录发往服务器的请求，seq 为服务器看到的序号，包括注入的请求
+func trackRequest(session *gamemitm.Session, cmd string, seq int32, at time.Time) {
+	if seq == 0 {
+		return
+	}
+	pendingsMu.Lock()
+	defer pendingsMu.Unlock()
+	m := pendings[session]
+	if m == nil {
+		m = make(map[int32]pendingRequest)
+		pendings[session] = m
+	}
+	if len(m) >= maxPending {
+		// 没有回复的请求会一直留在这里，过多时按时间淘汰，仍在等待的请求保留
+		evictPending(m, at)
+	}
+	m[seq] = pendingRequest{cmd: cmd, at: at}
+}
+
+// evictPending 删除超时的请求，没有超时的请求时删除最早的一个
+func evictPending(m map[int32]pendingRequest, now time.Time) {
+	var oldest int32
+	var oldestAt time.Time
+	evicted := false
+	for seq, req := range m {
+		if now.Sub(req.at) > pendingTimeout {
+			delete(m, seq)
+			evicted = true
+			continue
+		}
+		if oldestAt.IsZero() || req.at.Before(oldestAt) {
+			oldest, oldestAt = seq, req.at
+		}
+	}
+	if !evicted && !oldestAt.IsZero() {
+		delete(m, oldest)
+	}
+}
+
+// dropPendings 会话结束后删除它等待回复的请求
+func dropPendings(session *gamemitm.Session) {
+	pendingsMu.Lock()
+	defer pendingsMu.Unlock()
+	delete(pendings, session)
+}
+
+// observeResponse 使用服务器回复的 resp 找到请求并记录延迟，resp 为服务器看到的序号
+func observeResponse(session *gamemitm.Session, resp int32, at time.Time) {
+	if resp == 0 {
+		return
+	}
+	pendingsMu.Lock()
+	req, ok := pendings[session][resp]
+	if ok {
+		delete(pendings[session], resp)
+	}
+	pendingsMu.Unlock()
+	if ok {
+		requestLatency.With(req.cmd).Observe(at.Sub(req.at).Seconds())
+	}
+}
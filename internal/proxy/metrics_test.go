@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	gamemitm "github.com/husanpao/game-mitm"
+)
+
+func TestTrackRequestEvictsByAge(t *testing.T) {
+	session := &gamemitm.Session{}
+	defer dropPendings(session)
+	now := time.Now()
+
+	// 一半请求已经超时，一半仍在等待回复
+	for i := 1; i <= maxPending; i++ {
+		at := now.Add(-time.Duration(maxPending-i+1) * time.Millisecond)
+		if i%2 == 0 {
+			at = now.Add(-2 * pendingTimeout)
+		}
+		trackRequest(session, "role_getroleinfo", int32(i), at)
+	}
+	trackRequest(session, "system_buygold", maxPending+1, now)
+
+	pendingsMu.Lock()
+	m := pendings[session]
+	_, stale := m[2]
+	_, waiting := m[1]
+	size := len(m)
+	pendingsMu.Unlock()
+	if stale || !waiting || size != maxPending/2+1 {
+		t.Fatalf("stale=%v waiting=%v size=%d", stale, waiting, size)
+	}
+
+	// 都没有超时时只删除最早的请求
+	for i := maxPending + 2; len(pendings[session]) < maxPending; i++ {
+		trackRequest(session, "role_getroleinfo", int32(i), now)
+	}
+	trackRequest(session, "system_buygold", 1<<20, now)
+	pendingsMu.Lock()
+	_, oldest := pendings[session][1]
+	size = len(pendings[session])
+	pendingsMu.Unlock()
+	if oldest || size != maxPending {
+		t.Errorf("oldest kept=%v size=%d", oldest, size)
+	}
+}
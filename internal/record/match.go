@@ -0,0 +1,76 @@
+package record
+
+import "time"
+
+// maxPending 最多保留的等待回复的请求数
+const maxPending = 4096
+
+// Request 抓包中的一个客户端请求
+type Request struct {
+	Cmd      string    `json:"cmd"`
+	Seq      int64     `json:"seq"` // 客户端看到的序号，注入的请求为服务器看到的序号
+	Time     time.Time `json:"time"`
+	Injected bool      `json:"injected,omitempty"`
+}
+
+// Matcher 按抓包顺序将服务器回复与客户端请求配对，每个会话使用一个
+//
+// 抓包中客户端请求的 seq 是转换后服务器看到的序号，而转发给客户端的回复的 resp 是客户端看到的序号，
+// 两者相差此前注入到服务器的消息数；注入请求的回复没有转换，resp 为服务器看到的序号
+type Matcher struct {
+	offset   int64 // 已注入到服务器的消息数
+	pending  map[int64]Request
+	injected map[int64]Request
+	last     Request
+}
+
+// NewMatcher 创建 Matcher
+func NewMatcher() *Matcher {
+	return &Matcher{pending: make(map[int64]Request), injected: make(map[int64]Request)}
+}
+
+// Request 记录一个客户端请求，seq 为抓包中的序号，返回记录的请求
+func (m *Matcher) Request(cmd string, seq int64, at time.Time, injected bool) Request {
+	req := Request{Cmd: cmd, Seq: seq, Time: at, Injected: injected}
+	if injected {
+		m.offset++
+		add(m.injected, req)
+	} else {
+		req.Seq = seq - m.offset
+		add(m.pending, req)
+	}
+	m.last = req
+	return req
+}
+
+func add(pending map[int64]Request, req Request) {
+	if req.Seq == 0 {
+		return
+	}
+	if len(pending) >= maxPending {
+		for seq := range pending {
+			if seq < req.Seq-maxPending {
+				delete(pending, seq)
+			}
+		}
+	}
+	pending[req.Seq] = req
+}
+
+// Find 查找服务器回复对应的请求，injected 为回复是否为注入请求的回复
+func (m *Matcher) Find(resp int64, injected bool) (Request, bool) {
+	if resp == 0 {
+		return Request{}, false
+	}
+	pending := m.pending
+	if injected {
+		pending = m.injected
+	}
+	req, ok := pending[resp]
+	return req, ok
+}
+
+// Last 返回最近的请求
+func (m *Matcher) Last() (Request, bool) {
+	return m.last, m.last.Cmd != ""
+}
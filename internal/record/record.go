@@ -0,0 +1,114 @@
+package record
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"xyzw_study/internal/crypto/bon"
+)
+
+// Record 定义抓包文件中的一条记录，抓包文件为每行一条记录的 JSONL
+type Record struct {
+	Time     time.Time         `json:"time"`               // 捕获时间
+	Session  string            `json:"session,omitempty"`  // 会话ID
+	Call     string            `json:"call"`               // "client" 或 "server"
+	Raw      string            `json:"raw,omitempty"`      // 原始X加密帧的十六进制
+	Msg      json.RawMessage   `json:"msg,omitempty"`      // 解码后的消息 JSON
+	Names    map[string]string `json:"names,omitempty"`    // ID字段对应的名称，格式: {路径: 名称}，来自配置表
+	Injected bool              `json:"injected,omitempty"` // 调试注入的消息或服务器对注入请求的回复，序号为服务器看到的序号
+	Forged   bool              `json:"forged,omitempty"`   // 调试伪造发给客户端的服务器消息，同时为 Injected，内容不来自服务器
+}
+
+// Value 返回记录解码后的消息
+// 优先从原始帧解码以保留BON类型，没有原始帧时退回到 Msg
+func (r Record) Value() (map[string]any, error) {
+	if r.Raw != "" {
+		data, err := hex.DecodeString(r.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("解析原始帧失败: %w", err)
+		}
+		return bon.DecodeXWithBody(data)
+	}
+	if len(r.Msg) == 0 {
+		return nil, errors.New("记录没有消息内容")
+	}
+	var msg map[string]any
+	dec := json.NewDecoder(strings.NewReader(string(r.Msg)))
+	dec.UseNumber()
+	if err := dec.Decode(&msg); err != nil {
+		return nil, err
+	}
+	return bon.FromJSON(msg).(map[string]any), nil
+}
+
+// Cmd 返回记录中的命令名
+func (r Record) Cmd() string {
+	var head struct {
+		Cmd string `json:"cmd"`
+	}
+	if len(r.Msg) > 0 && json.Unmarshal(r.Msg, &head) == nil && head.Cmd != "" {
+		return head.Cmd
+	}
+	msg, err := r.Value()
+	if err != nil {
+		return ""
+	}
+	cmd, _ := msg["cmd"].(string)
+	return cmd
+}
+
+// Writer 将记录写入 JSONL 抓包文件
+type Writer struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewWriter 创建一个新的 Writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, enc: json.NewEncoder(w)}
+}
+
+// Write 写入一条记录
+func (w *Writer) Write(r Record) error {
+	return w.enc.Encode(r)
+}
+
+// Read 从 JSONL 读取所有记录
+func Read(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("第 %d 行解析失败: %w", line, err)
+		}
+		if rec.Call == "" {
+			return nil, fmt.Errorf("第 %d 行缺少 call 字段", line)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// ReadFile 读取 JSONL 抓包文件
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
@@ -0,0 +1,344 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"xyzw_study/internal/crypto/bon"
+	"xyzw_study/internal/msgpath"
+	"xyzw_study/internal/record"
+)
+
+// Action 定义脱敏方式
+type Action string
+
+const (
+	// Hash 替换为带密钥的哈希，数字字段保持数字类型
+	Hash Action = "hash"
+	// Mask 字符串只保留首尾字符，数字置零
+	Mask Action = "mask"
+	// Drop 删除字段
+	Drop Action = "drop"
+	// Pseudonym 替换为一致的化名，同一个值在整个导出中总是得到同一个化名
+	Pseudonym Action = "pseudonym"
+)
+
+// Rule 定义一条脱敏规则
+// 规则只处理字段的值，以ID为键的对象（例如 items.<roleId>）中的键不会被替换，需要时使用 Drop 删除整个对象
+type Rule struct {
+	Cmd    string `json:"cmd,omitempty"` // 命令匹配，支持 * 通配，为空时匹配所有命令
+	Path   string `json:"path"`          // 字段路径，"*" 匹配任意一段，"**" 匹配任意多段
+	Action Action `json:"action"`
+}
+
+// Config 定义脱敏配置
+type Config struct {
+	// Secret 哈希和化名使用的密钥，为空时每次导出随机生成，不同导出之间无法关联
+	Secret string `json:"secret,omitempty"`
+	Rules  []Rule `json:"rules"`
+}
+
+// DefaultRules 默认脱敏规则，覆盖角色ID、名称、聊天内容和令牌
+func DefaultRules() []Rule {
+	return []Rule{
+		{Path: "body.**.roleId", Action: Pseudonym},
+		{Path: "body.**.targetId", Action: Pseudonym},
+		{Path: "body.**.legionId", Action: Pseudonym},
+		{Path: "body.**.name", Action: Pseudonym},
+		{Path: "body.**.roleName", Action: Pseudonym},
+		{Path: "body.**.nickname", Action: Pseudonym},
+		{Path: "body.**.legionName", Action: Pseudonym},
+		{Path: "body.**.openId", Action: Hash},
+		{Path: "body.**.uid", Action: Hash},
+		{Path: "body.**.token", Action: Drop},
+		{Path: "body.**.sessionKey", Action: Drop},
+		{Path: "body.**.sign", Action: Drop},
+		{Cmd: "System_NewChatMessageNotify", Path: "body.**.content", Action: Mask},
+		{Cmd: "System_NewChatMessageNotify", Path: "body.**.text", Action: Mask},
+		{Cmd: "system_sendchatmessage", Path: "body.**.content", Action: Mask},
+		{Cmd: "system_sendchatmessage", Path: "body.**.text", Action: Mask},
+	}
+}
+
+// DefaultConfig 返回使用默认规则的配置
+func DefaultConfig() Config {
+	return Config{Rules: DefaultRules()}
+}
+
+// LoadConfig 从 JSON 文件加载脱敏配置，文件不存在时返回默认配置
+func LoadConfig(file string) (Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultConfig(), nil
+		}
+		return Config{}, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, err
+	}
+	for _, rule := range cfg.Rules {
+		switch rule.Action {
+		case Hash, Mask, Drop, Pseudonym:
+		default:
+			return Config{}, fmt.Errorf("未知的脱敏方式: %s", rule.Action)
+		}
+	}
+	return cfg, nil
+}
+
+// Redactor 按规则对解码后的消息进行脱敏
+// 同一个 Redactor 内化名保持一致，可以并发使用
+type Redactor struct {
+	rules  []Rule
+	secret []byte
+
+	mu         sync.Mutex
+	pseudonyms map[string]any
+	counters   map[string]int
+}
+
+// New 创建一个新的 Redactor
+func New(cfg Config) *Redactor {
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &Redactor{
+		rules:      cfg.Rules,
+		secret:     secret,
+		pseudonyms: make(map[string]any),
+		counters:   make(map[string]int),
+	}
+}
+
+// Message 对解码后的消息（body 已解码）进行脱敏，原消息不会被修改
+func (r *Redactor) Message(msg map[string]any) map[string]any {
+	cmd, _ := msg["cmd"].(string)
+	var rules []Rule
+	for _, rule := range r.rules {
+		if rule.Cmd == "" {
+			rules = append(rules, rule)
+		} else if ok, _ := path.Match(rule.Cmd, cmd); ok {
+			rules = append(rules, rule)
+		}
+	}
+	result, _ := r.walk("", msg, rules)
+	return result.(map[string]any)
+}
+
+// walk 递归复制并脱敏，返回 false 表示该字段应被删除
+func (r *Redactor) walk(p string, v any, rules []Rule) (any, bool) {
+	if p != "" {
+		for _, rule := range rules {
+			if msgpath.Match(rule.Path, p) {
+				return r.apply(rule, v)
+			}
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			child := k
+			if p != "" {
+				child = p + "." + k
+			}
+			if redacted, keep := r.walk(child, item, rules); keep {
+				out[k] = redacted
+			}
+		}
+		return out, true
+	case []any:
+		out := make([]any, 0, len(val))
+		for i, item := range val {
+			child := strconv.Itoa(i)
+			if p != "" {
+				child = p + "." + child
+			}
+			if redacted, keep := r.walk(child, item, rules); keep {
+				out = append(out, redacted)
+			}
+		}
+		return out, true
+	default:
+		return v, true
+	}
+}
+
+func (r *Redactor) apply(rule Rule, v any) (any, bool) {
+	switch rule.Action {
+	case Drop:
+		return nil, false
+	case Mask:
+		return mask(v), true
+	case Hash:
+		return r.hash(v), true
+	case Pseudonym:
+		return r.pseudonym(v), true
+	}
+	return v, true
+}
+
+// mask 字符串只保留首尾字符，数字置零，其它类型置空
+func mask(v any) any {
+	switch val := v.(type) {
+	case string:
+		runes := []rune(val)
+		if len(runes) <= 2 {
+			return strings.Repeat("*", len(runes))
+		}
+		return string(runes[0]) + strings.Repeat("*", len(runes)-2) + string(runes[len(runes)-1])
+	case int32:
+		return int32(0)
+	case int64:
+		return int64(0)
+	case float32:
+		return float32(0)
+	case float64:
+		return float64(0)
+	case map[string]any:
+		// 对象和数组逐个叶子打码，不能整体原样返回
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = mask(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = mask(item)
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// hash 计算带密钥的哈希，数字和字符串保持字段的BON类型，其它类型替换为十六进制字符串
+func (r *Redactor) hash(v any) any {
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte(bon.TypeName(v) + ":" + msgpath.String(v)))
+	sum := mac.Sum(nil)
+	switch v.(type) {
+	case int32:
+		return int32(binary.BigEndian.Uint32(sum) & 0x7fffffff)
+	case int64:
+		return int64(binary.BigEndian.Uint64(sum) & 0x7fffffffffffffff)
+	case float32:
+		// 取尾数能精确表示的位数，结果为整数值的浮点数
+		return float32(binary.BigEndian.Uint32(sum) & (1<<24 - 1))
+	case float64:
+		return float64(binary.BigEndian.Uint64(sum) & (1<<53 - 1))
+	default:
+		return hex.EncodeToString(sum[:8])
+	}
+}
+
+// pseudonym 返回一致的化名，数字字段得到递增的数字，字符串字段得到 "anon_N"
+func (r *Redactor) pseudonym(v any) any {
+	key := bon.TypeName(v) + ":" + msgpath.String(v)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.pseudonyms[key]; ok {
+		return p
+	}
+
+	kind := bon.TypeName(v)
+	r.counters[kind]++
+	n := r.counters[kind]
+	var p any
+	switch v.(type) {
+	case int32:
+		p = int32(100000 + n)
+	case int64:
+		p = int64(100000 + n)
+	case float32:
+		p = float32(100000 + n)
+	case float64:
+		p = float64(100000 + n)
+	case string:
+		p = fmt.Sprintf("anon_%d", n)
+	default:
+		p = r.hash(v)
+	}
+	r.pseudonyms[key] = p
+	return p
+}
+
+// Frame 将脱敏后的消息重新编码为X加密的BON帧
+// 解码得到的 float32 和 float64 仍按 Float 和 Double 编码，整数值不会变成 Int
+func Frame(msg map[string]any) ([]byte, error) {
+	envelope := make(map[string]any, len(msg))
+	for k, v := range msg {
+		envelope[k] = exact(v)
+	}
+	if body, ok := envelope["body"]; ok && body != nil {
+		if _, isBinary := body.([]byte); !isBinary {
+			envelope["body"] = bon.EncodeToBytes(body)
+		}
+	}
+	return bon.EncodeAndEncryptX(envelope)
+}
+
+// exact 复制值并将浮点数转换为 bon.Float 和 bon.Double，编码时保持原来的BON类型
+func exact(v any) any {
+	switch val := v.(type) {
+	case float32:
+		return bon.Float(val)
+	case float64:
+		return bon.Double(val)
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = exact(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = exact(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// Record 对抓包记录进行脱敏，并重新编码原始帧
+func (r *Redactor) Record(rec record.Record) (record.Record, error) {
+	msg, err := rec.Value()
+	if err != nil {
+		return rec, err
+	}
+	redacted := r.Message(msg)
+
+	frame, err := Frame(redacted)
+	if err != nil {
+		return rec, err
+	}
+	decoded, err := bon.DecodeXWithBody(frame)
+	if err != nil {
+		return rec, fmt.Errorf("脱敏后的帧无法解码: %w", err)
+	}
+	data, err := json.Marshal(decoded)
+	if err != nil {
+		return rec, err
+	}
+
+	rec.Raw = hex.EncodeToString(frame)
+	rec.Msg = data
+	return rec, nil
+}
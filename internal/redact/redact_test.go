@@ -0,0 +1,155 @@
+package redact
+
+import (
+	"encoding/hex"
+	"testing"
+	"xyzw_study/internal/crypto/bon"
+	"xyzw_study/internal/record"
+)
+
+func TestRedactFrame(t *testing.T) {
+	msg := map[string]any{
+		"cmd":  "System_NewChatMessageNotify",
+		"seq":  int32(3),
+		"time": int64(1742068792116),
+		"body": map[string]any{
+			"chatMessage": map[string]any{
+				"roleId":  int32(123456),
+				"name":    "张三",
+				"content": "hello world",
+				"token":   "secret",
+			},
+			"members": []any{
+				map[string]any{"roleId": int32(123456)},
+				map[string]any{"roleId": int64(99)},
+			},
+		},
+	}
+
+	r := New(Config{Secret: "test", Rules: DefaultRules()})
+	redacted := r.Message(msg)
+	frame, err := Frame(redacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := bon.DecodeXWithBody(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := decoded["body"].(map[string]any)
+	chat := body["chatMessage"].(map[string]any)
+	if _, ok := chat["token"]; ok {
+		t.Error("token should be dropped")
+	}
+	if chat["content"] != "h*********d" {
+		t.Errorf("content not masked: %v", chat["content"])
+	}
+	if chat["name"] != "anon_1" {
+		t.Errorf("name not pseudonymised: %v", chat["name"])
+	}
+	members := body["members"].([]any)
+	first := members[0].(map[string]any)["roleId"]
+	if chat["roleId"] != first || first == int32(123456) {
+		t.Errorf("roleId pseudonyms inconsistent: %v vs %v", chat["roleId"], first)
+	}
+	if _, ok := members[1].(map[string]any)["roleId"].(int64); !ok {
+		t.Errorf("Long roleId should stay Long: %T", members[1].(map[string]any)["roleId"])
+	}
+
+	// 原消息不应被修改
+	if msg["body"].(map[string]any)["chatMessage"].(map[string]any)["token"] != "secret" {
+		t.Error("original message modified")
+	}
+}
+
+func TestRedactMaskNested(t *testing.T) {
+	msg := map[string]any{
+		"cmd": "system_sendchatmessage",
+		"seq": int32(1),
+		"body": map[string]any{
+			"content": map[string]any{
+				"text":  "hello world",
+				"count": int32(7),
+				"lines": []any{"secret", int64(42), float64(1.5)},
+			},
+		},
+	}
+
+	r := New(Config{Secret: "test", Rules: []Rule{{Path: "body.content", Action: Mask}}})
+	redacted := r.Message(msg)
+	content, ok := redacted["body"].(map[string]any)["content"].(map[string]any)
+	if !ok {
+		t.Fatalf("content should stay an object: %T", redacted["body"].(map[string]any)["content"])
+	}
+	if content["text"] != "h*********d" || content["count"] != int32(0) {
+		t.Errorf("object leaves not masked: %v", content)
+	}
+	lines := content["lines"].([]any)
+	if lines[0] != "s****t" || lines[1] != int64(0) || lines[2] != float64(0) {
+		t.Errorf("array leaves not masked: %v", lines)
+	}
+
+	// 原消息不应被修改
+	orig := msg["body"].(map[string]any)["content"].(map[string]any)
+	if orig["text"] != "hello world" || orig["lines"].([]any)[0] != "secret" {
+		t.Error("original message modified")
+	}
+}
+
+// TestRedactRecordTypes 脱敏后重新编码的帧中字段保持原来的BON类型
+func TestRedactRecordTypes(t *testing.T) {
+	frame, err := bon.EncodeAndEncryptX(map[string]any{
+		"cmd": "Role_GetRoleInfoResp",
+		"seq": int32(1),
+		"body": bon.EncodeToBytes(map[string]any{
+			"roleId":  bon.Double(123456),
+			"openId":  bon.Double(98765),
+			"uid":     bon.Float(4321),
+			"content": "hello",
+			"power":   bon.Double(0),
+			"rate":    bon.Float(1.5),
+			"members": []any{map[string]any{"roleId": bon.Double(7), "level": int32(3)}},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []Rule{
+		{Path: "body.**.roleId", Action: Pseudonym},
+		{Path: "body.openId", Action: Hash},
+		{Path: "body.uid", Action: Hash},
+		{Path: "body.power", Action: Mask},
+	}
+	r := New(Config{Secret: "test", Rules: rules})
+	rec, err := r.Record(record.Record{Call: "server", Raw: hex.EncodeToString(frame)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := rec.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := decoded["body"].(map[string]any)
+	want := map[string]string{
+		"roleId":  "Double",
+		"openId":  "Double",
+		"uid":     "Float",
+		"content": "String",
+		"power":   "Double",
+		"rate":    "Float",
+	}
+	for field, typ := range want {
+		if got := bon.TypeName(body[field]); got != typ {
+			t.Errorf("%s: %s(%v), want %s", field, got, body[field], typ)
+		}
+	}
+	if body["roleId"] == float64(123456) || body["openId"] == float64(98765) {
+		t.Errorf("not redacted: %v", body)
+	}
+	member := body["members"].([]any)[0].(map[string]any)
+	if bon.TypeName(member["roleId"]) != "Double" || member["level"] != int32(3) {
+		t.Errorf("member = %v", member)
+	}
+}
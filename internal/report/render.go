@@ -0,0 +1,200 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 报告格式
+const (
+	FormatMarkdown = "md"
+	FormatHTML     = "html"
+)
+
+// Write 按格式输出报告，format 为 FormatMarkdown 或 FormatHTML
+func Write(w io.Writer, r Report, format string) error {
+	switch format {
+	case FormatMarkdown, "markdown":
+		return Markdown(w, r)
+	case FormatHTML:
+		return HTML(w, r)
+	default:
+		return fmt.Errorf("不支持的报告格式: %s", format)
+	}
+}
+
+// Markdown 输出 Markdown 格式的报告
+func Markdown(w io.Writer, r Report) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", cell(r.Title))
+	fmt.Fprintf(&b, "- 会话: `%s`\n", r.Session)
+	fmt.Fprintf(&b, "- 时间: %s ~ %s（%s）\n", formatTime(r.Start), formatTime(r.End), formatDuration(r.Duration))
+	fmt.Fprintf(&b, "- 消息: %d 条，客户端 %d 条，服务器 %d 条\n", r.Packets, r.Client, r.Server)
+	fmt.Fprintf(&b, "- 解码失败: %d 条，调试注入: %d 条\n", len(r.Failures), len(r.Injected))
+	fmt.Fprintf(&b, "- 生成时间: %s\n", formatTime(r.Generated))
+
+	b.WriteString("\n## 命令频率\n\n")
+	b.WriteString("| 命令 | 方向 | 次数 | 字节数 | 备注 |\n|---|---|---:|---:|---|\n")
+	for _, c := range r.Commands {
+		fmt.Fprintf(&b, "| %s | %s | %d | %d | %s |\n", cell(c.Cmd), callName(c.Call), c.Count, c.Bytes, cell(c.Note))
+	}
+
+	b.WriteString("\n## 请求延迟（毫秒）\n\n")
+	if len(r.Latency) == 0 {
+		b.WriteString("没有找到请求和回复。\n")
+	} else {
+		b.WriteString("| 请求 | 次数 | P50 | P90 | P99 | 最大 | 备注 |\n|---|---:|---:|---:|---:|---:|---|\n")
+		for _, l := range r.Latency {
+			fmt.Fprintf(&b, "| %s | %d | %s | %s | %s | %s | %s |\n", cell(l.Cmd), l.Count, ms(l.P50), ms(l.P90), ms(l.P99), ms(l.Max), cell(l.Note))
+		}
+	}
+
+	b.WriteString("\n## 解码失败\n\n")
+	if len(r.Failures) == 0 {
+		b.WriteString("无。\n")
+	} else {
+		b.WriteString("| 时间 | 方向 | 字节数 | 错误 |\n|---|---|---:|---|\n")
+		for _, f := range r.Failures {
+			fmt.Fprintf(&b, "| %s | %s | %d | %s |\n", formatTime(f.Time), callName(f.Call), f.Bytes, cell(f.Error))
+		}
+	}
+
+	b.WriteString("\n## 调试注入的消息\n\n")
+	if len(r.Injected) == 0 {
+		b.WriteString("无。\n")
+	} else {
+		b.WriteString("| 时间 | 方向 | 命令 | seq | resp | 延迟 | 备注 |\n|---|---|---|---:|---:|---:|---|\n")
+		for _, e := range r.Injected {
+			fmt.Fprintf(&b, "| %s | %s | %s | %d | %d | %s | %s |\n", formatTime(e.Time), callName(e.Call), cell(e.Cmd), e.Seq, e.Resp, latency(e), cell(e.Note))
+		}
+	}
+
+	b.WriteString("\n## 时间线\n\n")
+	b.WriteString("| 偏移 | 方向 | 命令 | 次数 | 延迟 | 备注 |\n|---|---|---|---:|---:|---|\n")
+	for _, e := range r.Timeline {
+		cmd := cell(e.Cmd)
+		if e.Injected {
+			cmd += " （注入）"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %d | %s | %s |\n", formatDuration(e.Offset), callName(e.Call), cmd, e.Count, latency(e), cell(e.Note))
+	}
+	if r.Truncated > 0 {
+		fmt.Fprintf(&b, "\n另有 %d 条消息没有显示。\n", r.Truncated)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// HTML 输出单文件 HTML 格式的报告，样式内嵌，不引用外部资源
+func HTML(w io.Writer, r Report) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time":     formatTime,
+	"duration": formatDuration,
+	"call":     callName,
+	"ms":       ms,
+	"latency":  latency,
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "Microsoft YaHei", sans-serif; margin: 24px; color: #303133; }
+h1 { font-size: 22px; } h2 { font-size: 18px; margin-top: 28px; border-bottom: 1px solid #ebeef5; padding-bottom: 4px; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { border: 1px solid #ebeef5; padding: 4px 8px; text-align: left; }
+th { background: #f5f7fa; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.client { color: #409EFF; } .server { color: #67C23A; }
+.injected { background: #fdf6ec; }
+.note { color: #E6A23C; }
+.muted { color: #909399; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+<li>会话: <code>{{.Session}}</code></li>
+<li>时间: {{time .Start}} ~ {{time .End}}（{{duration .Duration}}）</li>
+<li>消息: {{.Packets}} 条，客户端 {{.Client}} 条，服务器 {{.Server}} 条</li>
+<li>解码失败: {{len .Failures}} 条，调试注入: {{len .Injected}} 条</li>
+<li class="muted">生成时间: {{time .Generated}}</li>
+</ul>
+
+<h2>命令频率</h2>
+<table>
+<tr><th>命令</th><th>方向</th><th>次数</th><th>字节数</th><th>备注</th></tr>
+{{range .Commands}}<tr><td>{{.Cmd}}</td><td class="{{.Call}}">{{call .Call}}</td><td class="num">{{.Count}}</td><td class="num">{{.Bytes}}</td><td class="note">{{.Note}}</td></tr>
+{{end}}</table>
+
+<h2>请求延迟（毫秒）</h2>
+{{if .Latency}}<table>
+<tr><th>请求</th><th>次数</th><th>P50</th><th>P90</th><th>P99</th><th>最大</th><th>备注</th></tr>
+{{range .Latency}}<tr><td>{{.Cmd}}</td><td class="num">{{.Count}}</td><td class="num">{{ms .P50}}</td><td class="num">{{ms .P90}}</td><td class="num">{{ms .P99}}</td><td class="num">{{ms .Max}}</td><td class="note">{{.Note}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">没有找到请求和回复。</p>{{end}}
+
+<h2>解码失败</h2>
+{{if .Failures}}<table>
+<tr><th>时间</th><th>方向</th><th>字节数</th><th>错误</th></tr>
+{{range .Failures}}<tr><td>{{time .Time}}</td><td class="{{.Call}}">{{call .Call}}</td><td class="num">{{.Bytes}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">无。</p>{{end}}
+
+<h2>调试注入的消息</h2>
+{{if .Injected}}<table>
+<tr><th>时间</th><th>方向</th><th>命令</th><th>seq</th><th>resp</th><th>延迟</th><th>备注</th></tr>
+{{range .Injected}}<tr><td>{{time .Time}}</td><td class="{{.Call}}">{{call .Call}}</td><td>{{.Cmd}}</td><td class="num">{{.Seq}}</td><td class="num">{{.Resp}}</td><td class="num">{{latency .}}</td><td class="note">{{.Note}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">无。</p>{{end}}
+
+<h2>时间线</h2>
+<table>
+<tr><th>偏移</th><th>方向</th><th>命令</th><th>次数</th><th>延迟</th><th>备注</th></tr>
+{{range .Timeline}}<tr{{if .Injected}} class="injected"{{end}}><td class="num">{{duration .Offset}}</td><td class="{{.Call}}">{{call .Call}}</td><td>{{.Cmd}}{{if .Injected}} （注入）{{end}}</td><td class="num">{{.Count}}</td><td class="num">{{latency .}}</td><td class="note">{{.Note}}</td></tr>
+{{end}}</table>
+{{if .Truncated}}<p class="muted">另有 {{.Truncated}} 条消息没有显示。</p>{{end}}
+</body>
+</html>
+`))
+
+// cell 转义 Markdown 表格单元格中的竖线和换行
+func cell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func callName(call string) string {
+	if call == "client" {
+		return "客户端"
+	}
+	return "服务器"
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05.000")
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+func ms(v float64) string {
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+// latency 回复的延迟，没有对应的请求时为空
+func latency(e Event) string {
+	if e.Request == "" {
+		return ""
+	}
+	return ms(e.Latency)
+}
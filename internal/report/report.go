@@ -0,0 +1,228 @@
+package report
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"xyzw_study/internal/msgpath"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/record"
+)
+
+// DefaultTimeline 时间线默认最多显示的行数
+const DefaultTimeline = 500
+
+// Options 生成报告的选项
+type Options struct {
+	Title       string // 标题，为空时使用会话ID
+	MaxTimeline int    // 时间线最多显示的行数，不大于 0 时使用 DefaultTimeline
+}
+
+// Report 一个会话的摘要报告
+type Report struct {
+	Title     string        `json:"title"`
+	Session   string        `json:"session"`
+	Generated time.Time     `json:"generated"` // 生成时间
+	Start     time.Time     `json:"start"`     // 第一条消息的时间
+	End       time.Time     `json:"end"`       // 最后一条消息的时间
+	Duration  time.Duration `json:"duration"`
+	Packets   int           `json:"packets"` // 消息总数
+	Client    int           `json:"client"`  // 客户端发出的消息数
+	Server    int           `json:"server"`  // 服务器发出的消息数
+
+	Commands  []CommandStat `json:"commands"`  // 命令频率，按次数倒序
+	Latency   []LatencyStat `json:"latency"`   // 请求到回复的延迟，按请求命令
+	Timeline  []Event       `json:"timeline"`  // 时间线，连续相同的消息合并为一行
+	Truncated int           `json:"truncated"` // 超出行数没有显示在时间线中的消息数
+	Failures  []Failure     `json:"failures"`  // 无法解码的消息
+	Injected  []Event       `json:"injected"`  // 调试注入的消息及其回复
+}
+
+// CommandStat 一个命令在一个方向上的出现次数
+type CommandStat struct {
+	Cmd   string `json:"cmd"`
+	Call  string `json:"call"` // "client" 或 "server"
+	Count int    `json:"count"`
+	Bytes int    `json:"bytes"` // 原始帧的总字节数
+	Note  string `json:"note,omitempty"`
+}
+
+// LatencyStat 一个请求命令从发出到收到回复的延迟，单位毫秒
+type LatencyStat struct {
+	Cmd   string  `json:"cmd"`
+	Count int     `json:"count"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+	Note  string  `json:"note,omitempty"`
+}
+
+// Event 时间线中的一行
+type Event struct {
+	Time     time.Time     `json:"time"`
+	Offset   time.Duration `json:"offset"` // 距第一条消息的时间
+	Call     string        `json:"call"`
+	Cmd      string        `json:"cmd"`
+	Seq      int64         `json:"seq,omitempty"`
+	Resp     int64         `json:"resp,omitempty"`
+	Count    int           `json:"count"`             // 连续出现的次数
+	Latency  float64       `json:"latency,omitempty"` // 回复的延迟，单位毫秒
+	Request  string        `json:"request,omitempty"` // 回复对应的请求命令
+	Injected bool          `json:"injected,omitempty"`
+	Note     string        `json:"note,omitempty"`
+}
+
+// Failure 一条无法解码的消息
+type Failure struct {
+	Time  time.Time `json:"time"`
+	Call  string    `json:"call"`
+	Bytes int       `json:"bytes"` // 原始帧的字节数
+	Error string    `json:"error"`
+}
+
+// Build 根据一个会话的抓包记录生成报告，records 按时间顺序排列
+// n 中的命令备注显示在各命令旁边
+func Build(session string, records []record.Record, n notes.Notes, opts Options) Report {
+	if opts.MaxTimeline <= 0 {
+		opts.MaxTimeline = DefaultTimeline
+	}
+	r := Report{
+		Title:     opts.Title,
+		Session:   session,
+		Generated: time.Now(),
+		Commands:  []CommandStat{},
+		Latency:   []LatencyStat{},
+		Timeline:  []Event{},
+		Failures:  []Failure{},
+		Injected:  []Event{},
+	}
+	if r.Title == "" {
+		r.Title = "会话报告 " + session
+	}
+	if len(records) == 0 {
+		return r
+	}
+	r.Start = records[0].Time
+	r.End = records[len(records)-1].Time
+	r.Duration = r.End.Sub(r.Start)
+	note := func(cmd string) string { return n.CommandNotes[cmd] }
+
+	commands := make(map[[2]string]*CommandStat)
+	latencies := make(map[string][]float64)
+	matcher := record.NewMatcher()
+	for _, rec := range records {
+		r.Packets++
+		if rec.Call == "client" {
+			r.Client++
+		} else {
+			r.Server++
+		}
+		size := len(rec.Raw) / 2
+
+		msg, err := rec.Value()
+		if err != nil {
+			r.Failures = append(r.Failures, Failure{Time: rec.Time, Call: rec.Call, Bytes: size, Error: err.Error()})
+			continue
+		}
+		cmd, _ := msg["cmd"].(string)
+		ev := Event{
+			Time:     rec.Time,
+			Offset:   rec.Time.Sub(r.Start),
+			Call:     rec.Call,
+			Cmd:      cmd,
+			Seq:      msgpath.Int(msg["seq"]),
+			Resp:     msgpath.Int(msg["resp"]),
+			Count:    1,
+			Injected: rec.Injected,
+			Note:     note(cmd),
+		}
+
+		key := [2]string{cmd, rec.Call}
+		stat := commands[key]
+		if stat == nil {
+			stat = &CommandStat{Cmd: cmd, Call: rec.Call, Note: ev.Note}
+			commands[key] = stat
+		}
+		stat.Count++
+		stat.Bytes += size
+
+		// 调试伪造的服务器消息的 resp 是客户端看到的序号，不与请求配对
+		if rec.Call == "client" {
+			matcher.Request(cmd, ev.Seq, rec.Time, rec.Injected)
+		} else if req, ok := matcher.Find(ev.Resp, rec.Injected); ok && !rec.Forged {
+			ev.Request = req.Cmd
+			if d := rec.Time.Sub(req.Time); d >= 0 {
+				ev.Latency = float64(d.Microseconds()) / 1000
+				latencies[req.Cmd] = append(latencies[req.Cmd], ev.Latency)
+			}
+		}
+
+		if rec.Injected {
+			r.Injected = append(r.Injected, ev)
+		}
+		r.addTimeline(ev, opts.MaxTimeline)
+	}
+
+	for _, stat := range commands {
+		r.Commands = append(r.Commands, *stat)
+	}
+	slices.SortFunc(r.Commands, func(a, b CommandStat) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		if c := strings.Compare(a.Cmd, b.Cmd); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Call, b.Call)
+	})
+
+	for _, cmd := range slices.Sorted(maps.Keys(latencies)) {
+		values := latencies[cmd]
+		slices.Sort(values)
+		r.Latency = append(r.Latency, LatencyStat{
+			Cmd:   cmd,
+			Count: len(values),
+			P50:   percentile(values, 50),
+			P90:   percentile(values, 90),
+			P99:   percentile(values, 99),
+			Max:   values[len(values)-1],
+			Note:  note(cmd),
+		})
+	}
+	return r
+}
+
+// addTimeline 添加时间线的一行，与上一行方向和命令相同时合并
+func (r *Report) addTimeline(ev Event, max int) {
+	if r.Truncated > 0 {
+		r.Truncated++
+		return
+	}
+	if n := len(r.Timeline); n > 0 {
+		last := &r.Timeline[n-1]
+		if last.Call == ev.Call && last.Cmd == ev.Cmd && last.Injected == ev.Injected {
+			last.Count++
+			return
+		}
+	}
+	if len(r.Timeline) >= max {
+		r.Truncated++
+		return
+	}
+	r.Timeline = append(r.Timeline, ev)
+}
+
+// percentile 使用最近秩法计算百分位数，values 已排序
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1]
+}
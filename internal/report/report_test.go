@@ -0,0 +1,125 @@
+package report
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/record"
+)
+
+func TestBuild(t *testing.T) {
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+	records := []record.Record{
+		{Time: at, Call: "client", Msg: json.RawMessage(`{"cmd":"role_getroleinfo","seq":1}`)},
+		{Time: at.Add(20 * ms), Call: "server", Msg: json.RawMessage(`{"cmd":"Role_GetRoleInfoResp","resp":1}`)},
+		// 注入的请求占用服务器的序号 2，之后客户端的序号 2 在抓包中是 3
+		{Time: at.Add(100 * ms), Call: "client", Injected: true, Msg: json.RawMessage(`{"cmd":"debug_test","seq":2}`)},
+		{Time: at.Add(150 * ms), Call: "server", Injected: true, Msg: json.RawMessage(`{"cmd":"DebugTestResp","resp":2}`)},
+		{Time: at.Add(200 * ms), Call: "client", Msg: json.RawMessage(`{"cmd":"item_openpack","seq":3}`)},
+		{Time: at.Add(240 * ms), Call: "server", Msg: json.RawMessage(`{"cmd":"Item_OpenBoxResp","resp":2}`)},
+		{Time: at.Add(300 * ms), Call: "server", Raw: "zz"},
+	}
+	for i := 0; i < 10; i++ {
+		sent := at.Add(time.Second + time.Duration(i)*time.Second)
+		seq := i + 4
+		records = append(records,
+			record.Record{Time: sent, Call: "client", Msg: json.RawMessage(`{"cmd":"item_openpack","seq":` + strconv.Itoa(seq) + `}`)},
+			record.Record{Time: sent.Add(time.Duration(i+1) * 10 * ms), Call: "server", Msg: json.RawMessage(`{"cmd":"Item_OpenBoxResp","resp":` + strconv.Itoa(seq-1) + `}`)},
+		)
+	}
+	n := notes.New()
+	n.CommandNotes["item_openpack"] = "打开宝箱"
+
+	r := Build("s1", records, n, Options{MaxTimeline: 5})
+	if r.Packets != len(records) || r.Client != 13 || r.Server != 14 {
+		t.Errorf("packets = %d client = %d server = %d", r.Packets, r.Client, r.Server)
+	}
+	if len(r.Failures) != 1 || r.Failures[0].Call != "server" {
+		t.Errorf("failures = %+v", r.Failures)
+	}
+	if len(r.Injected) != 2 || r.Injected[1].Request != "debug_test" || r.Injected[1].Latency != 50 {
+		t.Errorf("injected = %+v", r.Injected)
+	}
+	if len(r.Commands) == 0 || r.Commands[0].Cmd != "Item_OpenBoxResp" || r.Commands[0].Count != 11 {
+		t.Errorf("commands = %+v", r.Commands)
+	}
+
+	latency := map[string]LatencyStat{}
+	for _, l := range r.Latency {
+		latency[l.Cmd] = l
+	}
+	// item_openpack 的延迟为 40ms 和 10ms ~ 100ms
+	open := latency["item_openpack"]
+	if open.Count != 11 || open.P50 != 50 || open.P90 != 90 || open.P99 != 100 || open.Max != 100 || open.Note != "打开宝箱" {
+		t.Errorf("item_openpack = %+v", open)
+	}
+	if l := latency["role_getroleinfo"]; l.Count != 1 || l.Max != 20 {
+		t.Errorf("role_getroleinfo = %+v", l)
+	}
+
+	if len(r.Timeline) != 5 || r.Truncated != len(records)-len(r.Failures)-5 {
+		t.Errorf("timeline = %d truncated = %d", len(r.Timeline), r.Truncated)
+	}
+}
+
+// TestBuildForged 调试伪造的服务器消息不与注入的请求配对
+func TestBuildForged(t *testing.T) {
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+	records := []record.Record{
+		{Time: at, Call: "client", Msg: json.RawMessage(`{"cmd":"role_getroleinfo","seq":1}`)},
+		{Time: at.Add(20 * ms), Call: "server", Msg: json.RawMessage(`{"cmd":"Role_GetRoleInfoResp","resp":1}`)},
+		// 注入的请求占用服务器看到的 seq 2
+		{Time: at.Add(100 * ms), Call: "client", Injected: true, Msg: json.RawMessage(`{"cmd":"system_buygold","seq":2}`)},
+		// 客户端的 seq 2 在抓包中是 3，伪造的回复 resp 为客户端看到的 2
+		{Time: at.Add(200 * ms), Call: "client", Msg: json.RawMessage(`{"cmd":"item_openpack","seq":3}`)},
+		{Time: at.Add(210 * ms), Call: "server", Injected: true, Forged: true, Msg: json.RawMessage(`{"cmd":"Item_OpenBoxResp","resp":2}`)},
+		{Time: at.Add(300 * ms), Call: "server", Injected: true, Msg: json.RawMessage(`{"cmd":"System_BuyGoldResp","resp":2}`)},
+	}
+	r := Build("s1", records, notes.New(), Options{})
+
+	if len(r.Injected) != 3 {
+		t.Fatalf("injected = %+v", r.Injected)
+	}
+	if forged := r.Injected[1]; forged.Cmd != "Item_OpenBoxResp" || forged.Request != "" || forged.Latency != 0 {
+		t.Errorf("forged = %+v", forged)
+	}
+	if reply := r.Injected[2]; reply.Request != "system_buygold" || reply.Latency != 200 {
+		t.Errorf("injected reply = %+v", reply)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	records := []record.Record{
+		{Time: at, Call: "client", Msg: json.RawMessage(`{"cmd":"item_openpack","seq":1}`)},
+		{Time: at.Add(time.Second), Call: "server", Msg: json.RawMessage(`{"cmd":"Item_OpenBoxResp","resp":1}`)},
+	}
+	n := notes.New()
+	n.CommandNotes["item_openpack"] = "打开<宝箱>|道具"
+	r := Build("s1", records, n, Options{})
+
+	var md strings.Builder
+	if err := Write(&md, r, FormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(md.String(), `| item_openpack | 客户端 | 1 | 0 | 打开<宝箱>\|道具 |`) {
+		t.Errorf("markdown:\n%s", md.String())
+	}
+
+	var html strings.Builder
+	if err := Write(&html, r, FormatHTML); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), "打开&lt;宝箱&gt;|道具") || !strings.Contains(html.String(), "1000.0") {
+		t.Errorf("html:\n%s", html.String())
+	}
+
+	if err := Write(&md, r, "pdf"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
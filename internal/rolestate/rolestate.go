@@ -0,0 +1,348 @@
+package rolestate
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"xyzw_study/internal/msgpath"
+)
+
+// FullCmd 返回完整角色信息的命令，收到时替换整个角色状态
+const FullCmd = "Role_GetRoleInfoResp"
+
+// DefaultLimit 每个会话保留的最近变化数
+const DefaultLimit = 1000
+
+// 变化的类型
+const (
+	KindResource = "resource" // 角色的数值字段，例如 gold、diamond、level
+	KindItem     = "item"     // 道具，role.items
+	KindHero     = "hero"     // 武将，role.heroes
+	KindOther    = "other"    // 其他字段
+)
+
+// Change 一次更新中一个字段的变化
+type Change struct {
+	ID      int64     `json:"id"`              // 变化序号，同一个 Tracker 内递增
+	Time    time.Time `json:"time"`            // 消息时间
+	Session string    `json:"session"`         // 会话ID
+	Cmd     string    `json:"cmd"`             // 带来变化的消息命令
+	Seq     int64     `json:"seq,omitempty"`   // 消息的 seq
+	Resp    int64     `json:"resp,omitempty"`  // 消息回复的请求序号
+	Kind    string    `json:"kind"`            // 变化类型
+	Key     string    `json:"key"`             // 资源名、道具ID或武将ID
+	Path    string    `json:"path"`            // 相对 role 的字段路径，例如 items.3010.quantity
+	Old     any       `json:"old"`             // 原来的值，没有时为 null
+	New     any       `json:"new"`             // 新的值
+	Delta   float64   `json:"delta,omitempty"` // 数值变化量，不是数值时为 0
+}
+
+// Snapshot 一个会话的角色状态
+type Snapshot struct {
+	Session   string                    `json:"session"`   // 会话ID
+	Loaded    bool                      `json:"loaded"`    // 是否收到过完整角色信息，否则只有增量更新的字段
+	UpdatedAt time.Time                 `json:"updatedAt"` // 最近一次更新时间
+	Role      map[string]any            `json:"role"`      // 合并后的完整角色数据
+	Resources map[string]any            `json:"resources"` // 角色的数值字段
+	Items     map[string]float64        `json:"items"`     // 道具数量，道具ID -> 数量
+	Heroes    map[string]map[string]any `json:"heroes"`    // 武将，武将ID -> 武将数据
+	Changes   []Change                  `json:"changes"`   // 最近的变化，按时间顺序
+}
+
+// Tracker 根据服务器消息维护各会话的角色状态，可以被多个协程并发使用
+//
+// 收到 Role_GetRoleInfoResp 时使用 body.role 替换角色状态，
+// 其他服务器消息（例如 SyncRewardResp、Item_OpenBoxResp）中的 body.role 是增量数据，合并到角色状态中
+type Tracker struct {
+	limit int
+
+	mu       sync.Mutex
+	sessions map[string]*state
+	lastID   int64
+}
+
+type state struct {
+	loaded    bool
+	updatedAt time.Time
+	role      map[string]any
+	changes   []Change
+}
+
+// New 创建 Tracker，limit 为每个会话保留的最近变化数，不大于 0 时使用 DefaultLimit
+func New(limit int) *Tracker {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &Tracker{limit: limit, sessions: make(map[string]*state)}
+}
+
+// Message 解码 JSON 消息并更新角色状态，不是 JSON 或不带角色数据的消息返回 nil
+func (t *Tracker) Message(session string, at time.Time, data string) []Change {
+	// 大部分消息不带角色数据，先粗略判断避免解码
+	if !strings.Contains(data, `"role"`) {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	var msg map[string]any
+	if err := dec.Decode(&msg); err != nil {
+		return nil
+	}
+	return t.Apply(session, at, msg)
+}
+
+// Apply 使用一条服务器消息更新角色状态，返回这条消息带来的变化
+func (t *Tracker) Apply(session string, at time.Time, msg map[string]any) []Change {
+	body, _ := msg["body"].(map[string]any)
+	role, ok := body["role"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	role = normalize(role).(map[string]any)
+	cmd, _ := msg["cmd"].(string)
+	full := strings.EqualFold(cmd, FullCmd)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.sessions[session]
+	if s == nil {
+		s = &state{role: make(map[string]any)}
+		t.sessions[session] = s
+	}
+
+	var changes []Change
+	// 第一次收到完整角色信息时没有可以比较的状态，不记录变化
+	if s.loaded || !full {
+		for path, v := range msgpath.Flatten(role) {
+			old, exists := msgpath.Get(s.role, path)
+			if exists && equal(old, v) {
+				continue
+			}
+			if !exists {
+				old = nil
+			}
+			kind, key := classify(path)
+			c := Change{
+				Time:    at,
+				Session: session,
+				Cmd:     cmd,
+				Seq:     msgpath.Int(msg["seq"]),
+				Resp:    msgpath.Int(msg["resp"]),
+				Kind:    kind,
+				Key:     key,
+				Path:    path,
+				Old:     old,
+				New:     v,
+			}
+			if n, ok := number(v); ok {
+				o, _ := number(old)
+				c.Delta = n - o
+			}
+			changes = append(changes, c)
+		}
+		slices.SortFunc(changes, func(a, b Change) int { return strings.Compare(a.Path, b.Path) })
+		for i := range changes {
+			t.lastID++
+			changes[i].ID = t.lastID
+		}
+	}
+
+	if full {
+		s.role = clone(role).(map[string]any)
+		s.loaded = true
+	} else {
+		merge(s.role, role)
+	}
+	s.updatedAt = at
+	s.changes = append(s.changes, changes...)
+	if len(s.changes) > t.limit {
+		s.changes = slices.Clone(s.changes[len(s.changes)-t.limit:])
+	}
+	return changes
+}
+
+// Sessions 返回所有有角色状态的会话，最近更新的在前
+func (t *Tracker) Sessions() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := slices.Collect(maps.Keys(t.sessions))
+	slices.SortFunc(ids, func(a, b string) int {
+		return t.sessions[b].updatedAt.Compare(t.sessions[a].updatedAt)
+	})
+	return ids
+}
+
+// Snapshot 返回会话的角色状态，session 为空时返回最近更新的会话
+// since 大于 0 时只返回序号大于 since 的变化
+func (t *Tracker) Snapshot(session string, since int64) (Snapshot, bool) {
+	if session == "" {
+		ids := t.Sessions()
+		if len(ids) == 0 {
+			return Snapshot{}, false
+		}
+		session = ids[0]
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.sessions[session]
+	if s == nil {
+		return Snapshot{}, false
+	}
+	role := clone(s.role).(map[string]any)
+	snap := Snapshot{
+		Session:   session,
+		Loaded:    s.loaded,
+		UpdatedAt: s.updatedAt,
+		Role:      role,
+		Resources: make(map[string]any),
+		Items:     make(map[string]float64),
+		Heroes:    make(map[string]map[string]any),
+		Changes:   []Change{},
+	}
+	for k, v := range role {
+		if _, ok := number(v); ok {
+			snap.Resources[k] = v
+		}
+	}
+	items, _ := role["items"].(map[string]any)
+	for id, v := range items {
+		if n, ok := quantity(v); ok {
+			snap.Items[id] = n
+		}
+	}
+	heroes, _ := role["heroes"].(map[string]any)
+	for id, v := range heroes {
+		if h, ok := v.(map[string]any); ok {
+			snap.Heroes[id] = h
+		}
+	}
+	for _, c := range s.changes {
+		if c.ID > since {
+			snap.Changes = append(snap.Changes, c)
+		}
+	}
+	return snap, true
+}
+
+// classify 根据相对 role 的路径判断变化类型
+func classify(path string) (kind, key string) {
+	segs := strings.Split(path, ".")
+	switch {
+	case len(segs) >= 2 && segs[0] == "items":
+		return KindItem, segs[1]
+	case len(segs) >= 2 && segs[0] == "heroes":
+		return KindHero, segs[1]
+	case len(segs) == 1:
+		return KindResource, segs[0]
+	default:
+		return KindOther, path
+	}
+}
+
+// quantity 返回道具数量，道具可以是数量，也可以是带 quantity 字段的对象
+func quantity(v any) (float64, bool) {
+	if obj, ok := v.(map[string]any); ok {
+		v = obj["quantity"]
+	}
+	return number(v)
+}
+
+// merge 将增量数据合并到 dst，对象逐个字段合并，其他值直接替换
+func merge(dst, src map[string]any) {
+	for k, v := range src {
+		if sub, ok := v.(map[string]any); ok {
+			if cur, ok := dst[k].(map[string]any); ok {
+				merge(cur, sub)
+				continue
+			}
+		}
+		dst[k] = clone(v)
+	}
+}
+
+// normalize 将 json.Number 和 BON 解码得到的各种数值类型统一为 int64 或 float64
+func normalize(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case int, int8, int16, int32, uint8, uint16, uint32:
+		n, _ := number(val)
+		return int64(n)
+	case float32:
+		return float64(val)
+	case map[string]any:
+		for k, item := range val {
+			val[k] = normalize(item)
+		}
+	case []any:
+		for i, item := range val {
+			val[i] = normalize(item)
+		}
+	}
+	return v
+}
+
+func clone(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(val))
+		for k, item := range val {
+			m[k] = clone(item)
+		}
+		return m
+	case []any:
+		s := make([]any, len(val))
+		for i, item := range val {
+			s[i] = clone(item)
+		}
+		return s
+	}
+	return v
+}
+
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return msgpath.String(a) == msgpath.String(b)
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
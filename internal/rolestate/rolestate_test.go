@@ -0,0 +1,70 @@
+package rolestate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	tr := New(0)
+	at := time.Unix(1700000000, 0)
+
+	// 收到完整角色信息前的增量数据也会记录
+	if c := tr.Message("s1", at, `{"cmd":"SyncRewardResp","seq":3,"body":{"role":{"gold":100}}}`); len(c) != 1 || c[0].Delta != 100 {
+		t.Fatalf("sync before full = %+v", c)
+	}
+	if snap, _ := tr.Snapshot("s1", 0); snap.Loaded {
+		t.Error("loaded before Role_GetRoleInfoResp")
+	}
+
+	full := `{"cmd":"Role_GetRoleInfoResp","resp":1,"body":{"role":{"gold":500,"diamond":20,"name":"玩家",
+		"items":{"3010":{"itemId":3010,"quantity":5}},"heroes":{"101":{"heroId":101,"level":10}}}}}`
+	if c := tr.Message("s1", at, full); len(c) != 0 {
+		t.Errorf("first full load changes = %+v", c)
+	}
+
+	c := tr.Message("s1", at.Add(time.Second), `{"cmd":"Item_OpenBoxResp","seq":9,"resp":4,"body":{"role":{
+		"gold":480,"items":{"3010":{"quantity":4},"3011":{"itemId":3011,"quantity":1}}},"reward":[{"type":1}]}}`)
+	want := map[string]float64{"gold": -20, "items.3010.quantity": -1, "items.3011.itemId": 3011, "items.3011.quantity": 1}
+	if len(c) != len(want) {
+		t.Fatalf("changes = %+v", c)
+	}
+	for _, ch := range c {
+		if d, ok := want[ch.Path]; !ok || ch.Delta != d || ch.Cmd != "Item_OpenBoxResp" || ch.Resp != 4 {
+			t.Errorf("change %+v", ch)
+		}
+	}
+	if c[0].Kind != KindResource || c[1].Kind != KindItem || c[1].Key != "3010" {
+		t.Errorf("kinds = %+v", c[:2])
+	}
+
+	snap, ok := tr.Snapshot("", c[0].ID-1)
+	if !ok || !snap.Loaded || snap.Session != "s1" {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+	if snap.Items["3010"] != 4 || snap.Items["3011"] != 1 || snap.Resources["gold"] != int64(480) || snap.Heroes["101"]["level"] != int64(10) {
+		t.Errorf("snapshot = %+v", snap)
+	}
+	if _, ok := snap.Resources["name"]; ok {
+		t.Error("string field in resources")
+	}
+	if len(snap.Changes) != 4 {
+		t.Errorf("changes since = %d", len(snap.Changes))
+	}
+
+	// 不带角色数据的消息不影响状态
+	if c := tr.Message("s1", at, `{"cmd":"System_NewChatMessageNotify","body":{"text":"role"}}`); c != nil {
+		t.Errorf("chat changes = %+v", c)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	tr := New(2)
+	for i := 0; i < 5; i++ {
+		tr.Apply("s", time.Now(), map[string]any{"cmd": "SyncRewardResp", "body": map[string]any{"role": map[string]any{"gold": int32(i + 1)}}})
+	}
+	snap, _ := tr.Snapshot("s", 0)
+	if len(snap.Changes) != 2 || snap.Changes[1].New != int64(5) || snap.Changes[1].Delta != 1 {
+		t.Errorf("changes = %+v", snap.Changes)
+	}
+}
@@ -0,0 +1,440 @@
+package scripts
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+	"xyzw_study/internal/atomicfile"
+)
+
+// 修订记录的操作类型
+const (
+	ActionCreate  = "create"  // 新建脚本
+	ActionUpdate  = "update"  // 修改脚本
+	ActionDelete  = "delete"  // 删除脚本，内容保留在修订记录中
+	ActionRestore = "restore" // 恢复到历史版本或恢复已删除的脚本
+	ActionImport  = "import"  // 修订记录功能之前保存的脚本，第一次修改前记录原内容
+)
+
+var (
+	// ErrNotFound 表示脚本或修订版本不存在
+	ErrNotFound = errors.New("脚本不存在")
+	// ErrInvalidID 表示脚本ID包含不允许的字符
+	ErrInvalidID = errors.New("无效的脚本ID")
+
+	validID = regexp.MustCompile(`^[0-9A-Za-z_-]{1,64}$`)
+)
+
+// Script 定义脚本数据结构
+type Script struct {
+	ID        string     `json:"id"`                  // 脚本ID
+	Name      string     `json:"name"`                // 脚本名称
+	Content   string     `json:"content"`             // 脚本内容
+	Enabled   bool       `json:"enabled"`             // 是否启用
+	CreatedAt time.Time  `json:"createdAt"`           // 创建时间
+	UpdatedAt time.Time  `json:"updatedAt"`           // 更新时间
+	DeletedAt *time.Time `json:"deletedAt,omitempty"` // 删除时间，删除的脚本可以恢复
+}
+
+// Revision 脚本的一个历史版本，修订记录只追加不修改
+type Revision struct {
+	Rev     int       `json:"rev"`            // 版本号，从 1 开始
+	Time    time.Time `json:"time"`           // 修改时间
+	Author  string    `json:"author"`         // 修改人
+	Action  string    `json:"action"`         // 操作类型
+	From    int       `json:"from,omitempty"` // 恢复操作使用的版本号
+	Name    string    `json:"name"`           // 脚本名称
+	Content string    `json:"content"`        // 脚本内容
+	Enabled bool      `json:"enabled"`        // 是否启用
+}
+
+// file 脚本文件格式
+type file struct {
+	Scripts []Script `json:"scripts"`
+}
+
+// NewID 生成脚本ID，由创建时间和随机数组成，同一秒创建的脚本也不会重复
+func NewID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().Format("20060102150405") + "-" + hex.EncodeToString(b)
+}
+
+// Store 保存脚本文件和每个脚本的修订记录，可以被多个请求并发使用
+//
+// 脚本列表写入 path，修订记录按脚本保存在同目录 script_history/<id>.jsonl 中，每行一个版本
+// 删除脚本只标记删除时间，可以通过 Restore 恢复
+type Store struct {
+	path       string
+	historyDir string
+
+	mu      sync.Mutex
+	scripts []Script
+	modTime time.Time
+	size    int64
+}
+
+// Open 打开脚本文件，文件不存在时创建空脚本列表
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:       path,
+		historyDir: filepath.Join(filepath.Dir(path), "script_history"),
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := s.write(nil); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List 返回未删除的脚本
+func (s *Store) List() ([]Script, error) {
+	return s.filter(func(sc Script) bool { return sc.DeletedAt == nil })
+}
+
+// Deleted 返回已删除的脚本
+func (s *Store) Deleted() ([]Script, error) {
+	return s.filter(func(sc Script) bool { return sc.DeletedAt != nil })
+}
+
+// All 返回包括已删除脚本在内的全部脚本
+func (s *Store) All() ([]Script, error) {
+	return s.filter(func(Script) bool { return true })
+}
+
+func (s *Store) filter(keep func(Script) bool) ([]Script, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	list := make([]Script, 0, len(s.scripts))
+	for _, sc := range s.scripts {
+		if keep(sc) {
+			list = append(list, sc)
+		}
+	}
+	return list, nil
+}
+
+// Get 返回指定的脚本，包括已删除的脚本
+func (s *Store) Get(id string) (Script, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return Script{}, err
+	}
+	i := s.index(id)
+	if i < 0 {
+		return Script{}, ErrNotFound
+	}
+	return s.scripts[i], nil
+}
+
+// Save 新建或修改脚本并记录修订版本
+// ID 为空时生成新ID，ID 不存在时使用该ID新建脚本，内容没有变化时不记录新版本
+// 保存已删除的脚本时同时取消删除
+func (s *Store) Save(sc Script, author string) (Script, error) {
+	if sc.ID == "" {
+		sc.ID = NewID()
+	}
+	if !validID.MatchString(sc.ID) {
+		return Script{}, ErrInvalidID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return Script{}, err
+	}
+
+	now := time.Now()
+	scripts := append([]Script(nil), s.scripts...)
+	i := s.index(sc.ID)
+	if i < 0 {
+		sc.CreatedAt = now
+		sc.UpdatedAt = now
+		sc.DeletedAt = nil
+		if err := s.appendRevision(sc, author, ActionCreate, 0); err != nil {
+			return Script{}, err
+		}
+		scripts = append(scripts, sc)
+		return sc, s.write(scripts)
+	}
+
+	old := scripts[i]
+	if old.Name == sc.Name && old.Content == sc.Content && old.Enabled == sc.Enabled && old.DeletedAt == nil {
+		return old, nil
+	}
+	if err := s.importRevision(old); err != nil {
+		return Script{}, err
+	}
+	sc.CreatedAt = old.CreatedAt
+	sc.UpdatedAt = now
+	sc.DeletedAt = nil
+	if err := s.appendRevision(sc, author, ActionUpdate, 0); err != nil {
+		return Script{}, err
+	}
+	scripts[i] = sc
+	return sc, s.write(scripts)
+}
+
+// Delete 删除脚本，脚本内容和修订记录都会保留，可以通过 Restore 恢复
+func (s *Store) Delete(id, author string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+	i := s.index(id)
+	if i < 0 || s.scripts[i].DeletedAt != nil {
+		return ErrNotFound
+	}
+	scripts := append([]Script(nil), s.scripts...)
+	sc := scripts[i]
+	if err := s.importRevision(sc); err != nil {
+		return err
+	}
+	now := time.Now()
+	sc.DeletedAt = &now
+	sc.Enabled = false
+	if err := s.appendRevision(sc, author, ActionDelete, 0); err != nil {
+		return err
+	}
+	scripts[i] = sc
+	return s.write(scripts)
+}
+
+// Restore 将脚本的名称和内容恢复到指定版本，已删除的脚本同时取消删除
+// rev 为 0 时只恢复已删除的脚本，保留删除前的内容
+// 恢复后的脚本保持禁用状态，避免旧版本的脚本直接开始运行
+func (s *Store) Restore(id string, rev int, author string) (Script, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return Script{}, err
+	}
+	i := s.index(id)
+	if i < 0 {
+		return Script{}, ErrNotFound
+	}
+	scripts := append([]Script(nil), s.scripts...)
+	sc := scripts[i]
+	if rev != 0 {
+		revs, err := s.revisions(id)
+		if err != nil {
+			return Script{}, err
+		}
+		j := slices.IndexFunc(revs, func(r Revision) bool { return r.Rev == rev })
+		if j < 0 {
+			return Script{}, fmt.Errorf("%w: 版本 %d", ErrNotFound, rev)
+		}
+		sc.Name = revs[j].Name
+		sc.Content = revs[j].Content
+	} else if sc.DeletedAt == nil {
+		return sc, nil
+	}
+	// 恢复到旧版本或取消删除都需要重新确认后再启用
+	sc.Enabled = false
+	sc.DeletedAt = nil
+	sc.UpdatedAt = time.Now()
+	if err := s.appendRevision(sc, author, ActionRestore, rev); err != nil {
+		return Script{}, err
+	}
+	scripts[i] = sc
+	return sc, s.write(scripts)
+}
+
+// Revisions 返回脚本的全部修订版本，按版本号排列
+func (s *Store) Revisions(id string) ([]Revision, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	if s.index(id) < 0 {
+		return nil, ErrNotFound
+	}
+	revs, err := s.revisions(id)
+	if err != nil {
+		return nil, err
+	}
+	if revs == nil {
+		revs = []Revision{}
+	}
+	return revs, nil
+}
+
+func (s *Store) index(id string) int {
+	for i, sc := range s.scripts {
+		if sc.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// revisions 读取修订记录，调用方需要持有 mu
+func (s *Store) revisions(id string) ([]Revision, error) {
+	f, err := os.Open(s.historyPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var revs []Revision
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var rev Revision
+		if err := json.Unmarshal(scanner.Bytes(), &rev); err != nil {
+			// 写入时崩溃可能留下不完整的最后一行，跳过
+			continue
+		}
+		revs = append(revs, rev)
+	}
+	return revs, scanner.Err()
+}
+
+// importRevision 没有修订记录的旧脚本在修改前先记录当前内容，调用方需要持有 mu
+func (s *Store) importRevision(sc Script) error {
+	if _, err := os.Stat(s.historyPath(sc.ID)); !os.IsNotExist(err) {
+		return err
+	}
+	rev := Revision{
+		Rev:     1,
+		Time:    sc.UpdatedAt,
+		Action:  ActionImport,
+		Name:    sc.Name,
+		Content: sc.Content,
+		Enabled: sc.Enabled,
+	}
+	return s.append(sc.ID, rev)
+}
+
+// appendRevision 追加一个修订版本，调用方需要持有 mu
+func (s *Store) appendRevision(sc Script, author, action string, from int) error {
+	revs, err := s.revisions(sc.ID)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(revs) > 0 {
+		next = revs[len(revs)-1].Rev + 1
+	}
+	rev := Revision{
+		Rev:     next,
+		Time:    time.Now(),
+		Author:  author,
+		Action:  action,
+		From:    from,
+		Name:    sc.Name,
+		Content: sc.Content,
+		Enabled: sc.Enabled,
+	}
+	return s.append(sc.ID, rev)
+}
+
+func (s *Store) append(id string, rev Revision) error {
+	if err := os.MkdirAll(s.historyDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.historyPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *Store) historyPath(id string) string {
+	return filepath.Join(s.historyDir, id+".jsonl")
+}
+
+// reload 文件被其它程序修改时重新加载，调用方需要持有 mu
+func (s *Store) reload() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	return s.load()
+}
+
+// load 从文件加载脚本，调用方需要持有 mu 或独占 Store
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.scripts = f.Scripts
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+// write 保存脚本列表，调用方需要持有 mu 或独占 Store
+func (s *Store) write(scripts []Script) error {
+	if scripts == nil {
+		scripts = []Script{}
+	}
+	data, err := json.MarshalIndent(file{Scripts: scripts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(s.path, data, 0644); err != nil {
+		return err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.scripts = scripts
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
@@ -0,0 +1,139 @@
+package scripts
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSaveRevisions(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "scripts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := s.Save(Script{Name: "统计", Content: "v1", Enabled: true}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.Content = "v2"
+	if _, err := s.Save(sc, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	// 内容没有变化时不记录新版本
+	if _, err := s.Save(sc, "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err := s.Revisions(sc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 2 || revs[0].Action != ActionCreate || revs[0].Author != "alice" || revs[1].Content != "v2" || revs[1].Author != "bob" {
+		t.Fatalf("revisions = %+v", revs)
+	}
+
+	restored, err := s.Restore(sc.ID, 1, "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Content != "v1" {
+		t.Errorf("restored content = %q", restored.Content)
+	}
+	// 恢复到旧版本后保持禁用，需要重新确认后启用
+	if got, _ := s.Get(sc.ID); restored.Enabled || got.Enabled {
+		t.Errorf("restored script enabled: %+v", got)
+	}
+	revs, _ = s.Revisions(sc.ID)
+	if last := revs[len(revs)-1]; last.Rev != 3 || last.Action != ActionRestore || last.From != 1 {
+		t.Errorf("restore revision = %+v", last)
+	}
+	if _, err := s.Restore(sc.ID, 9, "carol"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("restore missing revision: %v", err)
+	}
+}
+
+func TestDeleteRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scripts.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, _ := s.Save(Script{Name: "a", Content: "x", Enabled: true}, "")
+	if err := s.Delete(sc.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := s.List(); len(list) != 0 {
+		t.Errorf("deleted script listed: %+v", list)
+	}
+	if deleted, _ := s.Deleted(); len(deleted) != 1 {
+		t.Fatalf("deleted = %+v", deleted)
+	}
+	if err := s.Delete(sc.ID, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete twice: %v", err)
+	}
+
+	reopened, _ := Open(path)
+	restored, err := reopened.Restore(sc.ID, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Content != "x" || restored.Enabled || restored.DeletedAt != nil {
+		t.Errorf("restored = %+v", restored)
+	}
+}
+
+func TestLegacyScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scripts.json")
+	legacy := `{"scripts":[{"id":"20240101120000","name":"旧脚本","content":"old","enabled":true}]}`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, _ := s.Get("20240101120000")
+	sc.Content = "bad edit"
+	if _, err := s.Save(sc, ""); err != nil {
+		t.Fatal(err)
+	}
+	// 第一次修改前记录原内容
+	revs, _ := s.Revisions(sc.ID)
+	if len(revs) != 2 || revs[0].Action != ActionImport || revs[0].Content != "old" {
+		t.Fatalf("revisions = %+v", revs)
+	}
+	if _, err := s.Save(Script{ID: "../x"}, ""); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("path in id: %v", err)
+	}
+}
+
+func TestSaveConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scripts.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Save(Script{Name: "新脚本"}, ""); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reopened, _ := Open(path)
+	list, _ := reopened.List()
+	ids := make(map[string]bool)
+	for _, sc := range list {
+		ids[sc.ID] = true
+	}
+	if len(list) != 20 || len(ids) != 20 {
+		t.Errorf("%d scripts with %d unique ids", len(list), len(ids))
+	}
+}
@@ -0,0 +1,264 @@
+package seqmap
+
+import "sync"
+
+// AckCmd 心跳和确认消息的命令名，不占用序号
+const AckCmd = "_sys/ack"
+
+// maxEntries 每个序号空间最多保留的映射数量，超过后丢弃最早的一半
+const maxEntries = 8192
+
+// Header 定义消息中与序号相关的字段
+// Seq 为发送方的序号，Ack 为发送方收到的对方最后一个序号，Resp 为所回复请求的序号，0 表示没有
+type Header struct {
+	Cmd  string
+	Seq  int32
+	Ack  int32
+	Resp int32
+}
+
+// pair 记录一条消息在发送方和接收方看到的序号，0 表示该方看不到这条消息
+type pair struct {
+	origin int32 // 发送方看到的序号，注入的消息为 0
+	peer   int32 // 接收方看到的序号，丢弃的消息为 0
+}
+
+// space 维护一个方向的序号空间，发送方的序号连续递增，接收方看到的序号也连续递增
+type space struct {
+	originLast int32
+	peerLast   int32
+	pairs      []pair
+}
+
+func (s *space) add(p pair) {
+	s.pairs = append(s.pairs, p)
+	if len(s.pairs) > maxEntries {
+		s.pairs = append([]pair(nil), s.pairs[len(s.pairs)/2:]...)
+	}
+}
+
+// find 查找发送方序号已有的映射，用于重发的消息
+func (s *space) find(origin int32) (pair, bool) {
+	for i := len(s.pairs) - 1; i >= 0; i-- {
+		if s.pairs[i].origin == origin {
+			return s.pairs[i], true
+		}
+		if s.pairs[i].origin != 0 && s.pairs[i].origin < origin {
+			break
+		}
+	}
+	return pair{}, false
+}
+
+// forward 转发发送方的消息，返回接收方看到的序号
+func (s *space) forward(origin int32) int32 {
+	if p, ok := s.find(origin); ok && p.peer != 0 {
+		return p.peer
+	}
+	s.peerLast++
+	if origin > s.originLast {
+		s.originLast = origin
+	}
+	s.add(pair{origin: origin, peer: s.peerLast})
+	return s.peerLast
+}
+
+// drop 丢弃发送方的消息，接收方的序号不变
+func (s *space) drop(origin int32) {
+	if _, ok := s.find(origin); ok {
+		return
+	}
+	if origin > s.originLast {
+		s.originLast = origin
+	}
+	s.add(pair{origin: origin})
+}
+
+// inject 注入一条发送方不知道的消息，返回接收方看到的序号
+func (s *space) inject() int32 {
+	s.peerLast++
+	s.add(pair{peer: s.peerLast})
+	return s.peerLast
+}
+
+// resp 将接收方序号精确转换为发送方序号，injected 表示该序号属于注入的消息
+func (s *space) resp(peer int32) (origin int32, injected, ok bool) {
+	for i := len(s.pairs) - 1; i >= 0; i-- {
+		p := s.pairs[i]
+		if p.peer == peer {
+			return p.origin, p.origin == 0, true
+		}
+		if p.peer != 0 && p.peer < peer {
+			break
+		}
+	}
+	return 0, false, false
+}
+
+// ack 将接收方确认的序号转换为发送方序号
+// 返回接收方序号不超过 peer 的最后一条发送方消息，注入的消息不会出现在发送方的确认中
+func (s *space) ack(peer int32) int32 {
+	if peer <= 0 || len(s.pairs) == 0 {
+		return peer
+	}
+	injected := false
+	for i := len(s.pairs) - 1; i >= 0; i-- {
+		p := s.pairs[i]
+		if p.peer == 0 || p.peer > peer {
+			continue
+		}
+		if p.origin != 0 {
+			return p.origin
+		}
+		injected = true
+	}
+	if injected {
+		// 确认范围内只有注入的消息
+		return 0
+	}
+	// 确认的序号早于保留的映射，按最早一条映射的偏移估算
+	for _, p := range s.pairs {
+		if p.origin != 0 && p.peer != 0 {
+			if origin := p.origin - (p.peer - peer); origin > 0 {
+				return origin
+			}
+			return 0
+		}
+	}
+	return peer
+}
+
+// Translator 维护客户端和服务器两个序号空间，支持双向注入和丢弃消息
+//
+// 客户端发出的消息使用客户端序号空间：客户端看到的 seq 和服务器看到的 seq 分别连续
+// 服务器发出的消息使用服务器序号空间：服务器看到的 seq 和客户端看到的 seq 分别连续
+// 转发时 seq 按发送方空间转换，ack 和 resp 按对方空间转换
+// 客户端发出过消息后又从 seq 1 开始表示重新登录，所有映射会被重置
+type Translator struct {
+	mu        sync.Mutex
+	client    space // 客户端发出的消息，origin 为客户端视角，peer 为服务器视角
+	server    space // 服务器发出的消息，origin 为服务器视角，peer 为客户端视角
+	clientAck int32 // 客户端最后确认的服务器序号，客户端视角
+	serverAck int32 // 服务器最后确认的客户端序号，服务器视角
+}
+
+// New 创建序号转换器
+func New() *Translator {
+	return &Translator{}
+}
+
+// Reset 清空所有映射
+func (t *Translator) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reset()
+}
+
+func (t *Translator) reset() {
+	t.client = space{}
+	t.server = space{}
+	t.clientAck = 0
+	t.serverAck = 0
+}
+
+// Upstream 转换客户端发往服务器的消息
+func (t *Translator) Upstream(h Header) Header {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if h.Cmd != AckCmd {
+		if h.Seq == 1 && t.client.originLast > 0 {
+			t.reset()
+		}
+		h.Seq = t.client.forward(h.Seq)
+	}
+	t.clientAck = h.Ack
+	h.Ack = t.server.ack(h.Ack)
+	if h.Resp != 0 {
+		if origin, _, ok := t.server.resp(h.Resp); ok {
+			h.Resp = origin
+		}
+	}
+	return h
+}
+
+// DropUpstream 记录被丢弃的客户端消息，之后的客户端消息在服务器看来仍然连续
+func (t *Translator) DropUpstream(h Header) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if h.Cmd == AckCmd {
+		return
+	}
+	if h.Seq == 1 && t.client.originLast > 0 {
+		t.reset()
+	}
+	t.client.drop(h.Seq)
+}
+
+// InjectUpstream 生成一条发往服务器的注入消息的序号
+// ack 使用客户端最后确认的服务器序号，服务器对它的回复可以通过 InjectedResp 识别
+func (t *Translator) InjectUpstream(cmd string) Header {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := Header{Cmd: cmd, Ack: t.server.ack(t.clientAck)}
+	if cmd != AckCmd {
+		h.Seq = t.client.inject()
+	}
+	return h
+}
+
+// InjectedResp 返回服务器消息是否是对注入消息的回复，这类消息通常不应转发给客户端
+func (t *Translator) InjectedResp(h Header) bool {
+	if h.Resp == 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, injected, _ := t.client.resp(h.Resp)
+	return injected
+}
+
+// Downstream 转换服务器发往客户端的消息
+func (t *Translator) Downstream(h Header) Header {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if h.Cmd != AckCmd {
+		h.Seq = t.server.forward(h.Seq)
+	}
+	t.serverAck = h.Ack
+	h.Ack = t.client.ack(h.Ack)
+	if h.Resp != 0 {
+		if origin, injected, ok := t.client.resp(h.Resp); ok && !injected {
+			h.Resp = origin
+		}
+	}
+	return h
+}
+
+// DropDownstream 记录被丢弃的服务器消息，之后的服务器消息在客户端看来仍然连续
+func (t *Translator) DropDownstream(h Header) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.serverAck = h.Ack
+	if h.Cmd != AckCmd {
+		t.server.drop(h.Seq)
+	}
+}
+
+// InjectDownstream 生成一条发往客户端的注入消息的序号
+// resp 为客户端视角的请求序号，0 表示推送消息
+func (t *Translator) InjectDownstream(cmd string, resp int32) Header {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := Header{Cmd: cmd, Ack: t.client.ack(t.serverAck), Resp: resp}
+	if cmd != AckCmd {
+		h.Seq = t.server.inject()
+	}
+	return h
+}
+
+// LastClientSeq 返回客户端最后一条消息的客户端视角序号
+func (t *Translator) LastClientSeq() int32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.client.originLast
+}
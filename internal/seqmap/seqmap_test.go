@@ -0,0 +1,419 @@
+package seqmap
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestPassThrough(t *testing.T) {
+	tr := New()
+	for i := int32(1); i <= 5; i++ {
+		up := tr.Upstream(Header{Cmd: "a", Seq: i, Ack: i - 1})
+		if up.Seq != i || up.Ack != i-1 {
+			t.Fatalf("upstream %d changed: %+v", i, up)
+		}
+		down := tr.Downstream(Header{Cmd: "AResp", Seq: i, Ack: i, Resp: i})
+		if down.Seq != i || down.Ack != i || down.Resp != i {
+			t.Fatalf("downstream %d changed: %+v", i, down)
+		}
+	}
+}
+
+func TestInjectUpstream(t *testing.T) {
+	tr := New()
+	tr.Upstream(Header{Cmd: "a", Seq: 1})
+	tr.Downstream(Header{Cmd: "AResp", Seq: 1, Ack: 1, Resp: 1})
+
+	// 客户端还没有确认服务器的消息，注入消息不能提前确认，否则服务器看到的 ack 会回退
+	inj := tr.InjectUpstream("debug")
+	if inj.Seq != 2 || inj.Ack != 0 {
+		t.Fatalf("injected header: %+v", inj)
+	}
+	// 服务器对注入消息的回复
+	reply := Header{Cmd: "DebugResp", Seq: 2, Ack: 2, Resp: 2}
+	if !tr.InjectedResp(reply) {
+		t.Fatal("reply to injected frame not detected")
+	}
+	tr.DropDownstream(reply)
+
+	up := tr.Upstream(Header{Cmd: "b", Seq: 2, Ack: 1})
+	if up.Seq != 3 || up.Ack != 1 {
+		t.Fatalf("client seq 2 should be server seq 3: %+v", up)
+	}
+	down := tr.Downstream(Header{Cmd: "BResp", Seq: 3, Ack: 3, Resp: 3})
+	if down.Seq != 2 || down.Ack != 2 || down.Resp != 2 {
+		t.Fatalf("server reply not translated back: %+v", down)
+	}
+	if tr.InjectedResp(Header{Cmd: "BResp", Resp: 3}) {
+		t.Error("normal reply reported as injected")
+	}
+}
+
+func TestInjectUpstreamAckOnlyInjected(t *testing.T) {
+	tr := New()
+	tr.InjectUpstream("debug")
+	// 服务器只确认了注入的消息，客户端看来还没有消息被确认
+	down := tr.Downstream(Header{Cmd: AckCmd, Ack: 1})
+	if down.Ack != 0 {
+		t.Fatalf("ack of injected frame leaked to client: %+v", down)
+	}
+}
+
+func TestDropUpstream(t *testing.T) {
+	tr := New()
+	tr.Upstream(Header{Cmd: "a", Seq: 1})
+	tr.DropUpstream(Header{Cmd: "b", Seq: 2})
+	up := tr.Upstream(Header{Cmd: "c", Seq: 3})
+	if up.Seq != 2 {
+		t.Fatalf("seq after drop = %d, want 2", up.Seq)
+	}
+	// 服务器确认 2 即客户端的 3
+	down := tr.Downstream(Header{Cmd: "CResp", Seq: 1, Ack: 2, Resp: 2})
+	if down.Ack != 3 || down.Resp != 3 {
+		t.Fatalf("ack/resp not translated: %+v", down)
+	}
+	// 服务器确认 1 时被丢弃的 2 不算已确认
+	down = tr.Downstream(Header{Cmd: AckCmd, Ack: 1})
+	if down.Ack != 1 {
+		t.Fatalf("ack 1 = %d, want 1", down.Ack)
+	}
+
+	// 为被丢弃的请求伪造回复
+	fake := tr.InjectDownstream("BResp", 2)
+	if fake.Seq != 2 || fake.Resp != 2 || fake.Ack != 1 {
+		t.Fatalf("fake reply: %+v", fake)
+	}
+}
+
+func TestInjectDownstream(t *testing.T) {
+	tr := New()
+	tr.Upstream(Header{Cmd: "a", Seq: 1})
+	tr.Downstream(Header{Cmd: "AResp", Seq: 1, Ack: 1, Resp: 1})
+
+	push := tr.InjectDownstream("SyncRewardResp", 0)
+	if push.Seq != 2 || push.Ack != 1 || push.Resp != 0 {
+		t.Fatalf("injected push: %+v", push)
+	}
+	// 服务器的下一条消息在客户端看来是 3
+	down := tr.Downstream(Header{Cmd: "Notify", Seq: 2, Ack: 1})
+	if down.Seq != 3 {
+		t.Fatalf("server seq 2 should be client seq 3: %+v", down)
+	}
+	// 客户端确认 3，对服务器来说是 2
+	up := tr.Upstream(Header{Cmd: AckCmd, Ack: 3})
+	if up.Ack != 2 {
+		t.Fatalf("client ack 3 should be server ack 2: %+v", up)
+	}
+	// 客户端只确认了注入的 2，服务器看来只确认了 1
+	up = tr.Upstream(Header{Cmd: "b", Seq: 2, Ack: 2})
+	if up.Ack != 1 {
+		t.Fatalf("client ack 2 should be server ack 1: %+v", up)
+	}
+}
+
+func TestDropDownstream(t *testing.T) {
+	tr := New()
+	tr.Upstream(Header{Cmd: "a", Seq: 1})
+	tr.DropDownstream(Header{Cmd: "Notify", Seq: 1, Ack: 1})
+	down := tr.Downstream(Header{Cmd: "AResp", Seq: 2, Ack: 1, Resp: 1})
+	if down.Seq != 1 {
+		t.Fatalf("seq after drop = %d, want 1", down.Seq)
+	}
+	up := tr.Upstream(Header{Cmd: "b", Seq: 2, Ack: 1})
+	if up.Ack != 2 {
+		t.Fatalf("client ack 1 should be server ack 2: %+v", up)
+	}
+	// 注入消息使用服务器最后的确认
+	inj := tr.InjectDownstream("Push", 0)
+	if inj.Ack != 1 || inj.Seq != 2 {
+		t.Fatalf("injected push: %+v", inj)
+	}
+}
+
+func TestAckFrames(t *testing.T) {
+	tr := New()
+	tr.Upstream(Header{Cmd: "a", Seq: 1})
+	// 心跳不占用序号
+	if up := tr.Upstream(Header{Cmd: AckCmd, Seq: 0, Ack: 0}); up.Seq != 0 {
+		t.Fatalf("ack frame got seq: %+v", up)
+	}
+	tr.DropUpstream(Header{Cmd: AckCmd})
+	if up := tr.Upstream(Header{Cmd: "b", Seq: 2}); up.Seq != 2 {
+		t.Fatalf("ack frames consumed seq: %+v", up)
+	}
+	if inj := tr.InjectUpstream(AckCmd); inj.Seq != 0 {
+		t.Fatalf("injected ack got seq: %+v", inj)
+	}
+	if inj := tr.InjectDownstream(AckCmd, 0); inj.Seq != 0 || inj.Ack != 0 {
+		t.Fatalf("injected server ack: %+v", inj)
+	}
+	tr.DropDownstream(Header{Cmd: AckCmd, Ack: 2})
+	if inj := tr.InjectDownstream(AckCmd, 0); inj.Ack != 2 {
+		t.Fatalf("dropped server ack not remembered: %+v", inj)
+	}
+}
+
+func TestResetOnLogin(t *testing.T) {
+	tr := New()
+	tr.Upstream(Header{Cmd: "a", Seq: 1})
+	tr.InjectUpstream("debug")
+	tr.InjectDownstream("push", 0)
+	tr.Upstream(Header{Cmd: "b", Seq: 2})
+
+	// 重新登录，客户端从 1 开始
+	up := tr.Upstream(Header{Cmd: "login", Seq: 1})
+	if up.Seq != 1 || up.Ack != 0 {
+		t.Fatalf("not reset: %+v", up)
+	}
+	down := tr.Downstream(Header{Cmd: "LoginResp", Seq: 1, Ack: 1, Resp: 1})
+	if down.Seq != 1 || down.Resp != 1 {
+		t.Fatalf("downstream not reset: %+v", down)
+	}
+
+	tr.InjectUpstream("debug")
+	tr.Reset()
+	if up := tr.Upstream(Header{Cmd: "x", Seq: 5}); up.Seq != 1 {
+		t.Fatalf("Reset did not clear: %+v", up)
+	}
+	if tr.LastClientSeq() != 5 {
+		t.Errorf("LastClientSeq = %d", tr.LastClientSeq())
+	}
+}
+
+func TestRetransmit(t *testing.T) {
+	tr := New()
+	tr.Upstream(Header{Cmd: "a", Seq: 1})
+	tr.InjectUpstream("debug")
+	first := tr.Upstream(Header{Cmd: "b", Seq: 2})
+	again := tr.Upstream(Header{Cmd: "b", Seq: 2})
+	if first.Seq != again.Seq {
+		t.Fatalf("retransmit got new seq: %d vs %d", first.Seq, again.Seq)
+	}
+	if next := tr.Upstream(Header{Cmd: "c", Seq: 3}); next.Seq != first.Seq+1 {
+		t.Fatalf("seq after retransmit = %d", next.Seq)
+	}
+
+	tr.DropUpstream(Header{Cmd: "d", Seq: 4})
+	tr.DropUpstream(Header{Cmd: "d", Seq: 4})
+	if next := tr.Upstream(Header{Cmd: "e", Seq: 5}); next.Seq != first.Seq+2 {
+		t.Fatalf("seq after repeated drop = %d", next.Seq)
+	}
+}
+
+func TestSeqGap(t *testing.T) {
+	tr := New()
+	tr.Upstream(Header{Cmd: "a", Seq: 1})
+	// 客户端跳过了 2，服务器看到的仍然连续
+	up := tr.Upstream(Header{Cmd: "c", Seq: 3})
+	if up.Seq != 2 {
+		t.Fatalf("gap not closed: %+v", up)
+	}
+	if down := tr.Downstream(Header{Cmd: "CResp", Seq: 1, Ack: 2, Resp: 2}); down.Resp != 3 || down.Ack != 3 {
+		t.Fatalf("reply to gap: %+v", down)
+	}
+}
+
+func TestUnknownValuesPassThrough(t *testing.T) {
+	tr := New()
+	down := tr.Downstream(Header{Cmd: "Push", Seq: 7, Ack: 4, Resp: 9})
+	if down.Ack != 4 || down.Resp != 9 {
+		t.Fatalf("unknown ack/resp changed: %+v", down)
+	}
+	if tr.InjectedResp(Header{Resp: 9}) {
+		t.Error("unknown resp reported as injected")
+	}
+}
+
+func TestPruning(t *testing.T) {
+	tr := New()
+	tr.InjectUpstream("debug") // 偏移 1
+	n := int32(maxEntries * 3)
+	for i := int32(1); i <= n; i++ {
+		if up := tr.Upstream(Header{Cmd: "a", Seq: i + 1}); up.Seq != i+1 {
+			t.Fatalf("seq %d -> %d", i+1, up.Seq)
+		}
+	}
+	if len(tr.client.pairs) > maxEntries {
+		t.Fatalf("pairs not pruned: %d", len(tr.client.pairs))
+	}
+	// 最近的消息精确转换
+	if down := tr.Downstream(Header{Cmd: "R", Seq: 1, Ack: n + 1, Resp: n + 1}); down.Resp != n+1 || down.Ack != n+1 {
+		t.Fatalf("recent: %+v", down)
+	}
+	// 已清理的消息按偏移估算确认
+	if down := tr.Downstream(Header{Cmd: AckCmd, Ack: 10}); down.Ack != 10 {
+		t.Fatalf("pruned ack: %+v", down)
+	}
+}
+
+// TestRandomized 随机模拟客户端、服务器和代理的注入与丢弃，检查双方看到的序号始终一致
+func TestRandomized(t *testing.T) {
+	for seed := int64(1); seed <= 200; seed++ {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			simulate(t, rand.New(rand.NewSource(seed)), 400)
+		})
+	}
+}
+
+// sent 记录一条消息在双方视角的序号，0 表示该方看不到
+type sent struct {
+	origin, peer int32
+	cmd          string
+}
+
+// expectAck 计算确认转换的期望值：接收方序号不超过 ack 的最后一条发送方可见消息
+func expectAck(log []sent, ack int32) int32 {
+	best := int32(0)
+	for _, s := range log {
+		if s.peer != 0 && s.peer <= ack && s.origin != 0 {
+			best = s.origin
+		}
+	}
+	return best
+}
+
+func simulate(t *testing.T, r *rand.Rand, steps int) {
+	tr := New()
+
+	var (
+		clientSeq     int32  // 客户端最后发出的序号
+		clientRecv    int32  // 客户端最后收到的服务器序号（客户端视角）
+		clientLastAck int32  // 客户端最后收到的 ack
+		serverSeq     int32  // 服务器最后发出的序号
+		serverRecv    int32  // 服务器最后收到的客户端序号（服务器视角）
+		serverLastAck int32  // 服务器最后收到的 ack
+		clientLog     []sent // 客户端序号空间：origin 客户端视角，peer 服务器视角
+		serverLog     []sent // 服务器序号空间：origin 服务器视角，peer 客户端视角
+		pending       []sent // 服务器待回复的请求（服务器视角序号）
+		droppedReqs   []sent // 被丢弃、需要伪造回复的客户端请求
+	)
+	// 服务器接收一条消息
+	serverReceive := func(h Header, injected bool, cmd string) {
+		t.Helper()
+		if h.Cmd == AckCmd {
+			if h.Ack > serverSeq || h.Ack < serverLastAck {
+				t.Fatalf("server got bad ack %d (sent %d, last ack %d)", h.Ack, serverSeq, serverLastAck)
+			}
+			serverLastAck = h.Ack
+			return
+		}
+		if h.Seq != serverRecv+1 {
+			t.Fatalf("server got seq %d, want %d", h.Seq, serverRecv+1)
+		}
+		if h.Ack > serverSeq {
+			t.Fatalf("server got ack %d beyond sent %d", h.Ack, serverSeq)
+		}
+		if want := expectAck(serverLog, clientRecv); !injected && h.Ack != want {
+			t.Fatalf("server got ack %d, want %d", h.Ack, want)
+		}
+		serverRecv = h.Seq
+		pending = append(pending, sent{peer: h.Seq, cmd: cmd})
+	}
+
+	// 客户端接收一条消息
+	clientReceive := func(h Header) {
+		t.Helper()
+		if h.Cmd != AckCmd {
+			if h.Seq != clientRecv+1 {
+				t.Fatalf("client got seq %d, want %d", h.Seq, clientRecv+1)
+			}
+			clientRecv = h.Seq
+		}
+		if h.Ack > clientSeq || h.Ack < clientLastAck {
+			t.Fatalf("client got bad ack %d (sent %d, last %d)", h.Ack, clientSeq, clientLastAck)
+		}
+		clientLastAck = h.Ack
+		if h.Resp != 0 {
+			req, ok := func() (sent, bool) {
+				for _, s := range clientLog {
+					if s.origin == h.Resp {
+						return s, true
+					}
+				}
+				return sent{}, false
+			}()
+			if !ok || req.cmd+"Resp" != h.Cmd {
+				t.Fatalf("client got %s resp=%d, request was %+v", h.Cmd, h.Resp, req)
+			}
+		}
+	}
+
+	for step := 0; step < steps; step++ {
+		switch op := r.Intn(10); {
+		case op < 3: // 客户端发送请求
+			clientSeq++
+			cmd := fmt.Sprintf("c%d", clientSeq)
+			h := Header{Cmd: cmd, Seq: clientSeq, Ack: clientRecv}
+			if r.Intn(5) == 0 {
+				tr.DropUpstream(h)
+				clientLog = append(clientLog, sent{origin: clientSeq, cmd: cmd})
+				droppedReqs = append(droppedReqs, sent{origin: clientSeq, cmd: cmd})
+				continue
+			}
+			up := tr.Upstream(h)
+			clientLog = append(clientLog, sent{origin: clientSeq, peer: up.Seq, cmd: cmd})
+			serverReceive(up, false, cmd)
+		case op == 3: // 代理向服务器注入请求
+			h := tr.InjectUpstream("inj")
+			clientLog = append(clientLog, sent{peer: h.Seq, cmd: "inj"})
+			serverReceive(h, true, "inj")
+		case op < 6 && len(pending) > 0: // 服务器回复
+			req := pending[0]
+			pending = pending[1:]
+			serverSeq++
+			h := Header{Cmd: req.cmd + "Resp", Seq: serverSeq, Ack: serverRecv, Resp: req.peer}
+			if tr.InjectedResp(h) {
+				if req.cmd != "inj" {
+					t.Fatalf("reply to %s reported as injected", req.cmd)
+				}
+				tr.DropDownstream(h)
+				serverLog = append(serverLog, sent{origin: serverSeq})
+				continue
+			}
+			if req.cmd == "inj" {
+				t.Fatal("reply to injected request not detected")
+			}
+			down := tr.Downstream(h)
+			serverLog = append(serverLog, sent{origin: serverSeq, peer: down.Seq})
+			if want := expectAck(clientLog, serverRecv); down.Ack != want {
+				t.Fatalf("client ack %d, want %d", down.Ack, want)
+			}
+			clientReceive(down)
+		case op == 6: // 服务器推送，随机丢弃
+			serverSeq++
+			h := Header{Cmd: "Push", Seq: serverSeq, Ack: serverRecv}
+			if r.Intn(3) == 0 {
+				tr.DropDownstream(h)
+				serverLog = append(serverLog, sent{origin: serverSeq})
+				continue
+			}
+			down := tr.Downstream(h)
+			serverLog = append(serverLog, sent{origin: serverSeq, peer: down.Seq})
+			clientReceive(down)
+		case op == 7: // 代理向客户端注入推送或伪造被丢弃请求的回复
+			var resp int32
+			cmd := "Fake"
+			if len(droppedReqs) > 0 && r.Intn(2) == 0 {
+				resp = droppedReqs[0].origin
+				cmd = droppedReqs[0].cmd + "Resp"
+				droppedReqs = droppedReqs[1:]
+			}
+			h := tr.InjectDownstream(cmd, resp)
+			serverLog = append(serverLog, sent{peer: h.Seq})
+			clientReceive(h)
+		case op == 8: // 客户端心跳
+			up := tr.Upstream(Header{Cmd: AckCmd, Ack: clientRecv})
+			if want := expectAck(serverLog, clientRecv); up.Ack != want {
+				t.Fatalf("server ack %d, want %d", up.Ack, want)
+			}
+			serverReceive(up, false, "")
+		default: // 服务器心跳
+			down := tr.Downstream(Header{Cmd: AckCmd, Ack: serverRecv})
+			if want := expectAck(clientLog, serverRecv); down.Ack != want {
+				t.Fatalf("client ack %d, want %d", down.Ack, want)
+			}
+			clientReceive(down)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"xyzw_study/internal/msgpath"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// DefaultLimit 默认每页数量
+	DefaultLimit = 50
+	// MaxLimit 每页最大数量
+	MaxLimit = 1000
+)
+
+// Condition 定义一个字段过滤条件，例如 body.itemId==3010
+type Condition struct {
+	Path  string `json:"path"`
+	Op    string `json:"op"` // ==, !=, >=, <=, >, <, ~(包含)
+	Value string `json:"value"`
+}
+
+// 按匹配优先级排列，长的运算符在前
+var operators = []string{"==", "!=", ">=", "<=", "~", ">", "<"}
+
+// ParseFilter 解析过滤表达式，多个条件用 && 连接
+func ParseFilter(expr string) ([]Condition, error) {
+	var conds []Condition
+	for _, part := range strings.Split(expr, "&&") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		cond, err := parseCondition(part)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+func parseCondition(expr string) (Condition, error) {
+	best := -1
+	var op string
+	for _, candidate := range operators {
+		if i := strings.Index(expr, candidate); i > 0 && (best < 0 || i < best) {
+			best, op = i, candidate
+		}
+	}
+	if best < 0 {
+		return Condition{}, fmt.Errorf("无效的过滤条件: %s", expr)
+	}
+	path := strings.TrimSpace(expr[:best])
+	value := strings.TrimSpace(expr[best+len(op):])
+	value = strings.Trim(value, `"'`)
+	if path == "" {
+		return Condition{}, fmt.Errorf("过滤条件缺少字段: %s", expr)
+	}
+	return Condition{Path: path, Op: op, Value: value}, nil
+}
+
+// Match 判断字段值是否满足条件
+func (c Condition) Match(fields map[string]any) bool {
+	v, ok := fields[c.Path]
+	if !ok {
+		return c.Op == "!="
+	}
+	str := msgpath.String(v)
+	switch c.Op {
+	case "==":
+		return str == c.Value
+	case "!=":
+		return str != c.Value
+	case "~":
+		return strings.Contains(str, c.Value)
+	}
+
+	// 大小比较优先按数字比较
+	a, errA := strconv.ParseFloat(str, 64)
+	b, errB := strconv.ParseFloat(c.Value, 64)
+	var cmp int
+	if errA == nil && errB == nil {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(str, c.Value)
+	}
+	switch c.Op {
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Query 定义数据包查询条件
+type Query struct {
+	Cmd     string
+	Call    string // "client" 或 "server"
+	Session string
+	Since   time.Time
+	Until   time.Time
+	Where   []Condition
+	Match   func(Packet) bool // 额外的匹配条件，例如命令通配符，为 nil 时不检查
+	Limit   int
+	Offset  int
+}
+
+// Result 定义查询结果，数据包按时间倒序排列
+type Result struct {
+	Total   int      `json:"total"`
+	Offset  int      `json:"offset"`
+	Limit   int      `json:"limit"`
+	Packets []Packet `json:"packets"`
+}
+
+// Query 查询数据包
+func (s *Store) Query(q Query) (Result, error) {
+	q.Call = normalizeCall(q.Call)
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	result := Result{Offset: q.Offset, Limit: q.Limit, Packets: []Packet{}}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		ids := s.candidates(tx, q)
+		packets := tx.Bucket(bucketPackets)
+		for _, id := range ids {
+			data := packets.Get(itob(id))
+			if data == nil {
+				continue
+			}
+			var p Packet
+			if err := json.Unmarshal(data, &p); err != nil {
+				continue
+			}
+			if !q.match(p) {
+				continue
+			}
+			if result.Total >= q.Offset && len(result.Packets) < q.Limit {
+				result.Packets = append(result.Packets, p)
+			}
+			result.Total++
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Latest 按时间倒序返回满足条件的最近 q.Limit 个数据包，忽略 Offset
+// 找到足够的数据包后停止读取，不统计总数
+func (s *Store) Latest(q Query) ([]Packet, error) {
+	q.Call = normalizeCall(q.Call)
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+	result := []Packet{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		packets := tx.Bucket(bucketPackets)
+		for _, id := range s.candidates(tx, q) {
+			if len(result) == q.Limit {
+				break
+			}
+			data := packets.Get(itob(id))
+			if data == nil {
+				continue
+			}
+			var p Packet
+			if err := json.Unmarshal(data, &p); err != nil {
+				continue
+			}
+			if q.match(p) {
+				result = append(result, p)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Each 按时间顺序遍历满足条件的数据包，忽略分页参数
+func (s *Store) Each(q Query, fn func(Packet) error) error {
+	q.Call = normalizeCall(q.Call)
+	return s.db.View(func(tx *bolt.Tx) error {
+		ids := s.candidates(tx, q)
+		packets := tx.Bucket(bucketPackets)
+		for i := len(ids) - 1; i >= 0; i-- {
+			data := packets.Get(itob(ids[i]))
+			if data == nil {
+				continue
+			}
+			var p Packet
+			if err := json.Unmarshal(data, &p); err != nil {
+				continue
+			}
+			if !q.match(p) {
+				continue
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Sessions 返回所有会话ID
+func (s *Store) Sessions() ([]string, error) {
+	var sessions []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketSession).Cursor()
+		var last []byte
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			name := k[:len(k)-9]
+			if last != nil && bytes.Equal(name, last) {
+				continue
+			}
+			last = append(last[:0], name...)
+			if len(name) > 0 {
+				sessions = append(sessions, string(name))
+			}
+		}
+		return nil
+	})
+	return sessions, err
+}
+
+// candidates 选择最合适的索引，返回按ID倒序排列的候选数据包
+func (s *Store) candidates(tx *bolt.Tx, q Query) []uint64 {
+	for _, cond := range q.Where {
+		if cond.Op == "==" {
+			// 没有完整建立索引的数据包也可能满足条件，由 match 逐个检查
+			partial := scanIDs(tx.Bucket(bucketPartial))
+			if len(cond.Value) > maxIndexedValueLen {
+				return partial
+			}
+			return mergeIDs(scanIndex(tx.Bucket(bucketField), cond.Path+"="+cond.Value), partial)
+		}
+	}
+	if q.Cmd != "" {
+		return scanIndex(tx.Bucket(bucketCmd), q.Cmd)
+	}
+	if q.Session != "" {
+		return scanIndex(tx.Bucket(bucketSession), q.Session)
+	}
+
+	// 按时间索引倒序扫描
+	var ids []uint64
+	c := tx.Bucket(bucketTime).Cursor()
+	var k []byte
+	if q.Until.IsZero() {
+		k, _ = c.Last()
+	} else {
+		k, _ = c.Seek(itob(uint64(q.Until.UnixNano()) + 1))
+		if k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+	}
+	for ; k != nil; k, _ = c.Prev() {
+		ts := int64(binary.BigEndian.Uint64(k[:8]))
+		if !q.Since.IsZero() && ts < q.Since.UnixNano() {
+			break
+		}
+		ids = append(ids, binary.BigEndian.Uint64(k[8:]))
+	}
+	return ids
+}
+
+// scanIndex 扫描 "名称\x00ID" 形式的索引并按ID倒序返回
+func scanIndex(b *bolt.Bucket, name string) []uint64 {
+	var ids []uint64
+	prefix := indexPrefix(name)
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if len(k) != len(prefix)+8 {
+			continue
+		}
+		ids = append(ids, binary.BigEndian.Uint64(k[len(prefix):]))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	return ids
+}
+
+// scanIDs 返回以数据包ID为键的桶中的全部ID，按ID倒序
+func scanIDs(b *bolt.Bucket) []uint64 {
+	var ids []uint64
+	c := b.Cursor()
+	for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+		ids = append(ids, binary.BigEndian.Uint64(k))
+	}
+	return ids
+}
+
+// mergeIDs 合并两个按ID倒序排列的列表，去掉重复的ID
+func mergeIDs(a, b []uint64) []uint64 {
+	if len(b) == 0 {
+		return a
+	}
+	ids := make([]uint64, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j >= len(b) || i < len(a) && a[i] > b[j]:
+			ids = append(ids, a[i])
+			i++
+		case i >= len(a) || b[j] > a[i]:
+			ids = append(ids, b[j])
+			j++
+		default:
+			ids = append(ids, a[i])
+			i++
+			j++
+		}
+	}
+	return ids
+}
+
+// match 判断数据包是否满足查询条件
+func (q Query) match(p Packet) bool {
+	if q.Cmd != "" && p.Cmd != q.Cmd {
+		return false
+	}
+	if q.Call != "" && p.Call != q.Call {
+		return false
+	}
+	if q.Session != "" && p.Session != q.Session {
+		return false
+	}
+	if !q.Since.IsZero() && p.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && p.Time.After(q.Until) {
+		return false
+	}
+	if q.Match != nil && !q.Match(p) {
+		return false
+	}
+	if len(q.Where) == 0 {
+		return true
+	}
+	fields := p.fields()
+	for _, cond := range q.Where {
+		if !cond.Match(fields) {
+			return false
+		}
+	}
+	return true
+}
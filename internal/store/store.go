@@ -0,0 +1,315 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"xyzw_study/internal/msgpath"
+	"xyzw_study/internal/record"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketPackets = []byte("packets")
+	bucketTime    = []byte("idx_time")
+	bucketCmd     = []byte("idx_cmd")
+	bucketSession = []byte("idx_session")
+	bucketField   = []byte("idx_field")
+	// 没有完整建立字段索引的数据包，按字段值查询时需要逐个检查
+	bucketPartial = []byte("idx_partial")
+
+	allBuckets = [][]byte{bucketPackets, bucketTime, bucketCmd, bucketSession, bucketField, bucketPartial}
+)
+
+const (
+	// 单个数据包最多索引的字段数，避免角色信息之类的大包撑爆索引
+	maxIndexedFields = 2000
+	// 超过该长度的字段值不建立索引
+	maxIndexedValueLen = 128
+	// 批量写入的间隔
+	flushInterval = 200 * time.Millisecond
+)
+
+// Packet 定义存储中的一个数据包
+type Packet struct {
+	ID       uint64          `json:"id"`
+	Time     time.Time       `json:"time"`
+	Session  string          `json:"session"`
+	Call     string          `json:"call"` // "client" 或 "server"
+	Cmd      string          `json:"cmd"`
+	Seq      int64           `json:"seq"`
+	Raw      string          `json:"raw,omitempty"`      // 原始X加密帧的十六进制
+	Msg      json.RawMessage `json:"msg"`                // 解码后的消息 JSON
+	Injected bool            `json:"injected,omitempty"` // 调试注入的消息或服务器对注入请求的回复
+	Forged   bool            `json:"forged,omitempty"`   // 调试伪造的服务器消息，不是服务器的回复
+}
+
+// Record 将数据包转换为抓包文件记录
+func (p Packet) Record() record.Record {
+	return record.Record{Time: p.Time, Session: p.Session, Call: p.Call, Raw: p.Raw, Msg: p.Msg, Injected: p.Injected, Forged: p.Forged}
+}
+
+// FromRecord 由抓包文件记录创建数据包
+func FromRecord(r record.Record) Packet {
+	p := Packet{Time: r.Time, Session: r.Session, Call: r.Call, Raw: r.Raw, Msg: r.Msg, Injected: r.Injected, Forged: r.Forged}
+	p.fillHeader()
+	return p
+}
+
+// fillHeader 从消息中提取命令和序号
+func (p *Packet) fillHeader() {
+	var head struct {
+		Cmd string `json:"cmd"`
+		Seq int64  `json:"seq"`
+	}
+	if len(p.Msg) > 0 && json.Unmarshal(p.Msg, &head) == nil {
+		p.Cmd = head.Cmd
+		p.Seq = head.Seq
+	}
+}
+
+// Store 基于 bbolt 的持久化数据包存储
+type Store struct {
+	db      *bolt.DB
+	pending chan Packet
+	done    chan struct{}
+	once    sync.Once
+
+	mu     sync.RWMutex // 保护 closed，避免关闭后继续写入队列
+	closed bool
+}
+
+// Open 打开或创建数据包存储
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		// 旧版本的存储没有 idx_partial，需要补充标记
+		migrate := tx.Bucket(bucketPartial) == nil
+		for _, name := range allBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if migrate {
+			return markPartial(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &Store{
+		db:      db,
+		pending: make(chan Packet, 4096),
+		done:    make(chan struct{}),
+	}
+	go s.writeLoop()
+	return s, nil
+}
+
+// Close 写入剩余数据包并关闭存储，之后的 Add 会丢弃数据包
+func (s *Store) Close() error {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		close(s.pending)
+		s.mu.Unlock()
+		<-s.done
+	})
+	return s.db.Close()
+}
+
+// Add 异步添加一个数据包，不会阻塞抓包流程
+// 写入队列已满时丢弃数据包并返回 false
+func (s *Store) Add(p Packet) bool {
+	if p.Cmd == "" {
+		p.fillHeader()
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.pending <- p:
+		return true
+	default:
+		log.Println("数据包存储队列已满，丢弃数据包:", p.Cmd)
+		return false
+	}
+}
+
+// writeLoop 批量写入队列中的数据包
+func (s *Store) writeLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []Packet
+	for {
+		select {
+		case p, ok := <-s.pending:
+			if !ok {
+				s.write(batch)
+				return
+			}
+			batch = append(batch, p)
+			if len(batch) >= 256 {
+				s.write(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.write(batch)
+				batch = nil
+			}
+		}
+	}
+}
+
+func (s *Store) write(batch []Packet) {
+	if len(batch) == 0 {
+		return
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for i := range batch {
+			if err := s.put(tx, &batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("写入数据包存储失败:", err)
+	}
+}
+
+// put 在事务中写入数据包及其索引
+func (s *Store) put(tx *bolt.Tx, p *Packet) error {
+	packets := tx.Bucket(bucketPackets)
+	id, err := packets.NextSequence()
+	if err != nil {
+		return err
+	}
+	p.ID = id
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	key := itob(id)
+	if err := packets.Put(key, data); err != nil {
+		return err
+	}
+
+	timeKey := append(itob(uint64(p.Time.UnixNano())), key...)
+	if err := tx.Bucket(bucketTime).Put(timeKey, nil); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketCmd).Put(indexKey(p.Cmd, id), nil); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketSession).Put(indexKey(p.Session, id), nil); err != nil {
+		return err
+	}
+
+	entries, partial := p.indexEntries()
+	fields := tx.Bucket(bucketField)
+	for _, entry := range entries {
+		if err := fields.Put(indexKey(entry, id), nil); err != nil {
+			return err
+		}
+	}
+	if partial {
+		return tx.Bucket(bucketPartial).Put(key, nil)
+	}
+	return nil
+}
+
+// indexEntries 返回数据包需要建立索引的 "路径=值"，按路径排序
+// 有字段值过长或字段数超过上限没有建立索引时 partial 为 true
+func (p Packet) indexEntries() (entries []string, partial bool) {
+	fields := p.fields()
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		str := msgpath.String(fields[path])
+		if len(str) > maxIndexedValueLen || len(entries) >= maxIndexedFields {
+			partial = true
+			continue
+		}
+		entries = append(entries, path+"="+str)
+	}
+	return entries, partial
+}
+
+// markPartial 为已有的数据包补充 idx_partial 标记
+func markPartial(tx *bolt.Tx) error {
+	partial := tx.Bucket(bucketPartial)
+	return tx.Bucket(bucketPackets).ForEach(func(k, v []byte) error {
+		var p Packet
+		if json.Unmarshal(v, &p) != nil {
+			return nil
+		}
+		if _, ok := p.indexEntries(); ok {
+			return partial.Put(k, nil)
+		}
+		return nil
+	})
+}
+
+// fields 返回数据包消息展开后的字段
+func (p Packet) fields() map[string]any {
+	msg, err := p.Record().Value()
+	if err != nil {
+		return nil
+	}
+	return msgpath.Flatten(msg)
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// indexKey 生成 "名称\x00ID" 形式的索引键
+func indexKey(name string, id uint64) []byte {
+	key := make([]byte, 0, len(name)+9)
+	key = append(key, name...)
+	key = append(key, 0)
+	return append(key, itob(id)...)
+}
+
+// indexPrefix 生成索引前缀
+func indexPrefix(name string) []byte {
+	return append([]byte(name), 0)
+}
+
+// normalizeCall 统一方向参数
+func normalizeCall(dir string) string {
+	switch strings.ToLower(dir) {
+	case "send", "client", "c2s":
+		return "client"
+	case "recv", "receive", "server", "s2c":
+		return "server"
+	default:
+		return dir
+	}
+}
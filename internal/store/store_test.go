@@ -0,0 +1,162 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestParseFilter(t *testing.T) {
+	conds, err := ParseFilter("body.itemId==3010 && body.number>=2 && cmd~open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Condition{
+		{Path: "body.itemId", Op: "==", Value: "3010"},
+		{Path: "body.number", Op: ">=", Value: "2"},
+		{Path: "cmd", Op: "~", Value: "open"},
+	}
+	if len(conds) != len(want) {
+		t.Fatalf("got %+v", conds)
+	}
+	for i := range want {
+		if conds[i] != want[i] {
+			t.Errorf("condition %d: got %+v, want %+v", i, conds[i], want[i])
+		}
+	}
+	if _, err := ParseFilter("body.itemId"); err == nil {
+		t.Error("expected error for condition without operator")
+	}
+}
+
+func TestStoreQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packets.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	msgs := []struct {
+		call, session, msg string
+	}{
+		{"client", "s1", `{"cmd":"item_openpack","seq":1,"body":{"itemId":3010,"number":1}}`},
+		{"server", "s1", `{"cmd":"Item_OpenBoxResp","seq":1,"resp":1,"body":{"reward":[{"itemId":3010,"value":5}]}}`},
+		{"client", "s1", `{"cmd":"item_openpack","seq":2,"body":{"itemId":3011,"number":3}}`},
+		{"client", "s2", `{"cmd":"role_getroleinfo","seq":1,"body":{}}`},
+	}
+	for i, m := range msgs {
+		s.Add(Packet{Time: base.Add(time.Duration(i) * time.Minute), Session: m.session, Call: m.call, Msg: []byte(m.msg)})
+	}
+	// Close 会写入队列中剩余的数据包
+	s.Close()
+	if s, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cases := []struct {
+		name string
+		q    Query
+		want []int64
+	}{
+		{"all", Query{}, []int64{1, 2, 1, 1}},
+		{"cmd", Query{Cmd: "item_openpack"}, []int64{2, 1}},
+		{"dir", Query{Call: "recv"}, []int64{1}},
+		{"session", Query{Session: "s2"}, []int64{1}},
+		{"field", Query{Where: []Condition{{Path: "body.itemId", Op: "==", Value: "3010"}}}, []int64{1}},
+		{"nested", Query{Where: []Condition{{Path: "body.reward.0.itemId", Op: "==", Value: "3010"}}}, []int64{1}},
+		{"range", Query{Where: []Condition{{Path: "body.number", Op: ">", Value: "1"}}}, []int64{2}},
+		{"since", Query{Since: base.Add(90 * time.Second)}, []int64{1, 2}},
+		{"page", Query{Limit: 1, Offset: 1}, []int64{2}},
+		{"match", Query{Match: func(p Packet) bool { return p.Session == "s1" && p.Call == "client" }}, []int64{2, 1}},
+	}
+	for _, c := range cases {
+		result, err := s.Query(c.q)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(result.Packets) != len(c.want) {
+			t.Errorf("%s: got %d packets, want %d", c.name, len(result.Packets), len(c.want))
+			continue
+		}
+		for i, p := range result.Packets {
+			if p.Seq != c.want[i] {
+				t.Errorf("%s: packet %d seq %d, want %d", c.name, i, p.Seq, c.want[i])
+			}
+		}
+	}
+
+	// Latest 只返回最近的数据包
+	latest, err := s.Latest(Query{Call: "client", Limit: 2})
+	if err != nil || len(latest) != 2 || latest[0].Cmd != "role_getroleinfo" || latest[1].Seq != 2 {
+		t.Errorf("latest: got %+v, %v", latest, err)
+	}
+
+	sessions, err := s.Sessions()
+	if err != nil || len(sessions) != 2 {
+		t.Errorf("sessions: got %v, %v", sessions, err)
+	}
+}
+
+// TestStoreQueryUnindexed 字段值过长或字段数超过上限没有建立索引时，按字段值查询仍然能找到
+func TestStoreQueryUnindexed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packets.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", maxIndexedValueLen+1)
+	items := make([]string, 0, maxIndexedFields+1)
+	for i := 0; i <= maxIndexedFields; i++ {
+		items = append(items, fmt.Sprintf(`"%d":%d`, i, i))
+	}
+	base := time.Now().Add(-time.Hour)
+	for i, msg := range []string{
+		`{"cmd":"chat_send","seq":1,"body":{"text":"` + long + `"}}`,
+		`{"cmd":"Role_GetRoleInfoResp","seq":2,"body":{"items":{` + strings.Join(items, ",") + `}}}`,
+		`{"cmd":"item_openpack","seq":3,"body":{"itemId":3010}}`,
+	} {
+		s.Add(Packet{Time: base.Add(time.Duration(i) * time.Minute), Session: "s1", Call: "client", Msg: []byte(msg)})
+	}
+	s.Close()
+	// 模拟旧版本的存储，打开时补充标记
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket(bucketPartial) })
+	db.Close()
+	if s, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// 关闭后写入的数据包被丢弃，不会 panic
+	closed, _ := Open(filepath.Join(t.TempDir(), "closed.db"))
+	closed.Close()
+	if closed.Add(Packet{Msg: []byte(`{"cmd":"a"}`)}) {
+		t.Error("Add after Close should fail")
+	}
+
+	for _, c := range []struct {
+		cond Condition
+		want int64
+	}{
+		{Condition{Path: "body.text", Op: "==", Value: long}, 1},
+		{Condition{Path: "body.items.2000", Op: "==", Value: "2000"}, 2},
+		{Condition{Path: "body.items.1999", Op: "==", Value: "1999"}, 2},
+		{Condition{Path: "body.itemId", Op: "==", Value: "3010"}, 3},
+	} {
+		result, err := s.Query(Query{Where: []Condition{c.cond}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Packets) != 1 || result.Packets[0].Seq != c.want {
+			t.Errorf("%s: got %+v", c.cond.Path, result.Packets)
+		}
+	}
+}
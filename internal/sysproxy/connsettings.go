@@ -0,0 +1,80 @@
+package sysproxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Windows 连接设置中的代理标志，与 INTERNET_PER_CONN_FLAGS 一致
+const (
+	proxyTypeDirect       = 0x01
+	proxyTypeProxy        = 0x02
+	proxyTypeAutoProxyURL = 0x04
+	proxyTypeAutoDetect   = 0x08
+)
+
+// parseConnectionSettings 解析注册表 Connections\DefaultConnectionSettings 中的二进制设置
+// 格式: 版本(4) 计数(4) 标志(4) 代理地址长度(4)+地址 例外列表长度(4)+列表 PAC地址长度(4)+地址 ...
+func parseConnectionSettings(data []byte) (State, error) {
+	if len(data) < 12 {
+		return State{Mode: ModeUnknown}, errors.New("连接设置数据过短")
+	}
+	flags := binary.LittleEndian.Uint32(data[8:])
+	rest := data[12:]
+	var fields [3]string
+	for i := range fields {
+		if len(rest) < 4 {
+			return State{Mode: ModeUnknown}, errors.New("连接设置数据不完整")
+		}
+		n := binary.LittleEndian.Uint32(rest)
+		rest = rest[4:]
+		if uint32(len(rest)) < n {
+			return State{Mode: ModeUnknown}, errors.New("连接设置数据不完整")
+		}
+		fields[i] = string(rest[:n])
+		rest = rest[n:]
+	}
+	return stateFromFlags(flags, fields[0], fields[1], fields[2]), nil
+}
+
+// stateFromFlags 根据代理标志生成状态
+// 同时启用多项时按系统的生效顺序取 PAC、全局代理、自动检测
+func stateFromFlags(flags uint32, proxy, bypass, pac string) State {
+	state := State{
+		Proxy:      strings.TrimSpace(proxy),
+		PAC:        strings.TrimSpace(pac),
+		AutoDetect: flags&proxyTypeAutoDetect != 0,
+	}
+	for _, item := range strings.Split(bypass, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			state.Bypass = append(state.Bypass, item)
+		}
+	}
+	switch {
+	case flags&proxyTypeAutoProxyURL != 0 && state.PAC != "":
+		state.Mode = ModePAC
+	case flags&proxyTypeProxy != 0 && state.Proxy != "":
+		state.Mode = ModeGlobal
+	case state.AutoDetect:
+		state.Mode = ModeAutoDetect
+	default:
+		state.Mode = ModeDirect
+	}
+	return state
+}
+
+// connectionFlags 返回恢复状态时写入的代理标志
+func connectionFlags(s State) uint32 {
+	flags := uint32(proxyTypeDirect)
+	switch s.Mode {
+	case ModeGlobal:
+		flags |= proxyTypeProxy
+	case ModePAC:
+		flags |= proxyTypeAutoProxyURL
+	}
+	if s.AutoDetect || s.Mode == ModeAutoDetect {
+		flags |= proxyTypeAutoDetect
+	}
+	return flags
+}
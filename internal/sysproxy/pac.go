@@ -0,0 +1,44 @@
+package sysproxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PAC 生成只让指定域名走代理的 PAC 脚本，其余流量直连
+// 域名支持 * 通配，例如 *.hortorgames.com
+func PAC(proxyAddr string, hosts []string) string {
+	var conds []string
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" {
+			continue
+		}
+		conds = append(conds, fmt.Sprintf("shExpMatch(host, %q)", host))
+	}
+	if len(conds) == 0 {
+		return "function FindProxyForURL(url, host) {\n  return \"DIRECT\";\n}\n"
+	}
+
+	var b strings.Builder
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("  host = host.toLowerCase();\n")
+	fmt.Fprintf(&b, "  if (%s) {\n", strings.Join(conds, " ||\n      "))
+	fmt.Fprintf(&b, "    return \"PROXY %s\";\n", proxyAddr)
+	b.WriteString("  }\n")
+	b.WriteString("  return \"DIRECT\";\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// PACHandler 返回提供 PAC 脚本的 HTTP 处理函数
+func PACHandler(proxyAddr string, hosts []string) http.HandlerFunc {
+	script := PAC(proxyAddr, hosts)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+		// 禁止缓存，修改游戏域名后系统能立即读取新的脚本
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(script))
+	}
+}
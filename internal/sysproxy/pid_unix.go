@@ -0,0 +1,12 @@
+//go:build !windows
+
+package sysproxy
+
+import "syscall"
+
+// processAlive 判断进程是否仍在运行
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// 没有权限发送信号也说明进程存在
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,166 @@
+package sysproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateFileName 数据目录中保存原系统代理设置的文件名
+const StateFileName = "sysproxy_state.json"
+
+// 系统代理模式
+const (
+	ModeDirect     = "direct"     // 不使用代理
+	ModeGlobal     = "global"     // 全局代理
+	ModePAC        = "pac"        // PAC 自动配置
+	ModeAutoDetect = "autodetect" // 只启用自动检测设置
+	ModeUnknown    = "unknown"    // 无法读取，恢复时直接关闭代理
+)
+
+// State 定义修改前的系统代理设置，保存在状态文件中用于崩溃后恢复
+type State struct {
+	Mode       string    `json:"mode"`
+	Proxy      string    `json:"proxy,omitempty"`
+	Bypass     []string  `json:"bypass,omitempty"`
+	PAC        string    `json:"pac,omitempty"`        // PAC 脚本地址
+	AutoDetect bool      `json:"autoDetect,omitempty"` // 同时启用了自动检测设置
+	PID        int       `json:"pid"`                  // 修改系统代理的进程
+	SavedAt    time.Time `json:"savedAt"`              // 保存时间
+}
+
+// String 返回便于显示的代理设置
+func (s State) String() string {
+	text := s.Mode
+	switch s.Mode {
+	case ModeGlobal:
+		text += " " + s.Proxy
+	case ModePAC:
+		text += " " + s.PAC
+	}
+	if s.AutoDetect && s.Mode != ModeAutoDetect {
+		text += " +autodetect"
+	}
+	return text
+}
+
+// Apply 将系统代理恢复为该状态
+func (s State) Apply() error {
+	switch s.Mode {
+	case ModeGlobal:
+		if s.Proxy == "" {
+			return Off()
+		}
+	case ModePAC:
+		if s.PAC == "" {
+			return Off()
+		}
+	case ModeDirect, ModeAutoDetect:
+	default:
+		return Off()
+	}
+	return apply(s)
+}
+
+// Guard 负责在修改系统代理前保存原设置，并在任何退出路径上恢复
+type Guard struct {
+	stateFile string
+}
+
+// NewGuard 创建一个使用指定状态文件的 Guard
+func NewGuard(stateFile string) *Guard {
+	return &Guard{stateFile: stateFile}
+}
+
+// Pending 返回上次运行遗留的状态，存在说明上次没有正常恢复系统代理
+func (g *Guard) Pending() (State, bool) {
+	data, err := os.ReadFile(g.stateFile)
+	if err != nil {
+		return State{}, false
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		// 状态文件损坏时按关闭代理处理
+		return State{Mode: ModeUnknown}, true
+	}
+	return state, true
+}
+
+// Stale 返回需要恢复的遗留状态
+// 状态文件存在但保存它的进程仍在运行时，说明另一个实例正在使用系统代理，不能恢复
+func (g *Guard) Stale() (State, bool) {
+	state, ok := g.Pending()
+	if !ok {
+		return State{}, false
+	}
+	if state.PID != 0 && state.PID != os.Getpid() && processAlive(state.PID) {
+		return state, false
+	}
+	return state, true
+}
+
+// SetGlobal 保存当前系统代理设置后设置全局代理
+func (g *Guard) SetGlobal(addr string, bypass []string) error {
+	if err := g.save(); err != nil {
+		return fmt.Errorf("保存系统代理状态失败: %w", err)
+	}
+	if err := SetGlobal(addr, bypass); err != nil {
+		// 设置失败时尽量恢复原设置
+		g.Restore()
+		return err
+	}
+	return nil
+}
+
+// SetPAC 保存当前系统代理设置后设置 PAC 自动配置
+func (g *Guard) SetPAC(url string) error {
+	if err := g.save(); err != nil {
+		return fmt.Errorf("保存系统代理状态失败: %w", err)
+	}
+	if err := SetPAC(url); err != nil {
+		g.Restore()
+		return err
+	}
+	return nil
+}
+
+// save 保存当前系统代理设置，已有遗留状态时保留原来的状态
+func (g *Guard) save() error {
+	if _, ok := g.Pending(); ok {
+		return nil
+	}
+	state, err := Current()
+	if err != nil {
+		state = State{Mode: ModeUnknown}
+	}
+	state.PID = os.Getpid()
+	state.SavedAt = time.Now()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(g.stateFile), 0755); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免写入过程中崩溃留下半个文件
+	tmp := g.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, g.stateFile)
+}
+
+// Restore 恢复保存的系统代理设置并删除状态文件，没有保存的状态时不做任何事
+func (g *Guard) Restore() error {
+	state, ok := g.Pending()
+	if !ok {
+		return nil
+	}
+	if err := state.Apply(); err != nil {
+		return err
+	}
+	return os.Remove(g.stateFile)
+}
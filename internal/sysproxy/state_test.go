@@ -0,0 +1,95 @@
+package sysproxy
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// connectionSettings 按注册表格式生成连接设置
+func connectionSettings(flags uint32, proxy, bypass, pac string) []byte {
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint32(data, 0x46)
+	binary.LittleEndian.PutUint32(data[8:], flags)
+	for _, s := range []string{proxy, bypass, pac} {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(s)))
+		data = append(data, s...)
+	}
+	// 后面还有自动检测相关的字段，解析时忽略
+	return append(data, make([]byte, 32)...)
+}
+
+func TestParseConnectionSettings(t *testing.T) {
+	cases := []struct {
+		flags      uint32
+		mode       string
+		autoDetect bool
+	}{
+		{proxyTypeDirect, ModeDirect, false},
+		{proxyTypeDirect | proxyTypeProxy, ModeGlobal, false},
+		{proxyTypeDirect | proxyTypeAutoProxyURL | proxyTypeAutoDetect, ModePAC, true},
+		{proxyTypeDirect | proxyTypeAutoDetect, ModeAutoDetect, true},
+	}
+	for _, c := range cases {
+		data := connectionSettings(c.flags, "10.0.0.1:3128", "localhost;<local>", "http://wpad/proxy.pac")
+		state, err := parseConnectionSettings(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.Mode != c.mode || state.AutoDetect != c.autoDetect {
+			t.Errorf("flags %#x: got %s autodetect=%v", c.flags, state.Mode, state.AutoDetect)
+		}
+		if state.PAC != "http://wpad/proxy.pac" || state.Proxy != "10.0.0.1:3128" || len(state.Bypass) != 2 {
+			t.Errorf("flags %#x: fields not read: %+v", c.flags, state)
+		}
+		// 恢复时写入的标志与读取到的一致
+		if got := connectionFlags(state); got != c.flags {
+			t.Errorf("flags %#x: restore writes %#x", c.flags, got)
+		}
+	}
+
+	if _, err := parseConnectionSettings(connectionSettings(proxyTypeProxy, "a", "b", "c")[:20]); err == nil {
+		t.Error("truncated settings should fail")
+	}
+}
+
+func TestGuardStale(t *testing.T) {
+	file := filepath.Join(t.TempDir(), StateFileName)
+	guard := NewGuard(file)
+	write := func(pid int) {
+		data, _ := json.Marshal(State{Mode: ModePAC, PAC: "http://wpad/proxy.pac", PID: pid})
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok := guard.Stale(); ok {
+		t.Error("no state file should not be stale")
+	}
+
+	// 保存状态的进程仍在运行
+	write(os.Getppid())
+	if _, ok := guard.Stale(); ok {
+		t.Error("state of a running process should not be stale")
+	}
+	if _, ok := guard.Pending(); !ok {
+		t.Error("state should still be pending")
+	}
+
+	// 保存状态的进程已经退出
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	write(cmd.Process.Pid)
+	state, ok := guard.Stale()
+	if !ok {
+		t.Error("state of an exited process should be stale")
+	}
+	if state.Mode != ModePAC || state.PAC == "" {
+		t.Errorf("PAC state not kept: %+v", state)
+	}
+}
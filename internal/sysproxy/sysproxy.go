@@ -0,0 +1,14 @@
+package sysproxy
+
+import "errors"
+
+// ErrUnsupported 表示当前系统不支持自动设置系统代理
+var ErrUnsupported = errors.New("当前系统不支持设置系统代理")
+
+// DefaultBypass 默认不走代理的地址
+var DefaultBypass = []string{
+	"localhost", "127.*", "10.*",
+	"172.16.*", "172.17.*", "172.18.*", "172.19.*", "172.20.*", "172.21.*", "172.22.*", "172.23.*",
+	"172.24.*", "172.25.*", "172.26.*", "172.27.*", "172.28.*", "172.29.*", "172.30.*", "172.31.*",
+	"192.168.*",
+}
@@ -0,0 +1,145 @@
+//go:build darwin
+
+package sysproxy
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/husanpao/game-mitm/gosysproxy"
+)
+
+// networkServices 返回启用的网络服务，停用的服务以 * 开头
+func networkServices() ([]string, error) {
+	out, err := exec.Command("networksetup", "-listallnetworkservices").Output()
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "An asterisk") || strings.HasPrefix(line, "*") {
+			continue
+		}
+		services = append(services, line)
+	}
+	return services, nil
+}
+
+// networksetup 执行查询命令并将 "键: 值" 形式的输出解析为映射
+func networksetup(args ...string) (map[string]string, error) {
+	out, err := exec.Command("networksetup", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return values, nil
+}
+
+// Off 关闭系统代理，同时关闭 PAC 和自动发现
+func Off() error {
+	if err := gosysproxy.Off(); err != nil {
+		return err
+	}
+	services, err := networkServices()
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		exec.Command("networksetup", "-setautoproxystate", service, "off").Run()
+		exec.Command("networksetup", "-setproxyautodiscovery", service, "off").Run()
+	}
+	return nil
+}
+
+// Current 读取第一个启用的网络服务的代理设置
+// 设置代理时所有网络服务使用相同的设置，因此以第一个服务为准
+func Current() (State, error) {
+	services, err := networkServices()
+	if err != nil {
+		return State{Mode: ModeUnknown}, err
+	}
+	if len(services) == 0 {
+		return State{Mode: ModeUnknown}, errors.New("没有启用的网络服务")
+	}
+	service := services[0]
+
+	var flags uint32
+	var proxy, pac string
+	auto, err := networksetup("-getautoproxyurl", service)
+	if err != nil {
+		return State{Mode: ModeUnknown}, err
+	}
+	if auto["Enabled"] == "Yes" {
+		flags |= proxyTypeAutoProxyURL
+	}
+	if url := auto["URL"]; url != "(null)" {
+		pac = url
+	}
+	web, err := networksetup("-getwebproxy", service)
+	if err != nil {
+		return State{Mode: ModeUnknown}, err
+	}
+	if web["Enabled"] == "Yes" {
+		flags |= proxyTypeProxy
+	}
+	if web["Server"] != "" {
+		proxy = net.JoinHostPort(web["Server"], web["Port"])
+	}
+	if discovery, err := networksetup("-getproxyautodiscovery", service); err == nil &&
+		discovery["Auto Proxy Discovery"] == "On" {
+		flags |= proxyTypeAutoDetect
+	}
+
+	var bypass []string
+	if out, err := exec.Command("networksetup", "-getproxybypassdomains", service).Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			// 没有设置时输出一句说明而不是域名
+			if line = strings.TrimSpace(line); line != "" && !strings.Contains(line, " ") {
+				bypass = append(bypass, line)
+			}
+		}
+	}
+	return stateFromFlags(flags, proxy, strings.Join(bypass, ";"), pac), nil
+}
+
+// apply 按保存的模式恢复所有网络服务的代理设置
+func apply(s State) error {
+	var err error
+	switch s.Mode {
+	case ModeGlobal:
+		err = gosysproxy.SetGlobalProxy(s.Proxy, s.Bypass...)
+	case ModePAC:
+		if err = gosysproxy.Off(); err == nil {
+			err = gosysproxy.SetPAC(s.PAC)
+		}
+	default:
+		err = gosysproxy.Off()
+	}
+	if err != nil {
+		return err
+	}
+
+	services, err := networkServices()
+	if err != nil {
+		return err
+	}
+	discovery := "off"
+	if s.AutoDetect || s.Mode == ModeAutoDetect {
+		discovery = "on"
+	}
+	for _, service := range services {
+		if s.Mode != ModePAC {
+			exec.Command("networksetup", "-setautoproxystate", service, "off").Run()
+		}
+		exec.Command("networksetup", "-setproxyautodiscovery", service, discovery).Run()
+	}
+	return nil
+}
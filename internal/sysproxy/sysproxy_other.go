@@ -0,0 +1,33 @@
+//go:build !windows && !darwin
+
+package sysproxy
+
+// Supported 返回当前系统是否支持设置系统代理
+func Supported() bool {
+	return false
+}
+
+// SetGlobal 设置全局系统代理
+func SetGlobal(addr string, bypass []string) error {
+	return ErrUnsupported
+}
+
+// SetPAC 设置系统代理为 PAC 自动配置
+func SetPAC(url string) error {
+	return ErrUnsupported
+}
+
+// Off 关闭系统代理
+func Off() error {
+	return ErrUnsupported
+}
+
+// Current 读取当前系统代理设置
+func Current() (State, error) {
+	return State{Mode: ModeUnknown}, ErrUnsupported
+}
+
+// apply 恢复保存的系统代理设置
+func apply(s State) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,20 @@
+//go:build windows || darwin
+
+package sysproxy
+
+import "github.com/husanpao/game-mitm/gosysproxy"
+
+// Supported 返回当前系统是否支持设置系统代理
+func Supported() bool {
+	return true
+}
+
+// SetGlobal 设置全局系统代理
+func SetGlobal(addr string, bypass []string) error {
+	return gosysproxy.SetGlobalProxy(addr, bypass...)
+}
+
+// SetPAC 设置系统代理为 PAC 自动配置
+func SetPAC(url string) error {
+	return gosysproxy.SetPAC(url)
+}
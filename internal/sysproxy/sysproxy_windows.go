@@ -0,0 +1,101 @@
+//go:build windows
+
+package sysproxy
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/husanpao/game-mitm/gosysproxy"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	connectionsKey = `Software\Microsoft\Windows\CurrentVersion\Internet Settings\Connections`
+
+	internetOptionPerConnectionOption = 75
+
+	internetPerConnFlags         = 1
+	internetPerConnProxyServer   = 2
+	internetPerConnProxyBypass   = 3
+	internetPerConnAutoConfigURL = 4
+)
+
+var procInternetSetOption = syscall.NewLazyDLL("wininet.dll").NewProc("InternetSetOptionW")
+
+// perConnOption 对应 INTERNET_PER_CONN_OPTIONW，值为 DWORD、字符串指针或 FILETIME 的联合体
+type perConnOption struct {
+	option uint32
+	value  uint64
+}
+
+// perConnOptionList 对应 INTERNET_PER_CONN_OPTION_LISTW
+type perConnOptionList struct {
+	size       uint32
+	connection *uint16
+	count      uint32
+	optionErr  uint32
+	options    *perConnOption
+}
+
+// Off 关闭系统代理，同时关闭 PAC 和自动检测
+func Off() error {
+	return gosysproxy.Off()
+}
+
+// Current 读取当前系统代理设置，包括 PAC 地址和自动检测
+func Current() (State, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, connectionsKey, registry.QUERY_VALUE)
+	if err != nil {
+		if errors.Is(err, registry.ErrNotExist) {
+			// 从未修改过代理设置
+			return State{Mode: ModeDirect}, nil
+		}
+		return State{Mode: ModeUnknown}, err
+	}
+	defer key.Close()
+	data, _, err := key.GetBinaryValue("DefaultConnectionSettings")
+	if err != nil {
+		if errors.Is(err, registry.ErrNotExist) {
+			return State{Mode: ModeDirect}, nil
+		}
+		return State{Mode: ModeUnknown}, err
+	}
+	return parseConnectionSettings(data)
+}
+
+// apply 一次写入代理标志、代理地址、例外列表和 PAC 地址，完整还原保存的设置
+func apply(s State) error {
+	strs := []string{s.Proxy, strings.Join(s.Bypass, ";"), s.PAC}
+	ptrs := make([]*uint16, len(strs))
+	for i, str := range strs {
+		p, err := syscall.UTF16PtrFromString(str)
+		if err != nil {
+			return err
+		}
+		ptrs[i] = p
+	}
+	options := []perConnOption{
+		{option: internetPerConnFlags, value: uint64(connectionFlags(s))},
+		{option: internetPerConnProxyServer, value: uint64(uintptr(unsafe.Pointer(ptrs[0])))},
+		{option: internetPerConnProxyBypass, value: uint64(uintptr(unsafe.Pointer(ptrs[1])))},
+		{option: internetPerConnAutoConfigURL, value: uint64(uintptr(unsafe.Pointer(ptrs[2])))},
+	}
+	list := perConnOptionList{
+		count:   uint32(len(options)),
+		options: &options[0],
+	}
+	list.size = uint32(unsafe.Sizeof(list))
+	ret, _, callErr := procInternetSetOption.Call(0, internetOptionPerConnectionOption,
+		uintptr(unsafe.Pointer(&list)), unsafe.Sizeof(list))
+	runtime.KeepAlive(ptrs)
+	runtime.KeepAlive(options)
+	if ret == 0 {
+		return fmt.Errorf("写入系统代理设置失败: %w", callErr)
+	}
+	return gosysproxy.Flush()
+}
@@ -0,0 +1,154 @@
+package tables
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"xyzw_study/internal/msgpath"
+	"xyzw_study/internal/record"
+)
+
+// Mapping 字段到配置表的映射，格式: {cmd: {路径: 表名}}，与备注中的 keyNotes 格式相同
+// 命令为 "*" 时对所有命令生效，路径中 "*" 匹配任意一段，"**" 匹配任意多段
+// 路径匹配到数值时使用该值作为ID，匹配到对象时使用最后一段键名作为ID，例如 body.role.items.*
+type Mapping map[string]map[string]string
+
+// DefaultMapping 默认映射，只有对应的配置表存在时才会生效
+func DefaultMapping() Mapping {
+	return Mapping{
+		"*": {
+			"**.itemId": "item",
+			"**.heroId": "hero",
+		},
+	}
+}
+
+// With 返回合并了 other 的映射，相同命令和路径以 other 为准
+func (m Mapping) With(other map[string]map[string]string) Mapping {
+	merged := make(Mapping, len(m)+len(other))
+	for cmd, paths := range m {
+		merged[cmd] = maps.Clone(paths)
+	}
+	for cmd, paths := range other {
+		if merged[cmd] == nil {
+			merged[cmd] = make(map[string]string)
+		}
+		maps.Copy(merged[cmd], paths)
+	}
+	return merged
+}
+
+// rules 返回对命令生效的映射规则，命令自己的规则在前
+func (m Mapping) rules(cmd string) []rule {
+	var rules []rule
+	for _, key := range []string{cmd, "*"} {
+		paths := m[key]
+		for _, p := range slices.Sorted(maps.Keys(paths)) {
+			if paths[p] != "" {
+				rules = append(rules, rule{pattern: p, table: strings.ToLower(paths[p])})
+			}
+		}
+		if cmd == "*" {
+			break
+		}
+	}
+	return rules
+}
+
+type rule struct {
+	pattern string
+	table   string
+}
+
+// Annotation 一个ID字段对应的名称
+type Annotation struct {
+	Path  string `json:"path"`  // 字段路径，ID为对象键名时为该对象的路径
+	Table string `json:"table"` // 配置表
+	ID    string `json:"id"`    // ID
+	Name  string `json:"name"`  // 名称
+}
+
+// Annotate 查找消息中ID字段对应的名称，msg 为解码后的消息
+func (s *Store) Annotate(m Mapping, cmd string, msg any) []Annotation {
+	rules := m.rules(cmd)
+	if len(rules) == 0 {
+		return nil
+	}
+	tables := s.snapshot()
+	if len(tables) == 0 {
+		return nil
+	}
+	var result []Annotation
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		if path != "" {
+			if a, ok := annotate(tables, rules, path, v); ok {
+				result = append(result, a)
+			}
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			for _, k := range slices.Sorted(maps.Keys(val)) {
+				walk(join(path, k), val[k])
+			}
+		case []any:
+			for i, item := range val {
+				walk(join(path, strconv.Itoa(i)), item)
+			}
+		}
+	}
+	walk("", msg)
+	return result
+}
+
+// annotate 检查一个字段是否匹配映射，第一个在配置表中找到名称的规则生效
+func annotate(tables map[string]Table, rules []rule, path string, v any) (Annotation, bool) {
+	for _, r := range rules {
+		t := tables[r.table]
+		if t == nil || !msgpath.Match(r.pattern, path) {
+			continue
+		}
+		var id string
+		switch v.(type) {
+		case map[string]any, []any:
+			id = path[strings.LastIndexByte(path, '.')+1:]
+		default:
+			id = msgpath.String(v)
+		}
+		if name, ok := t[id]; ok {
+			return Annotation{Path: path, Table: r.table, ID: id, Name: name}, true
+		}
+	}
+	return Annotation{}, false
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// Names 将注释转换为 路径 -> 名称 的映射，用于导出
+func Names(annotations []Annotation) map[string]string {
+	if len(annotations) == 0 {
+		return nil
+	}
+	names := make(map[string]string, len(annotations))
+	for _, a := range annotations {
+		names[a.Path] = a.Name
+	}
+	return names
+}
+
+// Record 为抓包记录添加ID名称，无法解码的记录原样返回
+func (s *Store) Record(m Mapping, rec record.Record) record.Record {
+	msg, err := rec.Value()
+	if err != nil {
+		return rec
+	}
+	cmd, _ := msg["cmd"].(string)
+	rec.Names = Names(s.Annotate(m, cmd, msg))
+	return rec
+}
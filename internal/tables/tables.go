@@ -0,0 +1,253 @@
+package tables
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"xyzw_study/internal/msgpath"
+)
+
+// DirName 数据目录中存放配置表的子目录
+const DirName = "tables"
+
+// reloadInterval 检查配置表文件是否变化的最小间隔
+const reloadInterval = 2 * time.Second
+
+// Table 一张配置表，ID 到名称的映射
+type Table map[string]string
+
+// Info 配置表概要
+type Info struct {
+	Name string `json:"name"` // 表名，即去掉扩展名的文件名
+	File string `json:"file"` // 文件名
+	Rows int    `json:"rows"` // 行数
+}
+
+// Store 从目录加载游戏配置表，可以被多个协程并发使用
+//
+// 目录中每个 .json 或 .csv 文件是一张表，表名为去掉扩展名的小写文件名，例如 item.json 为 item 表
+// JSON 可以是对象数组 [{"id": 3010, "name": "..."}]，也可以是以ID为键的对象 {"3010": "..."} 或 {"3010": {"name": "..."}}
+// CSV 第一行为表头，使用 id 列和 name 列，没有时使用第一列和第二列
+// 文件变化后下次使用时重新加载
+type Store struct {
+	dir string
+
+	mu      sync.Mutex
+	tables  map[string]Table
+	infos   []Info
+	sig     string
+	checked time.Time
+	err     error
+}
+
+// Open 打开配置表目录，目录不存在时没有任何表
+func Open(dir string) *Store {
+	s := &Store{dir: dir}
+	s.mu.Lock()
+	s.reload(true)
+	s.mu.Unlock()
+	return s
+}
+
+// Dir 返回配置表目录
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Err 返回最近一次加载时的错误，部分文件加载失败时其他表仍然可用
+func (s *Store) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload(false)
+	return s.err
+}
+
+// List 返回所有配置表的概要
+func (s *Store) List() []Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload(false)
+	return slices.Clone(s.infos)
+}
+
+// Lookup 查找ID对应的名称
+func (s *Store) Lookup(table, id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload(false)
+	name, ok := s.tables[strings.ToLower(table)][id]
+	return name, ok
+}
+
+// snapshot 返回当前加载的表，返回的表不会被修改
+func (s *Store) snapshot() map[string]Table {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload(false)
+	return s.tables
+}
+
+// reload 配置表文件变化时重新加载，调用方需要持有 mu
+func (s *Store) reload(force bool) {
+	if !force && time.Since(s.checked) < reloadInterval {
+		return
+	}
+	s.checked = time.Now()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !os.IsNotExist(err) {
+		s.err = err
+		return
+	}
+	var files []os.DirEntry
+	var sig strings.Builder
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || ext != ".json" && ext != ".csv" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, e)
+		fmt.Fprintf(&sig, "%s:%d:%d;", e.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	if !force && sig.String() == s.sig {
+		return
+	}
+
+	tables := make(map[string]Table)
+	var infos []Info
+	var errs []error
+	for _, e := range files {
+		name := strings.ToLower(strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+		t, err := loadFile(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("加载配置表 %s 失败: %w", e.Name(), err))
+			continue
+		}
+		if _, dup := tables[name]; dup {
+			errs = append(errs, fmt.Errorf("配置表 %s 重复，忽略 %s", name, e.Name()))
+			continue
+		}
+		tables[name] = t
+		infos = append(infos, Info{Name: name, File: e.Name(), Rows: len(t)})
+	}
+	s.tables = tables
+	s.infos = infos
+	s.sig = sig.String()
+	s.err = errors.Join(errs...)
+}
+
+// loadFile 按扩展名加载一个配置表文件
+func loadFile(path string) (Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return parseCSV(data)
+	}
+	return parseJSON(data)
+}
+
+// idFields 和 nameFields 按顺序查找ID列和名称列，不区分大小写
+var (
+	idFields   = []string{"id"}
+	nameFields = []string{"name", "名称", "名字", "title"}
+)
+
+func parseJSON(data []byte) (Table, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	t := make(Table)
+	switch val := v.(type) {
+	case []any:
+		for i, row := range val {
+			obj, ok := row.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("第 %d 行不是对象", i+1)
+			}
+			id, ok := field(obj, idFields)
+			if !ok {
+				return nil, fmt.Errorf("第 %d 行没有 id 字段", i+1)
+			}
+			if name, ok := field(obj, nameFields); ok {
+				t[id] = name
+			}
+		}
+	case map[string]any:
+		for id, row := range val {
+			switch r := row.(type) {
+			case string:
+				t[id] = r
+			case map[string]any:
+				if name, ok := field(r, nameFields); ok {
+					t[id] = name
+				}
+			}
+		}
+	default:
+		return nil, errors.New("配置表必须是数组或对象")
+	}
+	return t, nil
+}
+
+// field 按候选名称查找字段，不区分大小写
+func field(obj map[string]any, names []string) (string, bool) {
+	for _, name := range names {
+		for k, v := range obj {
+			if strings.EqualFold(k, name) && v != nil {
+				return msgpath.String(v), true
+			}
+		}
+	}
+	return "", false
+}
+
+func parseCSV(data []byte) (Table, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return Table{}, nil
+	}
+	header := rows[0]
+	idCol := column(header, idFields, 0)
+	nameCol := column(header, nameFields, 1)
+	t := make(Table)
+	for _, row := range rows[1:] {
+		if idCol < len(row) && nameCol < len(row) && row[idCol] != "" {
+			t[strings.TrimSpace(row[idCol])] = strings.TrimSpace(row[nameCol])
+		}
+	}
+	return t, nil
+}
+
+func column(header, names []string, fallback int) int {
+	for _, name := range names {
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i
+			}
+		}
+	}
+	return fallback
+}
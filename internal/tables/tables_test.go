@@ -0,0 +1,93 @@
+package tables
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"xyzw_study/internal/record"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testStore(t *testing.T) *Store {
+	dir := t.TempDir()
+	writeFile(t, dir, "Item.json", `[{"id": 3010, "name": "招募令"}, {"ID": 3011, "名称": "金砖"}]`)
+	writeFile(t, dir, "hero.json", `{"101": "刘备", "102": {"name": "关羽"}}`)
+	writeFile(t, dir, "equip.csv", "\xef\xbb\xbf编号,名称\n1,青龙刀\n2,丈八矛\n")
+	writeFile(t, dir, "broken.json", `{`)
+	return Open(dir)
+}
+
+func TestLoad(t *testing.T) {
+	s := testStore(t)
+	if len(s.List()) != 3 || s.Err() == nil {
+		t.Fatalf("list = %+v, err = %v", s.List(), s.Err())
+	}
+	for _, c := range []struct{ table, id, name string }{
+		{"item", "3010", "招募令"},
+		{"ITEM", "3011", "金砖"},
+		{"hero", "102", "关羽"},
+		{"equip", "2", "丈八矛"},
+	} {
+		if name, ok := s.Lookup(c.table, c.id); !ok || name != c.name {
+			t.Errorf("Lookup(%s, %s) = %q, %v", c.table, c.id, name, ok)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	s := testStore(t)
+	m := DefaultMapping().With(map[string]map[string]string{
+		"role_getroleinforesp": {"body.role.items.*": "item", "body.role.heroes.*.id": "hero"},
+	})
+	var msg map[string]any
+	json.Unmarshal([]byte(`{"cmd": "role_getroleinforesp", "body": {"role": {
+		"items": {"3010": {"quantity": 5}, "9999": {"quantity": 1}},
+		"heroes": [{"id": 101}, {"id": 5}],
+		"reward": {"itemId": 3011}
+	}}}`), &msg)
+
+	names := Names(s.Annotate(m, "role_getroleinforesp", msg))
+	want := map[string]string{
+		"body.role.items.3010":    "招募令",
+		"body.role.heroes.0.id":   "刘备",
+		"body.role.reward.itemId": "金砖",
+	}
+	if len(names) != len(want) {
+		t.Fatalf("names = %v", names)
+	}
+	for k, v := range want {
+		if names[k] != v {
+			t.Errorf("names[%s] = %q, want %q", k, names[k], v)
+		}
+	}
+
+	// 其他命令只使用默认映射
+	if names := Names(s.Annotate(m, "other", msg)); len(names) != 1 {
+		t.Errorf("other cmd names = %v", names)
+	}
+}
+
+func TestRecordAndReload(t *testing.T) {
+	s := testStore(t)
+	rec := record.Record{Msg: json.RawMessage(`{"cmd": "item_use", "body": {"itemId": 3010}}`)}
+	if rec = s.Record(DefaultMapping(), rec); rec.Names["body.itemId"] != "招募令" {
+		t.Fatalf("names = %v", rec.Names)
+	}
+
+	writeFile(t, s.Dir(), "item.csv", "id,name\n3010,新招募令\n")
+	os.Remove(filepath.Join(s.Dir(), "Item.json"))
+	s.mu.Lock()
+	s.checked = time.Time{}
+	s.mu.Unlock()
+	if name, _ := s.Lookup("item", "3010"); name != "新招募令" {
+		t.Errorf("after reload name = %q", name)
+	}
+}
@@ -0,0 +1,5 @@
+module github.com/husanpao/game-mitm
+
+go 1.20
+
+require github.com/gorilla/websocket v1.5.3
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"xyzw_study/internal/bundle"
+)
+
+// HandleBundleExport 导出备注和脚本
+// 参数 base=1 表示导出用于共享，导出的内容同时作为下次导入的合并基准
+func HandleBundleExport(w http.ResponseWriter, r *http.Request) {
+	b, err := bundle.Export(noteStore, scriptStore)
+	if err != nil {
+		http.Error(w, "导出失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("base") == "1" {
+		if err := bundle.SaveBase(dataDir, b); err != nil {
+			http.Error(w, "导出失败: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("xyzw-bundle-%s.json", time.Now().Format("20060102150405"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	b.Write(w)
+}
+
+// HandleBundleImport 导入备注和脚本，与本地数据三方合并并返回冲突
+// 参数 dryRun=1 只返回合并结果，strategy=remote 时冲突使用导入的版本
+func HandleBundleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持POST请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := bundle.Read(r.Body)
+	if err != nil {
+		http.Error(w, "解析请求数据失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := bundle.Options{
+		Theirs: query.Get("strategy") == "remote",
+		DryRun: query.Get("dryRun") == "1",
+		Author: scriptAuthor(r),
+	}
+	summary, err := bundle.Import(noteStore, scriptStore, dataDir, b, opts)
+	if err != nil {
+		http.Error(w, "导入失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
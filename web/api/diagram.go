@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"xyzw_study/internal/diagram"
+	"xyzw_study/internal/notes"
+)
+
+// HandleDiagram 导出会话中一段消息的时序图
+// 例如 /api/diagram?session=xxx&format=mermaid&seq=10-25&fields=body.itemId&exclude=heart_beat
+// 参数 since、until 与 /api/packets 相同，seq 为抓包中客户端请求的序号范围，
+// fields 和 exclude 可以重复或用逗号分隔，download=1 时作为附件下载
+func HandleDiagram(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+		return
+	}
+	if packetStore == nil {
+		http.Error(w, "数据包存储未初始化", http.StatusServiceUnavailable)
+		return
+	}
+	params := r.URL.Query()
+	session := params.Get("session")
+	if session == "" {
+		http.Error(w, "缺少 session 参数", http.StatusBadRequest)
+		return
+	}
+	format := params.Get("format")
+	if format == "" {
+		format = diagram.FormatMermaid
+	}
+	if format != diagram.FormatMermaid && format != diagram.FormatPlantUML {
+		http.Error(w, "不支持的时序图格式: "+format, http.StatusBadRequest)
+		return
+	}
+
+	opts := diagram.Options{
+		Title:   params.Get("title"),
+		Fields:  listParam(params["fields"]),
+		Exclude: listParam(params["exclude"]),
+	}
+	var err error
+	if opts.Since, err = parseTime(params.Get("since")); err != nil {
+		http.Error(w, "解析查询参数失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Until, err = parseTime(params.Get("until")); err != nil {
+		http.Error(w, "解析查询参数失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.SeqFrom, opts.SeqTo, err = diagram.ParseSeqRange(params.Get("seq")); err != nil {
+		http.Error(w, "解析查询参数失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		if opts.MaxMessages, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "解析查询参数失败: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 回复与请求的配对需要会话从开始的全部消息，范围在生成时序图时再选择
+	records, err := sessionRecords(session)
+	if err != nil {
+		http.Error(w, "查询数据包失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(records) == 0 {
+		http.Error(w, "会话没有数据包: "+session, http.StatusNotFound)
+		return
+	}
+	n := notes.New()
+	if noteStore != nil {
+		if n, _, err = noteStore.Get(); err != nil {
+			http.Error(w, "读取备注失败: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	d := diagram.Build(records, n, opts)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if params.Get("download") == "1" {
+		ext := map[string]string{diagram.FormatMermaid: "mmd", diagram.FormatPlantUML: "puml"}[format]
+		w.Header().Set("Content-Disposition", `attachment; filename="xyzw-`+safeFilename(session)+`.`+ext+`"`)
+	}
+	diagram.Write(w, d, format)
+}
+
+// listParam 合并重复的参数，每个参数也可以用逗号分隔多个值
+func listParam(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"xyzw_study/internal/store"
+)
+
+func TestHandleDiagram(t *testing.T) {
+	base := time.Now().Add(-time.Minute)
+	var packets []store.Packet
+	for i, msg := range []string{
+		`{"cmd":"heart_beat","seq":1}`,
+		`{"cmd":"HeartBeatResp","resp":1}`,
+		`{"cmd":"item_openpack","seq":2,"body":{"itemId":3010}}`,
+		`{"cmd":"Item_OpenBoxResp","resp":2}`,
+	} {
+		call := "client"
+		if strings.Contains(msg, "Resp") {
+			call = "server"
+		}
+		packets = append(packets, store.Packet{Time: base.Add(time.Duration(i) * time.Second), Session: "s1", Call: call, Msg: json.RawMessage(msg)})
+	}
+	useTestStore(t, packets...)
+
+	for _, tc := range []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"", http.StatusBadRequest, "session"},
+		{"?session=s1&format=svg", http.StatusBadRequest, "svg"},
+		{"?session=s1&seq=3-1", http.StatusBadRequest, "序号"},
+		{"?session=s1&seq=2&fields=itemId", http.StatusOK, "sequenceDiagram\n    participant C as 客户端\n    participant S as 服务器\n    C->>S: item_openpack seq=2<br/>itemId=3010\n    S-->>C: Item_OpenBoxResp 1000ms\n"},
+		{"?session=s1&format=plantuml&exclude=heart_beat,HeartBeatResp", http.StatusOK, "@startuml\nparticipant \"客户端\" as C\nparticipant \"服务器\" as S\nC -> S : item_openpack seq=2\n"},
+	} {
+		rec := httptest.NewRecorder()
+		HandleDiagram(rec, httptest.NewRequest(http.MethodGet, "/api/diagram"+tc.query, nil))
+		if rec.Code != tc.code || !strings.Contains(rec.Body.String(), tc.want) {
+			t.Errorf("%s: %d\n%s", tc.query, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"xyzw_study/internal/crypto/bon"
+	"xyzw_study/internal/diff"
+	"xyzw_study/internal/record"
+)
+
+// DiffRequest 定义差异比较请求
+// 任一侧有 JSONL 抓包内容时按命令比较两个抓包，忽略其它字段；
+// 否则比较两个消息，每一侧优先使用原始X帧的十六进制以保留BON类型，没有时使用解码后的 JSON
+type DiffRequest struct {
+	A        json.RawMessage `json:"a"`
+	B        json.RawMessage `json:"b"`
+	ARaw     string          `json:"aRaw"`
+	BRaw     string          `json:"bRaw"`
+	ACapture string          `json:"aCapture"`
+	BCapture string          `json:"bCapture"`
+	Ignore   []string        `json:"ignore"` // 为空时使用默认忽略字段
+}
+
+// HandleDiff 处理差异比较请求
+func HandleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持POST请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DiffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "解析请求数据失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := diff.Options{Ignore: req.Ignore}
+	if opts.Ignore == nil {
+		opts.Ignore = diff.DefaultIgnore
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// 按命令比较两个抓包
+	if req.ACapture != "" || req.BCapture != "" {
+		a, err := record.Read(strings.NewReader(req.ACapture))
+		if err != nil {
+			http.Error(w, "解析抓包A失败: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := record.Read(strings.NewReader(req.BCapture))
+		if err != nil {
+			http.Error(w, "解析抓包B失败: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := diff.Records(a, b, opts)
+		if err != nil {
+			http.Error(w, "比较抓包失败: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"cmds": result})
+		return
+	}
+
+	a, err := diffValue(req.A, req.ARaw)
+	if err != nil {
+		http.Error(w, "解析值A失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, err := diffValue(req.B, req.BRaw)
+	if err != nil {
+		http.Error(w, "解析值B失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"changes": diff.Values(a, b, opts)})
+}
+
+// diffValue 将请求中的一侧解析为BON类型的值，raw 非空时优先使用
+func diffValue(value json.RawMessage, raw string) (any, error) {
+	if raw != "" {
+		data, err := hex.DecodeString(raw)
+		if err != nil {
+			return nil, err
+		}
+		return bon.DecodeXWithBody(data)
+	}
+	if len(value) == 0 {
+		return nil, nil
+	}
+	var v any
+	dec := json.NewDecoder(strings.NewReader(string(value)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return bon.FromJSON(v), nil
+}
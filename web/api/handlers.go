@@ -2,95 +2,109 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	gamemitm "github.com/husanpao/game-mitm"
 	"log"
 	"net/http"
-	"os"
+	"sync"
 	"time"
 	"xyzw_study/internal/crypto/bon"
-	"xyzw_study/internal/model"
+	"xyzw_study/internal/notes"
 	"xyzw_study/internal/proxy"
 )
 
 var (
 	debugQueue = make(chan DebugMessage, 100) // 调试消息队列
-	game       *gamemitm.Session
+	game       *gamemitm.Session              // 最近收到消息的游戏会话，调试消息注入到这个会话
+	gameMu     sync.Mutex
+
+	errDebugQueueFull = errors.New("调试队列已满")
 )
 
 // Notes 定义备注数据结构
-type Notes struct {
-	CommandNotes map[string]string            `json:"commandNotes"`
-	KeyNotes     map[string]map[string]string `json:"keyNotes"`
-}
+type Notes = notes.Notes
+
+// 调试消息的发送方向
+const (
+	DebugToServer = "server" // 伪装成客户端发给服务器，默认方向
+	DebugToClient = "client" // 伪装成服务器发给游戏客户端
+)
 
 // DebugMessage 定义调试消息结构
 type DebugMessage struct {
-	Cmd  string `json:"cmd"`
-	Data any    `json:"data"`
-}
-
-// 保存备注数据到文件
-func saveNotes(notes Notes) error {
-	data, err := json.MarshalIndent(notes, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(notesFilePath, data, 0644)
+	Cmd       string `json:"cmd"`
+	Data      any    `json:"data"`
+	Direction string `json:"direction,omitempty"` // 发送方向，server 或 client，为空时发给服务器
+	Resp      int32  `json:"resp,omitempty"`      // 发给客户端时回复的客户端请求序号，0 表示推送
 }
 
-// 从文件加载备注数据
-func loadNotes() (Notes, error) {
-	var notes Notes
-	notes.CommandNotes = make(map[string]string)
-	notes.KeyNotes = make(map[string]map[string]string)
-
-	data, err := os.ReadFile(notesFilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// 文件不存在，返回空备注
-			return notes, nil
-		}
-		return notes, err
-	}
-
-	err = json.Unmarshal(data, &notes)
-	return notes, err
-}
-
-// HandleSaveNotes 处理备注保存请求
+// HandleSaveNotes 处理备注保存请求，替换全部备注
+// 请求带 If-Match 时，备注在加载后被修改过则返回 412，避免覆盖其他页面的修改
 func HandleSaveNotes(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "只支持POST请求", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var notes Notes
-	err := json.NewDecoder(r.Body).Decode(&notes)
+	var n Notes
+	err := json.NewDecoder(r.Body).Decode(&n)
 	if err != nil {
 		http.Error(w, "解析请求数据失败: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err = saveNotes(notes)
+	etag, err := noteStore.Replace(n, r.Header.Get("If-Match"))
+	if errors.Is(err, notes.ErrConflict) {
+		w.Header().Set("ETag", etag)
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
 	if err != nil {
 		http.Error(w, "保存备注失败: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("ETag", etag)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"success": true}`))
 }
 
-// HandleLoadNotes 处理备注加载请求
+// HandleLoadNotes 处理备注加载请求，ETag 响应头用于保存时检查冲突
 func HandleLoadNotes(w http.ResponseWriter, r *http.Request) {
-	notes, err := loadNotes()
+	n, etag, err := noteStore.Get()
 	if err != nil {
 		http.Error(w, "加载备注失败: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(notes)
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(n)
+}
+
+// HandlePatchNotes 处理单条备注的修改和删除，不影响其他备注
+// 请求体格式与 JSON Merge Patch 相同，值为 null 时删除，返回修改后的全部备注
+// 例如 PATCH /api/notes {"keyNotes": {"role_getroleinfo": {"body.role.level": "等级"}}}
+func HandlePatchNotes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "只支持PATCH请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var patch notes.Patch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "解析请求数据失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	n, etag, err := noteStore.Update(patch)
+	if err != nil {
+		http.Error(w, "保存备注失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(n)
 }
 
 // HandleDebugMessage 处理调试消息发送
@@ -108,12 +122,35 @@ func HandleDebugMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 将消息添加到队列
+	if err := queueDebugMessage(message); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errDebugQueueFull) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"success": true}`))
+}
+
+// queueDebugMessage 校验调试消息并加入发送队列
+func queueDebugMessage(message DebugMessage) error {
+	switch message.Direction {
+	case "", DebugToServer, DebugToClient:
+	default:
+		return errors.New("未知的发送方向: " + message.Direction)
+	}
+	if message.Cmd == "" {
+		return errors.New("缺少 cmd")
+	}
 	select {
 	case debugQueue <- message:
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"success": true}`))
+		debugMessages.With(debugDirection(message), "queued").Inc()
+		return nil
 	default:
-		http.Error(w, "调试队列已满", http.StatusServiceUnavailable)
+		debugMessages.With(debugDirection(message), "rejected").Inc()
+		return errDebugQueueFull
 	}
 }
 
@@ -124,25 +161,9 @@ func ConsumeDebugQueue() {
 		case msg := <-debugQueue:
 			// 构造消息
 			log.Println("收到调试消息:", msg)
-			if game != nil {
-
-				debugMsg := model.XYMsg{
-					Ack:  0,
-					Body: bon.EncodeToBytes(msg.Data),
-					Cmd:  msg.Cmd,
-					Seq:  proxy.NextSeq(),
-					Time: time.Now().UnixMilli(),
-				}
-				bs, err := bon.EncodeAndEncryptX(debugMsg)
-				result := make([]byte, len(bs))
-				copy(result, bs)
-				if err != nil {
-					log.Println(err)
-				} else {
-					HandleGamePacket(proxy.GamePacket{Raw: bs, RawData: bon.DecodeX(bs), Direction: proxy.Send, Session: nil})
-					game.SendBinaryToServer(result)
-
-				}
+			if err := sendDebugMessage(msg); err != nil {
+				debugMessages.With(debugDirection(msg), "failed").Inc()
+				log.Println(err)
 			}
 			// 等待2秒
 			time.Sleep(2 * time.Second)
@@ -150,10 +171,69 @@ func ConsumeDebugQueue() {
 	}
 }
 
+// sendDebugMessage 编码调试消息并发送，没有游戏会话时忽略
+// 序号由会话的转换器分配，之后的真实消息会顺延
+// 发给服务器的消息的回复不会转发给客户端，发给客户端的消息使用服务器序号并确认客户端最后的请求
+func sendDebugMessage(msg DebugMessage) error {
+	game := currentGame()
+	if game == nil {
+		return nil
+	}
+	toClient := msg.Direction == DebugToClient
+
+	var (
+		bs  []byte
+		err error
+	)
+	if toClient {
+		bs, err = proxy.EncodeToClient(game, msg.Cmd, msg.Data, msg.Resp)
+	} else {
+		bs, err = proxy.EncodeToServer(game, msg.Cmd, msg.Data)
+	}
+	if err != nil {
+		return err
+	}
+	// DecodeX 会原地解密，使用拷贝解码
+	decodedInput := make([]byte, len(bs))
+	copy(decodedInput, bs)
+	packet := proxy.GamePacket{Raw: bs, RawData: bon.DecodeX(decodedInput), Direction: proxy.Send, Session: game, Time: time.Now(), Injected: true}
+	if toClient {
+		packet.Direction = proxy.Receive
+		packet.Forged = true
+	}
+	HandleGamePacket(packet)
+	if toClient {
+		game.SendBinaryToClient(bs)
+	} else {
+		game.SendBinaryToServer(bs)
+	}
+	debugMessages.With(debugDirection(msg), "sent").Inc()
+	return nil
+}
+
+// currentGame 返回调试消息注入的游戏会话，没有连接中的会话时返回 nil
+func currentGame() *gamemitm.Session {
+	gameMu.Lock()
+	defer gameMu.Unlock()
+	return game
+}
+
+// HandleSessionClosed 游戏连接断开时调用，断开的会话不再用于注入调试消息
+func HandleSessionClosed(session *gamemitm.Session, sessionID string) {
+	gameMu.Lock()
+	defer gameMu.Unlock()
+	if game == session {
+		game = nil
+	}
+}
+
 // HandleGamePacket 处理游戏数据包
 func HandleGamePacket(packet proxy.GamePacket) {
-	if game == nil {
+	// 重连后使用新的会话，注入的消息不改变目标会话
+	if packet.Session != nil && !packet.Injected {
+		gameMu.Lock()
 		game = packet.Session
+		gameMu.Unlock()
 	}
 
 	// 确定消息方向
@@ -164,9 +244,20 @@ func HandleGamePacket(packet proxy.GamePacket) {
 		call = "server"
 	}
 
-	// 广播消息到所有连接的 WebSocket 客户端
-	BroadcastMessage(WSMessage{
-		Call: call,
-		Msg:  packet.RawData,
-	})
+	// 持久化数据包
+	storePacket(packet, call)
+
+	// 服务器消息中的角色数据更新到角色状态，客户端请求用于查找引起变化的命令
+	if call == "server" {
+		updateRoleState(packet)
+	} else {
+		recordRequest(packet)
+	}
+
+	// 推送到订阅了该消息的 WebSocket 客户端
+	broadcast(newWSPacket(WSMessage{
+		Call:    call,
+		Msg:     packet.RawData,
+		Session: packetSessionID(packet),
+	}, packet.Raw))
 }
@@ -0,0 +1,388 @@
+package api
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"xyzw_study/internal/ledger"
+	"xyzw_study/internal/mockserver"
+	"xyzw_study/internal/proxy"
+	"xyzw_study/internal/rolestate"
+	"xyzw_study/internal/seqmap"
+
+	"github.com/gorilla/websocket"
+)
+
+// freePort 返回一个当前空闲的本地端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// startCapture 在临时目录中启动抓包代理，证书目录 ./ca 不会写入源码目录
+func startCapture(t *testing.T, hosts []string) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	port := freePort(t)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- proxy.StartCapture(proxy.Options{Port: port, Hosts: hosts, Logger: log.New(io.Discard, "", 0), Closed: HandleSessionClosed}, HandleGamePacket)
+	}()
+
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-errCh:
+			t.Fatalf("抓包代理启动失败: %v", err)
+		default:
+		}
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("抓包代理没有启动")
+	return ""
+}
+
+// gameClient 模拟通过代理连接的游戏客户端
+type gameClient struct {
+	t  *testing.T
+	ws *websocket.Conn
+}
+
+func (c *gameClient) send(f mockserver.Frame) {
+	c.t.Helper()
+	data, err := f.Encode()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *gameClient) recv() mockserver.Frame {
+	c.t.Helper()
+	c.ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.ws.ReadMessage()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	f, err := mockserver.Decode(data)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return f
+}
+
+// TestCaptureEndToEnd 通过模拟服务器测试代理的序号转换、调试消息注入和 Web 界面推送
+func TestCaptureEndToEnd(t *testing.T) {
+	game = nil
+	packetStore = nil
+	roleState = rolestate.New(0)
+	resourceLedger = ledger.New(0)
+
+	// 指标是全局的，比较测试前后的差值
+	metricNames := []string{
+		`xyzw_proxy_messages_total{direction="client",cmd="role_getroleinfo"}`,
+		`xyzw_proxy_frames_total{direction="server",format="x"}`,
+		`xyzw_proxy_request_latency_seconds_count{cmd="role_getroleinfo"}`,
+		`xyzw_proxy_request_latency_seconds_count{cmd="system_buygold"}`,
+		`xyzw_debug_messages_total{direction="server",result="sent"}`,
+	}
+	before := metricValues(t, metricNames)
+
+	mock := mockserver.New()
+	mock.Respond("role_getroleinfo", "Role_GetRoleInfoResp", map[string]any{"role": map[string]any{"level": int32(10)}})
+	mock.Respond("system_buygold", "System_BuyGoldResp", map[string]any{"gold": int32(100)})
+	gameServer := httptest.NewTLSServer(mock)
+	defer gameServer.Close()
+	gameURL, _ := url.Parse(gameServer.URL)
+
+	proxyAddr := startCapture(t, []string{gameURL.Hostname()})
+
+	// Web 界面连接
+	ui := httptest.NewServer(http.HandlerFunc(HandleWebSocket))
+	defer ui.Close()
+	uiConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ui.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uiConn.Close()
+
+	// 游戏客户端通过代理连接模拟服务器
+	dialer := websocket.Dialer{
+		Proxy:           http.ProxyURL(&url.URL{Scheme: "http", Host: proxyAddr}),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	ws, _, err := dialer.Dial("wss://"+gameURL.Host+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	client := &gameClient{t: t, ws: ws}
+
+	client.send(mockserver.Frame{Cmd: "role_getroleinfo", Seq: 1})
+	if resp := client.recv(); resp.Cmd != "Role_GetRoleInfoResp" || resp.Resp != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	// 注入调试消息，占用服务器看到的 seq 2
+	if err := sendDebugMessage(DebugMessage{Cmd: "system_buygold", Data: map[string]any{}}); err != nil {
+		t.Fatal(err)
+	}
+	// 调试消息的回复不转发给客户端，客户端只收到不占用序号的 _sys/ack
+	if resp := client.recv(); resp.Cmd != seqmap.AckCmd || resp.Seq != 0 || resp.Ack != 1 {
+		t.Fatalf("unexpected frame for debug response: %+v", resp)
+	}
+
+	// 客户端的 seq 2 在服务器上是 3，回复的 resp 需要还原为 2
+	client.send(mockserver.Frame{Cmd: "role_getroleinfo", Seq: 2, Ack: 1})
+	if resp := client.recv(); resp.Cmd != "Role_GetRoleInfoResp" || resp.Resp != 2 || resp.Ack != 2 || resp.Seq != 2 {
+		t.Fatalf("resp not translated back: %+v", resp)
+	}
+
+	var seqs []int32
+	for _, f := range mock.Received() {
+		seqs = append(seqs, f.Seq)
+	}
+	if len(seqs) != 3 || seqs[0] != 1 || seqs[1] != 2 || seqs[2] != 3 {
+		t.Errorf("server saw seqs %v, want [1 2 3]", seqs)
+	}
+	if v := mock.Violations(); len(v) != 0 {
+		t.Errorf("protocol violations: %v", v)
+	}
+
+	// Web 界面收到全部 6 条消息
+	calls := map[string]int{}
+	for i := 0; i < 6; i++ {
+		uiConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg WSMessage
+		if err := uiConn.ReadJSON(&msg); err != nil {
+			t.Fatalf("ui message %d: %v", i, err)
+		}
+		var decoded map[string]any
+		if s, ok := msg.Msg.(string); !ok || json.Unmarshal([]byte(s), &decoded) != nil {
+			t.Fatalf("ui message %d not decoded JSON: %v", i, msg.Msg)
+		}
+		calls[msg.Call+":"+decoded["cmd"].(string)]++
+	}
+	want := map[string]int{
+		"client:role_getroleinfo":     2,
+		"client:system_buygold":       1,
+		"server:Role_GetRoleInfoResp": 2,
+		"server:System_BuyGoldResp":   1,
+	}
+	for k, n := range want {
+		if calls[k] != n {
+			t.Errorf("ui got %d %s, want %d (all: %v)", calls[k], k, n, calls)
+		}
+	}
+
+	// 角色状态来自 Role_GetRoleInfoResp
+	rec := httptest.NewRecorder()
+	HandleState(rec, httptest.NewRequest(http.MethodGet, "/api/state", nil))
+	var state StateResponse
+	json.NewDecoder(rec.Body).Decode(&state)
+	if rec.Code != http.StatusOK || !state.Loaded || state.Resources["level"] != float64(10) {
+		t.Errorf("state: %d %+v", rec.Code, state.Snapshot)
+	}
+	// 客户端请求记入账本，用于统计掉落率
+	if n := resourceLedger.Summary("").Requests["role_getroleinfo"]; n != 2 {
+		t.Errorf("ledger requests = %d", n)
+	}
+
+	after := metricValues(t, metricNames)
+	for i, want := range []float64{2, 3, 2, 1, 1} {
+		if got := after[i] - before[i]; got != want {
+			t.Errorf("%s increased by %v, want %v", metricNames[i], got, want)
+		}
+	}
+}
+
+// metricValues 从 /metrics 的输出中读取指定序列的值，没有时为 0
+func metricValues(t *testing.T, names []string) []float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	HandleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasSuffix(rec.Body.String(), "# EOF\n") {
+		t.Fatalf("metrics: %d\n%s", rec.Code, rec.Body.String())
+	}
+	values := make([]float64, len(names))
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		for i, name := range names {
+			if v, ok := strings.CutPrefix(line, name+" "); ok {
+				values[i], _ = strconv.ParseFloat(v, 64)
+			}
+		}
+	}
+	return values
+}
+
+// TestCaptureInjectToClient 测试伪造服务器消息发给客户端后双方序号保持连续
+func TestCaptureInjectToClient(t *testing.T) {
+	if raceEnabled {
+		t.Skip("game-mitm 写入客户端连接没有加锁")
+	}
+	game = nil
+	packetStore = nil
+	roleState = rolestate.New(0)
+
+	mock := mockserver.New()
+	mock.Respond("role_getroleinfo", "Role_GetRoleInfoResp", map[string]any{"role": map[string]any{"level": int32(10)}})
+	gameServer := httptest.NewTLSServer(mock)
+	defer gameServer.Close()
+	gameURL, _ := url.Parse(gameServer.URL)
+
+	proxyAddr := startCapture(t, []string{gameURL.Hostname()})
+
+	dialer := websocket.Dialer{
+		Proxy:           http.ProxyURL(&url.URL{Scheme: "http", Host: proxyAddr}),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	ws, _, err := dialer.Dial("wss://"+gameURL.Host+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	client := &gameClient{t: t, ws: ws}
+
+	client.send(mockserver.Frame{Cmd: "role_getroleinfo", Seq: 1})
+	if resp := client.recv(); resp.Resp != 1 || resp.Seq != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	// 伪造服务器推送，占用客户端看到的服务器 seq 2
+	push := DebugMessage{Cmd: "System_NewChatMessageNotify", Data: map[string]any{"content": "hi"}, Direction: DebugToClient}
+	if err := sendDebugMessage(push); err != nil {
+		t.Fatal(err)
+	}
+	if f := client.recv(); f.Cmd != push.Cmd || f.Seq != 2 || f.Ack != 1 || f.Resp != 0 {
+		t.Fatalf("unexpected injected push: %+v", f)
+	}
+
+	// 伪造对客户端请求的回复
+	client.send(mockserver.Frame{Cmd: "role_getroleinfo", Seq: 2, Ack: 2})
+	if resp := client.recv(); resp.Resp != 2 || resp.Seq != 3 || resp.Ack != 2 {
+		t.Fatalf("unexpected response after injection: %+v", resp)
+	}
+	fake := DebugMessage{Cmd: "Role_GetRoleInfoResp", Data: map[string]any{"role": map[string]any{"level": int32(99)}}, Direction: DebugToClient, Resp: 2}
+	if err := sendDebugMessage(fake); err != nil {
+		t.Fatal(err)
+	}
+	if f := client.recv(); f.Cmd != fake.Cmd || f.Seq != 4 || f.Resp != 2 {
+		t.Fatalf("unexpected injected reply: %+v", f)
+	}
+	// 伪造的角色数据不改变角色状态
+	rec := httptest.NewRecorder()
+	HandleState(rec, httptest.NewRequest(http.MethodGet, "/api/state", nil))
+	var state StateResponse
+	json.NewDecoder(rec.Body).Decode(&state)
+	if rec.Code != http.StatusOK || state.Resources["level"] != float64(10) {
+		t.Errorf("forged reply changed role state: %d %+v", rec.Code, state.Resources)
+	}
+
+	// 客户端确认的伪造消息不会出现在服务器收到的 ack 中
+	client.send(mockserver.Frame{Cmd: "role_getroleinfo", Seq: 3, Ack: 4})
+	if resp := client.recv(); resp.Resp != 3 || resp.Seq != 5 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	received := mock.Received()
+	if len(received) != 3 || received[1].Ack != 1 || received[2].Ack != 2 {
+		t.Errorf("server saw %+v", received)
+	}
+	if v := mock.Violations(); len(v) != 0 {
+		t.Errorf("protocol violations: %v", v)
+	}
+}
+
+// TestCaptureReconnect 游戏客户端重连后调试消息注入到新的连接，断开的连接不再使用
+func TestCaptureReconnect(t *testing.T) {
+	game = nil
+	packetStore = nil
+
+	mock := mockserver.New()
+	mock.Respond("role_getroleinfo", "Role_GetRoleInfoResp", map[string]any{})
+	mock.Respond("system_buygold", "System_BuyGoldResp", map[string]any{})
+	gameServer := httptest.NewTLSServer(mock)
+	defer gameServer.Close()
+	gameURL, _ := url.Parse(gameServer.URL)
+
+	proxyAddr := startCapture(t, []string{gameURL.Hostname()})
+	dialer := websocket.Dialer{
+		Proxy:           http.ProxyURL(&url.URL{Scheme: "http", Host: proxyAddr}),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	connect := func() *gameClient {
+		ws, _, err := dialer.Dial("wss://"+gameURL.Host+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		client := &gameClient{t: t, ws: ws}
+		client.send(mockserver.Frame{Cmd: "role_getroleinfo", Seq: 1})
+		if resp := client.recv(); resp.Resp != 1 {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+		return client
+	}
+
+	first := connect()
+	if currentGame() == nil {
+		t.Fatal("session not tracked")
+	}
+	first.ws.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for currentGame() != nil && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if currentGame() != nil {
+		t.Fatal("closed session still used for injection")
+	}
+	// 没有连接时调试消息被忽略
+	if err := sendDebugMessage(DebugMessage{Cmd: "system_buygold", Data: map[string]any{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	second := connect()
+	if err := sendDebugMessage(DebugMessage{Cmd: "system_buygold", Data: map[string]any{}}); err != nil {
+		t.Fatal(err)
+	}
+	// 新连接收到注入请求的回复对应的 _sys/ack
+	if f := second.recv(); f.Cmd != seqmap.AckCmd || f.Ack != 1 {
+		t.Fatalf("injection not sent on the new session: %+v", f)
+	}
+	var cmds []string
+	for _, f := range mock.Received() {
+		cmds = append(cmds, f.Cmd)
+	}
+	if len(cmds) != 3 || cmds[2] != "system_buygold" {
+		t.Errorf("server received %v", cmds)
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"xyzw_study/internal/ledger"
+	"xyzw_study/internal/proxy"
+	"xyzw_study/internal/rolestate"
+)
+
+// ledgerRecent /api/ledger 返回的最近明细条数
+const ledgerRecent = 200
+
+// resourceLedger 各会话道具和资源的变化
+var resourceLedger = ledger.New(ledger.DefaultLimit)
+
+// recordRequest 记录客户端请求，用于找到服务器回复对应的请求命令
+func recordRequest(packet proxy.GamePacket) {
+	msg, ok := packet.RawData.(string)
+	if !ok || msg == "" {
+		return
+	}
+	var head struct {
+		Cmd string `json:"cmd"`
+		Seq int64  `json:"seq"`
+	}
+	if json.Unmarshal([]byte(msg), &head) != nil {
+		return
+	}
+	at := packet.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	resourceLedger.Request(packetSessionID(packet), at, head.Seq, head.Cmd, packet.Injected)
+}
+
+// ledgerName 返回道具ID对应的名称，来自 item 配置表
+func ledgerName(kind, key string) string {
+	if tableStore == nil || kind != rolestate.KindItem {
+		return ""
+	}
+	name, _ := tableStore.Lookup("item", key)
+	return name
+}
+
+// LedgerResponse /api/ledger 的返回数据
+type LedgerResponse struct {
+	ledger.Summary
+	Sessions []string          `json:"sessions"` // 有记录的会话
+	Recent   []ledger.Entry    `json:"recent"`   // 最近的明细，最新的在前
+	Names    map[string]string `json:"names"`    // 道具ID对应的名称
+}
+
+// HandleLedger 返回会话的道具和资源变化汇总，参数 session 为空时合并所有会话
+func HandleLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+		return
+	}
+	session := r.URL.Query().Get("session")
+	resp := LedgerResponse{
+		Summary:  resourceLedger.Summary(session),
+		Sessions: resourceLedger.Sessions(),
+		Recent:   []ledger.Entry{},
+		Names:    make(map[string]string),
+	}
+	entries := resourceLedger.Entries(session)
+	for i := len(entries) - 1; i >= 0 && len(resp.Recent) < ledgerRecent; i-- {
+		resp.Recent = append(resp.Recent, entries[i])
+	}
+	for _, t := range resp.Totals {
+		if name := ledgerName(t.Kind, t.Key); name != "" {
+			resp.Names[t.Key] = name
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleLedgerExport 以 CSV 导出道具和资源变化
+// 参数 session 指定会话，为空时导出所有会话；totals=1 导出汇总，否则导出明细
+func HandleLedgerExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+		return
+	}
+	session := r.URL.Query().Get("session")
+	totals := r.URL.Query().Get("totals") == "1"
+
+	kind := "entries"
+	if totals {
+		kind = "totals"
+	}
+	filename := fmt.Sprintf("xyzw-ledger-%s-%s.csv", kind, time.Now().Format("20060102150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	// 写入 BOM 以便 Excel 正确识别中文
+	w.Write([]byte("\xef\xbb\xbf"))
+
+	var err error
+	if totals {
+		err = ledger.WriteTotalsCSV(w, resourceLedger.Summary(session), ledgerName)
+	} else {
+		err = ledger.WriteCSV(w, resourceLedger.Entries(session), ledgerName)
+	}
+	if err != nil {
+		log.Println("导出资源账本失败:", err)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"xyzw_study/internal/metrics"
+)
+
+var (
+	startTime = time.Now()
+
+	debugMessages = metrics.Default.NewCounterVec("xyzw_debug_messages",
+		"调试消息数，result 为 queued（入队）、rejected（队列已满）、sent（已发送）或 failed（发送失败）", "direction", "result")
+	storeDropped = metrics.Default.NewCounterVec("xyzw_store_dropped",
+		"数据包存储队列已满时丢弃的数据包数")
+)
+
+func init() {
+	metrics.Default.NewGaugeFunc("xyzw_start_time_seconds", "程序启动时间，Unix 时间戳", func() float64 {
+		return float64(startTime.UnixMilli()) / 1000
+	})
+	metrics.Default.NewGaugeFunc("xyzw_ws_clients", "当前连接的 WebSocket 客户端数", func() float64 {
+		clientsMu.Lock()
+		defer clientsMu.Unlock()
+		return float64(len(clients))
+	})
+	metrics.Default.NewCounterFunc("xyzw_ws_sent", "推送给 WebSocket 客户端的数据包数", func() float64 {
+		return float64(wsSent.Load())
+	})
+	metrics.Default.NewCounterFunc("xyzw_ws_dropped", "客户端接收过慢时丢弃的推送数", func() float64 {
+		return float64(wsDropped.Load())
+	})
+	metrics.Default.NewCounterFunc("xyzw_ws_disconnected", "因接收过慢或写入超时断开的 WebSocket 连接数", func() float64 {
+		return float64(wsDisconnected.Load())
+	})
+	metrics.Default.NewGaugeFunc("xyzw_debug_queue_depth", "调试消息队列中等待发送的消息数", func() float64 {
+		return float64(len(debugQueue))
+	})
+	metrics.Default.NewGaugeFunc("xyzw_debug_queue_capacity", "调试消息队列的容量", func() float64 {
+		return float64(cap(debugQueue))
+	})
+}
+
+// debugDirection 返回调试消息的方向标签，为空时为默认方向
+func debugDirection(message DebugMessage) string {
+	if message.Direction == "" {
+		return DebugToServer
+	}
+	return message.Direction
+}
+
+// HandleMetrics 以 OpenMetrics 文本格式输出运行指标，供 Prometheus 采集
+// 需要访问令牌，Prometheus 使用 Authorization: Bearer 请求头
+// 没有配置 WebToken 时访问令牌每次启动都会变化，采集时应配置 MetricsToken 或固定的 WebToken
+func HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.Default.Write(w); err != nil {
+		log.Println("输出运行指标失败:", err)
+	}
+}
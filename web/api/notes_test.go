@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xyzw_study/internal/notes"
+)
+
+func TestNotesETag(t *testing.T) {
+	s, err := notes.Open(filepath.Join(t.TempDir(), "notes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteStore = s
+	defer func() { noteStore = nil }()
+
+	rec := httptest.NewRecorder()
+	HandleLoadNotes(rec, httptest.NewRequest(http.MethodGet, "/api/notes/load", nil))
+	loaded := rec.Header().Get("ETag")
+	if loaded == "" {
+		t.Fatal("load without ETag")
+	}
+
+	// 其他页面修改了单条备注
+	rec = httptest.NewRecorder()
+	HandlePatchNotes(rec, httptest.NewRequest(http.MethodPatch, "/api/notes",
+		strings.NewReader(`{"keyNotes":{"role_getroleinfo":{"body.role.level":"等级"}}}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", rec.Code, rec.Body)
+	}
+	var n Notes
+	json.NewDecoder(rec.Body).Decode(&n)
+	if n.KeyNotes["role_getroleinfo"]["body.role.level"] != "等级" {
+		t.Errorf("patched notes = %+v", n)
+	}
+
+	// 基于旧版本的整体保存被拒绝
+	req := httptest.NewRequest(http.MethodPost, "/api/notes/save", strings.NewReader(`{"commandNotes":{"a":"b"}}`))
+	req.Header.Set("If-Match", loaded)
+	rec = httptest.NewRecorder()
+	HandleSaveNotes(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale save: %d", rec.Code)
+	}
+	current := rec.Header().Get("ETag")
+
+	req = httptest.NewRequest(http.MethodPost, "/api/notes/save", strings.NewReader(`{"commandNotes":{"a":"b"}}`))
+	req.Header.Set("If-Match", current)
+	rec = httptest.NewRecorder()
+	HandleSaveNotes(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == current {
+		t.Fatalf("save: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	HandlePatchNotes(rec, httptest.NewRequest(http.MethodPost, "/api/notes", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST patch: %d", rec.Code)
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"xyzw_study/internal/proxy"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/redact"
+	"xyzw_study/internal/store"
+)
+
+// storePacket 将数据包写入持久化存储
+func storePacket(packet proxy.GamePacket, call string) {
+	if packetStore == nil {
+		return
+	}
+	msg, _ := packet.RawData.(string)
+	p := store.Packet{
+		Time:     packet.Time,
+		Session:  packetSessionID(packet),
+		Call:     call,
+		Raw:      hex.EncodeToString(packet.Raw),
+		Injected: packet.Injected,
+		Forged:   packet.Forged,
+	}
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+	if msg != "" {
+		p.Msg = json.RawMessage(msg)
+	}
+	if !packetStore.Add(p) {
+		storeDropped.With().Inc()
+	}
+}
+
+// packetSessionID 返回数据包所属的会话ID
+func packetSessionID(packet proxy.GamePacket) string {
+	if packet.SessionID != "" {
+		return packet.SessionID
+	}
+	return proxy.SessionID(packet.Session)
+}
+
+// parseQuery 从请求参数解析数据包查询条件
+func parseQuery(r *http.Request) (store.Query, error) {
+	params := r.URL.Query()
+	q := store.Query{
+		Cmd:     params.Get("cmd"),
+		Call:    params.Get("dir"),
+		Session: params.Get("session"),
+	}
+	var err error
+	if q.Since, err = parseTime(params.Get("since")); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseTime(params.Get("until")); err != nil {
+		return q, err
+	}
+	for _, expr := range params["q"] {
+		conds, err := store.ParseFilter(expr)
+		if err != nil {
+			return q, err
+		}
+		q.Where = append(q.Where, conds...)
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, err
+		}
+	}
+	if v := params.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// parseTime 解析 RFC3339 时间、毫秒时间戳或相对时间（例如 24h）
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// HandlePackets 处理数据包查询请求
+// 例如 /api/packets?cmd=item_openpack&dir=client&since=24h&q=body.itemId==3010&limit=50&offset=0
+func HandlePackets(w http.ResponseWriter, r *http.Request) {
+	if packetStore == nil {
+		http.Error(w, "数据包存储未初始化", http.StatusServiceUnavailable)
+		return
+	}
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, "解析查询参数失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := packetStore.Query(q)
+	if err != nil {
+		http.Error(w, "查询数据包失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandlePacketSessions 处理会话列表请求
+func HandlePacketSessions(w http.ResponseWriter, r *http.Request) {
+	if packetStore == nil {
+		http.Error(w, "数据包存储未初始化", http.StatusServiceUnavailable)
+		return
+	}
+	sessions, err := packetStore.Sessions()
+	if err != nil {
+		http.Error(w, "查询会话失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"sessions": sessions})
+}
+
+// HandleExportPackets 以 JSONL 抓包格式导出数据包，查询参数与 /api/packets 相同
+// 默认按 data/redact.json 中的规则脱敏，redact=0 时导出原始数据
+func HandleExportPackets(w http.ResponseWriter, r *http.Request) {
+	if packetStore == nil {
+		http.Error(w, "数据包存储未初始化", http.StatusServiceUnavailable)
+		return
+	}
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, "解析查询参数失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var redactor *redact.Redactor
+	if r.URL.Query().Get("redact") != "0" {
+		cfg, err := redact.LoadConfig(redactFilePath)
+		if err != nil {
+			http.Error(w, "加载脱敏规则失败: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redactor = redact.New(cfg)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="capture.jsonl"`)
+	writer := record.NewWriter(w)
+	mapping := tableMapping()
+	err = packetStore.Each(q, func(p store.Packet) error {
+		rec := p.Record()
+		if redactor != nil {
+			redacted, err := redactor.Record(rec)
+			if err != nil {
+				// 无法解码的数据包不导出，避免泄露原始内容
+				log.Println("脱敏数据包失败:", err)
+				return nil
+			}
+			rec = redacted
+		}
+		return writer.Write(annotateRecord(mapping, rec))
+	})
+	if err != nil {
+		log.Println("导出数据包失败:", err)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package api
+
+// raceEnabled 表示测试在竞态检测下运行
+// game-mitm 转发服务器消息时没有对客户端连接加锁，直接写入客户端会被报告为竞态
+const raceEnabled = true
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/report"
+	"xyzw_study/internal/store"
+)
+
+// sessionRecords 按时间顺序返回会话的全部数据包
+func sessionRecords(session string) ([]record.Record, error) {
+	var records []record.Record
+	err := packetStore.Each(store.Query{Session: session}, func(p store.Packet) error {
+		records = append(records, p.Record())
+		return nil
+	})
+	return records, err
+}
+
+// HandleReport 生成会话的摘要报告
+// 参数 session 为会话ID，format 为 html（默认）或 md，download=1 时作为附件下载
+func HandleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+		return
+	}
+	if packetStore == nil {
+		http.Error(w, "数据包存储未初始化", http.StatusServiceUnavailable)
+		return
+	}
+	params := r.URL.Query()
+	session := params.Get("session")
+	if session == "" {
+		http.Error(w, "缺少 session 参数", http.StatusBadRequest)
+		return
+	}
+	format := params.Get("format")
+	if format == "" {
+		format = report.FormatHTML
+	}
+	contentType := map[string]string{
+		report.FormatHTML:     "text/html; charset=utf-8",
+		report.FormatMarkdown: "text/markdown; charset=utf-8",
+	}[format]
+	if contentType == "" {
+		http.Error(w, "不支持的报告格式: "+format, http.StatusBadRequest)
+		return
+	}
+
+	records, err := sessionRecords(session)
+	if err != nil {
+		http.Error(w, "查询数据包失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(records) == 0 {
+		http.Error(w, "会话没有数据包: "+session, http.StatusNotFound)
+		return
+	}
+	n := notes.New()
+	if noteStore != nil {
+		if n, _, err = noteStore.Get(); err != nil {
+			http.Error(w, "读取备注失败: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rep := report.Build(session, records, n, report.Options{})
+	w.Header().Set("Content-Type", contentType)
+	if params.Get("download") == "1" {
+		w.Header().Set("Content-Disposition", `attachment; filename="xyzw-report-`+safeFilename(session)+`.`+format+`"`)
+	}
+	report.Write(w, rep, format)
+}
+
+// safeFilename 只保留文件名中的字母、数字、- 和 _
+func safeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, s)
+}
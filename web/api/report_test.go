@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"xyzw_study/internal/store"
+)
+
+// useTestStore 将数据包写入临时存储并作为 packetStore，测试结束时关闭
+func useTestStore(t *testing.T, packets ...store.Packet) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "packets.db")
+	s, err := store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range packets {
+		s.Add(p)
+	}
+	// 关闭时写入队列中的数据包
+	s.Close()
+	if packetStore, err = store.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		packetStore.Close()
+		packetStore = nil
+	})
+}
+
+func TestHandleReport(t *testing.T) {
+	base := time.Now().Add(-time.Minute)
+	useTestStore(t,
+		store.Packet{Time: base, Session: "s1", Call: "client", Msg: json.RawMessage(`{"cmd":"role_getroleinfo","seq":1}`)},
+		store.Packet{Time: base.Add(30 * time.Millisecond), Session: "s1", Call: "server", Msg: json.RawMessage(`{"cmd":"Role_GetRoleInfoResp","resp":1}`)},
+	)
+
+	for _, tc := range []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"", http.StatusBadRequest, "session"},
+		{"?session=s1&format=pdf", http.StatusBadRequest, "pdf"},
+		{"?session=s2", http.StatusNotFound, "s2"},
+		{"?session=s1", http.StatusOK, "<td>role_getroleinfo</td><td class=\"num\">1</td><td class=\"num\">30.0</td>"},
+		{"?session=s1&format=md", http.StatusOK, "| role_getroleinfo | 1 | 30.0 |"},
+	} {
+		rec := httptest.NewRecorder()
+		HandleReport(rec, httptest.NewRequest(http.MethodGet, "/api/report"+tc.query, nil))
+		if rec.Code != tc.code || !strings.Contains(rec.Body.String(), tc.want) {
+			t.Errorf("%s: %d\n%s", tc.query, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	HandleReport(rec, httptest.NewRequest(http.MethodGet, "/api/report?session=s1&download=1", nil))
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="xyzw-report-s1.html"` {
+		t.Errorf("Content-Disposition = %s", got)
+	}
+}
@@ -2,51 +2,52 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
-	"os"
-	"time"
+	"net/url"
+	"strings"
+	"xyzw_study/internal/scripts"
 )
 
 // Script 定义脚本数据结构
-type Script struct {
-	ID        string    `json:"id"`        // 脚本ID
-	Name      string    `json:"name"`      // 脚本名称
-	Content   string    `json:"content"`   // 脚本内容
-	Enabled   bool      `json:"enabled"`   // 是否启用
-	CreatedAt time.Time `json:"createdAt"` // 创建时间
-	UpdatedAt time.Time `json:"updatedAt"` // 更新时间
-}
+type Script = scripts.Script
 
 // Scripts 脚本列表
 type Scripts struct {
 	Scripts []Script `json:"scripts"`
 }
 
-// 保存脚本数据到文件
-func saveScripts(scripts Scripts) error {
-	data, err := json.MarshalIndent(scripts, "", "  ")
+// AuthorHeader 保存脚本时记录到修订记录中的修改人，没有时使用客户端地址
+// 请求头只能使用 ASCII 字符，中文名称需要 URL 编码
+const AuthorHeader = "X-XYZW-Author"
+
+// scriptAuthor 返回请求的修改人
+func scriptAuthor(r *http.Request) string {
+	author := r.Header.Get(AuthorHeader)
+	if v, err := url.PathUnescape(author); err == nil {
+		author = v
+	}
+	if author = strings.TrimSpace(author); author != "" {
+		return author
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return err
+		return r.RemoteAddr
 	}
-	return os.WriteFile(scriptsFilePath, data, 0644)
+	return host
 }
 
-// 从文件加载脚本数据
-func loadScripts() (Scripts, error) {
-	var scripts Scripts
-	scripts.Scripts = make([]Script, 0)
-
-	data, err := os.ReadFile(scriptsFilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// 文件不存在，返回空脚本列表
-			return scripts, nil
-		}
-		return scripts, err
+// scriptError 根据脚本存储返回的错误设置响应状态码
+func scriptError(w http.ResponseWriter, prefix string, err error) {
+	switch {
+	case errors.Is(err, scripts.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, scripts.ErrInvalidID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, prefix+err.Error(), http.StatusInternalServerError)
 	}
-
-	err = json.Unmarshal(data, &scripts)
-	return scripts, err
 }
 
 // HandleSaveScript 处理脚本保存请求
@@ -63,58 +64,39 @@ func HandleSaveScript(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 加载现有脚本
-	scripts, err := loadScripts()
+	// 保存脚本，同时记录修订版本
+	script, err = scriptStore.Save(script, scriptAuthor(r))
 	if err != nil {
-		http.Error(w, "加载脚本失败: "+err.Error(), http.StatusInternalServerError)
+		scriptError(w, "保存脚本失败: ", err)
 		return
 	}
 
-	// 检查是否是更新现有脚本
-	found := false
-	for i, s := range scripts.Scripts {
-		if s.ID == script.ID {
-			// 更新现有脚本
-			script.CreatedAt = s.CreatedAt
-			script.UpdatedAt = time.Now()
-			scripts.Scripts[i] = script
-			found = true
-			break
-		}
-	}
-
-	// 如果是新脚本，添加到列表
-	if !found {
-		if script.ID == "" {
-			// 生成新ID
-			script.ID = time.Now().Format("20060102150405")
-		}
-		script.CreatedAt = time.Now()
-		script.UpdatedAt = time.Now()
-		scripts.Scripts = append(scripts.Scripts, script)
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(script)
+}
 
-	// 保存脚本
-	err = saveScripts(scripts)
+// HandleLoadScripts 处理脚本加载请求，不包括已删除的脚本
+func HandleLoadScripts(w http.ResponseWriter, r *http.Request) {
+	list, err := scriptStore.List()
 	if err != nil {
-		http.Error(w, "保存脚本失败: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "加载脚本失败: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(script)
+	json.NewEncoder(w).Encode(Scripts{Scripts: list})
 }
 
-// HandleLoadScripts 处理脚本加载请求
-func HandleLoadScripts(w http.ResponseWriter, r *http.Request) {
-	scripts, err := loadScripts()
+// HandleDeletedScripts 处理已删除脚本的加载请求
+func HandleDeletedScripts(w http.ResponseWriter, r *http.Request) {
+	list, err := scriptStore.Deleted()
 	if err != nil {
 		http.Error(w, "加载脚本失败: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(scripts)
+	json.NewEncoder(w).Encode(Scripts{Scripts: list})
 }
 
 // HandleDeleteScript 处理脚本删除请求
@@ -133,29 +115,58 @@ func HandleDeleteScript(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 加载现有脚本
-	scripts, err := loadScripts()
+	// 删除脚本，内容保留在修订记录中，可以恢复
+	if err := scriptStore.Delete(requestData.ID, scriptAuthor(r)); err != nil {
+		scriptError(w, "删除脚本失败: ", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"success": true}`))
+}
+
+// HandleScriptRevisions 处理脚本修订记录请求
+// 例如 GET /api/scripts/{id}/revisions
+func HandleScriptRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	revs, err := scriptStore.Revisions(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, "加载脚本失败: "+err.Error(), http.StatusInternalServerError)
+		scriptError(w, "加载修订记录失败: ", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"revisions": revs})
+}
+
+// HandleRestoreScript 处理脚本恢复请求，恢复到指定版本或恢复已删除的脚本
+// 例如 POST /api/scripts/{id}/restore {"rev": 3}，不指定版本时只取消删除
+func HandleRestoreScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持POST请求", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// 查找并删除脚本
-	for i, script := range scripts.Scripts {
-		if script.ID == requestData.ID {
-			// 删除脚本
-			scripts.Scripts = append(scripts.Scripts[:i], scripts.Scripts[i+1:]...)
-			break
+	var requestData struct {
+		Rev int `json:"rev"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "解析请求数据失败: "+err.Error(), http.StatusBadRequest)
+			return
 		}
 	}
 
-	// 保存更新后的脚本列表
-	err = saveScripts(scripts)
+	script, err := scriptStore.Restore(r.PathValue("id"), requestData.Rev, scriptAuthor(r))
 	if err != nil {
-		http.Error(w, "保存脚本失败: "+err.Error(), http.StatusInternalServerError)
+		scriptError(w, "恢复脚本失败: ", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true}`))
+	json.NewEncoder(w).Encode(script)
 }
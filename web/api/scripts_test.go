@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xyzw_study/internal/scripts"
+)
+
+func TestScriptRevisionsAPI(t *testing.T) {
+	s, err := scripts.Open(filepath.Join(t.TempDir(), "scripts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptStore = s
+	defer func() { scriptStore = nil }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/scripts/save", HandleSaveScript)
+	mux.HandleFunc("/api/scripts/delete", HandleDeleteScript)
+	mux.HandleFunc("/api/scripts/{id}/revisions", HandleScriptRevisions)
+	mux.HandleFunc("/api/scripts/{id}/restore", HandleRestoreScript)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(AuthorHeader, url.PathEscape("小明"))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var script Script
+	json.NewDecoder(do(http.MethodPost, "/api/scripts/save", `{"name":"a","content":"v1"}`).Body).Decode(&script)
+	script.Content = "v2"
+	body, _ := json.Marshal(script)
+	do(http.MethodPost, "/api/scripts/save", string(body))
+	if rec := do(http.MethodPost, "/api/scripts/delete", `{"id":"`+script.ID+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body)
+	}
+
+	rec := do(http.MethodGet, "/api/scripts/"+script.ID+"/revisions", "")
+	var result struct {
+		Revisions []scripts.Revision `json:"revisions"`
+	}
+	json.NewDecoder(rec.Body).Decode(&result)
+	if len(result.Revisions) != 3 || result.Revisions[0].Author != "小明" || result.Revisions[2].Action != scripts.ActionDelete {
+		t.Fatalf("revisions = %+v", result.Revisions)
+	}
+
+	rec = do(http.MethodPost, "/api/scripts/"+script.ID+"/restore", `{"rev":1}`)
+	json.NewDecoder(rec.Body).Decode(&script)
+	if rec.Code != http.StatusOK || script.Content != "v1" || script.DeletedAt != nil {
+		t.Fatalf("restore: %d %+v", rec.Code, script)
+	}
+
+	if rec := do(http.MethodGet, "/api/scripts/nope/revisions", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing script: %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/scripts/"+script.ID+"/restore", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET restore: %d", rec.Code)
+	}
+}
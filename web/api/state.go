@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"xyzw_study/internal/proxy"
+	"xyzw_study/internal/rolestate"
+)
+
+// roleState 根据服务器消息维护的角色状态
+var roleState = rolestate.New(rolestate.DefaultLimit)
+
+// updateRoleState 使用服务器消息更新角色状态，道具和资源的变化记入账本
+// 调试伪造的服务器消息不是真实数据，不更新角色状态
+func updateRoleState(packet proxy.GamePacket) {
+	msg, ok := packet.RawData.(string)
+	if !ok || msg == "" || packet.Forged {
+		return
+	}
+	at := packet.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	resourceLedger.Changes(roleState.Message(packetSessionID(packet), at, msg), packet.Injected)
+}
+
+// StateResponse /api/state 的返回数据
+type StateResponse struct {
+	rolestate.Snapshot
+	Sessions  []string          `json:"sessions"`  // 所有有角色状态的会话，最近更新的在前
+	ItemNames map[string]string `json:"itemNames"` // 道具ID对应的名称，来自 item 配置表
+	HeroNames map[string]string `json:"heroNames"` // 武将ID对应的名称，来自 hero 配置表
+}
+
+// HandleState 返回角色状态和最近的变化
+// 参数 session 指定会话，默认为最近更新的会话；since 只返回序号大于该值的变化
+func HandleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+		return
+	}
+	var since int64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseInt(s, 10, 64); err != nil {
+			http.Error(w, "解析 since 失败: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	snap, ok := roleState.Snapshot(r.URL.Query().Get("session"), since)
+	if !ok {
+		http.Error(w, "还没有收到角色信息", http.StatusNotFound)
+		return
+	}
+	resp := StateResponse{
+		Snapshot:  snap,
+		Sessions:  roleState.Sessions(),
+		ItemNames: make(map[string]string),
+		HeroNames: make(map[string]string),
+	}
+	if tableStore != nil {
+		for id := range snap.Items {
+			if name, ok := tableStore.Lookup("item", id); ok {
+				resp.ItemNames[id] = name
+			}
+		}
+		for id := range snap.Heroes {
+			if name, ok := tableStore.Lookup("hero", id); ok {
+				resp.HeroNames[id] = name
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
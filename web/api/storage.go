@@ -1,49 +1,86 @@
 package api
 
 import (
-	"encoding/json"
+	"log"
 	"os"
 	"path/filepath"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/scripts"
+	"xyzw_study/internal/store"
+	"xyzw_study/internal/tables"
 )
 
 var (
 	// 数据目录
-	dataDir = "./data"
+	dataDir string
 	// 脚本数据文件路径
-	scriptsFilePath = filepath.Join(dataDir, "scripts.json")
+	scriptsFilePath string
 	// 备注数据文件路径
-	notesFilePath = filepath.Join(dataDir, "notes.json")
+	notesFilePath string
+	// 数据包存储文件路径
+	packetsFilePath string
+	// 脱敏规则文件路径
+	redactFilePath string
+
+	// 持久化数据包存储
+	packetStore *store.Store
+	// 备注存储
+	noteStore *notes.Store
+	// 脚本存储，包括修订记录
+	scriptStore *scripts.Store
+	// 游戏配置表，用于显示ID对应的名称
+	tableStore *tables.Store
 )
 
-// 初始化存储
-func InitStorage() error {
+// InitStorage 在指定的数据目录中初始化存储
+func InitStorage(dir string) error {
+	dataDir = dir
+	scriptsFilePath = filepath.Join(dataDir, "scripts.json")
+	notesFilePath = filepath.Join(dataDir, "notes.json")
+	packetsFilePath = filepath.Join(dataDir, "packets.db")
+	redactFilePath = filepath.Join(dataDir, "redact.json")
+
 	// 确保数据目录存在
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return err
 	}
 
-	// 确保脚本文件存在
-	if _, err := os.Stat(scriptsFilePath); os.IsNotExist(err) {
-		// 创建空的脚本文件
-		emptyScripts := Scripts{Scripts: []Script{}}
-		data, _ := json.MarshalIndent(emptyScripts, "", "  ")
-		if err := os.WriteFile(scriptsFilePath, data, 0644); err != nil {
-			return err
-		}
+	// 打开脚本文件，不存在时创建
+	sc, err := scripts.Open(scriptsFilePath)
+	if err != nil {
+		return err
 	}
+	scriptStore = sc
 
-	// 确保备注文件存在
-	if _, err := os.Stat(notesFilePath); os.IsNotExist(err) {
-		// 创建空的备注文件
-		emptyNotes := Notes{
-			CommandNotes: make(map[string]string),
-			KeyNotes:     make(map[string]map[string]string),
-		}
-		data, _ := json.MarshalIndent(emptyNotes, "", "  ")
-		if err := os.WriteFile(notesFilePath, data, 0644); err != nil {
-			return err
-		}
+	// 打开备注文件，不存在时创建
+	n, err := notes.Open(notesFilePath)
+	if err != nil {
+		return err
 	}
+	noteStore = n
+
+	// 加载配置表，个别文件加载失败不影响启动
+	tableStore = tables.Open(filepath.Join(dataDir, tables.DirName))
+	if err := tableStore.Err(); err != nil {
+		log.Println(err)
+	}
+
+	// 打开数据包存储
+	s, err := store.Open(packetsFilePath)
+	if err != nil {
+		return err
+	}
+	packetStore = s
 
 	return nil
 }
+
+// CloseStorage 关闭数据包存储，写入还在队列中的数据包，程序退出前调用
+func CloseStorage() {
+	if packetStore == nil {
+		return
+	}
+	if err := packetStore.Close(); err != nil {
+		log.Println("关闭数据包存储失败:", err)
+	}
+}
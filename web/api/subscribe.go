@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"xyzw_study/internal/msgpath"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/store"
+)
+
+// Filter 定义 WebSocket 客户端的订阅条件，所有条件都满足时才推送
+type Filter struct {
+	Cmd       []string `json:"cmd,omitempty"`       // 命令通配符，不区分大小写，例如 role_*，以 ! 开头表示排除
+	Direction string   `json:"direction,omitempty"` // client 或 server，为空时不限方向
+	Session   string   `json:"session,omitempty"`   // 会话ID，为空时不限会话
+	Where     []string `json:"where,omitempty"`     // 消息字段条件，格式与 /api/packets 的 q 参数相同，例如 body.itemId==3010
+
+	conds []store.Condition
+}
+
+// compile 校验并解析订阅条件
+func (f *Filter) compile() error {
+	for _, pattern := range f.Cmd {
+		if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+			return fmt.Errorf("无效的命令通配符: %s", pattern)
+		}
+	}
+	switch f.Direction {
+	case "", "client", "server":
+	default:
+		return fmt.Errorf("未知的消息方向: %s", f.Direction)
+	}
+	f.conds = nil
+	for _, expr := range f.Where {
+		conds, err := store.ParseFilter(expr)
+		if err != nil {
+			return err
+		}
+		f.conds = append(f.conds, conds...)
+	}
+	return nil
+}
+
+// matchCmd 判断命令是否满足通配符，没有包含规则时匹配所有未排除的命令
+func (f *Filter) matchCmd(cmd string) bool {
+	cmd = strings.ToLower(cmd)
+	included, hasInclude := false, false
+	for _, pattern := range f.Cmd {
+		pattern = strings.ToLower(pattern)
+		if exclude, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matched, _ := path.Match(exclude, cmd); matched {
+				return false
+			}
+			continue
+		}
+		hasInclude = true
+		if matched, _ := path.Match(pattern, cmd); matched {
+			included = true
+		}
+	}
+	return included || !hasInclude
+}
+
+// match 判断数据包是否满足订阅条件
+func (f *Filter) match(p *wsPacket) bool {
+	if f.Direction != "" && p.message.Call != f.Direction {
+		return false
+	}
+	if f.Session != "" && p.message.Session != f.Session {
+		return false
+	}
+	if len(f.Cmd) > 0 && !f.matchCmd(p.cmd) {
+		return false
+	}
+	if len(f.conds) == 0 {
+		return true
+	}
+	fields := p.fields()
+	for _, cond := range f.conds {
+		if !cond.Match(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+// wsPacket 定义一条待推送的数据包，展开后的字段在第一次需要时计算并在客户端之间共享
+type wsPacket struct {
+	message WSMessage
+	cmd     string
+	raw     []byte
+
+	once sync.Once
+	flat map[string]any
+}
+
+func newWSPacket(message WSMessage, raw []byte) *wsPacket {
+	p := &wsPacket{message: message, raw: raw}
+	if msg, ok := message.Msg.(string); ok {
+		var head struct {
+			Cmd string `json:"cmd"`
+		}
+		if json.Unmarshal([]byte(msg), &head) == nil {
+			p.cmd = head.Cmd
+		}
+	}
+	return p
+}
+
+// fields 返回消息展开后的字段，与数据包存储的过滤条件使用相同的解码方式
+func (p *wsPacket) fields() map[string]any {
+	p.once.Do(func() {
+		rec := record.Record{Raw: hex.EncodeToString(p.raw)}
+		if msg, ok := p.message.Msg.(string); ok {
+			rec.Msg = json.RawMessage(msg)
+		}
+		if value, err := rec.Value(); err == nil {
+			p.flat = msgpath.Flatten(value)
+		}
+	})
+	return p.flat
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"xyzw_study/internal/record"
+	"xyzw_study/internal/tables"
+)
+
+// tableMapping 返回默认映射和备注中配置的映射
+func tableMapping() tables.Mapping {
+	m := tables.DefaultMapping()
+	if noteStore == nil {
+		return m
+	}
+	n, _, err := noteStore.Get()
+	if err != nil {
+		return m
+	}
+	return m.With(n.KeyTables)
+}
+
+// annotateRecord 为导出的记录添加ID名称，没有配置表时原样返回
+func annotateRecord(m tables.Mapping, rec record.Record) record.Record {
+	if tableStore == nil || len(tableStore.List()) == 0 {
+		return rec
+	}
+	return tableStore.Record(m, rec)
+}
+
+// HandleTables 返回已加载的配置表和加载错误
+func HandleTables(w http.ResponseWriter, r *http.Request) {
+	result := map[string]any{
+		"dir":     tableStore.Dir(),
+		"tables":  tableStore.List(),
+		"mapping": tableMapping(),
+	}
+	if err := tableStore.Err(); err != nil {
+		result["error"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleAnnotate 查找消息中ID字段对应的名称
+// 请求体为 {"cmd": "...", "msg": {...}}，返回 {"annotations": [{"path", "table", "id", "name"}]}
+func HandleAnnotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持POST请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Cmd string         `json:"cmd"`
+		Msg map[string]any `json:"msg"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&requestData); err != nil {
+		http.Error(w, "解析请求数据失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	cmd := requestData.Cmd
+	if cmd == "" {
+		cmd, _ = requestData.Msg["cmd"].(string)
+	}
+
+	annotations := tableStore.Annotate(tableMapping(), strings.TrimSpace(cmd), requestData.Msg)
+	if annotations == nil {
+		annotations = []tables.Annotation{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"annotations": annotations})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xyzw_study/internal/notes"
+	"xyzw_study/internal/tables"
+)
+
+func TestAnnotateKeyTables(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "monster.csv"), []byte("id,name\n7,赤兔\n"), 0644)
+	s, err := notes.Open(filepath.Join(t.TempDir(), "notes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteStore, tableStore = s, tables.Open(dir)
+	defer func() { noteStore, tableStore = nil, nil }()
+
+	annotate := func() []tables.Annotation {
+		rec := httptest.NewRecorder()
+		HandleAnnotate(rec, httptest.NewRequest(http.MethodPost, "/api/tables/annotate",
+			strings.NewReader(`{"msg":{"cmd":"skyhorse_pickaward","body":{"monsterUId":7}}}`)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("annotate: %d %s", rec.Code, rec.Body)
+		}
+		var result struct{ Annotations []tables.Annotation }
+		json.NewDecoder(rec.Body).Decode(&result)
+		return result.Annotations
+	}
+	if got := annotate(); len(got) != 0 {
+		t.Fatalf("annotations without mapping = %+v", got)
+	}
+
+	// 在键备注旁配置字段对应的配置表
+	rec := httptest.NewRecorder()
+	HandlePatchNotes(rec, httptest.NewRequest(http.MethodPatch, "/api/notes",
+		strings.NewReader(`{"keyTables":{"skyhorse_pickaward":{"body.monsterUId":"monster"}}}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", rec.Code, rec.Body)
+	}
+	if got := annotate(); len(got) != 1 || got[0].Name != "赤兔" || got[0].Path != "body.monsterUId" {
+		t.Errorf("annotations = %+v", got)
+	}
+}
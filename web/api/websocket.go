@@ -2,26 +2,163 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"log"
 	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
+	"xyzw_study/internal/store"
 )
 
-var (
-	upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // 允许所有跨域请求
-		},
+// 发送队列满时的处理策略
+const (
+	OverflowDropOldest = "drop-oldest" // 丢弃最早的数据包推送
+	OverflowDisconnect = "disconnect"  // 断开该客户端，由前端重新连接
+)
+
+// WSOptions 定义 WebSocket 推送参数
+type WSOptions struct {
+	QueueSize    int           // 每个客户端最多排队的数据包推送数量
+	Overflow     string        // 队列满时的处理策略
+	WriteTimeout time.Duration // 单条消息的写入超时
+	PingInterval time.Duration // 心跳间隔，超过两个间隔没有收到回应时断开
+}
+
+// DefaultWSOptions 返回默认的 WebSocket 推送参数
+func DefaultWSOptions() WSOptions {
+	return WSOptions{
+		QueueSize:    256,
+		Overflow:     OverflowDropOldest,
+		WriteTimeout: 10 * time.Second,
+		PingInterval: 30 * time.Second,
 	}
-	clients   = make(map[*websocket.Conn]bool)
-	clientsMu sync.Mutex
+}
+
+// WSStats 定义 WebSocket 推送统计
+type WSStats struct {
+	Clients      int             `json:"clients"`      // 当前连接数
+	Sent         uint64          `json:"sent"`         // 已发送的数据包推送
+	Dropped      uint64          `json:"dropped"`      // 因队列满丢弃的数据包推送
+	Disconnected uint64          `json:"disconnected"` // 因队列满或写入超时断开的连接
+	Connections  []WSClientStats `json:"connections"`
+}
+
+// WSClientStats 定义单个连接的推送统计
+type WSClientStats struct {
+	Remote  string `json:"remote"`
+	Queued  int    `json:"queued"`
+	Sent    uint64 `json:"sent"`
+	Dropped uint64 `json:"dropped"`
+	Paused  bool   `json:"paused"`
+}
+
+var (
+	// 使用默认的 Origin 检查，只允许同源页面连接
+	upgrader  = websocket.Upgrader{}
+	clients   = make(map[*wsClient]bool)
+	clientsMu sync.Mutex // 同时保护 wsOptions
+	wsOptions = DefaultWSOptions()
+
+	wsSent         atomic.Uint64
+	wsDropped      atomic.Uint64
+	wsDisconnected atomic.Uint64
 )
 
+// ConfigureWebSocket 设置 WebSocket 推送参数，需要在启动 Web 服务之前调用
+// 未设置的参数使用默认值
+func ConfigureWebSocket(opts WSOptions) error {
+	def := DefaultWSOptions()
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = def.QueueSize
+	}
+	if opts.Overflow == "" {
+		opts.Overflow = def.Overflow
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = def.WriteTimeout
+	}
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = def.PingInterval
+	}
+	switch opts.Overflow {
+	case OverflowDropOldest, OverflowDisconnect:
+	default:
+		return fmt.Errorf("未知的队列溢出策略: %s", opts.Overflow)
+	}
+	clientsMu.Lock()
+	wsOptions = opts
+	clientsMu.Unlock()
+	return nil
+}
+
 // WSMessage 定义发送到前端的消息结构
 type WSMessage struct {
-	Call string `json:"call"` // "client" 或 "server"
-	Msg  any    `json:"msg"`  // JSON 字符串
+	Call    string `json:"call"`              // "client" 或 "server"
+	Msg     any    `json:"msg"`               // JSON 字符串
+	Session string `json:"session,omitempty"` // 会话ID
+}
+
+// RPCRequest 定义前端通过 WebSocket 发来的请求
+// 例如 {"id": 1, "method": "subscribe", "params": {"cmd": ["role_*"], "direction": "server"}}
+// 没有 id 的请求不回复
+type RPCRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// RPCResponse 定义请求的回复，id 与请求相同，数据包推送没有 id
+type RPCResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result any             `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// HistoryParams 定义 history 请求的参数
+type HistoryParams struct {
+	Filter *Filter `json:"filter,omitempty"` // 为空时使用当前的订阅条件
+	Since  string  `json:"since,omitempty"`  // 格式与 /api/packets 的 since 参数相同
+	Until  string  `json:"until,omitempty"`
+	Limit  int     `json:"limit,omitempty"` // 返回最近的多少条，默认 50
+}
+
+// outgoing 定义发送队列中的一条消息，请求的回复不会被丢弃
+type outgoing struct {
+	data   []byte
+	packet bool
+}
+
+// wsClient 表示一个前端连接及其订阅状态
+// 新连接默认订阅所有消息，所有消息经发送队列由单独的协程写入，推送数据包时不会阻塞
+type wsClient struct {
+	conn *websocket.Conn
+	opts WSOptions
+
+	mu         sync.Mutex
+	filter     Filter
+	subscribed bool
+	paused     bool
+	queue      []outgoing
+
+	notify    chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	sent      atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+func newWSClient(conn *websocket.Conn, opts WSOptions) *wsClient {
+	return &wsClient{
+		conn:       conn,
+		opts:       opts,
+		subscribed: true,
+		notify:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
 }
 
 // HandleWebSocket 处理 WebSocket 连接
@@ -31,32 +168,319 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		log.Println("WebSocket 升级错误:", err)
 		return
 	}
-	defer conn.Close()
-
 	// 添加新客户端
 	clientsMu.Lock()
-	clients[conn] = true
+	client := newWSClient(conn, wsOptions)
+	clients[client] = true
 	clientsMu.Unlock()
+	go client.writeLoop()
 
 	// 客户端断开连接时移除
 	defer func() {
 		clientsMu.Lock()
-		delete(clients, conn)
+		delete(clients, client)
 		clientsMu.Unlock()
+		client.close()
 	}()
 
-	// 保持连接，直到客户端断开
+	// 超过两个心跳间隔没有收到任何消息时断开
+	readTimeout := 2 * client.opts.PingInterval
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+
+	// 处理客户端请求，直到客户端断开
 	for {
-		_, _, err := conn.ReadMessage()
+		_, data, err := conn.ReadMessage()
 		if err != nil {
 			break
 		}
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		var req RPCRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			client.send(RPCResponse{ID: json.RawMessage("null"), Error: "解析请求数据失败: " + err.Error()})
+			continue
+		}
+		result, err := client.handle(req)
+		if len(req.ID) == 0 {
+			if err != nil {
+				log.Println("WebSocket 请求失败:", req.Method, err)
+			}
+			continue
+		}
+		resp := RPCResponse{ID: req.ID, Result: result}
+		if err != nil {
+			resp.Result = nil
+			resp.Error = err.Error()
+		}
+		if err := client.send(resp); err != nil {
+			break
+		}
 	}
 }
 
-// BroadcastMessage 向所有连接的客户端广播消息
+// handle 处理一个请求并返回结果
+func (c *wsClient) handle(req RPCRequest) (any, error) {
+	success := map[string]any{"success": true}
+	switch req.Method {
+	case "subscribe":
+		var filter Filter
+		if err := decodeParams(req.Params, &filter); err != nil {
+			return nil, err
+		}
+		if err := filter.compile(); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.filter = filter
+		c.subscribed = true
+		c.mu.Unlock()
+		return success, nil
+	case "unsubscribe":
+		c.mu.Lock()
+		c.subscribed = false
+		c.mu.Unlock()
+		return success, nil
+	case "pause":
+		c.mu.Lock()
+		c.paused = true
+		c.mu.Unlock()
+		return success, nil
+	case "resume":
+		c.mu.Lock()
+		c.paused = false
+		c.mu.Unlock()
+		return success, nil
+	case "history":
+		var params HistoryParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return c.history(params)
+	case "send":
+		var message DebugMessage
+		if err := decodeParams(req.Params, &message); err != nil {
+			return nil, err
+		}
+		if err := queueDebugMessage(message); err != nil {
+			return nil, err
+		}
+		return success, nil
+	default:
+		return nil, fmt.Errorf("未知的方法: %s", req.Method)
+	}
+}
+
+// history 从数据包存储查询满足条件的最近消息，按时间顺序返回
+func (c *wsClient) history(params HistoryParams) (any, error) {
+	if packetStore == nil {
+		return nil, errors.New("数据包存储未初始化")
+	}
+	var filter Filter
+	if params.Filter != nil {
+		filter = *params.Filter
+		if err := filter.compile(); err != nil {
+			return nil, err
+		}
+	} else {
+		c.mu.Lock()
+		filter = c.filter
+		c.mu.Unlock()
+	}
+	q := store.Query{Call: filter.Direction, Session: filter.Session, Where: filter.conds, Limit: params.Limit}
+	if len(filter.Cmd) > 0 {
+		q.Match = func(p store.Packet) bool { return filter.matchCmd(p.Cmd) }
+	}
+	var err error
+	if q.Since, err = parseTime(params.Since); err != nil {
+		return nil, err
+	}
+	if q.Until, err = parseTime(params.Until); err != nil {
+		return nil, err
+	}
+	// 从最新的数据包开始查询，返回时恢复为时间顺序
+	packets, err := packetStore.Latest(q)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]WSMessage, 0, len(packets))
+	for i := len(packets) - 1; i >= 0; i-- {
+		p := packets[i]
+		messages = append(messages, WSMessage{Call: p.Call, Msg: string(p.Msg), Session: p.Session})
+	}
+	return map[string]any{"packets": messages}, nil
+}
+
+// wants 判断是否需要向该客户端推送数据包
+func (c *wsClient) wants(p *wsPacket) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscribed && !c.paused && c.filter.match(p)
+}
+
+// send 编码一条回复并加入发送队列
+func (c *wsClient) send(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !c.enqueue(outgoing{data: data}) {
+		return errors.New("连接已关闭")
+	}
+	return nil
+}
+
+// enqueue 将消息加入发送队列，不会阻塞
+// 数据包推送超过队列长度时按溢出策略丢弃最早的推送或断开连接，返回 false 表示消息没有入队
+func (c *wsClient) enqueue(msg outgoing) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	c.mu.Lock()
+	if msg.packet && len(c.queue) >= c.opts.QueueSize {
+		if c.opts.Overflow == OverflowDisconnect {
+			c.mu.Unlock()
+			c.dropped.Add(1)
+			wsDropped.Add(1)
+			log.Printf("WebSocket 客户端 %s 接收过慢，断开连接", c.conn.RemoteAddr())
+			wsDisconnected.Add(1)
+			c.close()
+			return false
+		}
+		oldest := -1
+		for i, item := range c.queue {
+			if item.packet {
+				oldest = i
+				break
+			}
+		}
+		c.dropped.Add(1)
+		wsDropped.Add(1)
+		if oldest < 0 {
+			// 队列中全是回复，丢弃新的推送
+			c.mu.Unlock()
+			return false
+		}
+		c.queue = append(c.queue[:oldest], c.queue[oldest+1:]...)
+	}
+	c.queue = append(c.queue, msg)
+	c.mu.Unlock()
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// writeLoop 写入发送队列中的消息并定时发送心跳，写入失败或超时时断开连接
+func (c *wsClient) writeLoop() {
+	ticker := time.NewTicker(c.opts.PingInterval)
+	defer ticker.Stop()
+	defer c.close()
+	for {
+		select {
+		case <-c.notify:
+			c.mu.Lock()
+			batch := c.queue
+			c.queue = nil
+			c.mu.Unlock()
+			for _, msg := range batch {
+				c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout))
+				if err := c.conn.WriteMessage(websocket.TextMessage, msg.data); err != nil {
+					log.Println("发送消息错误:", err)
+					if errors.Is(err, os.ErrDeadlineExceeded) {
+						wsDisconnected.Add(1)
+					}
+					return
+				}
+				if msg.packet {
+					c.sent.Add(1)
+					wsSent.Add(1)
+				}
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.opts.WriteTimeout)); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close 关闭连接，可以重复调用
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// stats 返回连接的推送统计
+func (c *wsClient) stats() WSClientStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return WSClientStats{
+		Remote:  c.conn.RemoteAddr().String(),
+		Queued:  len(c.queue),
+		Sent:    c.sent.Load(),
+		Dropped: c.dropped.Load(),
+		Paused:  c.paused,
+	}
+}
+
+// CurrentWSStats 返回 WebSocket 推送统计
+func CurrentWSStats() WSStats {
+	clientsMu.Lock()
+	list := make([]*wsClient, 0, len(clients))
+	for client := range clients {
+		list = append(list, client)
+	}
+	clientsMu.Unlock()
+
+	stats := WSStats{
+		Clients:      len(list),
+		Sent:         wsSent.Load(),
+		Dropped:      wsDropped.Load(),
+		Disconnected: wsDisconnected.Load(),
+		Connections:  make([]WSClientStats, 0, len(list)),
+	}
+	for _, client := range list {
+		stats.Connections = append(stats.Connections, client.stats())
+	}
+	return stats
+}
+
+// HandleWSStats 处理 WebSocket 推送统计请求
+func HandleWSStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CurrentWSStats())
+}
+
+// decodeParams 解析请求参数，没有参数时保持默认值
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return errors.New("解析请求参数失败: " + err.Error())
+	}
+	return nil
+}
+
+// BroadcastMessage 向所有订阅条件匹配的客户端推送消息
 func BroadcastMessage(message WSMessage) {
-	jsonMessage, err := json.Marshal(message)
+	broadcast(newWSPacket(message, nil))
+}
+
+// broadcast 将数据包加入订阅条件匹配的客户端的发送队列，不会阻塞抓包流程
+func broadcast(p *wsPacket) {
+	jsonMessage, err := json.Marshal(p.message)
 	if err != nil {
 		log.Println("JSON 编码错误:", err)
 		return
@@ -66,11 +490,8 @@ func BroadcastMessage(message WSMessage) {
 	defer clientsMu.Unlock()
 
 	for client := range clients {
-		err := client.WriteMessage(websocket.TextMessage, jsonMessage)
-		if err != nil {
-			log.Println("发送消息错误:", err)
-			client.Close()
-			delete(clients, client)
+		if client.wants(p) {
+			client.enqueue(outgoing{data: jsonMessage, packet: true})
 		}
 	}
 }
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"xyzw_study/internal/store"
+
+	"github.com/gorilla/websocket"
+)
+
+// uiClient 模拟前端连接
+type uiClient struct {
+	t      *testing.T
+	ws     *websocket.Conn
+	nextID int
+}
+
+func dialUI(t *testing.T) *uiClient {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(HandleWebSocket))
+	t.Cleanup(ts.Close)
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return &uiClient{t: t, ws: ws}
+}
+
+// read 读取下一条消息
+func (c *uiClient) read() map[string]json.RawMessage {
+	c.t.Helper()
+	c.ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg map[string]json.RawMessage
+	if err := c.ws.ReadJSON(&msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// call 发送请求并返回回复，回复之前收到的数据包推送按顺序返回
+func (c *uiClient) call(method string, params any) (RPCResponse, []WSMessage) {
+	c.t.Helper()
+	c.nextID++
+	req := map[string]any{"id": c.nextID, "method": method, "params": params}
+	if err := c.ws.WriteJSON(req); err != nil {
+		c.t.Fatal(err)
+	}
+	var packets []WSMessage
+	for {
+		msg := c.read()
+		data, _ := json.Marshal(msg)
+		if _, ok := msg["id"]; !ok {
+			var packet WSMessage
+			json.Unmarshal(data, &packet)
+			packets = append(packets, packet)
+			continue
+		}
+		var resp RPCResponse
+		json.Unmarshal(data, &resp)
+		return resp, packets
+	}
+}
+
+func packetCmds(packets []WSMessage) []string {
+	var cmds []string
+	for _, p := range packets {
+		var head struct {
+			Cmd string `json:"cmd"`
+		}
+		json.Unmarshal([]byte(p.Msg.(string)), &head)
+		cmds = append(cmds, p.Call+":"+head.Cmd)
+	}
+	return cmds
+}
+
+func broadcastJSON(call, session, msg string) {
+	broadcast(newWSPacket(WSMessage{Call: call, Msg: msg, Session: session}, nil))
+}
+
+func TestWebSocketSubscribe(t *testing.T) {
+	ui := dialUI(t)
+	// 默认订阅全部消息
+	ui.call("resume", nil)
+	broadcastJSON("client", "s1", `{"cmd":"role_getroleinfo"}`)
+	if _, packets := ui.call("resume", nil); len(packets) != 1 {
+		t.Fatalf("default subscription got %v", packets)
+	}
+
+	resp, _ := ui.call("subscribe", Filter{
+		Cmd:       []string{"item_*", "!item_openpack"},
+		Direction: "client",
+		Session:   "s1",
+		Where:     []string{"body.itemId==3010"},
+	})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	broadcastJSON("client", "s1", `{"cmd":"item_openbox","body":{"itemId":3010}}`)
+	broadcastJSON("client", "s1", `{"cmd":"Item_OpenBox","body":{"itemId":3010}}`)
+	broadcastJSON("client", "s1", `{"cmd":"item_openbox","body":{"itemId":3011}}`)
+	broadcastJSON("client", "s1", `{"cmd":"item_openpack","body":{"itemId":3010}}`)
+	broadcastJSON("server", "s1", `{"cmd":"item_openbox","body":{"itemId":3010}}`)
+	broadcastJSON("client", "s2", `{"cmd":"item_openbox","body":{"itemId":3010}}`)
+	broadcastJSON("client", "s1", `{"cmd":"role_getroleinfo","body":{"itemId":3010}}`)
+
+	_, packets := ui.call("resume", nil)
+	got := strings.Join(packetCmds(packets), ",")
+	if got != "client:item_openbox,client:Item_OpenBox" {
+		t.Fatalf("filtered packets = %s", got)
+	}
+
+	// 暂停期间的消息不推送
+	ui.call("pause", nil)
+	broadcastJSON("client", "s1", `{"cmd":"item_openbox","body":{"itemId":3010}}`)
+	if _, packets := ui.call("resume", nil); len(packets) != 0 {
+		t.Fatalf("paused client got %v", packets)
+	}
+	broadcastJSON("client", "s1", `{"cmd":"item_openbox","body":{"itemId":3010}}`)
+	if _, packets := ui.call("unsubscribe", nil); len(packets) != 1 {
+		t.Fatalf("resumed client got %v", packets)
+	}
+	broadcastJSON("client", "s1", `{"cmd":"item_openbox","body":{"itemId":3010}}`)
+	if _, packets := ui.call("resume", nil); len(packets) != 0 {
+		t.Fatalf("unsubscribed client got %v", packets)
+	}
+}
+
+func TestWebSocketErrors(t *testing.T) {
+	ui := dialUI(t)
+	if resp, _ := ui.call("nope", nil); !strings.Contains(resp.Error, "未知的方法") {
+		t.Errorf("unknown method: %+v", resp)
+	}
+	if resp, _ := ui.call("subscribe", Filter{Cmd: []string{"["}}); resp.Error == "" {
+		t.Errorf("bad glob accepted")
+	}
+	if resp, _ := ui.call("subscribe", Filter{Where: []string{"body.x"}}); resp.Error == "" {
+		t.Errorf("bad condition accepted")
+	}
+	if resp, _ := ui.call("send", DebugMessage{Data: map[string]any{}}); !strings.Contains(resp.Error, "缺少 cmd") {
+		t.Errorf("send without cmd: %+v", resp)
+	}
+}
+
+func TestWebSocketSend(t *testing.T) {
+	ui := dialUI(t)
+	resp, _ := ui.call("send", DebugMessage{Cmd: "role_getroleinfo", Data: map[string]any{}, Direction: DebugToClient, Resp: 3})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	select {
+	case msg := <-debugQueue:
+		if msg.Cmd != "role_getroleinfo" || msg.Direction != DebugToClient || msg.Resp != 3 {
+			t.Errorf("queued %+v", msg)
+		}
+	default:
+		t.Fatal("message not queued")
+	}
+}
+
+func TestWebSocketHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packets.db")
+	s, err := store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now().Add(-time.Minute)
+	for i, msg := range []string{
+		`{"cmd":"role_getroleinfo","seq":1}`,
+		`{"cmd":"Role_GetRoleInfoResp","seq":1,"resp":1}`,
+		`{"cmd":"item_openbox","seq":2,"body":{"itemId":3010}}`,
+		`{"cmd":"item_openbox","seq":3,"body":{"itemId":3011}}`,
+		`{"cmd":"item_openbox","seq":4,"body":{"itemId":3010}}`,
+	} {
+		call := "client"
+		if strings.Contains(msg, "Resp") {
+			call = "server"
+		}
+		s.Add(store.Packet{Time: base.Add(time.Duration(i) * time.Second), Session: "s1", Call: call, Msg: json.RawMessage(msg)})
+	}
+	s.Close()
+	if packetStore, err = store.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		packetStore.Close()
+		packetStore = nil
+	}()
+
+	ui := dialUI(t)
+	resp, _ := ui.call("history", HistoryParams{Limit: 2})
+	if got := historyCmds(t, resp); got != "client:item_openbox,client:item_openbox" {
+		t.Errorf("latest history = %s", got)
+	}
+
+	// 不指定条件时使用当前订阅
+	ui.call("subscribe", Filter{Cmd: []string{"role_*"}})
+	resp, _ = ui.call("history", nil)
+	if got := historyCmds(t, resp); got != "client:role_getroleinfo,server:Role_GetRoleInfoResp" {
+		t.Errorf("subscription history = %s", got)
+	}
+
+	resp, _ = ui.call("history", HistoryParams{Filter: &Filter{Where: []string{"body.itemId==3010"}}})
+	if got := historyCmds(t, resp); got != "client:item_openbox,client:item_openbox" {
+		t.Errorf("predicate history = %s", got)
+	}
+}
+
+func historyCmds(t *testing.T, resp RPCResponse) string {
+	t.Helper()
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	data, _ := json.Marshal(resp.Result)
+	var result struct {
+		Packets []WSMessage `json:"packets"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(packetCmds(result.Packets), ",")
+}
+
+// stalledClient 创建一个不启动写入协程的连接，用于检查发送队列
+func stalledClient(t *testing.T, opts WSOptions) *wsClient {
+	t.Helper()
+	ui := dialUI(t)
+	return newWSClient(ui.ws, opts)
+}
+
+func queuedData(c *wsClient) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var items []string
+	for _, item := range c.queue {
+		items = append(items, string(item.data))
+	}
+	return strings.Join(items, ",")
+}
+
+func TestWebSocketDropOldest(t *testing.T) {
+	c := stalledClient(t, WSOptions{QueueSize: 2, Overflow: OverflowDropOldest})
+	before := wsDropped.Load()
+	c.enqueue(outgoing{data: []byte("p1"), packet: true})
+	c.enqueue(outgoing{data: []byte("p2"), packet: true})
+	// 回复不受队列长度限制
+	if !c.enqueue(outgoing{data: []byte("r1")}) {
+		t.Fatal("reply rejected")
+	}
+	if !c.enqueue(outgoing{data: []byte("p3"), packet: true}) {
+		t.Fatal("packet rejected")
+	}
+	if got := queuedData(c); got != "p2,r1,p3" {
+		t.Errorf("queue = %s", got)
+	}
+	if c.dropped.Load() != 1 || wsDropped.Load()-before != 1 {
+		t.Errorf("dropped = %d", c.dropped.Load())
+	}
+}
+
+func TestWebSocketDisconnectSlowClient(t *testing.T) {
+	c := stalledClient(t, WSOptions{QueueSize: 1, Overflow: OverflowDisconnect})
+	c.enqueue(outgoing{data: []byte("p1"), packet: true})
+	if c.enqueue(outgoing{data: []byte("p2"), packet: true}) {
+		t.Fatal("overflow accepted")
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("slow client not closed")
+	}
+	if c.enqueue(outgoing{data: []byte("r1")}) {
+		t.Error("closed client accepted reply")
+	}
+}
+
+func TestConfigureWebSocket(t *testing.T) {
+	defer ConfigureWebSocket(DefaultWSOptions())
+	if err := ConfigureWebSocket(WSOptions{Overflow: "block"}); err == nil {
+		t.Error("unknown overflow policy accepted")
+	}
+	if err := ConfigureWebSocket(WSOptions{QueueSize: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if wsOptions.QueueSize != 8 || wsOptions.Overflow != OverflowDropOldest || wsOptions.WriteTimeout <= 0 {
+		t.Errorf("options = %+v", wsOptions)
+	}
+
+	ui := dialUI(t)
+	ui.call("pause", nil)
+	stats := CurrentWSStats()
+	if stats.Clients != 1 || len(stats.Connections) != 1 || !stats.Connections[0].Paused {
+		t.Errorf("stats = %+v", stats)
+	}
+}
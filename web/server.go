@@ -6,7 +6,10 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"xyzw_study/internal/auth"
+	"xyzw_study/internal/config"
 	"xyzw_study/internal/proxy"
+	"xyzw_study/internal/sysproxy"
 	"xyzw_study/web/api"
 )
 
@@ -14,17 +17,37 @@ import (
 var staticFiles embed.FS
 
 // StartWebServer 启动 WebSocket 服务器并开始捕获游戏数据包
-func StartWebServer() {
+// 除 PAC 文件外的所有请求都需要 cfg.WebToken 访问令牌，为空时随机生成
+// Web 服务或抓包代理任意一个退出时返回错误，由调用方负责恢复系统代理
+func StartWebServer(cfg config.Config) error {
+	if cfg.WebToken == "" {
+		token, err := auth.RandomToken()
+		if err != nil {
+			return fmt.Errorf("生成访问令牌失败: %w", err)
+		}
+		cfg.WebToken = token
+	}
+	guard := auth.NewGuard(cfg.WebToken, auth.IsLoopback(cfg.WebAddr))
+	guard.Public("/proxy.pac")
+	if cfg.MetricsToken != "" {
+		guard.Allow(cfg.MetricsToken, "/metrics")
+	}
+
 	// 初始化存储
-	if err := api.InitStorage(); err != nil {
-		log.Fatal("初始化存储失败:", err)
+	if err := api.InitStorage(cfg.DataDir); err != nil {
+		return fmt.Errorf("初始化存储失败: %w", err)
+	}
+	if err := api.ConfigureWebSocket(api.WSOptions{QueueSize: cfg.WSQueueSize, Overflow: cfg.WSOverflow}); err != nil {
+		return err
 	}
 	// 设置 WebSocket 路由
 	http.HandleFunc("/ws", api.HandleWebSocket)
+	http.HandleFunc("/api/ws/stats", api.HandleWSStats)
 
 	// 设置备注API路由
 	http.HandleFunc("/api/notes/save", api.HandleSaveNotes)
 	http.HandleFunc("/api/notes/load", api.HandleLoadNotes)
+	http.HandleFunc("/api/notes", api.HandlePatchNotes)
 
 	// 设置调试消息API路由
 	http.HandleFunc("/api/debug/send", api.HandleDebugMessage)
@@ -33,11 +56,43 @@ func StartWebServer() {
 	http.HandleFunc("/api/scripts/save", api.HandleSaveScript)
 	http.HandleFunc("/api/scripts/load", api.HandleLoadScripts)
 	http.HandleFunc("/api/scripts/delete", api.HandleDeleteScript)
+	http.HandleFunc("/api/scripts/deleted", api.HandleDeletedScripts)
+	http.HandleFunc("/api/scripts/{id}/revisions", api.HandleScriptRevisions)
+	http.HandleFunc("/api/scripts/{id}/restore", api.HandleRestoreScript)
+
+	// 备注和脚本导入导出API路由
+	http.HandleFunc("/api/bundle/export", api.HandleBundleExport)
+	http.HandleFunc("/api/bundle/import", api.HandleBundleImport)
+
+	// 角色状态和资源账本API路由
+	http.HandleFunc("/api/state", api.HandleState)
+	http.HandleFunc("/api/ledger", api.HandleLedger)
+	http.HandleFunc("/api/ledger/export", api.HandleLedgerExport)
+
+	// 配置表API路由
+	http.HandleFunc("/api/tables", api.HandleTables)
+	http.HandleFunc("/api/tables/annotate", api.HandleAnnotate)
+
+	// 消息差异比较API路由
+	http.HandleFunc("/api/diff", api.HandleDiff)
+
+	// 数据包检索API路由
+	http.HandleFunc("/api/packets", api.HandlePackets)
+	http.HandleFunc("/api/packets/sessions", api.HandlePacketSessions)
+	http.HandleFunc("/api/report", api.HandleReport)
+	http.HandleFunc("/api/diagram", api.HandleDiagram)
+	http.HandleFunc("/api/packets/export", api.HandleExportPackets)
+
+	// 运行指标，供 Prometheus 采集
+	http.HandleFunc("/metrics", api.HandleMetrics)
+
+	// PAC 自动配置脚本，只让游戏域名走抓包代理
+	http.HandleFunc("/proxy.pac", sysproxy.PACHandler(cfg.ProxyAddr(), cfg.GameHosts))
 
 	// 使用嵌入的静态文件
 	staticFS, err := fs.Sub(staticFiles, "static")
 	if err != nil {
-		log.Fatal("无法加载嵌入的静态文件:", err)
+		return fmt.Errorf("无法加载嵌入的静态文件: %w", err)
 	}
 
 	// 提供静态文件服务
@@ -46,11 +101,18 @@ func StartWebServer() {
 	// 启动调试消息队列消费者
 	go api.ConsumeDebugQueue()
 
+	errCh := make(chan error, 2)
+
 	// 开始捕获游戏数据包
-	go proxy.StartCapture(api.HandleGamePacket)
+	go func() {
+		errCh <- proxy.StartCapture(proxy.Options{Port: cfg.ProxyPort, Hosts: cfg.GameHosts, Dial: cfg.UpstreamDial(), Closed: api.HandleSessionClosed}, api.HandleGamePacket)
+	}()
 
 	// 启动 HTTP 服务器
-	port := 12582
-	log.Printf("咸鱼之王调试服务器已启动，访问 http://localhost:%d\n", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	go func() {
+		log.Printf("咸鱼之王调试服务器已启动，监听 %s\n", cfg.WebAddr)
+		errCh <- http.ListenAndServe(cfg.WebAddr, guard.Handler(http.DefaultServeMux))
+	}()
+
+	return <-errCh
 }
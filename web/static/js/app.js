@@ -8,10 +8,13 @@ const App = {
             isConnected: false,
             connectionError: false,
             connecting: false,
+            paused: false,          // 是否暂停接收实时消息
+            historyLoading: false,  // 是否正在加载历史消息
 
             // 消息数据
             messages: [],
             currentJson: '',
+            currentMessage: null,   // 当前查看的消息
 
             // 最大消息数量限制，防止内存占用过多
             maxMessages: 100,
@@ -24,6 +27,11 @@ const App = {
             // 备注相关
             commandNotes: {}, // 存储命令备注，格式: {cmd: 'note'}
             keyNotes: {},     // 存储键备注，格式: {cmd: {key: 'note'}}
+            keyTables: {},    // 键对应的配置表，格式: {cmd: {key: 'table'}}，cmd 为 * 时对所有命令生效
+            notesEtag: '',    // 备注的 ETag，整体保存时用于检查冲突
+            tableList: [],    // 已加载的配置表
+            noteTable: '',    // 键备注对话框中选择的配置表
+            currentAnnotations: {}, // 当前消息中ID字段的名称，格式: {path: {table, id, name}}
             currentEditingNote: null, // 当前正在编辑的备注对象
             noteDialogVisible: false, // 备注对话框可见性
             noteContent: '',          // 备注内容
@@ -40,6 +48,8 @@ const App = {
             // Tab相关
             activeTab: 'detail',
             debugContent: '',
+            debugDirection: 'server', // 调试消息发送方向：server 发给服务器，client 发给游戏客户端
+            debugResp: 0,             // 发给客户端时回复的请求序号，0 表示推送
             jsonTitle: '',
             // 脚本管理相关
             scriptManagerVisible: false,  // 脚本管理对话框可见性
@@ -50,6 +60,28 @@ const App = {
             scriptBackup: null,           // 脚本编辑备份
             monacoEditor: null,           // Monaco 编辑器实例
             scriptEditActiveTab: 'editor', // 脚本编辑当前激活的 Tab
+            scriptAuthor: localStorage.getItem('scriptAuthor') || '', // 脚本修订记录中的修改人
+            revisionsVisible: false,      // 修订记录对话框可见性
+            revisionsScript: null,        // 查看修订记录的脚本
+            revisions: [],                // 修订记录，最新的在前
+            revisionsLoading: false,      // 修订记录加载状态
+            deletedScriptsVisible: false, // 已删除脚本对话框可见性
+            deletedScripts: [],           // 已删除的脚本
+            bundleImportVisible: false,   // 导入结果对话框可见性
+            bundleImportText: '',         // 待导入的导出包内容
+            bundleImportSummary: null,    // 导入预览结果
+            // 角色状态相关
+            roleState: null,              // 当前会话的角色状态
+            roleStateSession: '',         // 查看的会话，为空时查看最近更新的会话
+            roleStateError: '',           // 加载失败的原因
+            // 资源账本相关
+            ledger: null,                 // 资源账本汇总和最近明细
+            ledgerSession: '',            // 查看的会话，为空时合并所有会话
+            // 时序图相关
+            diagramVisible: false,        // 时序图对话框可见性
+            diagramForm: {format: 'mermaid', seq: '', fields: '', excludeHidden: true},
+            diagramText: '',              // 生成的时序图
+            diagramLoading: false,
         };
     },
 // 添加watch监听noteDialogVisible的变化
@@ -62,6 +94,18 @@ const App = {
                 });
             }
         },
+        activeTab(newVal) {
+            // 角色状态和资源账本页可见时定时刷新
+            if (this.roleStateTimer) {
+                clearInterval(this.roleStateTimer);
+                this.roleStateTimer = null;
+            }
+            const load = {state: this.loadRoleState, ledger: this.loadLedger}[newVal];
+            if (load) {
+                load();
+                this.roleStateTimer = setInterval(load, 2000);
+            }
+        },
         scriptEditVisible(newVal) {
             if (newVal) {
                 // 当对话框打开时，初始化编辑器
@@ -121,6 +165,29 @@ const App = {
         },
 
         // 获取所有脚本名称（用于筛选）
+        // 角色资源，按名称排序
+        roleResources() {
+            if (!this.roleState) return [];
+            return Object.keys(this.roleState.resources).sort().map(key => ({
+                key,
+                value: this.roleState.resources[key]
+            }));
+        },
+        // 角色道具，按ID排序
+        roleItems() {
+            if (!this.roleState) return [];
+            return Object.keys(this.roleState.items).sort((a, b) => Number(a) - Number(b)).map(id => ({
+                id,
+                name: this.roleState.itemNames[id] || '',
+                quantity: this.roleState.items[id]
+            }));
+        },
+        // 最近的变化，最新的在前
+        roleChanges() {
+            if (!this.roleState) return [];
+            return this.roleState.changes.slice().reverse();
+        },
+
         scriptNames() {
             const names = new Set();
             this.scriptLogs.forEach(log => {
@@ -133,6 +200,12 @@ const App = {
 
     },
 
+    created() {
+        // 等待回复的请求，不需要响应式
+        this.rpcSeq = 0;
+        this.rpcPending = new Map();
+    },
+
     mounted() {
         // 组件挂载后自动连接WebSocket
         this.connectWebSocket();
@@ -160,13 +233,16 @@ const App = {
         this.monacoEditor = null;
         // 组件卸载前关闭WebSocket连接
         this.closeWebSocket();
-
+        if (this.roleStateTimer) {
+            clearInterval(this.roleStateTimer);
+        }
     },
 
     methods: {
         // 连接WebSocket
         connectWebSocket() {
-            const wsUrl = "ws://127.0.0.1:12582/ws";
+            // 与页面同源连接，认证使用页面的 Cookie
+            const wsUrl = `${location.protocol === 'https:' ? 'wss' : 'ws'}://${location.host}/ws`;
 
             // 如果已有连接，先关闭
             if (this.websocket && this.websocket.readyState !== WebSocket.CLOSED) {
@@ -181,13 +257,22 @@ const App = {
                 this.isConnected = true;
                 this.connectionError = false;
                 this.connecting = false;
+                this.paused = false;
                 this.$message.success('WebSocket 连接成功');
+                // 订阅全部消息，筛选在页面中进行
+                this.rpc('subscribe', {}).catch(error => {
+                    this.$message.error('订阅失败: ' + error.message);
+                });
             };
 
-            // 接收消息
+            // 接收消息，带 id 的是请求的回复，其余是数据包推送
             this.websocket.onmessage = (event) => {
                 try {
                     const message = JSON.parse(event.data);
+                    if (message.id !== undefined) {
+                        this.handleRpcResponse(message);
+                        return;
+                    }
                     this.processMessage(message);
                 } catch (e) {
                     console.error('消息解析错误:', e);
@@ -197,6 +282,7 @@ const App = {
 
             // 连接关闭
             this.websocket.onclose = () => {
+                this.rejectPendingRpc();
                 this.isConnected = false;
                 this.connectionError = false;
                 this.connecting = false;
@@ -212,6 +298,92 @@ const App = {
             };
         },
 
+        // 请求后端 API，非 GET 请求带上 Cookie 中的 CSRF 令牌
+        apiFetch(url, options = {}) {
+            const method = (options.method || 'GET').toUpperCase();
+            if (method !== 'GET' && method !== 'HEAD') {
+                const match = document.cookie.match(/(?:^|;\s*)xyzw_csrf=([^;]*)/);
+                options.headers = Object.assign({}, options.headers, {
+                    'X-CSRF-Token': match ? decodeURIComponent(match[1]) : ''
+                });
+            }
+            return fetch(url, options).then(response => {
+                if (response.status === 401) {
+                    this.$message.error('访问令牌无效，请使用程序启动时输出的地址打开页面');
+                }
+                return response;
+            });
+        },
+
+        // 通过 WebSocket 发送请求，返回回复结果的 Promise
+        rpc(method, params) {
+            return new Promise((resolve, reject) => {
+                if (!this.websocket || this.websocket.readyState !== WebSocket.OPEN) {
+                    reject(new Error('WebSocket未连接'));
+                    return;
+                }
+                const id = ++this.rpcSeq;
+                this.rpcPending.set(id, {resolve, reject});
+                this.websocket.send(JSON.stringify({id, method, params}));
+            });
+        },
+
+        // 处理请求的回复
+        handleRpcResponse(message) {
+            const pending = this.rpcPending.get(message.id);
+            if (!pending) {
+                if (message.error) {
+                    console.error('WebSocket 请求错误:', message.error);
+                }
+                return;
+            }
+            this.rpcPending.delete(message.id);
+            if (message.error) {
+                pending.reject(new Error(message.error));
+            } else {
+                pending.resolve(message.result);
+            }
+        },
+
+        // 连接断开时结束所有等待中的请求
+        rejectPendingRpc() {
+            for (const pending of this.rpcPending.values()) {
+                pending.reject(new Error('WebSocket 连接已关闭'));
+            }
+            this.rpcPending.clear();
+        },
+
+        // 暂停或继续接收实时消息
+        togglePause() {
+            const method = this.paused ? 'resume' : 'pause';
+            this.rpc(method)
+                .then(() => {
+                    this.paused = !this.paused;
+                })
+                .catch(error => {
+                    this.$message.error('操作失败: ' + error.message);
+                });
+        },
+
+        // 从数据包存储加载最近的历史消息
+        loadHistory() {
+            this.historyLoading = true;
+            this.rpc('history', {limit: this.maxMessages})
+                .then(result => {
+                    this.messages = [];
+                    for (const packet of result.packets) {
+                        this.processMessage(packet, true);
+                    }
+                    this.$message.success(`已加载 ${result.packets.length} 条历史消息`);
+                })
+                .catch(error => {
+                    this.$message.error('加载历史消息失败: ' + error.message);
+                })
+                .finally(() => {
+                    this.historyLoading = false;
+                });
+        },
+
         // 关闭WebSocket连接
         closeWebSocket() {
             if (this.websocket && this.websocket.readyState !== WebSocket.CLOSED) {
@@ -228,9 +400,8 @@ const App = {
             }
         },
 
-        // 处理接收到的消息
-        // 处理接收到的消息
-        processMessage(message) {
+        // 处理接收到的消息，history 为 true 时是历史消息，不执行脚本
+        processMessage(message, history = false) {
             try {
                 // 解析消息内容
                 const parsedMsg = JSON.parse(message.msg);
@@ -238,6 +409,7 @@ const App = {
                 // 创建新消息对象
                 const newMessage = {
                     call: message.call,
+                    session: message.session,
                     msg: message.msg,
                     parsedMsg: parsedMsg,
                     timestamp: Date.now(),
@@ -252,8 +424,8 @@ const App = {
                     this.messages = this.messages.slice(0, this.maxMessages);
                 }
 
-                // 如果是服务器发来的消息，执行启用的脚本
-                if (message.call === 'server') {
+                // 如果是服务器发来的实时消息，执行启用的脚本
+                if (message.call === 'server' && !history) {
                     if (!this.excludedCommands.includes(parsedMsg.cmd)) {
                         this.executeScripts(newMessage);
                     }
@@ -365,8 +537,14 @@ const App = {
                 this.currentMessage = message; // 保存当前查看的消息，用于键备注
                 console.log(this.currentMessage)
                 this.currentJson = this.formatJson(message.parsedMsg);
+                this.currentAnnotations = {};
+                this.loadAnnotations(message);
                 this.jsonTitle = `${message.parsedMsg.cmd}   (${this.commandNotes[message.parsedMsg.cmd] || ''})`;
 
+                // 查看服务器消息时默认伪造服务器消息发给客户端
+                this.debugDirection = message.call === 'server' ? 'client' : 'server';
+                this.debugResp = 0;
+
                 // 设置调试内容为body部分
                 if (message.parsedMsg.body) {
                     this.debugContent = this.formatJson(message.parsedMsg.body);
@@ -416,21 +594,13 @@ const App = {
                 const jsonObj = {};
                 jsonObj.cmd = this.currentMessage.parsedMsg.cmd;
                 jsonObj.data = JSON.parse(this.debugContent)
-                // 发送到后端队列
-                fetch('/api/debug/send', {
-                    method: 'POST',
-                    headers: {
-                        'Content-Type': 'application/json'
-                    },
-                    body: JSON.stringify(jsonObj)
-                })
-                    .then(response => {
-                        if (!response.ok) {
-                            throw new Error('发送失败');
-                        }
-                        return response.json();
-                    })
-                    .then(data => {
+                jsonObj.direction = this.debugDirection;
+                if (this.debugDirection === 'client' && this.debugResp) {
+                    jsonObj.resp = this.debugResp;
+                }
+                // 通过 WebSocket 发送到后端队列
+                this.rpc('send', jsonObj)
+                    .then(() => {
                         this.$message.success('消息已加入队列，将在2秒内发送');
                     })
                     .catch(error => {
@@ -510,6 +680,8 @@ const App = {
 
                 // 值
                 if (typeof value === 'object' && value !== null) {
+                    // 以ID为键的对象，名称显示在键名后面
+                    this.appendAnnotation(row, keyPath);
                     // 递归处理嵌套对象
                     const nestedContainer = this.createFormattedJsonView(value, keyPath, level + 1);
                     row.appendChild(nestedContainer);
@@ -518,6 +690,7 @@ const App = {
                     valueSpan.className = typeof value === 'string' ? 'json-string' : 'json-value';
                     valueSpan.textContent = typeof value === 'string' ? `"${value}"` : `${value}`;
                     row.appendChild(valueSpan);
+                    this.appendAnnotation(row, keyPath);
                 }
 
                 // 添加逗号
@@ -572,6 +745,69 @@ const App = {
 
             return container;
         },
+        // 查找当前消息中ID字段对应的名称，返回后重新渲染JSON视图
+        loadAnnotations(message) {
+            this.apiFetch('/api/tables/annotate', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({cmd: message.parsedMsg.cmd, msg: message.parsedMsg})
+            })
+                .then(response => {
+                    if (!response.ok) {
+                        throw new Error('查找ID名称失败');
+                    }
+                    return response.json();
+                })
+                .then(data => {
+                    const list = data.annotations || [];
+                    // 切换了消息，或前后都没有名称时不需要重新渲染
+                    if (this.currentMessage !== message || (list.length === 0 && Object.keys(this.currentAnnotations).length === 0)) {
+                        return;
+                    }
+                    const annotations = {};
+                    list.forEach(a => {
+                        annotations[a.path] = a;
+                    });
+                    this.currentAnnotations = annotations;
+                    this.$nextTick(() => {
+                        this.addJsonKeyClickHandlers();
+                    });
+                })
+                .catch(error => {
+                    console.error('查找ID名称错误:', error);
+                });
+        },
+        // 在JSON行中显示ID对应的名称
+        appendAnnotation(row, keyPath) {
+            const annotation = this.currentAnnotations[keyPath];
+            if (!annotation) return;
+            const span = document.createElement('span');
+            span.className = 'json-annotation';
+            span.textContent = `<${annotation.name}>`;
+            span.title = `配置表 ${annotation.table}，ID ${annotation.id}`;
+            row.appendChild(span);
+        },
+        // 加载配置表列表，用于选择键对应的配置表
+        loadTableList() {
+            this.apiFetch('/api/tables')
+                .then(response => {
+                    if (!response.ok) {
+                        throw new Error('加载配置表失败');
+                    }
+                    return response.json();
+                })
+                .then(data => {
+                    this.tableList = data.tables || [];
+                    if (data.error) {
+                        console.warn('配置表加载错误:', data.error);
+                    }
+                })
+                .catch(error => {
+                    console.error('加载配置表错误:', error);
+                });
+        },
         // 添加新方法：切换JSON节点的展开/折叠状态
         toggleJsonNode(toggleIcon) {
             const row = toggleIcon.closest('.json-toggle-row');
@@ -739,6 +975,69 @@ const App = {
                     this.$message.error('复制失败，请手动复制');
                 });
         },
+        // 在新窗口打开当前消息所在会话的摘要报告
+        openReport() {
+            const session = this.currentMessage?.session;
+            if (!session) return;
+            window.open('/api/report?session=' + encodeURIComponent(session), '_blank');
+        },
+        // 打开时序图对话框，请求序号默认从当前消息开始
+        openDiagramDialog() {
+            const seq = this.currentMessage?.call === 'client' ? this.currentMessage.parsedMsg?.seq : undefined;
+            if (seq) {
+                this.diagramForm.seq = `${seq}-`;
+            }
+            this.diagramText = '';
+            this.diagramVisible = true;
+        },
+        // 时序图的查询参数
+        diagramParams() {
+            const params = new URLSearchParams();
+            params.set('session', this.currentMessage.session);
+            params.set('format', this.diagramForm.format);
+            if (this.diagramForm.seq) {
+                params.set('seq', this.diagramForm.seq);
+            }
+            if (this.diagramForm.fields) {
+                params.set('fields', this.diagramForm.fields);
+            }
+            if (this.diagramForm.excludeHidden && this.excludedCommands.length > 0) {
+                params.set('exclude', this.excludedCommands.join(','));
+            }
+            return params;
+        },
+        // 生成当前消息所在会话的时序图
+        loadDiagram() {
+            if (!this.currentMessage?.session) return;
+            this.diagramLoading = true;
+            this.apiFetch('/api/diagram?' + this.diagramParams().toString())
+                .then(response => response.text().then(text => {
+                    if (!response.ok) {
+                        throw new Error(text);
+                    }
+                    this.diagramText = text;
+                }))
+                .catch(error => {
+                    this.$message.error('生成时序图失败: ' + error.message);
+                })
+                .finally(() => {
+                    this.diagramLoading = false;
+                });
+        },
+        copyDiagram() {
+            navigator.clipboard.writeText(this.diagramText)
+                .then(() => {
+                    this.$message.success('已复制到剪贴板');
+                })
+                .catch(() => {
+                    this.$message.error('复制失败，请手动复制');
+                });
+        },
+        downloadDiagram() {
+            const params = this.diagramParams();
+            params.set('download', '1');
+            window.location.href = '/api/diagram?' + params.toString();
+        },
 
         // 格式化JSON
         formatJson(json) {
@@ -753,6 +1052,72 @@ const App = {
             const seconds = String(date.getSeconds()).padStart(2, '0');
             return `${hours}:${minutes}:${seconds}`;
         },
+        // 加载角色状态
+        loadRoleState() {
+            const params = this.roleStateSession ? `?session=${encodeURIComponent(this.roleStateSession)}` : '';
+            this.apiFetch('/api/state' + params)
+                .then(response => {
+                    if (response.status === 404) {
+                        this.roleState = null;
+                        this.roleStateError = '还没有收到角色信息，在游戏中打开角色信息后显示';
+                        return;
+                    }
+                    if (!response.ok) {
+                        throw new Error('加载角色状态失败');
+                    }
+                    return response.json().then(data => {
+                        this.roleState = data;
+                        this.roleStateError = '';
+                    });
+                })
+                .catch(error => {
+                    this.roleStateError = error.message;
+                });
+        },
+        // 加载资源账本
+        loadLedger() {
+            const params = this.ledgerSession ? `?session=${encodeURIComponent(this.ledgerSession)}` : '';
+            this.apiFetch('/api/ledger' + params)
+                .then(response => {
+                    if (!response.ok) {
+                        throw new Error('加载资源账本失败');
+                    }
+                    return response.json();
+                })
+                .then(data => {
+                    this.ledger = data;
+                })
+                .catch(error => {
+                    console.error('加载资源账本错误:', error);
+                });
+        },
+        // 以 CSV 导出资源账本，totals 为 true 时导出汇总
+        exportLedger(totals) {
+            const params = new URLSearchParams();
+            if (this.ledgerSession) {
+                params.set('session', this.ledgerSession);
+            }
+            if (totals) {
+                params.set('totals', '1');
+            }
+            window.location.href = '/api/ledger/export?' + params.toString();
+        },
+        // 账本中道具或资源的显示名称
+        ledgerKeyName(row) {
+            const name = this.ledger && this.ledger.names[row.key];
+            return name ? `${name} (${row.key})` : row.key;
+        },
+        // 变化对应的名称，道具和武将使用配置表中的名称
+        roleChangeName(change) {
+            if (!this.roleState) return change.key;
+            if (change.kind === 'item') {
+                return this.roleState.itemNames[change.key] || change.key;
+            }
+            if (change.kind === 'hero') {
+                return this.roleState.heroNames[change.key] || change.key;
+            }
+            return change.key;
+        },
         // 保存备注到本地存储
         // 修改saveNotes方法，将备注数据保存到后端
         saveNotes() {
@@ -760,25 +1125,70 @@ const App = {
             localStorage.setItem('commandNotes', JSON.stringify(this.commandNotes));
             localStorage.setItem('keyNotes', JSON.stringify(this.keyNotes));
 
-            // 发送到后端保存
-            fetch('/api/notes/save', {
+            // 发送到后端保存，带上 If-Match 防止覆盖其他页面的修改
+            const headers = {
+                'Content-Type': 'application/json'
+            };
+            if (this.notesEtag) {
+                headers['If-Match'] = this.notesEtag;
+            }
+            this.apiFetch('/api/notes/save', {
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
+                headers,
                 body: JSON.stringify({
                     commandNotes: this.commandNotes,
-                    keyNotes: this.keyNotes
+                    keyNotes: this.keyNotes,
+                    keyTables: this.keyTables
+                })
+            })
+                .then(response => {
+                    if (response.status === 412) {
+                        this.$message.warning('备注已被其他页面修改，已重新加载');
+                        this.loadNotes();
+                        return null;
+                    }
+                    if (!response.ok) {
+                        throw new Error('保存备注失败');
+                    }
+                    this.notesEtag = response.headers.get('ETag') || '';
+                    return response.json();
                 })
+                .then(data => {
+                    if (data) {
+                        console.log('备注数据保存成功');
+                    }
+                })
+                .catch(error => {
+                    console.error('保存备注错误:', error);
+                    this.$message.error('保存备注失败: ' + error.message);
+                });
+        },
+
+        // 保存单条备注，只提交修改的备注，不会覆盖其他页面的修改
+        // patch 格式: {commandNotes: {cmd: 'note'}}、{keyNotes: {cmd: {key: 'note'}}} 或 {keyTables: {cmd: {key: 'table'}}}，值为 null 时删除
+        patchNotes(patch) {
+            localStorage.setItem('commandNotes', JSON.stringify(this.commandNotes));
+            localStorage.setItem('keyNotes', JSON.stringify(this.keyNotes));
+
+            return this.apiFetch('/api/notes', {
+                method: 'PATCH',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify(patch)
             })
                 .then(response => {
                     if (!response.ok) {
                         throw new Error('保存备注失败');
                     }
+                    this.notesEtag = response.headers.get('ETag') || '';
                     return response.json();
                 })
                 .then(data => {
-                    console.log('备注数据保存成功');
+                    // 使用服务器返回的全部备注，同时更新其他页面的修改
+                    this.commandNotes = data.commandNotes || {};
+                    this.keyNotes = data.keyNotes || {};
+                    this.keyTables = data.keyTables || {};
                 })
                 .catch(error => {
                     console.error('保存备注错误:', error);
@@ -788,16 +1198,18 @@ const App = {
 
         // 修改loadNotes方法，从后端加载备注数据
         loadNotes() {
-            fetch('/api/notes/load')
+            this.apiFetch('/api/notes/load')
                 .then(response => {
                     if (!response.ok) {
                         throw new Error('加载备注失败');
                     }
+                    this.notesEtag = response.headers.get('ETag') || '';
                     return response.json();
                 })
                 .then(data => {
                     this.commandNotes = data.commandNotes || {};
                     this.keyNotes = data.keyNotes || {};
+                    this.keyTables = data.keyTables || {};
                     console.log('备注数据加载成功');
                 })
                 .catch(error => {
@@ -846,6 +1258,10 @@ const App = {
             }
 
             this.noteContent = this.keyNotes[cmd][key] || '';
+            this.noteTable = (this.keyTables[cmd] && this.keyTables[cmd][key]) || '';
+            if (this.tableList.length === 0) {
+                this.loadTableList();
+            }
             this.noteDialogVisible = true;
         },
 
@@ -854,21 +1270,24 @@ const App = {
         saveNote() {
             if (!this.currentEditingNote) return;
 
+            const note = this.noteContent.trim() ? this.noteContent : null;
+            let patch = null;
             if (this.currentEditingNote.type === 'command') {
                 const {cmd} = this.currentEditingNote;
-                if (this.noteContent.trim()) {
-                    this.commandNotes[cmd] = this.noteContent;
+                if (note) {
+                    this.commandNotes[cmd] = note;
                 } else {
                     delete this.commandNotes[cmd];
                 }
+                patch = {commandNotes: {[cmd]: note}};
             } else if (this.currentEditingNote.type === 'key') {
                 const {cmd, key} = this.currentEditingNote;
                 if (!this.keyNotes[cmd]) {
                     this.keyNotes[cmd] = {};
                 }
 
-                if (this.noteContent.trim()) {
-                    this.keyNotes[cmd][key] = this.noteContent;
+                if (note) {
+                    this.keyNotes[cmd][key] = note;
                 } else {
                     delete this.keyNotes[cmd][key];
                     // 如果没有键备注了，清理空对象
@@ -876,10 +1295,23 @@ const App = {
                         delete this.keyNotes[cmd];
                     }
                 }
+                patch = {keyNotes: {[cmd]: {[key]: note}}};
+
+                // 配置表修改后重新查找名称
+                const table = this.noteTable || null;
+                if (table !== ((this.keyTables[cmd] && this.keyTables[cmd][key]) || null)) {
+                    patch.keyTables = {[cmd]: {[key]: table}};
+                }
             }
 
-            // 保存到本地存储
-            this.saveNotes();
+            // 只提交修改的备注
+            if (patch) {
+                this.patchNotes(patch).then(() => {
+                    if (patch.keyTables && this.currentMessage) {
+                        this.loadAnnotations(this.currentMessage);
+                    }
+                });
+            }
             this.noteDialogVisible = false;
             this.$message.success('备注已保存');
 
@@ -942,7 +1374,7 @@ const App = {
         // 加载脚本列表
         loadScripts() {
             this.scriptsLoading = true;
-            fetch('/api/scripts/load')
+            this.apiFetch('/api/scripts/load')
                 .then(response => {
                     if (!response.ok) {
                         throw new Error('加载脚本失败');
@@ -1172,11 +1604,9 @@ function process(messageData) {
             // 添加日志，帮助调试
             console.log('保存脚本:', scriptToSave);
 
-            fetch('/api/scripts/save', {
+            this.apiFetch('/api/scripts/save', {
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
+                headers: this.scriptHeaders(),
                 body: JSON.stringify(scriptToSave)
             })
                 .then(response => {
@@ -1268,11 +1698,9 @@ function process(messageData) {
                 cancelButtonText: '取消',
                 type: 'warning'
             }).then(() => {
-                fetch('/api/scripts/delete', {
+                this.apiFetch('/api/scripts/delete', {
                     method: 'POST',
-                    headers: {
-                        'Content-Type': 'application/json'
-                    },
+                    headers: this.scriptHeaders(),
                     body: JSON.stringify({id: script.id})
                 })
                     .then(response => {
@@ -1304,11 +1732,9 @@ function process(messageData) {
             const scriptToSave = {...script};
             delete scriptToSave.editing;
 
-            fetch('/api/scripts/save', {
+            this.apiFetch('/api/scripts/save', {
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
+                headers: this.scriptHeaders(),
                 body: JSON.stringify(scriptToSave)
             })
                 .then(response => {
@@ -1329,6 +1755,183 @@ function process(messageData) {
                 });
         },
 
+        // 脚本请求的请求头，带上修改人
+        scriptHeaders() {
+            const headers = {
+                'Content-Type': 'application/json'
+            };
+            if (this.scriptAuthor) {
+                headers['X-XYZW-Author'] = encodeURIComponent(this.scriptAuthor);
+            }
+            return headers;
+        },
+
+        // 保存修改人到本地存储
+        saveScriptAuthor() {
+            localStorage.setItem('scriptAuthor', this.scriptAuthor.trim());
+        },
+
+        // 打开脚本修订记录
+        openRevisions(script) {
+            this.revisionsScript = script;
+            this.revisions = [];
+            this.revisionsVisible = true;
+            this.revisionsLoading = true;
+            this.apiFetch(`/api/scripts/${encodeURIComponent(script.id)}/revisions`)
+                .then(response => {
+                    if (!response.ok) {
+                        throw new Error('加载修订记录失败');
+                    }
+                    return response.json();
+                })
+                .then(data => {
+                    this.revisions = (data.revisions || []).reverse();
+                })
+                .catch(error => {
+                    console.error('加载修订记录错误:', error);
+                    this.$message.error('加载修订记录失败: ' + error.message);
+                })
+                .finally(() => {
+                    this.revisionsLoading = false;
+                });
+        },
+
+        // 修订记录操作类型的显示名称
+        revisionActionLabel(action) {
+            return {
+                create: '新建',
+                update: '修改',
+                delete: '删除',
+                restore: '恢复',
+                import: '原始版本'
+            }[action] || action;
+        },
+
+        // 恢复脚本，rev 为 0 时恢复已删除的脚本
+        restoreScript(script, rev) {
+            const tip = rev ? `确定要将脚本 "${script.name}" 恢复到版本 ${rev} 吗?` : `确定要恢复脚本 "${script.name}" 吗?`;
+            this.$confirm(tip, '提示', {
+                confirmButtonText: '确定',
+                cancelButtonText: '取消',
+                type: 'warning'
+            }).then(() => {
+                this.apiFetch(`/api/scripts/${encodeURIComponent(script.id)}/restore`, {
+                    method: 'POST',
+                    headers: this.scriptHeaders(),
+                    body: JSON.stringify({rev})
+                })
+                    .then(response => {
+                        if (!response.ok) {
+                            throw new Error('恢复脚本失败');
+                        }
+                        return response.json();
+                    })
+                    .then(data => {
+                        this.$message.success('脚本已恢复');
+                        this.revisionsVisible = false;
+                        this.deletedScripts = this.deletedScripts.filter(s => s.id !== data.id);
+                        this.loadScripts();
+                    })
+                    .catch(error => {
+                        console.error('恢复脚本错误:', error);
+                        this.$message.error('恢复脚本失败: ' + error.message);
+                    });
+            }).catch(() => {
+                // 取消恢复
+            });
+        },
+
+        // 导出备注和脚本用于共享，导出的内容作为下次导入的合并基准
+        exportBundle() {
+            window.location.href = '/api/bundle/export?base=1';
+        },
+
+        // 选择要导入的导出包文件
+        chooseBundleFile() {
+            this.$refs.bundleFile.value = '';
+            this.$refs.bundleFile.click();
+        },
+
+        // 读取导出包并预览合并结果
+        previewBundleImport(event) {
+            const file = event.target.files[0];
+            if (!file) return;
+            file.text().then(text => {
+                this.bundleImportText = text;
+                return this.importBundle('local', true);
+            });
+        },
+
+        // 导入导出包，strategy 为 remote 时冲突使用导入的版本
+        importBundle(strategy, dryRun) {
+            const params = new URLSearchParams({strategy});
+            if (dryRun) {
+                params.set('dryRun', '1');
+            }
+            return this.apiFetch('/api/bundle/import?' + params.toString(), {
+                method: 'POST',
+                headers: this.scriptHeaders(),
+                body: this.bundleImportText
+            })
+                .then(response => {
+                    if (!response.ok) {
+                        return response.text().then(text => {
+                            throw new Error(text.trim() || '导入失败');
+                        });
+                    }
+                    return response.json();
+                })
+                .then(summary => {
+                    if (dryRun) {
+                        this.bundleImportSummary = summary;
+                        this.bundleImportVisible = true;
+                        return;
+                    }
+                    this.bundleImportVisible = false;
+                    this.$message.success(`导入完成: 新增 ${summary.added}，修改 ${summary.updated}，删除 ${summary.deleted}，冲突 ${summary.conflicts.length}`);
+                    this.loadNotes();
+                    this.loadScripts();
+                })
+                .catch(error => {
+                    console.error('导入错误:', error);
+                    this.$message.error('导入失败: ' + error.message);
+                });
+        },
+
+        // 冲突条目的显示名称
+        conflictTarget(conflict) {
+            switch (conflict.kind) {
+                case 'command':
+                    return '命令备注 ' + conflict.cmd;
+                case 'key':
+                    return '键备注 ' + conflict.cmd + ' ' + conflict.key;
+                case 'table':
+                    return '配置表映射 ' + conflict.cmd + ' ' + conflict.key;
+                default:
+                    return '脚本 ' + (conflict.name || conflict.scriptId);
+            }
+        },
+
+        // 打开已删除脚本列表
+        openDeletedScripts() {
+            this.deletedScripts = [];
+            this.deletedScriptsVisible = true;
+            this.apiFetch('/api/scripts/deleted')
+                .then(response => {
+                    if (!response.ok) {
+                        throw new Error('加载已删除脚本失败');
+                    }
+                    return response.json();
+                })
+                .then(data => {
+                    this.deletedScripts = data.scripts || [];
+                })
+                .catch(error => {
+                    console.error('加载已删除脚本错误:', error);
+                    this.$message.error('加载已删除脚本失败: ' + error.message);
+                });
+        },
+
         // 格式化日期
         formatDate(dateString) {
             if (!dateString) return '';